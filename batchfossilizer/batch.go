@@ -15,44 +15,35 @@
 package batchfossilizer
 
 import (
-	"encoding/gob"
-	"os"
+	"fmt"
+	"time"
 
 	"github.com/stratumn/sdk/types"
 )
 
 type batch struct {
-	data    []types.Bytes32
-	meta    [][]byte
-	file    *os.File
-	encoder *gob.Encoder
+	id   string
+	data []types.Bytes32
+	meta [][]byte
 }
 
 func newBatch(maxLeaves int) *batch {
 	return &batch{
+		id:   fmt.Sprintf("%d", time.Now().UTC().UnixNano()),
 		data: make([]types.Bytes32, 0, maxLeaves),
 		meta: make([][]byte, 0, maxLeaves),
 	}
 }
 
-func (b *batch) append(f *fossil) {
+func (b *batch) append(f *Fossil) {
 	b.data = append(b.data, f.Data)
 	b.meta = append(b.meta, f.Meta)
 }
 
-func (b *batch) open(path string) (err error) {
-	flags := os.O_APPEND | os.O_WRONLY | os.O_EXCL | os.O_CREATE
-	if b.file, err = os.OpenFile(path, flags, FilePerm); err != nil {
-		return
+func (b *batch) fossils() []*Fossil {
+	fossils := make([]*Fossil, len(b.data))
+	for i := range b.data {
+		fossils[i] = &Fossil{Data: b.data[i], Meta: b.meta[i]}
 	}
-	b.encoder = gob.NewEncoder(b.file)
-	return
-}
-
-func (b *batch) close() (err error) {
-	if b.file != nil {
-		err = b.file.Close()
-		b.file = nil
-	}
-	return
+	return fossils
 }
@@ -18,12 +18,9 @@
 package batchfossilizer
 
 import (
+	"bytes"
 	"context"
-	"encoding/gob"
-	"fmt"
-	"io"
-	"os"
-	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -32,6 +29,7 @@ import (
 	"github.com/stratumn/sdk/cs"
 	"github.com/stratumn/sdk/cs/evidences"
 	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/types"
 
 	"github.com/stratumn/sdk/merkle"
 )
@@ -67,6 +65,10 @@ const (
 	// PendingExt is the pending hashes filename extension.
 	PendingExt = "pending"
 
+	// ResultsExt is the extension of the files containing the results of
+	// archived batches.
+	ResultsExt = "results"
+
 	// DirPerm is the directory's permissions.
 	DirPerm = 0600
 
@@ -91,18 +93,23 @@ type Config struct {
 	// Maximum number of simultaneous batches.
 	MaxSimBatches int
 
-	// Where to store pending hashes.
-	// If empty, pending hashes are not saved and will be lost if stopped
-	// abruptly.
+	// Where to store pending hashes and completed batches.
+	// If nil, a DirStorage is used if Path is set. Otherwise pending hashes
+	// are not saved and will be lost if stopped abruptly.
+	Storage Storage
+
+	// Where to store pending hashes and completed batches if Storage is
+	// nil.
 	Path string
 
-	// Whether to archive completed batches.
+	// Whether to archive completed batches. Archived batches can be
+	// queried with GetBatch and FindBatch.
 	Archive bool
 
 	// Whether to do a batch on stop.
 	StopBatch bool
 
-	// Whether to fsync after saving a hash to disk.
+	// Whether to fsync after saving a hash to disk if Storage is nil.
 	FSync bool
 }
 
@@ -145,7 +152,7 @@ type Info struct {
 type Fossilizer struct {
 	config               *Config
 	startedChan          chan chan struct{}
-	fossilChan           chan *fossil
+	fossilChan           chan *Fossil
 	resultChan           chan error
 	batchChan            chan *batch
 	stopChan             chan error
@@ -153,11 +160,15 @@ type Fossilizer struct {
 	fossilizerEventChans []chan *fossilizer.Event
 	waitGroup            sync.WaitGroup
 	transformer          Transformer
+	storage              Storage
+	dirStorage           *DirStorage // closed on stop if created by the fossilizer
 	pending              *batch
 	stopping             bool
 }
 
 // Transformer is the type of a function to transform results.
+// It may return a nil result to send no event, for instance if the events
+// are sent once the evidence is available.
 type Transformer func(evidence *cs.Evidence, data, meta []byte) (*fossilizer.Result, error)
 
 // New creates an instance of a Fossilizer.
@@ -165,7 +176,7 @@ func New(config *Config) (*Fossilizer, error) {
 	a := &Fossilizer{
 		config:      config,
 		startedChan: make(chan chan struct{}),
-		fossilChan:  make(chan *fossil),
+		fossilChan:  make(chan *Fossil),
 		resultChan:  make(chan error),
 		batchChan:   make(chan *batch, 1),
 		stopChan:    make(chan error, 1),
@@ -176,10 +187,18 @@ func New(config *Config) (*Fossilizer, error) {
 
 	a.SetTransformer(nil)
 
-	if a.config.Path != "" {
-		if err := a.ensurePath(); err != nil {
+	if config.Storage != nil {
+		a.storage = config.Storage
+	} else if config.Path != "" {
+		dirStorage, err := NewDirStorage(config.Path, config.FSync)
+		if err != nil {
 			return nil, err
 		}
+		a.storage = dirStorage
+		a.dirStorage = dirStorage
+	}
+
+	if a.storage != nil {
 		if err := a.recover(); err != nil {
 			return nil, err
 		}
@@ -206,7 +225,7 @@ func (a *Fossilizer) AddFossilizerEventChan(fossilizerEventChan chan *fossilizer
 
 // Fossilize implements github.com/stratumn/sdk/fossilizer.Adapter.Fossilize.
 func (a *Fossilizer) Fossilize(data []byte, meta []byte) error {
-	f := fossil{Meta: meta}
+	f := Fossil{Meta: meta}
 	copy(f.Data[:], data)
 	a.fossilChan <- &f
 	return <-a.resultChan
@@ -247,6 +266,90 @@ func (a *Fossilizer) Start(ctx context.Context) error {
 	}
 }
 
+// GetBatch returns the archived batch with the given Merkle root, or nil if
+// there is none.
+func (a *Fossilizer) GetBatch(root *types.Bytes32) (*Batch, error) {
+	if a.storage == nil {
+		return nil, ErrNoStorage
+	}
+	return a.storage.GetBatch(root)
+}
+
+// FindBatch returns the most recent archived batch containing the given hash,
+// or nil if there is none.
+func (a *Fossilizer) FindBatch(data *types.Bytes32) (*Batch, error) {
+	if a.storage == nil {
+		return nil, ErrNoStorage
+	}
+	return a.storage.FindBatch(data)
+}
+
+// SaveResults replaces the status and the results of an archived batch, for
+// instance once its evidences are confirmed. It does nothing if the
+// fossilizer doesn't archive batches.
+func (a *Fossilizer) SaveResults(root *types.Bytes32, status fossilizer.Status, results []*fossilizer.Result) error {
+	if a.storage == nil || !a.config.Archive {
+		return nil
+	}
+	return a.storage.SaveResults(root, status, results)
+}
+
+// FossilStatus implements
+// github.com/stratumn/sdk/fossilizer.Querier.FossilStatus.
+//
+// It looks for the data in the archived batches, so it returns nil if the
+// fossilizer has no storage or doesn't archive batches. The results are the
+// ones sent for the fossils, unless the batch was archived without them.
+func (a *Fossilizer) FossilStatus(data []byte) (*fossilizer.FossilStatus, error) {
+	if a.storage == nil || len(data) != types.Bytes32Size {
+		return nil, nil
+	}
+
+	var hash types.Bytes32
+	copy(hash[:], data)
+
+	b, err := a.storage.FindBatch(&hash)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	var results []*fossilizer.Result
+	for _, r := range batchResults(b) {
+		if bytes.Equal(r.Data, hash[:]) {
+			results = append(results, r)
+		}
+	}
+
+	return &fossilizer.FossilStatus{
+		Status:  batchStatus(b),
+		Root:    b.Root,
+		Results: results,
+	}, nil
+}
+
+// BatchStatus implements
+// github.com/stratumn/sdk/fossilizer.Querier.BatchStatus.
+//
+// It returns nil if the fossilizer has no storage or doesn't archive
+// batches.
+func (a *Fossilizer) BatchStatus(root *types.Bytes32) (*fossilizer.BatchStatus, error) {
+	if a.storage == nil {
+		return nil, nil
+	}
+
+	b, err := a.storage.GetBatch(root)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	return &fossilizer.BatchStatus{
+		Root:      b.Root,
+		Status:    batchStatus(b),
+		Timestamp: b.Timestamp,
+		Results:   batchResults(b),
+	}, nil
+}
+
 // Started return a channel that will receive once the fossilizer has started.
 func (a *Fossilizer) Started() <-chan struct{} {
 	c := make(chan struct{}, 1)
@@ -269,21 +372,11 @@ func (a *Fossilizer) SetTransformer(t Transformer) {
 	}
 }
 
-func (a *Fossilizer) fossilize(f *fossil) error {
-	if a.config.Path != "" {
-		if a.pending.file == nil {
-			if err := a.pending.open(a.pendingPath()); err != nil {
-				return err
-			}
-		}
-		if err := f.write(a.pending.encoder); err != nil {
+func (a *Fossilizer) fossilize(f *Fossil) error {
+	if a.storage != nil {
+		if err := a.storage.AddFossil(a.pending.id, f); err != nil {
 			return err
 		}
-		if a.config.FSync {
-			if err := a.pending.file.Sync(); err != nil {
-				return err
-			}
-		}
 	}
 
 	a.pending.append(f)
@@ -326,41 +419,40 @@ func (a *Fossilizer) batch(b *batch) {
 			return
 		}
 
-		root := tree.Root()
+		var (
+			root = tree.Root()
+			ts   = time.Now().UTC().Unix()
+		)
 		log.WithField("root", root).Info("Created tree with Merkle root")
 
-		a.sendEvidence(tree, b.meta)
+		results := a.sendEvidence(tree, b.meta, ts)
 		log.WithField("root", root).Info("Sent evidence for batch with Merkle root")
 
-		if b.file != nil {
-			path := b.file.Name()
-
-			if err := b.close(); err != nil {
-				log.WithField("error", err).Warn("Failed to close batch file")
-			}
-
+		if a.storage != nil {
 			if a.config.Archive {
-				archivePath := filepath.Join(a.config.Path, root.String())
-				if err := os.Rename(path, archivePath); err == nil {
-					log.WithFields(log.Fields{
-						"old": filepath.Base(path),
-						"new": filepath.Base(archivePath),
-					}).Info("Renamed batch file")
+				batch := &Batch{
+					Root:      root,
+					Timestamp: ts,
+					Fossils:   b.fossils(),
+					Status:    fossilizer.StatusSent,
+					Results:   results,
+				}
+				if err := a.storage.SaveBatch(b.id, batch); err == nil {
+					log.WithField("root", root).Info("Archived batch")
 				} else {
 					log.WithFields(log.Fields{
-						"old":   filepath.Base(path),
-						"new":   filepath.Base(archivePath),
+						"root":  root,
 						"error": err,
-					}).Warn("Failed to rename batch file")
+					}).Warn("Failed to archive batch")
 				}
 			} else {
-				if err := os.Remove(path); err == nil {
-					log.WithField("file", filepath.Base(path)).Info("Removed pending hashes file")
+				if err := a.storage.DeletePending(b.id); err == nil {
+					log.WithField("batch", b.id).Info("Removed pending hashes")
 				} else {
 					log.WithFields(log.Fields{
-						"file":  filepath.Base(path),
+						"batch": b.id,
 						"error": err,
-					}).Warn("Failed to remove batch file")
+					}).Warn("Failed to remove pending hashes")
 				}
 			}
 		}
@@ -369,11 +461,14 @@ func (a *Fossilizer) batch(b *batch) {
 	}()
 }
 
-func (a *Fossilizer) sendEvidence(tree *merkle.StaticTree, meta [][]byte) {
+// sendEvidence sends the results of the fossils of a batch and returns
+// them.
+func (a *Fossilizer) sendEvidence(tree *merkle.StaticTree, meta [][]byte, ts int64) []*fossilizer.Result {
+	var results []*fossilizer.Result
+
 	for i := 0; i < tree.LeavesLen(); i++ {
 		var (
 			err  error
-			ts   = time.Now().UTC().Unix()
 			root = tree.Root()
 			leaf = tree.Leaf(i)
 			d    = leaf[:]
@@ -393,7 +488,8 @@ func (a *Fossilizer) sendEvidence(tree *merkle.StaticTree, meta [][]byte) {
 
 		if r, err = a.transformer(&evidence, d, m); err != nil {
 			log.WithField("error", err).Error("Failed to transform evidence")
-		} else {
+		} else if r != nil {
+			results = append(results, r)
 			event := &fossilizer.Event{
 				EventType: fossilizer.DidFossilizeLink,
 				Data:      r,
@@ -403,6 +499,8 @@ func (a *Fossilizer) sendEvidence(tree *merkle.StaticTree, meta [][]byte) {
 			}
 		}
 	}
+
+	return results
 }
 
 func (a *Fossilizer) stop(err error) error {
@@ -419,12 +517,12 @@ func (a *Fossilizer) stop(err error) error {
 	a.waitGroup.Wait()
 	a.SetTransformer(nil)
 
-	if a.pending.file != nil {
-		if e := a.pending.file.Close(); e != nil {
+	if a.dirStorage != nil {
+		if e := a.dirStorage.Close(); e != nil {
 			if err == nil {
 				err = e
 			} else {
-				log.WithField("error", err).Error("Failed to close pending batch file")
+				log.WithField("error", e).Error("Failed to close pending batch files")
 			}
 		}
 	}
@@ -432,51 +530,33 @@ func (a *Fossilizer) stop(err error) error {
 	return err
 }
 
-func (a *Fossilizer) ensurePath() error {
-	if err := os.MkdirAll(a.config.Path, DirPerm); err != nil && !os.IsExist(err) {
-		return err
-	}
-	return nil
-}
-
 func (a *Fossilizer) recover() error {
-	matches, err := filepath.Glob(filepath.Join(a.config.Path, "*."+PendingExt))
+	pending, err := a.storage.Pending()
 	if err != nil {
 		return err
 	}
 
-	for _, path := range matches {
-		file, err := os.OpenFile(path, os.O_RDONLY|os.O_EXCL, FilePerm)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-
-		dec := gob.NewDecoder(file)
+	batchIDs := make([]string, 0, len(pending))
+	for batchID := range pending {
+		batchIDs = append(batchIDs, batchID)
+	}
+	sort.Strings(batchIDs)
 
-		for {
-			f, err := newFossilFromDecoder(dec)
-			if err == io.EOF {
-				break
-			}
-			if err = a.fossilize(f); err != nil {
+	for _, batchID := range batchIDs {
+		for _, f := range pending[batchID] {
+			if err := a.fossilize(f); err != nil {
 				return err
 			}
 		}
 
 		a.waitGroup.Wait()
 
-		if err := os.Remove(path); err != nil {
+		if err := a.storage.DeletePending(batchID); err != nil {
 			return err
 		}
 
-		log.WithField("file", filepath.Base(path)).Info("Recovered pending hashes file")
+		log.WithField("batch", batchID).Info("Recovered pending hashes")
 	}
 
 	return nil
 }
-
-func (a *Fossilizer) pendingPath() string {
-	filename := fmt.Sprintf("%d.%s", time.Now().UTC().UnixNano(), PendingExt)
-	return filepath.Join(a.config.Path, filename)
-}
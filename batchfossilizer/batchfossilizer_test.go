@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -28,6 +29,8 @@ import (
 	"github.com/stratumn/sdk/cs"
 	"github.com/stratumn/sdk/cs/evidences"
 	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/types"
 )
 
 func TestGetInfo(t *testing.T) {
@@ -169,6 +172,63 @@ func TestFossilize_Archive(t *testing.T) {
 	if _, err := os.Stat(archive); err != nil {
 		t.Errorf("os.Stat(): err: %s", err)
 	}
+
+	var root types.Bytes32
+	root.Unstring(filepath.Base(archive))
+	data := types.Bytes32(sha256.Sum256([]byte("c")))
+
+	batch, err := a.FindBatch(&data)
+	if err != nil {
+		t.Fatalf("a.FindBatch(): err: %s", err)
+	}
+	if batch == nil || *batch.Root != root || len(batch.Fossils) != 5 {
+		t.Fatalf("a.FindBatch() = %#v want batch with root %s", batch, root)
+	}
+	if got, want := string(batch.Fossils[2].Meta), "test c"; got != want {
+		t.Errorf("batch.Fossils[2].Meta = %q want %q", got, want)
+	}
+
+	got, err := a.GetBatch(&root)
+	if err != nil {
+		t.Fatalf("a.GetBatch(): err: %s", err)
+	}
+	if !reflect.DeepEqual(got, batch) {
+		t.Errorf("a.GetBatch() = %#v want %#v", got, batch)
+	}
+
+	if batch, err := a.FindBatch(testutil.RandomHash()); err != nil || batch != nil {
+		t.Errorf("a.FindBatch() = %#v, %v want nil, nil", batch, err)
+	}
+
+	fossil, err := a.FossilStatus(data[:])
+	if err != nil {
+		t.Fatalf("a.FossilStatus(): err: %s", err)
+	}
+	if fossil == nil || fossil.Status != fossilizer.StatusSent || *fossil.Root != root || len(fossil.Results) != 1 {
+		t.Fatalf("a.FossilStatus() = %#v want sent fossil in batch %s", fossil, root)
+	}
+	proof := fossil.Results[0].Evidence.Proof.(*evidences.BatchProof)
+	if got, want := proof.Path, pathABCDE2; !reflect.DeepEqual(got, want) {
+		t.Errorf("proof.Path = %#v want %#v", got, want)
+	}
+
+	status, err := a.BatchStatus(&root)
+	if err != nil {
+		t.Fatalf("a.BatchStatus(): err: %s", err)
+	}
+	if status == nil || status.Status != fossilizer.StatusSent || status.Timestamp != batch.Timestamp || len(status.Results) != 5 {
+		t.Errorf("a.BatchStatus() = %#v want sent batch with 5 results", status)
+	}
+}
+
+func TestFindBatch_noStorage(t *testing.T) {
+	a, err := New(&Config{Interval: interval})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+	if _, err := a.FindBatch(testutil.RandomHash()); err != ErrNoStorage {
+		t.Errorf("a.FindBatch(): err = %v want %v", err, ErrNoStorage)
+	}
 }
 
 func TestNew_recover(t *testing.T) {
@@ -295,9 +355,14 @@ func TestBatchProof(t *testing.T) {
 	t.Run("TestVerify()", func(t *testing.T) {
 		for _, r := range results {
 			e := r.Evidence.Proof.(*evidences.BatchProof)
-			if e.Verify(nil) != true {
+			var lh types.Bytes32
+			copy(lh[:], r.Data)
+			if e.Verify(&lh) != true {
 				t.Errorf("got evidence.Verify() == false")
 			}
+			if e.Verify(testutil.RandomHash()) {
+				t.Errorf("got evidence.Verify() == true for a random hash")
+			}
 		}
 	})
 }
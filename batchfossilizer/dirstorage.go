@@ -0,0 +1,313 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batchfossilizer
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/types"
+)
+
+// DirStorage implements Storage using files in a directory.
+//
+// The fossils of a pending batch are gob encoded in a file named after the
+// ID of the batch with the PendingExt extension. Once the batch is completed,
+// the file is renamed after its Merkle root and its modification time is set
+// to the time of the batch. The status and the results of the batch are saved
+// as JSON in a file named after its Merkle root with the ResultsExt
+// extension.
+//
+// The files are not indexed, so FindBatch reads the whole archive. The
+// storage is not meant to serve lookups of fossils, use a LevelDB or a
+// PostgreSQL storage instead.
+type DirStorage struct {
+	path  string
+	fsync bool
+	mutex sync.Mutex
+	files map[string]*pendingFile
+}
+
+type pendingFile struct {
+	file    *os.File
+	encoder *gob.Encoder
+}
+
+// NewDirStorage creates a storage in the given directory, creating it if
+// needed. If fsync is true, files are synced after saving each fossil.
+func NewDirStorage(path string, fsync bool) (*DirStorage, error) {
+	if err := os.MkdirAll(path, DirPerm); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	return &DirStorage{
+		path:  path,
+		fsync: fsync,
+		files: map[string]*pendingFile{},
+	}, nil
+}
+
+// AddFossil implements Storage.AddFossil.
+func (s *DirStorage) AddFossil(batchID string, f *Fossil) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pf, ok := s.files[batchID]
+	if !ok {
+		flags := os.O_APPEND | os.O_WRONLY | os.O_EXCL | os.O_CREATE
+		file, err := os.OpenFile(s.pendingPath(batchID), flags, FilePerm)
+		if err != nil {
+			return err
+		}
+		pf = &pendingFile{file: file, encoder: gob.NewEncoder(file)}
+		s.files[batchID] = pf
+	}
+
+	if err := f.write(pf.encoder); err != nil {
+		return err
+	}
+	if s.fsync {
+		return pf.file.Sync()
+	}
+	return nil
+}
+
+// Pending implements Storage.Pending.
+func (s *DirStorage) Pending() (map[string][]*Fossil, error) {
+	matches, err := filepath.Glob(filepath.Join(s.path, "*."+PendingExt))
+	if err != nil {
+		return nil, err
+	}
+
+	pending := map[string][]*Fossil{}
+	for _, path := range matches {
+		fossils, err := readFossils(path)
+		if err != nil {
+			return nil, err
+		}
+		batchID := strings.TrimSuffix(filepath.Base(path), "."+PendingExt)
+		pending[batchID] = fossils
+	}
+
+	return pending, nil
+}
+
+// DeletePending implements Storage.DeletePending.
+func (s *DirStorage) DeletePending(batchID string) error {
+	if err := s.closeFile(batchID); err != nil {
+		return err
+	}
+	if err := os.Remove(s.pendingPath(batchID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SaveBatch implements Storage.SaveBatch.
+func (s *DirStorage) SaveBatch(batchID string, b *Batch) error {
+	if err := s.closeFile(batchID); err != nil {
+		return err
+	}
+
+	archivePath := filepath.Join(s.path, b.Root.String())
+	if err := os.Rename(s.pendingPath(batchID), archivePath); err != nil {
+		return err
+	}
+
+	t := time.Unix(b.Timestamp, 0)
+	if err := os.Chtimes(archivePath, t, t); err != nil {
+		return err
+	}
+
+	if b.Status == "" && len(b.Results) == 0 {
+		return nil
+	}
+	return s.writeResults(b.Root, b.Status, b.Results)
+}
+
+// SaveResults implements Storage.SaveResults.
+func (s *DirStorage) SaveResults(root *types.Bytes32, status fossilizer.Status, results []*fossilizer.Result) error {
+	if _, err := os.Stat(filepath.Join(s.path, root.String())); os.IsNotExist(err) {
+		return ErrBatchNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.writeResults(root, status, results)
+}
+
+// GetBatch implements Storage.GetBatch.
+func (s *DirStorage) GetBatch(root *types.Bytes32) (*Batch, error) {
+	path := filepath.Join(s.path, root.String())
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fossils, err := readFossils(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.readBatch(root, info, fossils)
+}
+
+// FindBatch implements Storage.FindBatch.
+//
+// It reads the archived batches from the most recent to the oldest one, so
+// it takes a time proportional to the size of the archive.
+func (s *DirStorage) FindBatch(data *types.Bytes32) (*Batch, error) {
+	infos, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+
+	for _, info := range infos {
+		var root types.Bytes32
+		if info.IsDir() || root.Unstring(info.Name()) != nil {
+			continue
+		}
+		fossils, err := readFossils(filepath.Join(s.path, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fossils {
+			if f.Data == *data {
+				return s.readBatch(&root, info, fossils)
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// Close closes the files of the pending batches.
+func (s *DirStorage) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var err error
+	for batchID, pf := range s.files {
+		if e := pf.file.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(s.files, batchID)
+	}
+	return err
+}
+
+func (s *DirStorage) closeFile(batchID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pf, ok := s.files[batchID]
+	if !ok {
+		return nil
+	}
+	delete(s.files, batchID)
+	return pf.file.Close()
+}
+
+func (s *DirStorage) pendingPath(batchID string) string {
+	return filepath.Join(s.path, batchID+"."+PendingExt)
+}
+
+func (s *DirStorage) resultsPath(root *types.Bytes32) string {
+	return filepath.Join(s.path, root.String()+"."+ResultsExt)
+}
+
+// batchResultsFile is the content of the results file of a batch.
+type batchResultsFile struct {
+	Status  fossilizer.Status    `json:"status"`
+	Results []*fossilizer.Result `json:"results"`
+}
+
+func (s *DirStorage) writeResults(root *types.Bytes32, status fossilizer.Status, results []*fossilizer.Result) error {
+	data, err := json.Marshal(&batchResultsFile{Status: status, Results: results})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.resultsPath(root), data, FilePerm)
+}
+
+// readBatch returns an archived batch with its results, if they were saved.
+func (s *DirStorage) readBatch(root *types.Bytes32, info os.FileInfo, fossils []*Fossil) (*Batch, error) {
+	b := &Batch{
+		Root:      root,
+		Timestamp: info.ModTime().Unix(),
+		Fossils:   fossils,
+	}
+
+	data, err := ioutil.ReadFile(s.resultsPath(root))
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f batchResultsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	b.Status, b.Results = f.Status, f.Results
+
+	return b, nil
+}
+
+func readFossils(path string) ([]*Fossil, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		fossils []*Fossil
+		dec     = gob.NewDecoder(file)
+	)
+	for {
+		f, err := newFossilFromDecoder(dec)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			// The fossilizer stopped while writing the last fossil.
+			log.WithField("file", filepath.Base(path)).Warn("Ignored truncated fossil")
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		fossils = append(fossils, f)
+	}
+
+	return fossils, nil
+}
@@ -20,16 +20,18 @@ import (
 	"github.com/stratumn/sdk/types"
 )
 
-type fossil struct {
-	Data types.Bytes32
-	Meta []byte
+// Fossil is a hash and its meta data waiting to be batched or contained in a
+// batch.
+type Fossil struct {
+	Data types.Bytes32 `json:"data"`
+	Meta []byte        `json:"meta"`
 }
 
-func newFossilFromDecoder(dec *gob.Decoder) (f *fossil, err error) {
+func newFossilFromDecoder(dec *gob.Decoder) (f *Fossil, err error) {
 	err = dec.Decode(&f)
 	return
 }
 
-func (f *fossil) write(enc *gob.Encoder) error {
+func (f *Fossil) write(enc *gob.Encoder) error {
 	return enc.Encode(f)
 }
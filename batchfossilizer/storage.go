@@ -0,0 +1,130 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batchfossilizer
+
+import (
+	"errors"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/merkle"
+	"github.com/stratumn/sdk/types"
+)
+
+var (
+	// ErrNoStorage is returned when querying batches of a fossilizer
+	// without storage.
+	ErrNoStorage = errors.New("the fossilizer has no storage")
+
+	// ErrBatchNotFound is returned when saving the results of a batch
+	// that wasn't archived.
+	ErrBatchNotFound = errors.New("batch not found")
+)
+
+// Batch is a completed batch of fossils.
+type Batch struct {
+	Root      *types.Bytes32 `json:"merkleRoot"`
+	Timestamp int64          `json:"timestamp"`
+	Fossils   []*Fossil      `json:"fossils"`
+
+	// The status of the batch and the results sent for its fossils, with
+	// the evidences created by transformers. They are empty if the batch
+	// was archived without its results.
+	Status  fossilizer.Status    `json:"status,omitempty"`
+	Results []*fossilizer.Result `json:"results,omitempty"`
+}
+
+// batchResults returns the results of the fossils of an archived batch.
+//
+// If the batch was archived without its results, they are rebuilt from the
+// fossils and the evidences only contain the Merkle proofs of the batch.
+func batchResults(b *Batch) []*fossilizer.Result {
+	if len(b.Results) > 0 {
+		return b.Results
+	}
+
+	leaves := make([]types.Bytes32, len(b.Fossils))
+	for i, f := range b.Fossils {
+		leaves[i] = f.Data
+	}
+
+	tree, err := merkle.NewStaticTree(leaves)
+	if err != nil {
+		// Only happens if the batch is empty.
+		return nil
+	}
+
+	results := make([]*fossilizer.Result, len(b.Fossils))
+	for i, f := range b.Fossils {
+		data := f.Data
+		results[i] = &fossilizer.Result{
+			Evidence: cs.Evidence{
+				Backend:  Name,
+				Provider: Name,
+				Proof: &evidences.BatchProof{
+					Timestamp: b.Timestamp,
+					Root:      tree.Root(),
+					Path:      tree.Path(i),
+				},
+			},
+			Data: data[:],
+			Meta: f.Meta,
+		}
+	}
+
+	return results
+}
+
+// batchStatus returns the status of an archived batch.
+func batchStatus(b *Batch) fossilizer.Status {
+	if b.Status == "" {
+		return fossilizer.StatusSent
+	}
+	return b.Status
+}
+
+// Storage persists the pending fossils and the completed batches of a
+// fossilizer.
+//
+// Pending fossils are grouped by the ID of the batch they will be part of.
+// IDs of batches are ordered by creation time when sorted as strings.
+type Storage interface {
+	// AddFossil saves a fossil of the pending batch with the given ID.
+	AddFossil(batchID string, f *Fossil) error
+
+	// Pending returns the fossils of the pending batches, indexed by batch
+	// ID, in the order they were added.
+	Pending() (map[string][]*Fossil, error)
+
+	// DeletePending deletes the fossils of a pending batch.
+	DeletePending(batchID string) error
+
+	// SaveBatch saves a completed batch and deletes its pending fossils.
+	SaveBatch(batchID string, b *Batch) error
+
+	// SaveResults replaces the status and the results of a completed
+	// batch. It returns ErrBatchNotFound if the batch wasn't saved.
+	SaveResults(root *types.Bytes32, status fossilizer.Status, results []*fossilizer.Result) error
+
+	// GetBatch returns the completed batch with the given Merkle root, or
+	// nil if there is none.
+	GetBatch(root *types.Bytes32) (*Batch, error)
+
+	// FindBatch returns the completed batch containing the given hash, or
+	// nil if there is none. If several batches contain the hash, it
+	// returns the most recent one.
+	FindBatch(data *types.Bytes32) (*Batch, error)
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storages creates the storages of batch fossilizers by type.
+package storages
+
+import (
+	"fmt"
+
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/leveldbstore"
+	"github.com/stratumn/sdk/postgresstore"
+)
+
+// Storage types.
+const (
+	// Dir stores files in a directory.
+	Dir = "dir"
+
+	// LevelDB stores fossils in a LevelDB database.
+	LevelDB = "leveldb"
+
+	// Postgres stores fossils in a PostgreSQL database.
+	Postgres = "postgres"
+)
+
+// New creates a storage of the given type.
+//
+// The path is the directory of Dir and LevelDB storages, and the URL is the
+// one of the PostgreSQL database. Tables of a Postgres storage are created if
+// they do not exist. It returns nil for a Dir storage without a path.
+//
+// The ID identifies the fossilizer in a Postgres database shared by several
+// fossilizers, each of which must use its own ID.
+func New(storageType, path, url, id string, fsync bool) (batchfossilizer.Storage, error) {
+	switch storageType {
+	case Dir:
+		if path == "" {
+			return nil, nil
+		}
+		return batchfossilizer.NewDirStorage(path, fsync)
+	case LevelDB:
+		if path == "" {
+			return nil, fmt.Errorf("a path is required by the %s storage", LevelDB)
+		}
+		return leveldbstore.NewFossilizerStorage(&leveldbstore.Config{Path: path})
+	case Postgres:
+		s, err := postgresstore.NewFossilizerStorage(&postgresstore.Config{URL: url}, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Create(); err != nil {
+			return nil, err
+		}
+		if err := s.Prepare(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", storageType)
+	}
+}
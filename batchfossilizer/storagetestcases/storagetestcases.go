@@ -0,0 +1,235 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storagetestcases defines test cases to test batch fossilizer
+// storages.
+package storagetestcases
+
+import (
+	"testing"
+
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Factory wraps functions to allocate and free a storage,
+// and is used to run the tests on a storage.
+type Factory struct {
+	// New creates a storage.
+	New func() (batchfossilizer.Storage, error)
+
+	// Free is an optional function to free a storage.
+	Free func(s batchfossilizer.Storage)
+}
+
+// RunTests runs all the tests for the storage interface.
+func (f Factory) RunTests(t *testing.T) {
+	t.Run("AddFossil", f.TestAddFossil)
+	t.Run("DeletePending", f.TestDeletePending)
+	t.Run("SaveBatch", f.TestSaveBatch)
+	t.Run("SaveResults", f.TestSaveResults)
+	t.Run("FindBatch", f.TestFindBatch)
+}
+
+func (f Factory) initStorage(t *testing.T) batchfossilizer.Storage {
+	s, err := f.New()
+	if err != nil {
+		t.Fatalf("f.New(): err: %s", err)
+	}
+	if s == nil {
+		t.Fatal("s = nil want batchfossilizer.Storage")
+	}
+	return s
+}
+
+func (f Factory) free(s batchfossilizer.Storage) {
+	if f.Free != nil {
+		f.Free(s)
+	}
+}
+
+func randomFossils(n int) []*batchfossilizer.Fossil {
+	fossils := make([]*batchfossilizer.Fossil, n)
+	for i := range fossils {
+		fossils[i] = &batchfossilizer.Fossil{
+			Data: *testutil.RandomHash(),
+			Meta: []byte(testutil.RandomString(12)),
+		}
+	}
+	return fossils
+}
+
+func randomResults(fossils []*batchfossilizer.Fossil) []*fossilizer.Result {
+	results := make([]*fossilizer.Result, len(fossils))
+	for i, f := range fossils {
+		data := f.Data
+		results[i] = &fossilizer.Result{
+			Evidence: cs.Evidence{
+				Backend:  batchfossilizer.Name,
+				Provider: testutil.RandomString(8),
+				Proof: &evidences.BatchProof{
+					Timestamp: 1500000000,
+					Root:      testutil.RandomHash(),
+					Path:      types.Path{},
+				},
+			},
+			Data: data[:],
+			Meta: f.Meta,
+		}
+	}
+	return results
+}
+
+func (f Factory) addFossils(t *testing.T, s batchfossilizer.Storage, batchID string, fossils []*batchfossilizer.Fossil) {
+	for _, fossil := range fossils {
+		if err := s.AddFossil(batchID, fossil); err != nil {
+			t.Fatalf("s.AddFossil(): err: %s", err)
+		}
+	}
+}
+
+// TestAddFossil tests what happens when you add pending fossils.
+func (f Factory) TestAddFossil(t *testing.T) {
+	s := f.initStorage(t)
+	defer f.free(s)
+
+	pending, err := s.Pending()
+	assert.NoError(t, err, "s.Pending()")
+	assert.Empty(t, pending, "s.Pending()")
+
+	fossils1, fossils2 := randomFossils(3), randomFossils(2)
+	f.addFossils(t, s, "1", fossils1)
+	f.addFossils(t, s, "2", fossils2)
+
+	pending, err = s.Pending()
+	assert.NoError(t, err, "s.Pending()")
+	assert.Equal(t, map[string][]*batchfossilizer.Fossil{"1": fossils1, "2": fossils2}, pending, "s.Pending()")
+}
+
+// TestDeletePending tests what happens when you delete pending fossils.
+func (f Factory) TestDeletePending(t *testing.T) {
+	s := f.initStorage(t)
+	defer f.free(s)
+
+	fossils1, fossils2 := randomFossils(3), randomFossils(2)
+	f.addFossils(t, s, "1", fossils1)
+	f.addFossils(t, s, "2", fossils2)
+
+	assert.NoError(t, s.DeletePending("1"), "s.DeletePending()")
+	assert.NoError(t, s.DeletePending("3"), "s.DeletePending() of an unknown batch")
+
+	pending, err := s.Pending()
+	assert.NoError(t, err, "s.Pending()")
+	assert.Equal(t, map[string][]*batchfossilizer.Fossil{"2": fossils2}, pending, "s.Pending()")
+}
+
+// TestSaveBatch tests what happens when you save a completed batch.
+func (f Factory) TestSaveBatch(t *testing.T) {
+	s := f.initStorage(t)
+	defer f.free(s)
+
+	fossils := randomFossils(4)
+	f.addFossils(t, s, "1", fossils)
+
+	batch := &batchfossilizer.Batch{
+		Root:      testutil.RandomHash(),
+		Timestamp: 1500000000,
+		Fossils:   fossils,
+	}
+	assert.NoError(t, s.SaveBatch("1", batch), "s.SaveBatch()")
+
+	pending, err := s.Pending()
+	assert.NoError(t, err, "s.Pending()")
+	assert.Empty(t, pending, "s.Pending()")
+
+	got, err := s.GetBatch(batch.Root)
+	assert.NoError(t, err, "s.GetBatch()")
+	assert.Equal(t, batch, got, "s.GetBatch()")
+
+	got, err = s.GetBatch(testutil.RandomHash())
+	assert.NoError(t, err, "s.GetBatch() of an unknown root")
+	assert.Nil(t, got, "s.GetBatch() of an unknown root")
+}
+
+// TestSaveResults tests what happens when you save the results of a
+// completed batch.
+func (f Factory) TestSaveResults(t *testing.T) {
+	s := f.initStorage(t)
+	defer f.free(s)
+
+	fossils := randomFossils(2)
+	f.addFossils(t, s, "1", fossils)
+
+	batch := &batchfossilizer.Batch{
+		Root:      testutil.RandomHash(),
+		Timestamp: 1500000000,
+		Fossils:   fossils,
+		Status:    fossilizer.StatusSent,
+		Results:   randomResults(fossils),
+	}
+	assert.NoError(t, s.SaveBatch("1", batch), "s.SaveBatch()")
+
+	got, err := s.GetBatch(batch.Root)
+	assert.NoError(t, err, "s.GetBatch()")
+	assert.Equal(t, batch, got, "s.GetBatch()")
+
+	batch.Status, batch.Results = fossilizer.StatusAnchored, randomResults(fossils)
+	assert.NoError(t, s.SaveResults(batch.Root, batch.Status, batch.Results), "s.SaveResults()")
+
+	got, err = s.FindBatch(&fossils[0].Data)
+	assert.NoError(t, err, "s.FindBatch()")
+	assert.Equal(t, batch, got, "s.FindBatch()")
+
+	err = s.SaveResults(testutil.RandomHash(), fossilizer.StatusAnchored, batch.Results)
+	assert.Equal(t, batchfossilizer.ErrBatchNotFound, err, "s.SaveResults() of an unknown root")
+}
+
+// TestFindBatch tests what happens when you find the batch containing a
+// hash.
+func (f Factory) TestFindBatch(t *testing.T) {
+	s := f.initStorage(t)
+	defer f.free(s)
+
+	fossils1, fossils2 := randomFossils(3), randomFossils(2)
+	// The first fossil is in both batches.
+	fossils2 = append(fossils2, fossils1[0])
+
+	batch1 := &batchfossilizer.Batch{Root: testutil.RandomHash(), Timestamp: 1500000000, Fossils: fossils1}
+	batch2 := &batchfossilizer.Batch{Root: testutil.RandomHash(), Timestamp: 1500000100, Fossils: fossils2}
+	f.addFossils(t, s, "1", fossils1)
+	assert.NoError(t, s.SaveBatch("1", batch1), "s.SaveBatch()")
+	f.addFossils(t, s, "2", fossils2)
+	assert.NoError(t, s.SaveBatch("2", batch2), "s.SaveBatch()")
+
+	got, err := s.FindBatch(&fossils1[1].Data)
+	assert.NoError(t, err, "s.FindBatch()")
+	assert.Equal(t, batch1, got, "s.FindBatch()")
+
+	got, err = s.FindBatch(&fossils2[1].Data)
+	assert.NoError(t, err, "s.FindBatch()")
+	assert.Equal(t, batch2, got, "s.FindBatch()")
+
+	got, err = s.FindBatch(&fossils1[0].Data)
+	assert.NoError(t, err, "s.FindBatch() of a hash in several batches")
+	assert.Equal(t, batch2, got, "s.FindBatch() of a hash in several batches")
+
+	got, err = s.FindBatch(testutil.RandomHash())
+	assert.NoError(t, err, "s.FindBatch() of an unknown hash")
+	assert.Nil(t, got, "s.FindBatch() of an unknown hash")
+}
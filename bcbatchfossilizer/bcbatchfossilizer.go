@@ -17,7 +17,10 @@
 package bcbatchfossilizer
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -36,11 +39,88 @@ const (
 
 	// Description is the description set in the fossilizer's information.
 	Description = "Indigo's Blockchain Batch Fossilizer"
+
+	// DefaultConfirmations is the default number of confirmations after
+	// which a fossil is confirmed.
+	DefaultConfirmations = 6
+
+	// DefaultPollInterval is the default interval between queries of the
+	// status of transactions.
+	DefaultPollInterval = time.Minute
+
+	// DefaultMaxMissingPolls is the default number of consecutive polls
+	// after which a missing transaction is considered dropped.
+	DefaultMaxMissingPolls = 10
+
+	// DefaultMaxPendingPolls is the default number of consecutive polls
+	// after which the fee of a transaction waiting to be mined is bumped.
+	DefaultMaxPendingPolls = 30
 )
 
 // Config contains configuration options for the fossilizer.
 type Config struct {
 	HashTimestamper blockchain.HashTimestamper
+
+	// An optional chain querier. If set, the fossilizer watches the
+	// transactions it sends and emits a DidConfirmLink event once they
+	// have enough confirmations.
+	//
+	// The transactions being watched are only kept in memory: after a
+	// restart, the transactions sent before are no longer watched, so
+	// their fees are not bumped and no DidConfirmLink event is emitted
+	// for them.
+	ChainQuerier blockchain.ChainQuerier
+
+	// Number of confirmations after which a fossil is confirmed.
+	Confirmations uint64
+
+	// Interval between queries of the status of transactions.
+	PollInterval time.Duration
+
+	// Number of consecutive polls after which a missing transaction is
+	// considered dropped and its root anchored again.
+	MaxMissingPolls int
+
+	// Number of consecutive polls after which the fee of a transaction
+	// waiting to be mined is bumped, if the timestamper implements
+	// github.com/stratumn/sdk/blockchain.FeeBumper.
+	MaxPendingPolls int
+}
+
+// GetConfirmations returns the configuration's number of confirmations or the
+// default value.
+func (c *Config) GetConfirmations() uint64 {
+	if c.Confirmations > 0 {
+		return c.Confirmations
+	}
+	return DefaultConfirmations
+}
+
+// GetPollInterval returns the configuration's poll interval or the default
+// value.
+func (c *Config) GetPollInterval() time.Duration {
+	if c.PollInterval > 0 {
+		return c.PollInterval
+	}
+	return DefaultPollInterval
+}
+
+// GetMaxMissingPolls returns the configuration's maximum number of missing
+// polls or the default value.
+func (c *Config) GetMaxMissingPolls() int {
+	if c.MaxMissingPolls > 0 {
+		return c.MaxMissingPolls
+	}
+	return DefaultMaxMissingPolls
+}
+
+// GetMaxPendingPolls returns the configuration's maximum number of pending
+// polls or the default value.
+func (c *Config) GetMaxPendingPolls() int {
+	if c.MaxPendingPolls > 0 {
+		return c.MaxPendingPolls
+	}
+	return DefaultMaxPendingPolls
 }
 
 // Info is the info returned by GetInfo.
@@ -50,6 +130,10 @@ type Info struct {
 	Version     string `json:"version"`
 	Commit      string `json:"commit"`
 	Blockchain  string `json:"blockchain"`
+
+	// The balance of the account of the timestamper, if it can report
+	// it.
+	Balance *blockchain.Balance `json:"balance,omitempty"`
 }
 
 // Fossilizer is the type that
@@ -59,6 +143,9 @@ type Fossilizer struct {
 	config            *Config
 	lastRoot          *types.Bytes32
 	lastTransactionID types.TransactionID
+	eventChans        []chan *fossilizer.Event
+	anchorsMutex      sync.Mutex
+	anchors           []*anchor
 }
 
 // New creates an instance of a Fossilizer.
@@ -82,6 +169,22 @@ func New(config *Config, batchConfig *batchfossilizer.Config) (*Fossilizer, erro
 	return &f, err
 }
 
+// AddFossilizerEventChan implements
+// github.com/stratumn/sdk/fossilizer.Adapter.AddFossilizerEventChan.
+func (a *Fossilizer) AddFossilizerEventChan(fossilizerEventChan chan *fossilizer.Event) {
+	a.eventChans = append(a.eventChans, fossilizerEventChan)
+	a.Fossilizer.AddFossilizerEventChan(fossilizerEventChan)
+}
+
+// Start starts the fossilizer and, if a chain querier was given, the
+// confirmation watcher.
+func (a *Fossilizer) Start(ctx context.Context) error {
+	if a.config.ChainQuerier != nil {
+		go a.watch(ctx)
+	}
+	return a.Fossilizer.Start(ctx)
+}
+
 // GetInfo implements github.com/stratumn/sdk/fossilizer.Adapter.GetInfo.
 func (a *Fossilizer) GetInfo() (interface{}, error) {
 	batchInfo, err := a.Fossilizer.GetInfo()
@@ -96,13 +199,24 @@ func (a *Fossilizer) GetInfo() (interface{}, error) {
 
 	timestamperInfo := a.config.HashTimestamper.GetInfo()
 
-	return &Info{
+	bcInfo := &Info{
 		Name:        Name,
 		Description: fmt.Sprintf("%s with %s", Description, timestamperInfo.Description),
 		Version:     info.Version,
 		Commit:      info.Commit,
 		Blockchain:  timestamperInfo.Network.String(),
-	}, nil
+	}
+
+	if reporter, ok := a.config.HashTimestamper.(blockchain.BalanceReporter); ok {
+		balance, err := reporter.Balance()
+		if err != nil {
+			log.WithField("error", err).Warn("Failed to get balance")
+		} else {
+			bcInfo.Balance = balance
+		}
+	}
+
+	return bcInfo, nil
 }
 
 func (a *Fossilizer) transform(evidence *cs.Evidence, data, meta []byte) (*fossilizer.Result, error) {
@@ -139,5 +253,9 @@ func (a *Fossilizer) transform(evidence *cs.Evidence, data, meta []byte) (*fossi
 		Meta:     meta,
 	}
 
+	if a.config.ChainQuerier != nil {
+		a.addToAnchor(root, a.lastTransactionID, &r)
+	}
+
 	return &r, nil
 }
@@ -15,14 +15,27 @@
 package bcbatchfossilizer
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
 	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/btctesting"
+	"github.com/stratumn/sdk/blockchain/btc/btctimestamper"
 	"github.com/stratumn/sdk/blockchain/dummytimestamper"
 	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/dummystore"
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/types"
 )
 
 func TestGetInfo(t *testing.T) {
@@ -45,6 +58,41 @@ func TestGetInfo(t *testing.T) {
 	}
 }
 
+func TestGetInfo_balance(t *testing.T) {
+	privKey, _ := btcec.NewPrivateKey(btcec.S256())
+	wif, _ := btcutil.NewWIF(privKey, btc.NetworkRegtest.Params(), true)
+	harness := btctesting.NewHarness(btc.NetworkRegtest)
+	ts, err := btctimestamper.New(&btctimestamper.Config{
+		UnspentFinder: harness,
+		Broadcaster:   harness,
+		WIF:           wif.String(),
+		Network:       btc.NetworkRegtest,
+		Fee:           1000,
+		UTXOStore:     dummystore.New(&dummystore.Config{}),
+		ChainQuerier:  harness,
+	})
+	if err != nil {
+		t.Fatalf("btctimestamper.New(): err: %s", err)
+	}
+	harness.Fund(ts.Address(), 100000)
+	if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	a, err := New(&Config{HashTimestamper: ts}, &batchfossilizer.Config{})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+	got, err := a.GetInfo()
+	if err != nil {
+		t.Fatalf("a.GetInfo(): err: %s", err)
+	}
+	want := &blockchain.Balance{Unconfirmed: 99000, Runway: 99}
+	if got := got.(*Info).Balance; !reflect.DeepEqual(got, want) {
+		t.Errorf("a.GetInfo(): Balance = %#v want %#v", got, want)
+	}
+}
+
 func TestFossilize(t *testing.T) {
 	a, err := New(&Config{
 		HashTimestamper: dummytimestamper.Timestamper{},
@@ -106,9 +154,83 @@ func TestBcBatchProof(t *testing.T) {
 	t.Run("TestVerify()", func(t *testing.T) {
 		for _, r := range results {
 			e := r.Evidence.Proof.(*evidences.BcBatchProof)
-			if e.Verify(nil) != true {
+			var lh types.Bytes32
+			copy(lh[:], r.Data)
+			if e.Verify(&lh) != true {
 				t.Errorf("got evidence.Verify() == false")
 			}
+			if e.Verify(testutil.RandomHash()) {
+				t.Errorf("got evidence.Verify() == true for a random hash")
+			}
 		}
 	})
 }
+
+func TestFossilize_bitcoinHarness(t *testing.T) {
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("btcec.NewPrivateKey(): err: %s", err)
+	}
+	wif, err := btcutil.NewWIF(privKey, btc.NetworkRegtest.Params(), false)
+	if err != nil {
+		t.Fatalf("btcutil.NewWIF(): err: %s", err)
+	}
+	harness := btctesting.NewHarness(btc.NetworkRegtest)
+	ts, err := btctimestamper.New(&btctimestamper.Config{
+		UnspentFinder: harness,
+		Broadcaster:   harness,
+		WIF:           wif.String(),
+		Network:       btc.NetworkRegtest,
+		AddressType:   btctimestamper.AddressP2WPKH,
+		Fee:           10000,
+	})
+	if err != nil {
+		t.Fatalf("btctimestamper.New(): err: %s", err)
+	}
+	if err := harness.Fund(ts.Address(), 100000); err != nil {
+		t.Fatalf("harness.Fund(): err: %s", err)
+	}
+
+	a, err := New(&Config{
+		HashTimestamper: ts,
+		ChainQuerier:    harness,
+		Confirmations:   2,
+		PollInterval:    testPollInterval,
+	}, &batchfossilizer.Config{
+		Interval: testInterval,
+	})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	ec := make(chan *fossilizer.Event, 10)
+	a.AddFossilizerEventChan(ec)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Start(ctx)
+	<-a.Started()
+
+	hash := sha256.Sum256([]byte("a"))
+	if err := a.Fossilize(hash[:], []byte("test a")); err != nil {
+		t.Fatalf("a.Fossilize(): err: %s", err)
+	}
+	r := waitEvent(t, ec, fossilizer.DidFossilizeLink)
+	proof := r.Evidence.Proof.(*evidences.BcBatchProof)
+	if got, want := r.Evidence.Provider, btc.NetworkRegtest.String(); got != want {
+		t.Errorf("r.Evidence.Provider = %s want %s", got, want)
+	}
+
+	tx, ok := harness.Transaction(proof.TransactionID)
+	if !ok {
+		t.Fatalf("transaction %s was not broadcast", proof.TransactionID)
+	}
+	if !bytes.Contains(tx.TxOut[1].PkScript, proof.Batch.Root[:]) {
+		t.Errorf("tx.TxOut[1].PkScript = %x want it to contain %s", tx.TxOut[1].PkScript, proof.Batch.Root)
+	}
+
+	harness.Mine(2)
+	r = waitEvent(t, ec, fossilizer.DidConfirmLink)
+	if got, want := r.Evidence.Proof.(*evidences.BcBatchProof).Confirmations, uint64(2); got != want {
+		t.Errorf("proof.Confirmations = %d want %d", got, want)
+	}
+}
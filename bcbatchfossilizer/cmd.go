@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/batchfossilizer/storages"
 	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/postgresstore"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -18,11 +20,17 @@ var (
 	archive         bool
 	exitBatch       bool
 	fsync           bool
+	storageType     string
+	storageURL      string
+	storageID       string
 	key             string
 	fee             int64
 	bcyAPIKey       string
 	limiterInterval time.Duration
 	limiterSize     int
+	confirmations   uint64
+	pollInterval    time.Duration
+	maxPendingPolls int
 )
 
 // RegisterFlags registers the flags used by RunWithFlags.
@@ -33,20 +41,37 @@ func RegisterFlags() {
 	flag.BoolVar(&archive, "archive", batchfossilizer.DefaultArchive, "whether to archive completed batches (requires path)")
 	flag.BoolVar(&exitBatch, "exitbatch", batchfossilizer.DefaultStopBatch, "whether to do a batch on exit")
 	flag.BoolVar(&fsync, "fsync", batchfossilizer.DefaultFSync, "whether to fsync after saving a pending hash (requires path)")
+	flag.StringVar(&storageType, "storage", storages.Dir, "where to store pending hashes and archived batches (dir, leveldb or postgres), dir and leveldb require path")
+	flag.StringVar(&storageURL, "storageurl", postgresstore.DefaultURL, "URL of the PostgreSQL database of the postgres storage")
+	flag.StringVar(&storageID, "storageid", "", "ID of the fossilizer in a postgres storage shared by several fossilizers")
+	flag.Uint64Var(&confirmations, "confirmations", DefaultConfirmations, "number of confirmations after which a fossil is confirmed")
+	flag.DurationVar(&pollInterval, "pollinterval", DefaultPollInterval, "interval between queries of the status of transactions")
+	flag.IntVar(&maxPendingPolls, "maxpendingpolls", DefaultMaxPendingPolls, "number of polls after which the fee of a transaction waiting to be mined is bumped (requires replace-by-fee)")
 }
 
 // RunWithFlags should be called after RegisterFlags and flag.Parse to initialize
 // a bcbatchfossilizer using flag values.
-func RunWithFlags(ctx context.Context, version, commit string, hashTS blockchain.HashTimestamper) *Fossilizer {
+// The chain querier is optional, confirmations are not tracked if it is nil.
+func RunWithFlags(ctx context.Context, version, commit string, hashTS blockchain.HashTimestamper, querier blockchain.ChainQuerier) *Fossilizer {
 	log.Infof("%s v%s@%s", Description, version, commit[:7])
 
+	storage, err := storages.New(storageType, path, storageURL, storageID, fsync)
+	if err != nil {
+		log.WithField("error", err).Fatal("Failed to create batch fossilizer storage")
+	}
+
 	a, err := New(&Config{
 		HashTimestamper: hashTS,
+		ChainQuerier:    querier,
+		Confirmations:   confirmations,
+		PollInterval:    pollInterval,
+		MaxPendingPolls: maxPendingPolls,
 	}, &batchfossilizer.Config{
 		Version:   version,
 		Commit:    commit,
 		Interval:  interval,
 		MaxLeaves: maxLeaves,
+		Storage:   storage,
 		Path:      path,
 		Archive:   archive,
 		StopBatch: exitBatch,
@@ -0,0 +1,260 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bcbatchfossilizer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/types"
+)
+
+// anchor is a Merkle root timestamped in a transaction that is waiting for
+// confirmations.
+//
+// The fields below mu are shared by the watcher and by the goroutine adding
+// results, so they must only be accessed while holding mu.
+type anchor struct {
+	root *types.Bytes32
+
+	mu      sync.Mutex
+	txid    types.TransactionID
+	results []*fossilizer.Result
+	missing int
+	pending int
+}
+
+// addToAnchor adds a copy of a result to the anchor of a root.
+func (a *Fossilizer) addToAnchor(root *types.Bytes32, txid types.TransactionID, r *fossilizer.Result) {
+	proof := *r.Evidence.Proof.(*evidences.BcBatchProof)
+	result := *r
+	result.Evidence.Proof = &proof
+
+	a.anchorsMutex.Lock()
+	defer a.anchorsMutex.Unlock()
+
+	for _, anc := range a.anchors {
+		if *anc.root == *root {
+			anc.mu.Lock()
+			// The root may have been anchored again in another
+			// transaction.
+			proof.TransactionID = anc.txid
+			anc.results = append(anc.results, &result)
+			anc.mu.Unlock()
+			return
+		}
+	}
+
+	a.anchors = append(a.anchors, &anchor{
+		root:    root,
+		txid:    txid,
+		results: []*fossilizer.Result{&result},
+	})
+}
+
+func (a *Fossilizer) watch(ctx context.Context) {
+	ticker := time.NewTicker(a.config.GetPollInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.pollAnchors()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *Fossilizer) pollAnchors() {
+	a.anchorsMutex.Lock()
+	anchors := append([]*anchor(nil), a.anchors...)
+	a.anchorsMutex.Unlock()
+
+	for _, anc := range anchors {
+		a.pollAnchor(anc)
+	}
+}
+
+// pollAnchor queries the status of the transaction of an anchor. Queries
+// and transactions are sent without holding the lock of the anchor.
+func (a *Fossilizer) pollAnchor(anc *anchor) {
+	anc.mu.Lock()
+	txid := anc.txid
+	anc.mu.Unlock()
+
+	status, err := a.config.ChainQuerier.TransactionStatus(txid)
+	switch {
+	case errors.Cause(err) == blockchain.ErrTransactionNotFound:
+		anc.mu.Lock()
+		anc.missing++
+		missing := anc.missing
+		anc.mu.Unlock()
+
+		log.WithFields(log.Fields{
+			"txid":    txid,
+			"root":    anc.root,
+			"missing": missing,
+		}).Warn("Transaction not found")
+		if missing >= a.config.GetMaxMissingPolls() {
+			a.reanchor(anc, txid)
+		}
+	case err != nil:
+		log.WithFields(log.Fields{
+			"txid":  txid,
+			"error": err,
+		}).Error("Failed to query transaction status")
+	case !status.Mined:
+		// The transaction is waiting to be mined, or was in a block
+		// that got orphaned and is back in the mempool.
+		anc.mu.Lock()
+		anc.missing = 0
+		anc.pending++
+		pending := anc.pending
+		anc.mu.Unlock()
+
+		if pending >= a.config.GetMaxPendingPolls() {
+			a.bump(anc, txid)
+		}
+	default:
+		anc.mu.Lock()
+		anc.missing = 0
+		anc.pending = 0
+		anc.mu.Unlock()
+
+		if status.Confirmations >= a.config.GetConfirmations() {
+			a.confirm(anc, txid, status)
+		}
+	}
+}
+
+// reanchor timestamps the root of an anchor whose transaction was dropped
+// in a new transaction.
+func (a *Fossilizer) reanchor(anc *anchor, oldTxid types.TransactionID) {
+	txid, err := a.config.HashTimestamper.TimestampHash(anc.root)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"root":  anc.root,
+			"error": err,
+		}).Error("Failed to anchor root again")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"txid":    txid,
+		"oldTxid": oldTxid,
+		"root":    anc.root,
+	}).Info("Anchored root again")
+
+	a.setTransactionID(anc, txid)
+}
+
+// bump replaces the transaction of an anchor waiting to be mined with one
+// paying a higher fee, if the timestamper supports it.
+func (a *Fossilizer) bump(anc *anchor, oldTxid types.TransactionID) {
+	bumper, ok := a.config.HashTimestamper.(blockchain.FeeBumper)
+	if !ok {
+		return
+	}
+
+	txid, err := bumper.BumpFee(oldTxid)
+	if err != nil {
+		// Try again after another period.
+		anc.mu.Lock()
+		anc.pending = 0
+		anc.mu.Unlock()
+
+		log.WithFields(log.Fields{
+			"txid":  oldTxid,
+			"root":  anc.root,
+			"error": err,
+		}).Error("Failed to bump transaction fee")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"txid":    txid,
+		"oldTxid": oldTxid,
+		"root":    anc.root,
+	}).Info("Bumped transaction fee")
+
+	a.setTransactionID(anc, txid)
+}
+
+// setTransactionID sets the transaction of an anchor and of its evidences.
+func (a *Fossilizer) setTransactionID(anc *anchor, txid types.TransactionID) {
+	anc.mu.Lock()
+	defer anc.mu.Unlock()
+
+	anc.txid = txid
+	anc.missing = 0
+	anc.pending = 0
+	for _, r := range anc.results {
+		r.Evidence.Proof.(*evidences.BcBatchProof).TransactionID = txid
+	}
+}
+
+// confirm upgrades the evidences of an anchor and sends them to the event
+// channels.
+func (a *Fossilizer) confirm(anc *anchor, txid types.TransactionID, status *blockchain.TransactionStatus) {
+	// Removing the anchor while holding both locks guarantees that no
+	// result is added after the results are copied.
+	a.anchorsMutex.Lock()
+	for i, other := range a.anchors {
+		if other == anc {
+			a.anchors = append(a.anchors[:i], a.anchors[i+1:]...)
+			break
+		}
+	}
+	anc.mu.Lock()
+	results := append([]*fossilizer.Result(nil), anc.results...)
+	anc.mu.Unlock()
+	a.anchorsMutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"txid":          txid,
+		"root":          anc.root,
+		"confirmations": status.Confirmations,
+	}).Info("Confirmed transaction")
+
+	for _, r := range results {
+		proof := r.Evidence.Proof.(*evidences.BcBatchProof)
+		proof.BlockHash = status.BlockHash
+		proof.BlockHeight = status.BlockHeight
+		proof.Confirmations = status.Confirmations
+
+		event := &fossilizer.Event{
+			EventType: fossilizer.DidConfirmLink,
+			Data:      r,
+		}
+		for _, c := range a.eventChans {
+			c <- event
+		}
+	}
+
+	if err := a.SaveResults(anc.root, fossilizer.StatusAnchored, results); err != nil {
+		log.WithFields(log.Fields{
+			"root":  anc.root,
+			"error": err,
+		}).Warn("Failed to archive confirmed evidences")
+	}
+}
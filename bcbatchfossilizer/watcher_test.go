@@ -0,0 +1,295 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bcbatchfossilizer
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
+	"github.com/pkg/errors"
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/btctesting"
+	"github.com/stratumn/sdk/blockchain/btc/btctimestamper"
+	"github.com/stratumn/sdk/blockchain/eth"
+	"github.com/stratumn/sdk/blockchain/eth/ethtesting"
+	"github.com/stratumn/sdk/blockchain/eth/ethtimestamper"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/types"
+)
+
+const (
+	testKey          = "4646464646464646464646464646464646464646464646464646464646464646"
+	testPollInterval = 10 * time.Millisecond
+)
+
+func newWatchedFossilizer(t *testing.T, path string) (*Fossilizer, *ethtesting.SimulatedBackend, chan *fossilizer.Event, func()) {
+	privKey, _ := eth.ParsePrivateKey(testKey)
+	backend := ethtesting.NewSimulatedBackend(big.NewInt(1337), map[types.Bytes20]*big.Int{
+		*eth.PubKeyToAddress(privKey.PubKey().ToECDSA()): big.NewInt(1e18),
+	})
+	ts, err := ethtimestamper.New(&ethtimestamper.Config{
+		Client:     backend,
+		PrivateKey: testKey,
+	})
+	if err != nil {
+		t.Fatalf("ethtimestamper.New(): err: %s", err)
+	}
+
+	a, err := New(&Config{
+		HashTimestamper: ts,
+		ChainQuerier:    backend,
+		Confirmations:   3,
+		PollInterval:    testPollInterval,
+		MaxMissingPolls: 2,
+	}, &batchfossilizer.Config{
+		Interval: testInterval,
+		Path:     path,
+		Archive:  path != "",
+	})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	ec := make(chan *fossilizer.Event, 10)
+	a.AddFossilizerEventChan(ec)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		if err := a.Start(ctx); err != nil && errors.Cause(err) != context.Canceled {
+			t.Errorf("a.Start(): err: %s", err)
+		}
+	}()
+	<-a.Started()
+
+	return a, backend, ec, cancel
+}
+
+func waitEvent(t *testing.T, ec chan *fossilizer.Event, eventType fossilizer.EventType) *fossilizer.Result {
+	select {
+	case e := <-ec:
+		if e.EventType != eventType {
+			t.Fatalf("e.EventType = %s want %s", e.EventType, eventType)
+		}
+		return e.Data.(*fossilizer.Result)
+	case <-time.After(time.Second):
+		t.Fatalf("did not receive %s event", eventType)
+	}
+	return nil
+}
+
+func TestWatcher_confirm(t *testing.T) {
+	a, backend, ec, cancel := newWatchedFossilizer(t, "")
+	defer cancel()
+
+	if err := a.Fossilize(testutil.RandomHash()[:], []byte("test")); err != nil {
+		t.Fatalf("a.Fossilize(): err: %s", err)
+	}
+	r := waitEvent(t, ec, fossilizer.DidFossilizeLink)
+	txid := r.Evidence.Proof.(*evidences.BcBatchProof).TransactionID
+
+	// One confirmation is not enough.
+	time.Sleep(5 * testPollInterval)
+	select {
+	case e := <-ec:
+		t.Fatalf("unexpected event %s", e.EventType)
+	default:
+	}
+
+	backend.Mine(2)
+	r = waitEvent(t, ec, fossilizer.DidConfirmLink)
+	proof := r.Evidence.Proof.(*evidences.BcBatchProof)
+	if got, want := proof.TransactionID.String(), txid.String(); got != want {
+		t.Errorf("proof.TransactionID = %s want %s", got, want)
+	}
+	status, _ := backend.TransactionStatus(txid)
+	if got, want := proof.BlockHeight, status.BlockHeight; got != want {
+		t.Errorf("proof.BlockHeight = %d want %d", got, want)
+	}
+	if proof.BlockHash == nil || *proof.BlockHash != *status.BlockHash {
+		t.Errorf("proof.BlockHash = %v want %s", proof.BlockHash, status.BlockHash)
+	}
+	if got, want := proof.Confirmations, uint64(3); got != want {
+		t.Errorf("proof.Confirmations = %d want %d", got, want)
+	}
+	if string(r.Meta) != "test" {
+		t.Errorf("r.Meta = %q want %q", r.Meta, "test")
+	}
+}
+
+func TestWatcher_reanchor(t *testing.T) {
+	a, backend, ec, cancel := newWatchedFossilizer(t, "")
+	defer cancel()
+
+	if err := a.Fossilize(testutil.RandomHash()[:], []byte("test")); err != nil {
+		t.Fatalf("a.Fossilize(): err: %s", err)
+	}
+	r := waitEvent(t, ec, fossilizer.DidFossilizeLink)
+	txid := r.Evidence.Proof.(*evidences.BcBatchProof).TransactionID
+	backend.Drop(types.NewBytes32FromBytes(txid))
+
+	// Wait for the root to be anchored again.
+	deadline := time.Now().Add(time.Second)
+	for len(backend.Transactions()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("root was not anchored again")
+		}
+		time.Sleep(testPollInterval)
+	}
+
+	backend.Mine(2)
+	r = waitEvent(t, ec, fossilizer.DidConfirmLink)
+	proof := r.Evidence.Proof.(*evidences.BcBatchProof)
+	tx, ok := backend.TransactionByHash(types.NewBytes32FromBytes(proof.TransactionID))
+	if !ok {
+		t.Fatal("new transaction was not mined")
+	}
+	if !proof.Batch.Root.EqualsBytes(tx.Data) {
+		t.Errorf("tx.Data = %x want %s", tx.Data, proof.Batch.Root)
+	}
+}
+
+// waitFossilStatus waits for an archived fossil to have the given status.
+func waitFossilStatus(t *testing.T, a *Fossilizer, data []byte, status fossilizer.Status) *fossilizer.FossilStatus {
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, err := a.FossilStatus(data)
+		if err != nil {
+			t.Fatalf("a.FossilStatus(): err: %s", err)
+		}
+		if got != nil && got.Status == status {
+			return got
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("a.FossilStatus() = %#v want status %s", got, status)
+		}
+		time.Sleep(testPollInterval)
+	}
+}
+
+func TestWatcher_archive(t *testing.T) {
+	path, err := ioutil.TempDir("", "bcbatchfossilizer")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): err: %s", err)
+	}
+	defer os.RemoveAll(path)
+
+	a, backend, ec, cancel := newWatchedFossilizer(t, path)
+	defer cancel()
+
+	data := testutil.RandomHash()[:]
+	if err := a.Fossilize(data, []byte("test")); err != nil {
+		t.Fatalf("a.Fossilize(): err: %s", err)
+	}
+	r := waitEvent(t, ec, fossilizer.DidFossilizeLink)
+	txid := r.Evidence.Proof.(*evidences.BcBatchProof).TransactionID
+
+	// The archive keeps the evidences of the events.
+	status := waitFossilStatus(t, a, data, fossilizer.StatusSent)
+	if len(status.Results) != 1 {
+		t.Fatalf("len(status.Results) = %d want 1", len(status.Results))
+	}
+	proof, ok := status.Results[0].Evidence.Proof.(*evidences.BcBatchProof)
+	if !ok || proof.TransactionID.String() != txid.String() {
+		t.Fatalf("status.Results[0].Evidence.Proof = %#v want transaction %s", status.Results[0].Evidence.Proof, txid)
+	}
+
+	backend.Mine(3)
+	waitEvent(t, ec, fossilizer.DidConfirmLink)
+
+	status = waitFossilStatus(t, a, data, fossilizer.StatusAnchored)
+	proof = status.Results[0].Evidence.Proof.(*evidences.BcBatchProof)
+	if got, want := proof.Confirmations, uint64(3); got < want {
+		t.Errorf("proof.Confirmations = %d want at least %d", got, want)
+	}
+}
+
+func TestWatcher_bumpFee(t *testing.T) {
+	privKey, _ := btcec.NewPrivateKey(btcec.S256())
+	wif, _ := btcutil.NewWIF(privKey, btc.NetworkRegtest.Params(), false)
+	harness := btctesting.NewHarness(btc.NetworkRegtest)
+	harness.SetFeeRate(10)
+
+	ts, err := btctimestamper.New(&btctimestamper.Config{
+		UnspentFinder: harness,
+		Broadcaster:   harness,
+		WIF:           wif.String(),
+		Network:       btc.NetworkRegtest,
+		FeeEstimator:  harness,
+		RBF:           true,
+	})
+	if err != nil {
+		t.Fatalf("btctimestamper.New(): err: %s", err)
+	}
+	harness.Fund(ts.Address(), 1000000)
+
+	a, err := New(&Config{
+		HashTimestamper: ts,
+		ChainQuerier:    harness,
+		Confirmations:   1,
+		PollInterval:    testPollInterval,
+		MaxPendingPolls: 2,
+	}, &batchfossilizer.Config{
+		Interval: testInterval,
+	})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	ec := make(chan *fossilizer.Event, 10)
+	a.AddFossilizerEventChan(ec)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Start(ctx)
+	<-a.Started()
+
+	if err := a.Fossilize(testutil.RandomHash()[:], []byte("test")); err != nil {
+		t.Fatalf("a.Fossilize(): err: %s", err)
+	}
+	r := waitEvent(t, ec, fossilizer.DidFossilizeLink)
+	txid := r.Evidence.Proof.(*evidences.BcBatchProof).TransactionID
+	fee, _ := harness.Fee(txid)
+
+	// Wait for the transaction to be replaced.
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := harness.Transaction(txid); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("transaction fee was not bumped")
+		}
+		time.Sleep(testPollInterval)
+	}
+
+	harness.Mine(1)
+	r = waitEvent(t, ec, fossilizer.DidConfirmLink)
+	proof := r.Evidence.Proof.(*evidences.BcBatchProof)
+	bumped, ok := harness.Fee(proof.TransactionID)
+	if !ok {
+		t.Fatal("replacement transaction was not mined")
+	}
+	if bumped <= fee {
+		t.Errorf("bumped fee = %d want more than %d", bumped, fee)
+	}
+}
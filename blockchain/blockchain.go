@@ -16,6 +16,7 @@
 package blockchain
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/stratumn/sdk/types"
@@ -46,3 +47,56 @@ type HashTimestamper interface {
 	// TimestampHash timestamps a hash on a blockchain.
 	TimestampHash(hash *types.Bytes32) (types.TransactionID, error)
 }
+
+// ErrTransactionNotFound is returned by a ChainQuerier when a transaction is
+// neither in a block nor waiting to be mined.
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// TransactionStatus is the status of a transaction on a blockchain.
+type TransactionStatus struct {
+	// Mined is true if the transaction is in a block of the main chain.
+	Mined bool
+
+	// The hash of the block containing the transaction.
+	BlockHash *types.Bytes32
+
+	// The height of the block containing the transaction.
+	BlockHeight uint64
+
+	// The number of blocks, including the one containing the transaction,
+	// on top of which the transaction was mined.
+	Confirmations uint64
+}
+
+// ChainQuerier must be able to query the status of transactions.
+type ChainQuerier interface {
+	// TransactionStatus returns the status of a transaction. It returns
+	// ErrTransactionNotFound if the transaction was dropped.
+	TransactionStatus(txid types.TransactionID) (*TransactionStatus, error)
+}
+
+// FeeBumper must be able to replace a transaction waiting to be mined with
+// one paying a higher fee.
+type FeeBumper interface {
+	// BumpFee replaces a transaction sent by the timestamper and returns
+	// the ID of the new transaction.
+	BumpFee(txid types.TransactionID) (types.TransactionID, error)
+}
+
+// Balance is the balance of the account used by a timestamper.
+type Balance struct {
+	// The confirmed balance in the smallest unit of the blockchain.
+	Confirmed int64 `json:"confirmed"`
+
+	// The unconfirmed balance in the smallest unit of the blockchain.
+	Unconfirmed int64 `json:"unconfirmed"`
+
+	// The estimated number of transactions the balance can pay for.
+	Runway int64 `json:"runway"`
+}
+
+// BalanceReporter must be able to report the balance of its account.
+type BalanceReporter interface {
+	// Balance returns the balance of the account.
+	Balance() (*Balance, error)
+}
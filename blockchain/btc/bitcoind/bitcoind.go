@@ -0,0 +1,448 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bitcoind implements a client for the JSON-RPC API of a Bitcoin Core
+// node.
+package bitcoind
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/pkg/errors"
+
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/types"
+)
+
+const (
+	// DefaultURL is the default URL of the JSON-RPC endpoint of a node on
+	// the main network.
+	DefaultURL = "http://localhost:8332"
+
+	// DefaultTest3URL is the default URL of the JSON-RPC endpoint of a node
+	// on the test network.
+	DefaultTest3URL = "http://localhost:18332"
+
+	// DefaultRegtestURL is the default URL of the JSON-RPC endpoint of a
+	// node on the regression test network.
+	DefaultRegtestURL = "http://localhost:18443"
+
+	// DefaultTimeout is the default timeout of requests.
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultMinConf is the default number of confirmations of the outputs
+	// returned by listunspent.
+	DefaultMinConf = 1
+
+	// satoshisPerBitcoin is used to convert amounts returned by the node.
+	satoshisPerBitcoin = 1e8
+)
+
+// Config contains configuration options for the client.
+type Config struct {
+	// Network is the Bitcoin network.
+	Network btc.Network
+
+	// The URL of the JSON-RPC endpoint. It defaults to the default RPC port
+	// of the network on localhost.
+	URL string
+
+	// Credentials of the JSON-RPC endpoint (rpcuser and rpcpassword).
+	Username string
+	Password string
+
+	// The path of the cookie file written by the node, used instead of
+	// the credentials if set. It is read before every request since the
+	// node creates a new one each time it starts.
+	CookieFile string
+
+	// Whether to find unspent outputs with scantxoutset instead of
+	// listunspent. It works without a wallet but scans the whole UTXO set.
+	Scan bool
+
+	// The minimum number of confirmations of the outputs returned by
+	// listunspent.
+	MinConf int
+
+	// The timeout of requests.
+	Timeout time.Duration
+}
+
+// GetURL returns the configured URL or the default URL of the network.
+func (c *Config) GetURL() string {
+	if c.URL != "" {
+		return c.URL
+	}
+	switch c.Network {
+	case btc.NetworkTest3:
+		return DefaultTest3URL
+	case btc.NetworkRegtest:
+		return DefaultRegtestURL
+	default:
+		return DefaultURL
+	}
+}
+
+// Error is an error returned by the JSON-RPC endpoint.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements error.Error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Client is a bitcoind JSON-RPC client.
+type Client struct {
+	config *Config
+	client *http.Client
+	id     uint64
+}
+
+// New creates a client for a Bitcoin Core node.
+func New(config *Config) *Client {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Client{
+		config: config,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+type unspent struct {
+	TXID         string  `json:"txid"`
+	Vout         int     `json:"vout"`
+	ScriptPubKey string  `json:"scriptPubKey"`
+	Amount       float64 `json:"amount"`
+}
+
+type scanResult struct {
+	Success  bool      `json:"success"`
+	Unspents []unspent `json:"unspents"`
+}
+
+// FindUnspent implements
+// github.com/stratumn/sdk/blockchain/btc.UnspentFinder.FindUnspent.
+func (c *Client) FindUnspent(address btcutil.Address, amount int64) ([]btc.Output, int64, error) {
+	addr := address.EncodeAddress()
+
+	var unspents []unspent
+	if c.config.Scan {
+		var res scanResult
+		if err := c.call("scantxoutset", &res, "start", []string{"addr(" + addr + ")"}); err != nil {
+			return nil, 0, err
+		}
+		if !res.Success {
+			return nil, 0, errors.New("scantxoutset did not complete")
+		}
+		unspents = res.Unspents
+	} else {
+		minConf := c.config.MinConf
+		if minConf <= 0 {
+			minConf = DefaultMinConf
+		}
+		if err := c.call("listunspent", &unspents, minConf, 9999999, []string{addr}); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var (
+		outputs []btc.Output
+		total   int64
+	)
+
+	for _, u := range unspents {
+		output := btc.Output{Index: u.Vout}
+		if err := output.TXHash.Unstring(u.TXID); err != nil {
+			return nil, 0, err
+		}
+
+		var err error
+		if output.PKScript, err = hex.DecodeString(u.ScriptPubKey); err != nil {
+			return nil, 0, errors.WithStack(err)
+		}
+
+		output.Value = int64(u.Amount*satoshisPerBitcoin + 0.5)
+		outputs = append(outputs, output)
+
+		total += output.Value
+		if total >= amount {
+			break
+		}
+	}
+
+	if total < amount {
+		return nil, 0, fmt.Errorf("Not enough Bitcoins available on %s, expected at least %d satoshis got %d", addr, amount, total)
+	}
+
+	return outputs, total, nil
+}
+
+// Broadcast implements
+// github.com/stratumn/sdk/blockchain/btc.Broadcaster.Broadcast.
+func (c *Client) Broadcast(raw []byte) error {
+	var txid string
+	return c.call("sendrawtransaction", &txid, hex.EncodeToString(raw))
+}
+
+// errCodeNotFound is the error code returned by the node for unknown
+// transactions.
+const errCodeNotFound = -5
+
+type rawTransaction struct {
+	Hex           string `json:"hex"`
+	BlockHash     string `json:"blockhash"`
+	Confirmations uint64 `json:"confirmations"`
+}
+
+type block struct {
+	Height     int64    `json:"height"`
+	Time       int64    `json:"time"`
+	MerkleRoot string   `json:"merkleroot"`
+	TXIDs      []string `json:"tx"`
+}
+
+// TransactionStatus implements
+// github.com/stratumn/sdk/blockchain.ChainQuerier.TransactionStatus.
+// The node must have a transaction index (-txindex) to find transactions
+// that are not in its wallet or its mempool.
+func (c *Client) TransactionStatus(txid types.TransactionID) (*blockchain.TransactionStatus, error) {
+	var tx rawTransaction
+	if err := c.call("getrawtransaction", &tx, txid.String(), true); err != nil {
+		if rpcErr, ok := err.(*Error); ok && rpcErr.Code == errCodeNotFound {
+			return nil, blockchain.ErrTransactionNotFound
+		}
+		return nil, err
+	}
+
+	status := &blockchain.TransactionStatus{}
+	if tx.BlockHash == "" || tx.Confirmations == 0 {
+		return status, nil
+	}
+
+	var count uint64
+	if err := c.call("getblockcount", &count); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if status.BlockHash, err = types.NewBytes32FromString(tx.BlockHash); err != nil {
+		return nil, err
+	}
+	status.Mined = true
+	status.Confirmations = tx.Confirmations
+	status.BlockHeight = count - tx.Confirmations + 1
+
+	return status, nil
+}
+
+// TransactionProof implements
+// github.com/stratumn/sdk/blockchain/btc.TransactionProver.TransactionProof.
+// The node must have a transaction index (-txindex) to find transactions
+// that are not in its wallet or its mempool.
+func (c *Client) TransactionProof(txid types.TransactionID) (*btc.TransactionProof, error) {
+	var tx rawTransaction
+	if err := c.call("getrawtransaction", &tx, txid.String(), true); err != nil {
+		if rpcErr, ok := err.(*Error); ok && rpcErr.Code == errCodeNotFound {
+			return nil, blockchain.ErrTransactionNotFound
+		}
+		return nil, err
+	}
+	if tx.BlockHash == "" || tx.Confirmations == 0 {
+		return nil, btc.ErrTransactionNotMined
+	}
+
+	raw, err := hex.DecodeString(tx.Hex)
+	if err != nil {
+		return nil, err
+	}
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := msgTx.SerializeNoWitness(&buf); err != nil {
+		return nil, err
+	}
+
+	var b block
+	if err := c.call("getblock", &b, tx.BlockHash, 1); err != nil {
+		return nil, err
+	}
+
+	proof := &btc.TransactionProof{
+		Raw:         buf.Bytes(),
+		BlockHeight: b.Height,
+		BlockTime:   b.Time,
+		Index:       -1,
+	}
+	txHashes := make([]chainhash.Hash, len(b.TXIDs))
+	for i, id := range b.TXIDs {
+		hash, err := chainhash.NewHashFromStr(id)
+		if err != nil {
+			return nil, err
+		}
+		txHashes[i] = *hash
+		if id == txid.String() {
+			proof.Index = i
+		}
+	}
+	if proof.Index < 0 {
+		return nil, fmt.Errorf("transaction %s is not in block %s", txid, tx.BlockHash)
+	}
+
+	proof.MerkleRoot, proof.MerkleBranch = btc.MerkleBranch(txHashes, proof.Index)
+	if proof.MerkleRoot.String() != b.MerkleRoot {
+		return nil, fmt.Errorf("transactions of block %s do not match its Merkle root", tx.BlockHash)
+	}
+
+	return proof, nil
+}
+
+// BlockMerkleRoot implements
+// github.com/stratumn/sdk/blockchain/btc.MerkleRootReader.BlockMerkleRoot.
+func (c *Client) BlockMerkleRoot(height int64) (chainhash.Hash, error) {
+	var hash string
+	if err := c.call("getblockhash", &hash, height); err != nil {
+		return chainhash.Hash{}, err
+	}
+
+	var b block
+	if err := c.call("getblockheader", &b, hash, true); err != nil {
+		return chainhash.Hash{}, err
+	}
+
+	root, err := chainhash.NewHashFromStr(b.MerkleRoot)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	return *root, nil
+}
+
+type feeEstimate struct {
+	FeeRate float64  `json:"feerate"`
+	Errors  []string `json:"errors"`
+}
+
+// EstimateFee implements
+// github.com/stratumn/sdk/blockchain/btc.FeeEstimator.EstimateFee.
+func (c *Client) EstimateFee(blocks int) (int64, error) {
+	var res feeEstimate
+	if err := c.call("estimatesmartfee", &res, blocks); err != nil {
+		return 0, err
+	}
+	if res.FeeRate <= 0 {
+		// The node does not have enough data yet, which is always the
+		// case on regtest.
+		if len(res.Errors) > 0 {
+			return 0, errors.Errorf("estimatesmartfee: %s", strings.Join(res.Errors, ", "))
+		}
+		return 0, errors.New("estimatesmartfee: no fee rate available")
+	}
+
+	// The node returns bitcoins per kilo virtual byte. Round up to the
+	// next satoshi per virtual byte.
+	return (int64(res.FeeRate*satoshisPerBitcoin+0.5) + 999) / 1000, nil
+}
+
+type request struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+func (c *Client) call(method string, result interface{}, params ...interface{}) error {
+	body, err := json.Marshal(request{
+		JSONRPC: "1.0",
+		ID:      atomic.AddUint64(&c.id, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest("POST", c.config.GetURL(), bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	username, password, err := c.credentials()
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, password)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return errors.New("bitcoind rejected the credentials")
+	}
+
+	// The node replies with an error status along with an error object
+	// when the call fails.
+	var r response
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return errors.Wrapf(err, "%s: invalid response with HTTP status %d", method, res.StatusCode)
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+
+	return errors.WithStack(json.Unmarshal(r.Result, result))
+}
+
+func (c *Client) credentials() (string, string, error) {
+	if c.config.CookieFile == "" {
+		return c.config.Username, c.config.Password, nil
+	}
+
+	cookie, err := ioutil.ReadFile(c.config.CookieFile)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(cookie)), ":", 2)
+	if len(parts) != 2 {
+		return "", "", errors.Errorf("invalid cookie file %s", c.config.CookieFile)
+	}
+
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,539 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitcoind
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/types"
+)
+
+const (
+	testAddress = "n4XCm5oQmo98uGhAJDxQ8wGsqA2YoGrKNX"
+	testTXID    = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+	testScript  = "76a914fc56f7f9f80cfba26f300c77b893c39ed89351ff88ac"
+)
+
+// node is a stand-in for the JSON-RPC API of bitcoind.
+type node struct {
+	username string
+	password string
+	unspents []unspent
+	calls    []request
+	raw      []string
+	feeRate  float64
+	txs      map[string]rawTransaction
+	blocks   map[string]block
+}
+
+func (n *node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if username, password, ok := r.BasicAuth(); !ok || username != n.username || password != n.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		request
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.calls = append(n.calls, req.request)
+
+	var result interface{}
+	switch req.Method {
+	case "listunspent":
+		var addresses []string
+		json.Unmarshal(req.Params[2], &addresses)
+		result = n.filter(addresses[0])
+	case "scantxoutset":
+		var descriptors []string
+		json.Unmarshal(req.Params[1], &descriptors)
+		result = map[string]interface{}{
+			"success":  true,
+			"unspents": n.filter(descriptors[0][len("addr(") : len(descriptors[0])-1]),
+		}
+	case "sendrawtransaction":
+		var raw string
+		json.Unmarshal(req.Params[0], &raw)
+		if _, err := hex.DecodeString(raw); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": nil,
+				"error":  Error{Code: -22, Message: "TX decode failed"},
+			})
+			return
+		}
+		n.raw = append(n.raw, raw)
+		result = testTXID
+	case "getrawtransaction":
+		var txid string
+		json.Unmarshal(req.Params[0], &txid)
+		tx, ok := n.txs[txid]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": nil,
+				"error":  Error{Code: -5, Message: "No such mempool or blockchain transaction"},
+			})
+			return
+		}
+		result = tx
+	case "getblock":
+		var hash string
+		json.Unmarshal(req.Params[0], &hash)
+		result = n.blocks[hash]
+	case "getblockhash":
+		var height int64
+		json.Unmarshal(req.Params[0], &height)
+		for hash, b := range n.blocks {
+			if b.Height == height {
+				result = hash
+			}
+		}
+		if result == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": nil,
+				"error":  Error{Code: -8, Message: "Block height out of range"},
+			})
+			return
+		}
+	case "getblockheader":
+		var hash string
+		json.Unmarshal(req.Params[0], &hash)
+		result = n.blocks[hash]
+	case "getblockcount":
+		result = 100
+	case "estimatesmartfee":
+		if n.feeRate <= 0 {
+			result = map[string]interface{}{"errors": []string{"Insufficient data or no feerate found"}, "blocks": 0}
+			break
+		}
+		result = map[string]interface{}{"feerate": n.feeRate, "blocks": 2}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": nil,
+			"error":  Error{Code: -32601, Message: "Method not found"},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error": nil})
+}
+
+func (n *node) filter(address string) []unspent {
+	if address != testAddress {
+		return []unspent{}
+	}
+	return n.unspents
+}
+
+func newNode(t *testing.T) (*node, *httptest.Server) {
+	n := &node{
+		username: "user",
+		password: "pass",
+		unspents: []unspent{
+			{TXID: testTXID, Vout: 0, ScriptPubKey: testScript, Amount: 0.001},
+			{TXID: testTXID, Vout: 1, ScriptPubKey: testScript, Amount: 0.002},
+		},
+	}
+	return n, httptest.NewServer(n)
+}
+
+func decodeTestAddress(t *testing.T) btcutil.Address {
+	addr, err := btcutil.DecodeAddress(testAddress, &chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatalf("btcutil.DecodeAddress(): err: %s", err)
+	}
+	return addr
+}
+
+func TestFindUnspent(t *testing.T) {
+	n, server := newNode(t)
+	defer server.Close()
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+	})
+
+	outputs, total, err := c.FindUnspent(decodeTestAddress(t), 150000)
+	if err != nil {
+		t.Fatalf("c.FindUnspent(): err: %s", err)
+	}
+	if got, want := total, int64(300000); got != want {
+		t.Errorf("c.FindUnspent(): total = %d want %d", got, want)
+	}
+	if got, want := len(outputs), 2; got != want {
+		t.Fatalf("c.FindUnspent(): len(outputs) = %d want %d", got, want)
+	}
+	if got, want := outputs[1].TXHash.String(), testTXID; got != want {
+		t.Errorf("outputs[1].TXHash = %s want %s", got, want)
+	}
+	if got, want := outputs[1].Index, 1; got != want {
+		t.Errorf("outputs[1].Index = %d want %d", got, want)
+	}
+	if got, want := hex.EncodeToString(outputs[1].PKScript), testScript; got != want {
+		t.Errorf("outputs[1].PKScript = %s want %s", got, want)
+	}
+	if got, want := outputs[1].Value, int64(200000); got != want {
+		t.Errorf("outputs[1].Value = %d want %d", got, want)
+	}
+	if got, want := n.calls[0].Method, "listunspent"; got != want {
+		t.Errorf("method = %s want %s", got, want)
+	}
+}
+
+func TestFindUnspent_scan(t *testing.T) {
+	n, server := newNode(t)
+	defer server.Close()
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+		Scan:     true,
+	})
+
+	outputs, total, err := c.FindUnspent(decodeTestAddress(t), 50000)
+	if err != nil {
+		t.Fatalf("c.FindUnspent(): err: %s", err)
+	}
+	if got, want := total, int64(100000); got != want {
+		t.Errorf("c.FindUnspent(): total = %d want %d", got, want)
+	}
+	if got, want := len(outputs), 1; got != want {
+		t.Errorf("c.FindUnspent(): len(outputs) = %d want %d", got, want)
+	}
+	if got, want := n.calls[0].Method, "scantxoutset"; got != want {
+		t.Errorf("method = %s want %s", got, want)
+	}
+}
+
+func TestFindUnspent_notEnough(t *testing.T) {
+	_, server := newNode(t)
+	defer server.Close()
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+	})
+
+	if _, _, err := c.FindUnspent(decodeTestAddress(t), 1000000000000); err == nil {
+		t.Error("c.FindUnspent(): err = nil want Error")
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	n, server := newNode(t)
+	defer server.Close()
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+	})
+
+	if err := c.Broadcast([]byte{1, 2, 3}); err != nil {
+		t.Fatalf("c.Broadcast(): err: %s", err)
+	}
+	if got, want := n.raw, []string{"010203"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("raw = %v want %v", got, want)
+	}
+}
+
+func TestTransactionStatus(t *testing.T) {
+	n, server := newNode(t)
+	defer server.Close()
+	blockHash := "00000000000000000000000000000000000000000000000000000000000000ff"
+	n.txs = map[string]rawTransaction{
+		testTXID:            {BlockHash: blockHash, Confirmations: 3},
+		"ab" + testTXID[2:]: {},
+	}
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+	})
+
+	txid, _ := types.NewBytes32FromString(testTXID)
+	status, err := c.TransactionStatus(txid[:])
+	if err != nil {
+		t.Fatalf("c.TransactionStatus(): err: %s", err)
+	}
+	if !status.Mined {
+		t.Error("status.Mined = false want true")
+	}
+	if got, want := status.BlockHash.String(), blockHash; got != want {
+		t.Errorf("status.BlockHash = %s want %s", got, want)
+	}
+	if got, want := status.BlockHeight, uint64(98); got != want {
+		t.Errorf("status.BlockHeight = %d want %d", got, want)
+	}
+
+	txid, _ = types.NewBytes32FromString("ab" + testTXID[2:])
+	if status, err = c.TransactionStatus(txid[:]); err != nil {
+		t.Fatalf("c.TransactionStatus(): err: %s", err)
+	}
+	if status.Mined {
+		t.Error("status.Mined = true want false")
+	}
+
+	txid, _ = types.NewBytes32FromString("cd" + testTXID[2:])
+	if _, err = c.TransactionStatus(txid[:]); err != blockchain.ErrTransactionNotFound {
+		t.Errorf("c.TransactionStatus(): err = %v want %v", err, blockchain.ErrTransactionNotFound)
+	}
+}
+
+func TestTransactionProof(t *testing.T) {
+	n, server := newNode(t)
+	defer server.Close()
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0), []byte{0x51}, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0x6a}))
+	var buf bytes.Buffer
+	tx.Serialize(&buf)
+	txid := tx.TxHash().String()
+
+	txHashes := []chainhash.Hash{{1}, tx.TxHash(), {3}}
+	root, _ := btc.MerkleBranch(txHashes, 0)
+
+	blockHash := "00000000000000000000000000000000000000000000000000000000000000ff"
+	n.txs = map[string]rawTransaction{
+		txid:                {Hex: hex.EncodeToString(buf.Bytes()), BlockHash: blockHash, Confirmations: 3},
+		"ab" + testTXID[2:]: {},
+	}
+	n.blocks = map[string]block{
+		blockHash: {
+			Height:     98,
+			Time:       1500000000,
+			MerkleRoot: root.String(),
+			TXIDs:      []string{txHashes[0].String(), txid, txHashes[2].String()},
+		},
+	}
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+	})
+
+	id, _ := types.NewBytes32FromString(txid)
+	proof, err := c.TransactionProof(id[:])
+	if err != nil {
+		t.Fatalf("c.TransactionProof(): err: %s", err)
+	}
+	if !bytes.Equal(proof.Raw, buf.Bytes()) {
+		t.Errorf("proof.Raw = %x want %x", proof.Raw, buf.Bytes())
+	}
+	if got, want := proof.BlockHeight, int64(98); got != want {
+		t.Errorf("proof.BlockHeight = %d want %d", got, want)
+	}
+	if got, want := proof.Index, 1; got != want {
+		t.Errorf("proof.Index = %d want %d", got, want)
+	}
+	if proof.MerkleRoot != root {
+		t.Errorf("proof.MerkleRoot = %s want %s", proof.MerkleRoot, root)
+	}
+	if got, want := len(proof.MerkleBranch), 2; got != want {
+		t.Errorf("len(proof.MerkleBranch) = %d want %d", got, want)
+	}
+
+	id, _ = types.NewBytes32FromString("ab" + testTXID[2:])
+	if _, err = c.TransactionProof(id[:]); err != btc.ErrTransactionNotMined {
+		t.Errorf("c.TransactionProof(): err = %v want %v", err, btc.ErrTransactionNotMined)
+	}
+}
+
+func TestBlockMerkleRoot(t *testing.T) {
+	n, server := newNode(t)
+	defer server.Close()
+
+	root := chainhash.Hash{1, 2, 3}
+	n.blocks = map[string]block{
+		"00000000000000000000000000000000000000000000000000000000000000ff": {
+			Height:     98,
+			MerkleRoot: root.String(),
+		},
+	}
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+	})
+
+	got, err := c.BlockMerkleRoot(98)
+	if err != nil {
+		t.Fatalf("c.BlockMerkleRoot(): err: %s", err)
+	}
+	if got != root {
+		t.Errorf("c.BlockMerkleRoot() = %s want %s", got, root)
+	}
+
+	if _, err := c.BlockMerkleRoot(99); err == nil {
+		t.Error("c.BlockMerkleRoot(): err = nil want Error")
+	}
+}
+
+func TestEstimateFee(t *testing.T) {
+	n, server := newNode(t)
+	defer server.Close()
+	n.feeRate = 0.00012345
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+	})
+
+	rate, err := c.EstimateFee(6)
+	if err != nil {
+		t.Fatalf("c.EstimateFee(): err: %s", err)
+	}
+	if got, want := rate, int64(13); got != want {
+		t.Errorf("c.EstimateFee() = %d want %d", got, want)
+	}
+}
+
+func TestEstimateFee_unavailable(t *testing.T) {
+	_, server := newNode(t)
+	defer server.Close()
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+	})
+
+	if _, err := c.EstimateFee(6); err == nil {
+		t.Error("c.EstimateFee(): err = nil want Error")
+	}
+}
+
+func TestCall_error(t *testing.T) {
+	_, server := newNode(t)
+	defer server.Close()
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "pass",
+	})
+
+	var result interface{}
+	err := c.call("getinfo", &result)
+	if rpcErr, ok := err.(*Error); !ok || rpcErr.Code != -32601 {
+		t.Errorf("c.call(): err = %#v want *Error", err)
+	}
+}
+
+func TestCall_unauthorized(t *testing.T) {
+	_, server := newNode(t)
+	defer server.Close()
+
+	c := New(&Config{
+		Network:  btc.NetworkTest3,
+		URL:      server.URL,
+		Username: "user",
+		Password: "wrong",
+	})
+
+	if err := c.Broadcast([]byte{1}); err == nil {
+		t.Error("c.Broadcast(): err = nil want Error")
+	}
+}
+
+func TestCall_cookie(t *testing.T) {
+	n, server := newNode(t)
+	defer server.Close()
+	n.username, n.password = "__cookie__", "secret"
+
+	dir, err := ioutil.TempDir("", "bitcoind")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	cookie := filepath.Join(dir, ".cookie")
+	if err := ioutil.WriteFile(cookie, []byte("__cookie__:secret"), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile(): err: %s", err)
+	}
+
+	c := New(&Config{
+		Network:    btc.NetworkTest3,
+		URL:        server.URL,
+		CookieFile: cookie,
+	})
+
+	if err := c.Broadcast([]byte{1}); err != nil {
+		t.Errorf("c.Broadcast(): err: %s", err)
+	}
+
+	c.config.CookieFile = filepath.Join(dir, "missing")
+	if err := c.Broadcast([]byte{1}); err == nil {
+		t.Error("c.Broadcast(): err = nil want Error")
+	}
+}
+
+func TestConfig_GetURL(t *testing.T) {
+	tests := []struct {
+		config *Config
+		want   string
+	}{
+		{&Config{Network: btc.NetworkMain}, DefaultURL},
+		{&Config{Network: btc.NetworkTest3}, DefaultTest3URL},
+		{&Config{Network: btc.NetworkRegtest}, DefaultRegtestURL},
+		{&Config{Network: btc.NetworkTest3, URL: "http://node:8332"}, "http://node:8332"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.config.GetURL(); got != tt.want {
+			t.Errorf("%s: config.GetURL() = %q want %q", tt.config.Network, got, tt.want)
+		}
+	}
+}
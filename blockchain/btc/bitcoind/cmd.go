@@ -0,0 +1,45 @@
+package bitcoind
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/stratumn/sdk/blockchain/btc"
+)
+
+var (
+	url        string
+	username   string
+	password   string
+	cookieFile string
+	scan       bool
+	minConf    int
+	timeout    time.Duration
+)
+
+// RegisterFlags registers the flags used by InitializeWithFlags.
+func RegisterFlags() {
+	flag.StringVar(&url, "btc-rpc-url", "", "URL of the bitcoind JSON-RPC endpoint (defaults to the RPC port of the network on localhost)")
+	flag.StringVar(&username, "btc-rpc-user", os.Getenv("BTC_RPC_USER"), "bitcoind JSON-RPC username")
+	flag.StringVar(&password, "btc-rpc-password", os.Getenv("BTC_RPC_PASSWORD"), "bitcoind JSON-RPC password")
+	flag.StringVar(&cookieFile, "btc-rpc-cookie", "", "path of the bitcoind cookie file, used instead of username and password")
+	flag.BoolVar(&scan, "btc-rpc-scan", false, "whether to find unspent outputs with scantxoutset instead of the node's wallet")
+	flag.IntVar(&minConf, "btc-rpc-minconf", DefaultMinConf, "minimum number of confirmations of unspent outputs")
+	flag.DurationVar(&timeout, "btc-rpc-timeout", DefaultTimeout, "timeout of requests to bitcoind")
+}
+
+// InitializeWithFlags should be called after RegisterFlags and flag.Parse to
+// initialize a bitcoind client using flag values.
+func InitializeWithFlags(network btc.Network) *Client {
+	return New(&Config{
+		Network:    network,
+		URL:        url,
+		Username:   username,
+		Password:   password,
+		CookieFile: cookieFile,
+		Scan:       scan,
+		MinConf:    minConf,
+		Timeout:    timeout,
+	})
+}
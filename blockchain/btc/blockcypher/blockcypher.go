@@ -24,7 +24,8 @@ import (
 	"time"
 
 	"github.com/blockcypher/gobcy"
-	"github.com/btcsuite/btcutil/base58"
+	"github.com/btcsuite/btcutil"
+	"github.com/stratumn/sdk/blockchain"
 	"github.com/stratumn/sdk/blockchain/btc"
 	"github.com/stratumn/sdk/types"
 )
@@ -81,14 +82,14 @@ func New(c *Config) *Client {
 
 // FindUnspent implements
 // github.com/stratumn/sdk/blockchain/btc.UnspentFinder.FindUnspent.
-func (c *Client) FindUnspent(address *types.ReversedBytes20, amount int64) ([]btc.Output, int64, error) {
+func (c *Client) FindUnspent(address btcutil.Address, amount int64) ([]btc.Output, int64, error) {
 	for range c.limiter {
 		break
 	}
 	c.waitGroup.Add(1)
 	defer c.waitGroup.Done()
 
-	addr := base58.CheckEncode(address[:], c.config.Network.ID())
+	addr := address.EncodeAddress()
 	addrInfo, err := c.api.GetAddr(addr, map[string]string{
 		"unspentOnly":   "true",
 		"includeScript": "true",
@@ -105,7 +106,7 @@ func (c *Client) FindUnspent(address *types.ReversedBytes20, amount int64) ([]bt
 
 TX_LOOP:
 	for _, TXRef := range addrInfo.TXRefs {
-		output := btc.Output{Index: TXRef.TXOutputN}
+		output := btc.Output{Index: TXRef.TXOutputN, Value: int64(TXRef.Value)}
 		if err := output.TXHash.Unstring(TXRef.TXHash); err != nil {
 			return nil, 0, err
 		}
@@ -117,7 +118,7 @@ TX_LOOP:
 
 		outputs = append(outputs, output)
 
-		total += int64(TXRef.Value)
+		total += output.Value
 		if total >= amount {
 			break TX_LOOP
 		}
@@ -143,6 +144,66 @@ func (c *Client) Broadcast(raw []byte) error {
 	return err
 }
 
+// TransactionStatus implements
+// github.com/stratumn/sdk/blockchain.ChainQuerier.TransactionStatus.
+func (c *Client) TransactionStatus(txid types.TransactionID) (*blockchain.TransactionStatus, error) {
+	for range c.limiter {
+		break
+	}
+	c.waitGroup.Add(1)
+	defer c.waitGroup.Done()
+
+	tx, err := c.api.GetTX(txid.String(), nil)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "not found") {
+			return nil, blockchain.ErrTransactionNotFound
+		}
+		return nil, err
+	}
+
+	status := &blockchain.TransactionStatus{}
+	if tx.BlockHeight < 0 || tx.BlockHash == "" {
+		return status, nil
+	}
+
+	status.Mined = true
+	status.BlockHeight = uint64(tx.BlockHeight)
+	status.Confirmations = uint64(tx.Confirmations)
+	if status.BlockHash, err = types.NewBytes32FromString(tx.BlockHash); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// EstimateFee implements
+// github.com/stratumn/sdk/blockchain/btc.FeeEstimator.EstimateFee.
+// BlockCypher only gives high, medium and low fee rates, which target one to
+// two blocks, three to six blocks and seven blocks or more.
+func (c *Client) EstimateFee(blocks int) (int64, error) {
+	for range c.limiter {
+		break
+	}
+	c.waitGroup.Add(1)
+	defer c.waitGroup.Done()
+
+	chain, err := c.api.GetChain()
+	if err != nil {
+		return 0, err
+	}
+
+	feePerKB := chain.LowFee
+	switch {
+	case blocks <= 2:
+		feePerKB = chain.HighFee
+	case blocks <= 6:
+		feePerKB = chain.MediumFee
+	}
+
+	// Round up to the next satoshi per byte.
+	return (int64(feePerKB) + 999) / 1000, nil
+}
+
 // Start starts the client.
 func (c *Client) Start(ctx context.Context) {
 	size := c.config.LimiterSize
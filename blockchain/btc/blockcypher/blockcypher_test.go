@@ -22,7 +22,6 @@ import (
 	"github.com/btcsuite/btcutil"
 	"github.com/stratumn/sdk/blockchain/btc"
 	"github.com/stratumn/sdk/testutil"
-	"github.com/stratumn/sdk/types"
 )
 
 func TestFindUnspent(t *testing.T) {
@@ -36,10 +35,7 @@ func TestFindUnspent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("btcutil.DecodeAddress(): err: %s", err)
 	}
-	var addr20 types.ReversedBytes20
-	copy(addr20[:], addr.ScriptAddress())
-
-	outputs, total, err := bcy.FindUnspent(&addr20, 1000000)
+	outputs, total, err := bcy.FindUnspent(addr, 1000000)
 
 	if err != nil {
 		t.Errorf("bcy.FindUnspent(): err: %s", err)
@@ -73,10 +69,7 @@ func TestFindUnspent_notEnough(t *testing.T) {
 	if err != nil {
 		t.Fatalf("btcutil.DecodeAddress(): err: %s", err)
 	}
-	var addr20 types.ReversedBytes20
-	copy(addr20[:], addr.ScriptAddress())
-
-	_, _, err = bcy.FindUnspent(&addr20, 1000000000000)
+	_, _, err = bcy.FindUnspent(addr, 1000000000000)
 	if err == nil {
 		t.Errorf("bcy.FindUnspent(): err = nil want Error")
 	}
@@ -46,6 +46,16 @@ func RunWithFlags(ctx context.Context, key string) *Client {
 		log.Fatal("WIF encoded private key uses unknown Bitcoin network")
 	}
 
+	return RunWithNetworkFlags(ctx, network)
+}
+
+// RunWithNetworkFlags should be called after RegisterFlags and flag.Parse to
+// initialize a blockcypher client for a network using flag values.
+func RunWithNetworkFlags(ctx context.Context, network btc.Network) *Client {
+	if network != btc.NetworkMain && network != btc.NetworkTest3 {
+		log.WithField("network", network).Fatal("BlockCypher only supports the main and test3 Bitcoin networks")
+	}
+
 	bcy := New(&Config{
 		Network:         network,
 		APIKey:          bcyAPIKey,
@@ -15,8 +15,14 @@
 // Package btc defines primitives to work with Bitcoin.
 package btc
 
-import "github.com/stratumn/sdk/types"
-import "github.com/btcsuite/btcd/chaincfg"
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+	"github.com/stratumn/sdk/types"
+)
 
 // Network represents a Bitcoin network.
 type Network string
@@ -27,30 +33,71 @@ const (
 
 	// NetworkMain is an identified for the main Bitcoin network.
 	NetworkMain Network = "bitcoin:main"
+
+	// NetworkRegtest is an identifier for the regression test network.
+	NetworkRegtest Network = "bitcoin:regtest"
+
+	// NetworkSimnet is an identifier for the simulation test network.
+	NetworkSimnet Network = "bitcoin:simnet"
 )
 
+// ErrUnsupportedNetwork is returned when a key or a network is not one of the
+// supported Bitcoin networks.
+var ErrUnsupportedNetwork = errors.New("unsupported network")
+
 // String implements fmt.Stringer.
 func (n Network) String() string {
 	return string(n)
 }
 
-// ID returns the byte ID of the network.
-func (n Network) ID() byte {
+// Params returns the chain parameters of the network, or nil if the network
+// is not supported.
+func (n Network) Params() *chaincfg.Params {
 	switch n {
 	case NetworkTest3:
-		return chaincfg.TestNet3Params.PubKeyHashAddrID
+		return &chaincfg.TestNet3Params
 	case NetworkMain:
-		return chaincfg.MainNetParams.PubKeyHashAddrID
+		return &chaincfg.MainNetParams
+	case NetworkRegtest:
+		return &chaincfg.RegressionNetParams
+	case NetworkSimnet:
+		return &chaincfg.SimNetParams
+	}
+
+	return nil
+}
+
+// ID returns the byte ID of the network.
+func (n Network) ID() byte {
+	if params := n.Params(); params != nil {
+		return params.PubKeyHashAddrID
 	}
 
 	return 0
 }
 
+// NetworkFromWIF returns the network of a WIF encoded key.
+// Regtest keys use the same prefix as testnet keys, so NetworkTest3 is
+// returned for both.
+func NetworkFromWIF(wif *btcutil.WIF) (Network, error) {
+	for _, n := range []Network{NetworkMain, NetworkTest3, NetworkSimnet} {
+		if wif.IsForNet(n.Params()) {
+			return n, nil
+		}
+	}
+
+	return "", ErrUnsupportedNetwork
+}
+
 // Output represents a transaction output.
 type Output struct {
 	TXHash   types.ReversedBytes32
 	PKScript []byte
 	Index    int
+
+	// The amount of the output in satoshis, required to sign segwit
+	// inputs.
+	Value int64
 }
 
 // UnspentFinder is find unspent outputs.
@@ -58,7 +105,7 @@ type UnspentFinder interface {
 	// FindUnspent find unspent outputs for the given address and the
 	// required amount. It returns the outputs and the total amount of the
 	// outputs.
-	FindUnspent(address *types.ReversedBytes20, amount int64) (outputs []Output, total int64, err error)
+	FindUnspent(address btcutil.Address, amount int64) (outputs []Output, total int64, err error)
 }
 
 // Broadcaster is able to broadcast raw Bitcoin transactions.
@@ -66,3 +113,81 @@ type Broadcaster interface {
 	// Broadcast broadcasts a raw transaction.
 	Broadcast(raw []byte) error
 }
+
+// FeeEstimator is able to estimate the fee rate required for a transaction to
+// be mined quickly.
+type FeeEstimator interface {
+	// EstimateFee returns the fee rate, in satoshis per virtual byte,
+	// required for a transaction to be mined within the given number of
+	// blocks.
+	EstimateFee(blocks int) (int64, error)
+}
+
+// ErrTransactionNotMined is returned by a TransactionProver when a
+// transaction is waiting to be mined.
+var ErrTransactionNotMined = errors.New("transaction not mined")
+
+// TransactionProof proves that a transaction is included in a block.
+type TransactionProof struct {
+	// The transaction serialized without witness data, whose double
+	// SHA-256 hash is the transaction ID.
+	Raw []byte
+
+	// The height and the Unix time of the block containing the
+	// transaction.
+	BlockHeight int64
+	BlockTime   int64
+
+	// The Merkle root of the block, in the byte order of block headers.
+	MerkleRoot chainhash.Hash
+
+	// The index of the transaction in the block and the hashes of its
+	// siblings in the Merkle tree of the block, from the transaction up.
+	Index        int
+	MerkleBranch []chainhash.Hash
+}
+
+// TransactionProver is able to prove that a transaction was mined.
+type TransactionProver interface {
+	// TransactionProof returns the inclusion proof of a mined transaction.
+	// It returns github.com/stratumn/sdk/blockchain.ErrTransactionNotFound
+	// if the transaction does not exist, and ErrTransactionNotMined if it
+	// is not in a block yet.
+	TransactionProof(txid types.TransactionID) (*TransactionProof, error)
+}
+
+// MerkleRootReader is able to read the Merkle roots of block headers, which
+// is needed to check that an attested message is really in the chain.
+type MerkleRootReader interface {
+	// BlockMerkleRoot returns the Merkle root of the block at a height, in
+	// the byte order of block headers.
+	BlockMerkleRoot(height int64) (chainhash.Hash, error)
+}
+
+// MerkleBranch computes the Merkle root of the transactions of a block and the
+// branch of the transaction at the given index. The last hash of a level with
+// an odd number of hashes is paired with itself.
+func MerkleBranch(txHashes []chainhash.Hash, index int) (root chainhash.Hash, branch []chainhash.Hash) {
+	level := append([]chainhash.Hash(nil), txHashes...)
+
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+
+		branch = append(branch, level[index^1])
+		index /= 2
+
+		next := make([]chainhash.Hash, len(level)/2)
+		for i := range next {
+			next[i] = chainhash.DoubleHashH(append(level[2*i][:], level[2*i+1][:]...))
+		}
+		level = next
+	}
+
+	if len(level) == 1 {
+		root = level[0]
+	}
+
+	return root, branch
+}
@@ -14,7 +14,12 @@
 
 package btc
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
 
 func TestNetworkString(t *testing.T) {
 	if got, want := NetworkTest3.String(), "bitcoin:test3"; got != want {
@@ -30,3 +35,79 @@ func TestNetworkID(t *testing.T) {
 		t.Errorf(`NetworkTest3.String() = "%x" want "%x"`, got, want)
 	}
 }
+
+func TestNetworkParams(t *testing.T) {
+	if got, want := NetworkRegtest.Params().Name, "regtest"; got != want {
+		t.Errorf("NetworkRegtest.Params().Name = %s want %s", got, want)
+	}
+	if got, want := NetworkSimnet.ID(), byte(0x3f); got != want {
+		t.Errorf(`NetworkSimnet.ID() = "%x" want "%x"`, got, want)
+	}
+	if got := Network("bitcoin:unknown").Params(); got != nil {
+		t.Errorf("Network.Params() = %v want nil", got)
+	}
+}
+
+func TestNetworkFromWIF(t *testing.T) {
+	tests := []struct {
+		wif     string
+		network Network
+	}{
+		{"924v2d7ryXJjnbwB6M9GsZDEjAkfE9aHeQAG1j8muA4UEjozeAJ", NetworkTest3},
+		{"L3Wbnfn57Fc547FLSkm6iCzAaHmLArNUBCYx6q8LdxWoEMoFZmLH", NetworkMain},
+	}
+	for _, tt := range tests {
+		wif, err := btcutil.DecodeWIF(tt.wif)
+		if err != nil {
+			t.Fatalf("btcutil.DecodeWIF(): err: %s", err)
+		}
+		got, err := NetworkFromWIF(wif)
+		if err != nil {
+			t.Fatalf("NetworkFromWIF(): err: %s", err)
+		}
+		if got != tt.network {
+			t.Errorf("NetworkFromWIF(%s) = %s want %s", tt.wif, got, tt.network)
+		}
+	}
+}
+
+func TestMerkleBranch(t *testing.T) {
+	// Transactions of block 100000.
+	var txHashes []chainhash.Hash
+	for _, txid := range []string{
+		"8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87",
+		"fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4",
+		"6359f0868171b1d194cbee1af2f16ea598ae8fad666d9b012c8ed2b79a236ec4",
+		"e9a66845e05d5abc0ad04ec80f774a7e585c6e8db975962d069a522137b80c1d",
+	} {
+		hash, _ := chainhash.NewHashFromStr(txid)
+		txHashes = append(txHashes, *hash)
+	}
+
+	for index := range txHashes {
+		root, branch := MerkleBranch(txHashes, index)
+		if got, want := root.String(), "f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766"; got != want {
+			t.Errorf("MerkleBranch(): root = %s want %s", got, want)
+		}
+
+		// Climb the branch back to the root.
+		hash, i := txHashes[index], index
+		for _, sibling := range branch {
+			if i%2 == 0 {
+				hash = chainhash.DoubleHashH(append(hash[:], sibling[:]...))
+			} else {
+				hash = chainhash.DoubleHashH(append(sibling[:], hash[:]...))
+			}
+			i /= 2
+		}
+		if hash != root {
+			t.Errorf("MerkleBranch(%d): branch leads to %s want %s", index, hash, root)
+		}
+	}
+
+	// The last transaction of an odd level is paired with itself.
+	root, _ := MerkleBranch(txHashes[:3], 2)
+	if got, want := root.String(), "fa435470825de273081dcc706b25514c936fa6dc80ab965ce6970d68ddd0b553"; got != want {
+		t.Errorf("MerkleBranch(): root = %s want %s", got, want)
+	}
+}
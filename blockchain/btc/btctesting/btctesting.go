@@ -16,8 +16,8 @@
 package btctesting
 
 import (
+	"github.com/btcsuite/btcutil"
 	"github.com/stratumn/sdk/blockchain/btc"
-	"github.com/stratumn/sdk/types"
 )
 
 // Mock is used to mock a UnspentFinder and Broadcaster.
@@ -37,19 +37,19 @@ type MockFindUnspent struct {
 	CalledCount int
 
 	// The address that was passed to each call.
-	CalledWithAddress []*types.ReversedBytes20
+	CalledWithAddress []btcutil.Address
 
 	// The amount that was passed to each call.
 	CalledWithAmount []int64
 
 	// The last address that was passed.
-	LastCalledWithAddress *types.ReversedBytes20
+	LastCalledWithAddress btcutil.Address
 
 	// The last amount that was passed.
 	LastCalledWithAmount int64
 
 	// An optional implementation of the function.
-	Fn func(*types.ReversedBytes20, int64) ([]btc.Output, int64, error)
+	Fn func(btcutil.Address, int64) ([]btc.Output, int64, error)
 }
 
 // MockBroadcast mocks the Broadcast function.
@@ -69,7 +69,7 @@ type MockBroadcast struct {
 
 // FindUnspent implements
 // github.com/stratumn/sdk/blockchain/btc.UnspentFinder.FindUnspent.
-func (a *Mock) FindUnspent(address *types.ReversedBytes20, amount int64) ([]btc.Output, int64, error) {
+func (a *Mock) FindUnspent(address btcutil.Address, amount int64) ([]btc.Output, int64, error) {
 	a.MockFindUnspent.CalledCount++
 	a.MockFindUnspent.CalledWithAddress = append(a.MockFindUnspent.CalledWithAddress, address)
 	a.MockFindUnspent.LastCalledWithAddress = address
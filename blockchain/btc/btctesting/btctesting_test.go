@@ -19,32 +19,30 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/btcsuite/btcutil"
 	"github.com/stratumn/sdk/blockchain/btc"
 	"github.com/stratumn/sdk/testutil"
-	"github.com/stratumn/sdk/types"
 )
 
 func TestMockFindUnspent(t *testing.T) {
 	a := &Mock{}
 
-	var addr1 types.ReversedBytes20
-	copy(addr1[:], testutil.RandomHash()[:])
-	if _, _, err := a.FindUnspent(&addr1, 1000); err != nil {
+	addr1, _ := btcutil.NewAddressPubKeyHash(testutil.RandomHash()[:20], btc.NetworkTest3.Params())
+	if _, _, err := a.FindUnspent(addr1, 1000); err != nil {
 		t.Fatalf("a.FindUnspent(): err: %s", err)
 	}
 
-	a.MockFindUnspent.Fn = func(*types.ReversedBytes20, int64) ([]btc.Output, int64, error) { return nil, 10000, nil }
+	a.MockFindUnspent.Fn = func(btcutil.Address, int64) ([]btc.Output, int64, error) { return nil, 10000, nil }
 
-	var addr2 types.ReversedBytes20
-	copy(addr2[:], testutil.RandomHash()[:])
-	if _, _, err := a.FindUnspent(&addr2, 2000); err != nil {
+	addr2, _ := btcutil.NewAddressPubKeyHash(testutil.RandomHash()[:20], btc.NetworkTest3.Params())
+	if _, _, err := a.FindUnspent(addr2, 2000); err != nil {
 		t.Errorf("a.FindUnspent(): err: %s", err)
 	}
 
 	if got, want := a.MockFindUnspent.CalledCount, 2; got != want {
 		t.Errorf(`a.MockFindUnspent.CalledCount = %d want %d`, got, want)
 	}
-	got, want := a.MockFindUnspent.CalledWithAddress, []*types.ReversedBytes20{&addr1, &addr2}
+	got, want := a.MockFindUnspent.CalledWithAddress, []btcutil.Address{addr1, addr2}
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf(`a.MockFindUnspent.CalledWithAddress = %q want %q`, got, want)
 	}
@@ -0,0 +1,526 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btctesting
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/types"
+)
+
+// harnessGenesisTime is the Unix time of the genesis block of the harness.
+const harnessGenesisTime = 1500000000
+
+const harnessEngineFlags = txscript.ScriptBip16 | txscript.ScriptVerifyDERSignatures |
+	txscript.ScriptStrictMultiSig | txscript.ScriptDiscourageUpgradableNops |
+	txscript.ScriptVerifyWitness | txscript.ScriptVerifyStrictEncoding
+
+// Harness simulates the UTXO set and the mining of a Bitcoin network
+// in-process. Transactions are validated, including their scripts, when they
+// are broadcast and stay in the mempool until Mine is called. Transactions in
+// the mempool that signal replace-by-fee can be replaced by transactions
+// paying a higher fee.
+//
+// It implements github.com/stratumn/sdk/blockchain/btc.UnspentFinder,
+// github.com/stratumn/sdk/blockchain/btc.Broadcaster,
+// github.com/stratumn/sdk/blockchain/btc.FeeEstimator,
+// github.com/stratumn/sdk/blockchain/btc.TransactionProver and
+// github.com/stratumn/sdk/blockchain.ChainQuerier.
+type Harness struct {
+	network btc.Network
+	mu      sync.Mutex
+	utxos   map[wire.OutPoint]*wire.TxOut
+	txs     map[chainhash.Hash]*harnessTx
+	height  int64
+	feeRate int64
+}
+
+type harnessTx struct {
+	tx *wire.MsgTx
+
+	// The height of the block containing the transaction, zero if it is
+	// in the mempool.
+	height int64
+
+	// The outputs spent by the transaction.
+	spent map[wire.OutPoint]*wire.TxOut
+
+	// The fee paid by the transaction.
+	fee int64
+}
+
+// NewHarness creates a harness for a network, typically btc.NetworkRegtest
+// or btc.NetworkSimnet.
+func NewHarness(network btc.Network) *Harness {
+	return &Harness{
+		network: network,
+		utxos:   map[wire.OutPoint]*wire.TxOut{},
+		txs:     map[chainhash.Hash]*harnessTx{},
+	}
+}
+
+// Fund mines a block with a coinbase transaction paying the given amount to
+// an address.
+func (h *Harness) Fund(address btcutil.Address, amount int64) error {
+	PKScript, err := h.payToAddrScript(address)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// The height makes the hash of the coinbase transaction unique.
+	sigScript := make([]byte, 8)
+	binary.LittleEndian.PutUint64(sigScript, uint64(h.height+1))
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), sigScript, nil))
+	tx.AddTxOut(wire.NewTxOut(amount, PKScript))
+
+	h.accept(tx, nil)
+	h.mine(1)
+
+	return nil
+}
+
+// FindUnspent implements
+// github.com/stratumn/sdk/blockchain/btc.UnspentFinder.FindUnspent.
+// Unconfirmed outputs are included.
+func (h *Harness) FindUnspent(address btcutil.Address, amount int64) ([]btc.Output, int64, error) {
+	PKScript, err := h.payToAddrScript(address)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var (
+		outputs []btc.Output
+		total   int64
+	)
+
+	for _, outPoint := range h.sortedOutPoints() {
+		txOut := h.utxos[outPoint]
+		if !bytes.Equal(txOut.PkScript, PKScript) {
+			continue
+		}
+
+		output := btc.Output{PKScript: txOut.PkScript, Index: int(outPoint.Index), Value: txOut.Value}
+		copy(output.TXHash[:], outPoint.Hash[:])
+		outputs = append(outputs, output)
+
+		total += txOut.Value
+		if total >= amount {
+			return outputs, total, nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("Not enough Bitcoins available, expected at least %d satoshis got %d", amount, total)
+}
+
+// Broadcast implements
+// github.com/stratumn/sdk/blockchain/btc.Broadcaster.Broadcast.
+func (h *Harness) Broadcast(raw []byte) error {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.txs[tx.TxHash()]; ok {
+		return fmt.Errorf("transaction %s already exists", tx.TxHash())
+	}
+
+	var totalIn, totalOut int64
+	sigHashes := txscript.NewTxSigHashes(tx)
+	spent := map[wire.OutPoint]*wire.TxOut{}
+	conflicts := map[chainhash.Hash]*harnessTx{}
+	for i, txIn := range tx.TxIn {
+		prevOut, ok := h.utxos[txIn.PreviousOutPoint]
+		if !ok {
+			conflict := h.findSpender(txIn.PreviousOutPoint)
+			if conflict == nil {
+				return fmt.Errorf("input %d spends a missing or spent output", i)
+			}
+			conflicts[conflict.tx.TxHash()] = conflict
+			prevOut = conflict.spent[txIn.PreviousOutPoint]
+		}
+		vm, err := txscript.NewEngine(prevOut.PkScript, tx, i, harnessEngineFlags, nil, sigHashes, prevOut.Value)
+		if err != nil {
+			return err
+		}
+		if err := vm.Execute(); err != nil {
+			return fmt.Errorf("input %d: %s", i, err)
+		}
+		spent[txIn.PreviousOutPoint] = prevOut
+		totalIn += prevOut.Value
+	}
+	for _, txOut := range tx.TxOut {
+		totalOut += txOut.Value
+	}
+	if totalOut > totalIn {
+		return fmt.Errorf("outputs (%d) exceed inputs (%d)", totalOut, totalIn)
+	}
+
+	fee := totalIn - totalOut
+	if len(conflicts) > 0 {
+		// Follow the main rules of BIP 125: the replaced transactions
+		// must signal replaceability and the replacement must pay for
+		// them and for its own relay at one satoshi per byte.
+		var replacedFees int64
+		for hash, conflict := range conflicts {
+			if !signalsReplacement(conflict.tx) {
+				return fmt.Errorf("transaction %s conflicts with %s which does not signal replace-by-fee", tx.TxHash(), hash)
+			}
+			replacedFees += conflict.fee
+		}
+		vsize := (tx.SerializeSizeStripped()*3 + tx.SerializeSize() + 3) / 4
+		if minFee := replacedFees + int64(vsize); fee < minFee {
+			return fmt.Errorf("replacement transaction fee %d is less than %d", fee, minFee)
+		}
+		for _, conflict := range conflicts {
+			h.drop(conflict)
+		}
+	}
+
+	h.accept(tx, spent)
+	h.txs[tx.TxHash()].fee = fee
+
+	return nil
+}
+
+// SetFeeRate sets the fee rate returned by EstimateFee, in satoshis per
+// virtual byte. If it is zero, EstimateFee returns an error like a node
+// which does not have enough data yet.
+func (h *Harness) SetFeeRate(rate int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.feeRate = rate
+}
+
+// EstimateFee implements
+// github.com/stratumn/sdk/blockchain/btc.FeeEstimator.EstimateFee.
+func (h *Harness) EstimateFee(blocks int) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.feeRate <= 0 {
+		return 0, errors.New("no fee rate available")
+	}
+	return h.feeRate, nil
+}
+
+// Fee returns the fee paid by an accepted transaction.
+func (h *Harness) Fee(txid types.TransactionID) (int64, bool) {
+	hash, err := chainhash.NewHashFromStr(txid.String())
+	if err != nil {
+		return 0, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if htx, ok := h.txs[*hash]; ok {
+		return htx.fee, true
+	}
+	return 0, false
+}
+
+// TransactionStatus implements
+// github.com/stratumn/sdk/blockchain.ChainQuerier.TransactionStatus.
+func (h *Harness) TransactionStatus(txid types.TransactionID) (*blockchain.TransactionStatus, error) {
+	hash, err := chainhash.NewHashFromStr(txid.String())
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	htx, ok := h.txs[*hash]
+	if !ok {
+		return nil, blockchain.ErrTransactionNotFound
+	}
+	if htx.height == 0 {
+		return &blockchain.TransactionStatus{}, nil
+	}
+
+	return &blockchain.TransactionStatus{
+		Mined:         true,
+		BlockHash:     blockHash(htx.height),
+		BlockHeight:   uint64(htx.height),
+		Confirmations: uint64(h.height - htx.height + 1),
+	}, nil
+}
+
+// Transaction returns an accepted transaction given its ID as returned by
+// github.com/stratumn/sdk/blockchain/btc/btctimestamper.
+func (h *Harness) Transaction(txid types.TransactionID) (*wire.MsgTx, bool) {
+	hash, err := chainhash.NewHashFromStr(txid.String())
+	if err != nil {
+		return nil, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if htx, ok := h.txs[*hash]; ok {
+		return htx.tx, true
+	}
+	return nil, false
+}
+
+// TransactionProof implements
+// github.com/stratumn/sdk/blockchain/btc.TransactionProver.TransactionProof.
+// The transactions of a block are ordered by hash.
+func (h *Harness) TransactionProof(txid types.TransactionID) (*btc.TransactionProof, error) {
+	hash, err := chainhash.NewHashFromStr(txid.String())
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	htx, ok := h.txs[*hash]
+	if !ok {
+		return nil, blockchain.ErrTransactionNotFound
+	}
+	if htx.height == 0 {
+		return nil, btc.ErrTransactionNotMined
+	}
+
+	var raw bytes.Buffer
+	if err := htx.tx.SerializeNoWitness(&raw); err != nil {
+		return nil, err
+	}
+
+	txHashes := h.blockTxHashes(htx.height)
+	proof := &btc.TransactionProof{
+		Raw:         raw.Bytes(),
+		BlockHeight: htx.height,
+		BlockTime:   blockTime(htx.height),
+	}
+	for i, txHash := range txHashes {
+		if txHash == *hash {
+			proof.Index = i
+		}
+	}
+	proof.MerkleRoot, proof.MerkleBranch = btc.MerkleBranch(txHashes, proof.Index)
+
+	return proof, nil
+}
+
+// MerkleRoot returns the Merkle root of the block at a height, as it would
+// appear in its header.
+func (h *Harness) MerkleRoot(height int64) chainhash.Hash {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	root, _ := btc.MerkleBranch(h.blockTxHashes(height), 0)
+	return root
+}
+
+// BlockMerkleRoot implements
+// github.com/stratumn/sdk/blockchain/btc.MerkleRootReader.BlockMerkleRoot.
+func (h *Harness) BlockMerkleRoot(height int64) (chainhash.Hash, error) {
+	if height < 1 || height > h.Height() {
+		return chainhash.Hash{}, fmt.Errorf("block %d not found", height)
+	}
+	return h.MerkleRoot(height), nil
+}
+
+// blockTxHashes returns the hashes of the transactions of the block at a
+// height, ordered by hash.
+func (h *Harness) blockTxHashes(height int64) []chainhash.Hash {
+	var txHashes []chainhash.Hash
+	for txHash, htx := range h.txs {
+		if htx.height == height {
+			txHashes = append(txHashes, txHash)
+		}
+	}
+	sort.Slice(txHashes, func(i, j int) bool {
+		return bytes.Compare(txHashes[i][:], txHashes[j][:]) < 0
+	})
+	return txHashes
+}
+
+// Mine mines blocks. The first block includes the transactions in the
+// mempool.
+func (h *Harness) Mine(blocks int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mine(blocks)
+}
+
+// Height returns the height of the chain.
+func (h *Harness) Height() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.height
+}
+
+// Balance returns the sum of the unspent outputs of an address.
+func (h *Harness) Balance(address btcutil.Address) int64 {
+	PKScript, err := h.payToAddrScript(address)
+	if err != nil {
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var balance int64
+	for _, txOut := range h.utxos {
+		if bytes.Equal(txOut.PkScript, PKScript) {
+			balance += txOut.Value
+		}
+	}
+	return balance
+}
+
+// Drop removes a transaction, as if its block was orphaned and it was
+// evicted from the mempool. The outputs it spent become unspent again.
+// Transactions spending its outputs are not dropped.
+func (h *Harness) Drop(txid types.TransactionID) {
+	hash, err := chainhash.NewHashFromStr(txid.String())
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if htx, ok := h.txs[*hash]; ok {
+		h.drop(htx)
+	}
+}
+
+func (h *Harness) accept(tx *wire.MsgTx, spent map[wire.OutPoint]*wire.TxOut) {
+	hash := tx.TxHash()
+	for outPoint := range spent {
+		delete(h.utxos, outPoint)
+	}
+	for i, txOut := range tx.TxOut {
+		// Null data outputs are provably unspendable.
+		if txscript.GetScriptClass(txOut.PkScript) == txscript.NullDataTy {
+			continue
+		}
+		h.utxos[wire.OutPoint{Hash: hash, Index: uint32(i)}] = txOut
+	}
+	h.txs[hash] = &harnessTx{tx: tx, spent: spent}
+}
+
+func (h *Harness) drop(htx *harnessTx) {
+	hash := htx.tx.TxHash()
+	delete(h.txs, hash)
+	for i := range htx.tx.TxOut {
+		delete(h.utxos, wire.OutPoint{Hash: hash, Index: uint32(i)})
+	}
+	for outPoint, txOut := range htx.spent {
+		h.utxos[outPoint] = txOut
+	}
+}
+
+// findSpender returns the transaction in the mempool spending an output.
+func (h *Harness) findSpender(outPoint wire.OutPoint) *harnessTx {
+	for _, htx := range h.txs {
+		if htx.height != 0 {
+			continue
+		}
+		if _, ok := htx.spent[outPoint]; ok {
+			return htx
+		}
+	}
+	return nil
+}
+
+// signalsReplacement returns whether a transaction signals replace-by-fee as
+// defined by BIP 125.
+func signalsReplacement(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence < wire.MaxTxInSequenceNum-1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Harness) mine(blocks int) {
+	if blocks <= 0 {
+		return
+	}
+	h.height++
+	for _, htx := range h.txs {
+		if htx.height == 0 {
+			htx.height = h.height
+		}
+	}
+	h.height += int64(blocks - 1)
+}
+
+func (h *Harness) sortedOutPoints() []wire.OutPoint {
+	outPoints := make([]wire.OutPoint, 0, len(h.utxos))
+	for outPoint := range h.utxos {
+		outPoints = append(outPoints, outPoint)
+	}
+	sort.Slice(outPoints, func(i, j int) bool {
+		if c := bytes.Compare(outPoints[i].Hash[:], outPoints[j].Hash[:]); c != 0 {
+			return c < 0
+		}
+		return outPoints[i].Index < outPoints[j].Index
+	})
+	return outPoints
+}
+
+func (h *Harness) payToAddrScript(address btcutil.Address) ([]byte, error) {
+	params := h.network.Params()
+	if params == nil {
+		return nil, btc.ErrUnsupportedNetwork
+	}
+	if !address.IsForNet(params) {
+		return nil, fmt.Errorf("address %s is not for network %s", address, h.network)
+	}
+	return txscript.PayToAddrScript(address)
+}
+
+// blockTime returns the Unix time of the block at a height, ten minutes after
+// the previous one.
+func blockTime(height int64) int64 {
+	return harnessGenesisTime + height*600
+}
+
+func blockHash(height int64) *types.Bytes32 {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(height))
+	hash := types.Bytes32(sha256.Sum256(b[:]))
+	return &hash
+}
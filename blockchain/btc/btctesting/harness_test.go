@@ -0,0 +1,183 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package btctesting
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/btctimestamper"
+	"github.com/stratumn/sdk/testutil"
+)
+
+func newHarnessTimestamper(t *testing.T) (*Harness, *btctimestamper.Timestamper, btcutil.Address) {
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("btcec.NewPrivateKey(): err: %s", err)
+	}
+	wif, err := btcutil.NewWIF(privKey, btc.NetworkRegtest.Params(), false)
+	if err != nil {
+		t.Fatalf("btcutil.NewWIF(): err: %s", err)
+	}
+
+	h := NewHarness(btc.NetworkRegtest)
+	ts, err := btctimestamper.New(&btctimestamper.Config{
+		UnspentFinder: h,
+		Broadcaster:   h,
+		WIF:           wif.String(),
+		Network:       btc.NetworkRegtest,
+		Fee:           10000,
+	})
+	if err != nil {
+		t.Fatalf("btctimestamper.New(): err: %s", err)
+	}
+
+	return h, ts, ts.Address()
+}
+
+func TestHarness_TimestampHash(t *testing.T) {
+	h, ts, address := newHarnessTimestamper(t)
+	if err := h.Fund(address, 100000); err != nil {
+		t.Fatalf("h.Fund(): err: %s", err)
+	}
+
+	hash := testutil.RandomHash()
+	txid, err := ts.TimestampHash(hash)
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	tx, ok := h.Transaction(txid)
+	if !ok {
+		t.Fatalf("h.Transaction(): transaction %s not found", txid)
+	}
+	if !bytes.Contains(tx.TxOut[1].PkScript, hash[:]) {
+		t.Errorf("tx.TxOut[1].PkScript = %x want it to contain %s", tx.TxOut[1].PkScript, hash)
+	}
+	if got, want := h.Balance(address), int64(90000); got != want {
+		t.Errorf("h.Balance() = %d want %d", got, want)
+	}
+
+	status, err := h.TransactionStatus(txid)
+	if err != nil {
+		t.Fatalf("h.TransactionStatus(): err: %s", err)
+	}
+	if status.Mined {
+		t.Error("status.Mined = true want false")
+	}
+
+	h.Mine(3)
+	if status, err = h.TransactionStatus(txid); err != nil {
+		t.Fatalf("h.TransactionStatus(): err: %s", err)
+	}
+	if !status.Mined {
+		t.Error("status.Mined = false want true")
+	}
+	if got, want := status.Confirmations, uint64(3); got != want {
+		t.Errorf("status.Confirmations = %d want %d", got, want)
+	}
+	if got, want := status.BlockHeight, uint64(2); got != want {
+		t.Errorf("status.BlockHeight = %d want %d", got, want)
+	}
+
+	// Spend the unconfirmed change output.
+	if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	if got, want := h.Balance(address), int64(80000); got != want {
+		t.Errorf("h.Balance() = %d want %d", got, want)
+	}
+}
+
+func TestHarness_multipleInputs(t *testing.T) {
+	h, ts, address := newHarnessTimestamper(t)
+	for i := 0; i < 3; i++ {
+		if err := h.Fund(address, 4000); err != nil {
+			t.Fatalf("h.Fund(): err: %s", err)
+		}
+	}
+
+	txid, err := ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	tx, _ := h.Transaction(txid)
+	if got, want := len(tx.TxIn), 3; got != want {
+		t.Errorf("len(tx.TxIn) = %d want %d", got, want)
+	}
+}
+
+func TestHarness_Broadcast_doubleSpend(t *testing.T) {
+	h, ts, address := newHarnessTimestamper(t)
+	if err := h.Fund(address, 10000); err != nil {
+		t.Fatalf("h.Fund(): err: %s", err)
+	}
+
+	// The whole balance is spent as fee, nothing is left for a second
+	// transaction.
+	if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	if _, err := ts.TimestampHash(testutil.RandomHash()); err == nil {
+		t.Error("ts.TimestampHash(): err = nil want Error")
+	}
+}
+
+func TestHarness_Broadcast_invalid(t *testing.T) {
+	h := NewHarness(btc.NetworkRegtest)
+	if err := h.Broadcast([]byte("invalid")); err == nil {
+		t.Error("h.Broadcast(): err = nil want Error")
+	}
+}
+
+func TestHarness_Drop(t *testing.T) {
+	h, ts, address := newHarnessTimestamper(t)
+	if err := h.Fund(address, 100000); err != nil {
+		t.Fatalf("h.Fund(): err: %s", err)
+	}
+
+	txid, err := ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	h.Drop(txid)
+
+	if _, err := h.TransactionStatus(txid); err != blockchain.ErrTransactionNotFound {
+		t.Errorf("h.TransactionStatus(): err = %v want %s", err, blockchain.ErrTransactionNotFound)
+	}
+	if got, want := h.Balance(address), int64(100000); got != want {
+		t.Errorf("h.Balance() = %d want %d", got, want)
+	}
+}
+
+func TestHarness_EstimateFee(t *testing.T) {
+	h := NewHarness(btc.NetworkRegtest)
+	if _, err := h.EstimateFee(6); err == nil {
+		t.Error("h.EstimateFee(): err = nil want Error")
+	}
+
+	h.SetFeeRate(42)
+	rate, err := h.EstimateFee(6)
+	if err != nil {
+		t.Fatalf("h.EstimateFee(): err: %s", err)
+	}
+	if got, want := rate, int64(42); got != want {
+		t.Errorf("h.EstimateFee() = %d want %d", got, want)
+	}
+}
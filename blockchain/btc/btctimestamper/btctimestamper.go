@@ -18,8 +18,12 @@ package btctimestamper
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"sync"
+	"sync/atomic"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -29,7 +33,12 @@ import (
 	"github.com/btcsuite/btcutil"
 	"github.com/stratumn/sdk/blockchain"
 	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/hdwallet"
+	"github.com/stratumn/sdk/blockchain/btc/utxo"
+	"github.com/stratumn/sdk/store"
 	"github.com/stratumn/sdk/types"
+
+	log "github.com/sirupsen/logrus"
 )
 
 const (
@@ -38,6 +47,102 @@ const (
 
 	// Description describes this Timestamper
 	Description = "Bitcoin Timestamper"
+
+	// DefaultFeeTarget is the default number of blocks within which
+	// transactions should be mined when estimating fees.
+	DefaultFeeTarget = 6
+
+	// DefaultMinFeeRate is the default floor of estimated fee rates, in
+	// satoshis per virtual byte.
+	DefaultMinFeeRate = int64(1)
+
+	// DefaultMaxFeeRate is the default ceiling of fee rates, in satoshis
+	// per virtual byte.
+	DefaultMaxFeeRate = int64(500)
+
+	// IncrementalFeeRate is the minimum increase of the fee rate of a
+	// replacement transaction, in satoshis per virtual byte, as required
+	// by the default relay policy of nodes.
+	IncrementalFeeRate = int64(1)
+
+	// FeeBumpPercent is the minimum increase of the fee of a replacement
+	// transaction, in percent of the fee of the replaced transaction.
+	FeeBumpPercent = 25
+
+	// rbfSequence is the sequence number of inputs of transactions which
+	// signal replace-by-fee (BIP 125).
+	rbfSequence = wire.MaxTxInSequenceNum - 2
+
+	// minTxSize is a lower bound of the virtual size of a transaction
+	// with one input, a change output and a null data output, used as a
+	// first estimate before finding unspent outputs.
+	minTxSize = 150
+
+	// maxPendingTxs is the number of transactions whose fee can be bumped.
+	maxPendingTxs = 1000
+
+	// dustLimit is the value under which nodes do not relay outputs.
+	dustLimit = 546
+)
+
+// AddressType is the type of the address of the timestamper, which determines
+// how its outputs are spent.
+type AddressType string
+
+const (
+	// AddressP2PKH is a legacy pay-to-pubkey-hash address. The public key
+	// is compressed if the WIF encoded key says so.
+	AddressP2PKH AddressType = "p2pkh"
+
+	// AddressP2SHP2WPKH is a pay-to-witness-pubkey-hash address nested in
+	// a pay-to-script-hash address, for backends which do not support
+	// native segwit addresses.
+	AddressP2SHP2WPKH AddressType = "p2sh-p2wpkh"
+
+	// AddressP2WPKH is a native segwit pay-to-witness-pubkey-hash address.
+	AddressP2WPKH AddressType = "p2wpkh"
+)
+
+// purpose returns the BIP43 purpose of the derivation path of keys of the
+// address type.
+func (t AddressType) purpose() uint32 {
+	switch t {
+	case AddressP2SHP2WPKH:
+		return hdwallet.PurposeBIP49
+	case AddressP2WPKH:
+		return hdwallet.PurposeBIP84
+	}
+	return hdwallet.PurposeBIP44
+}
+
+var (
+	// ErrRBFDisabled is returned when bumping a fee while replace-by-fee is
+	// disabled.
+	ErrRBFDisabled = errors.New("replace-by-fee is disabled")
+
+	// ErrUnknownTransaction is returned when bumping the fee of a
+	// transaction that was not sent by the timestamper.
+	ErrUnknownTransaction = errors.New("unknown transaction")
+
+	// ErrMaxFeeRate is returned when bumping a fee would exceed the maximum
+	// fee rate.
+	ErrMaxFeeRate = errors.New("maximum fee rate reached")
+
+	// ErrNoUTXOStore is returned when querying the balance of a timestamper
+	// which does not track its unspent outputs.
+	ErrNoUTXOStore = errors.New("unspent outputs are not tracked")
+
+	// ErrKeySource is returned when the configuration does not contain
+	// exactly one of a WIF encoded key, an extended key or a mnemonic.
+	ErrKeySource = errors.New("exactly one of a WIF encoded key, an extended key or a mnemonic is required")
+
+	// ErrNoWallet is returned when rotating a key which was not derived
+	// from an extended key or a mnemonic.
+	ErrNoWallet = errors.New("key rotation requires an extended key or a mnemonic")
+
+	// ErrRotationTracked is returned when rotating keys while unspent
+	// outputs are tracked, since the tracker follows a single address.
+	ErrRotationTracked = errors.New("key rotation is not supported when unspent outputs are tracked")
 )
 
 // Config contains configuration options for the timestamper.
@@ -51,53 +156,347 @@ type Config struct {
 	// A wallet import format key.
 	WIF string
 
-	// Transaction fee
+	// A master extended private key, used instead of a WIF encoded key.
+	// Keys are derived from KeyPath.
+	ExtendedKey string
+
+	// A BIP39 mnemonic and its optional passphrase, used instead of a WIF
+	// encoded key. Keys are derived from KeyPath. Requires the network.
+	Mnemonic           string
+	MnemonicPassphrase string
+
+	// The derivation path of the keys of an extended key or a mnemonic.
+	// Defaults to the BIP44, BIP49 or BIP84 path of the address type, for
+	// instance m/84'/0'/0'/0 for native segwit addresses on mainnet.
+	KeyPath string
+
+	// The index of the current key in the derivation path.
+	KeyIndex uint32
+
+	// The number of transactions after which a derived key is rotated.
+	// The change of the last transaction is sent to the address of the key
+	// at the next index, which is used from then on. Zero disables
+	// automatic rotation.
+	RotateAfter int
+
+	// An optional function called with the index of the new key after a
+	// rotation, to persist it.
+	OnRotate func(index uint32)
+
+	// The Bitcoin network. Optional unless the key is for regtest, which
+	// uses the same prefix as testnet3, or is a mnemonic. Defaults to the
+	// network of the key.
+	Network btc.Network
+
+	// The type of the address of the key. Segwit addresses always use the
+	// compressed public key. Defaults to AddressP2PKH.
+	AddressType AddressType
+
+	// Transaction fee, used when there is no fee estimator or when the
+	// estimation fails.
 	Fee int64
+
+	// An optional fee estimator. If set, the fee of a transaction is its
+	// virtual size times the estimated fee rate.
+	FeeEstimator btc.FeeEstimator
+
+	// The number of blocks within which transactions should be mined when
+	// estimating fees.
+	FeeTarget int
+
+	// The floor and the ceiling of fee rates, in satoshis per virtual byte.
+	// The ceiling also limits fee bumps.
+	MinFeeRate int64
+	MaxFeeRate int64
+
+	// Whether transactions signal replace-by-fee (BIP 125), which is
+	// required to bump their fee.
+	RBF bool
+
+	// An optional store in which the unspent outputs of the address are
+	// tracked. If set, the unspent finder and the broadcaster are wrapped
+	// in a github.com/stratumn/sdk/blockchain/btc/utxo.Tracker, which
+	// requires a chain querier.
+	UTXOStore store.KeyValueStore
+
+	// The chain querier used by the UTXO tracker.
+	ChainQuerier blockchain.ChainQuerier
+}
+
+// GetFeeTarget returns the configuration's fee target or the default value.
+func (c *Config) GetFeeTarget() int {
+	if c.FeeTarget > 0 {
+		return c.FeeTarget
+	}
+	return DefaultFeeTarget
+}
+
+// GetMinFeeRate returns the configuration's minimum fee rate or the default
+// value.
+func (c *Config) GetMinFeeRate() int64 {
+	if c.MinFeeRate > 0 {
+		return c.MinFeeRate
+	}
+	return DefaultMinFeeRate
+}
+
+// GetMaxFeeRate returns the configuration's maximum fee rate or the default
+// value.
+func (c *Config) GetMaxFeeRate() int64 {
+	if c.MaxFeeRate > 0 {
+		return c.MaxFeeRate
+	}
+	return DefaultMaxFeeRate
 }
 
 // Timestamper is the type that implements
 // github.com/stratumn/sdk/blockchain.Timestamper.
 type Timestamper struct {
-	config    *Config
-	net       btc.Network
-	netParams *chaincfg.Params
-	privKey   *btcec.PrivateKey
-	pubKey    *btcec.PublicKey
-	address   *btcutil.AddressPubKeyHash
+	config      *Config
+	net         btc.Network
+	netParams   *chaincfg.Params
+	addressType AddressType
+
+	// The wallet from which keys are derived, if any.
+	wallet *hdwallet.Wallet
+
+	// The current key, the number of transactions it sent and whether
+	// it must be rotated by the next transaction.
+	keyMutex sync.Mutex
+	key      *signingKey
+	txCount  int
+	rotate   bool
+
+	finder      btc.UnspentFinder
+	broadcaster btc.Broadcaster
+	tracker     *utxo.Tracker
+
+	// The fee of the last transaction, used to estimate the runway.
+	lastFee int64
+
+	// Transactions that can be replaced, oldest first.
+	pendingMutex sync.Mutex
+	pending      []*pendingTx
+}
+
+// signingKey is a private key and its address.
+type signingKey struct {
+	privKey  *btcec.PrivateKey
+	compress bool
+	address  btcutil.Address
+
+	// The index of a derived key.
+	index uint32
+
+	// The witness program of a P2SH-P2WPKH address.
+	redeemScript []byte
+}
+
+// pendingTx is a transaction sent by the timestamper.
+type pendingTx struct {
+	txid    types.TransactionID
+	hash    *types.Bytes32
+	outputs []btc.Output
+	total   int64
+	fee     int64
+
+	// The key spending the outputs and the key receiving the change.
+	from *signingKey
+	to   *signingKey
 }
 
 // New creates an instance of a Timestamper.
 func New(config *Config) (*Timestamper, error) {
-	WIF, err := btcutil.DecodeWIF(config.WIF)
+	ts := &Timestamper{
+		config:      config,
+		net:         config.Network,
+		addressType: config.AddressType,
+	}
+	if ts.addressType == "" {
+		ts.addressType = AddressP2PKH
+	}
+
+	privKey, compress, err := ts.loadKey()
 	if err != nil {
 		return nil, err
 	}
+	if ts.key, err = ts.newSigningKey(privKey, compress); err != nil {
+		return nil, err
+	}
+	ts.key.index = config.KeyIndex
 
-	ts := &Timestamper{
-		config:  config,
-		privKey: WIF.PrivKey,
-		pubKey:  WIF.PrivKey.PubKey(),
+	ts.finder, ts.broadcaster = config.UnspentFinder, config.Broadcaster
+	if config.UTXOStore != nil {
+		if config.RotateAfter > 0 {
+			return nil, ErrRotationTracked
+		}
+		ts.tracker, err = utxo.New(&utxo.Config{
+			Store:         config.UTXOStore,
+			Address:       ts.key.address,
+			UnspentFinder: config.UnspentFinder,
+			Broadcaster:   config.Broadcaster,
+			ChainQuerier:  config.ChainQuerier,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ts.finder, ts.broadcaster = ts.tracker, ts.tracker
+	}
+
+	return ts, nil
+}
+
+// loadKey returns the private key given by the configuration and whether its
+// public key is compressed. It sets the network of the timestamper and the
+// wallet of derived keys.
+func (ts *Timestamper) loadKey() (*btcec.PrivateKey, bool, error) {
+	config := ts.config
+
+	sources := 0
+	for _, key := range []string{config.WIF, config.ExtendedKey, config.Mnemonic} {
+		if key != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, false, ErrKeySource
 	}
 
-	if WIF.IsForNet(&chaincfg.TestNet3Params) {
-		ts.net = btc.NetworkTest3
-		ts.netParams = &chaincfg.TestNet3Params
-	} else if WIF.IsForNet(&chaincfg.MainNetParams) {
-		ts.net = btc.NetworkMain
-		ts.netParams = &chaincfg.MainNetParams
+	var err error
+	if config.WIF != "" {
+		WIF, err := btcutil.DecodeWIF(config.WIF)
+		if err != nil {
+			return nil, false, err
+		}
+		if ts.net == "" {
+			if ts.net, err = btc.NetworkFromWIF(WIF); err != nil {
+				return nil, false, err
+			}
+		}
+		if ts.netParams = ts.net.Params(); ts.netParams == nil {
+			return nil, false, btc.ErrUnsupportedNetwork
+		}
+		if !WIF.IsForNet(ts.netParams) {
+			return nil, false, fmt.Errorf("WIF encoded key is not for network %s", ts.net)
+		}
+		return WIF.PrivKey, WIF.CompressPubKey, nil
 	}
 
-	if ts.netParams == nil {
-		return nil, errors.New("unsupported network")
+	if ts.net == "" {
+		if config.Mnemonic != "" {
+			return nil, false, errors.New("the network of a mnemonic is required")
+		}
+		if ts.net, err = hdwallet.NetworkFromExtendedKey(config.ExtendedKey); err != nil {
+			return nil, false, err
+		}
+	}
+	if ts.netParams = ts.net.Params(); ts.netParams == nil {
+		return nil, false, btc.ErrUnsupportedNetwork
+	}
+
+	path := config.KeyPath
+	if path == "" {
+		path = hdwallet.DefaultPath(ts.addressType.purpose(), ts.net)
+	}
+	if config.ExtendedKey != "" {
+		if ts.wallet, err = hdwallet.NewFromExtendedKey(config.ExtendedKey, path); err != nil {
+			return nil, false, err
+		}
+		if !ts.wallet.IsForNetwork(ts.net) {
+			return nil, false, fmt.Errorf("extended key is not for network %s", ts.net)
+		}
+	} else {
+		ts.wallet, err = hdwallet.NewFromMnemonic(config.Mnemonic, config.MnemonicPassphrase, ts.net, path)
+		if err != nil {
+			return nil, false, err
+		}
 	}
 
-	pubKeyHash := btcutil.Hash160(ts.pubKey.SerializeUncompressed())
-	ts.address, err = btcutil.NewAddressPubKeyHash(pubKeyHash, ts.netParams)
+	privKey, err := ts.wallet.PrivateKey(config.KeyIndex)
+	if err != nil {
+		return nil, false, err
+	}
+	log.WithField("path", ts.wallet.Path(config.KeyIndex)).Info("Derived Bitcoin timestamper key")
+
+	// Derived keys always use compressed public keys.
+	return privKey, true, nil
+}
+
+// newSigningKey creates a signing key with an address of the type of the
+// timestamper.
+func (ts *Timestamper) newSigningKey(privKey *btcec.PrivateKey, compress bool) (*signingKey, error) {
+	key := &signingKey{
+		privKey:  privKey,
+		compress: compress || ts.addressType != AddressP2PKH,
+	}
+
+	pubKey := privKey.PubKey().SerializeUncompressed()
+	if key.compress {
+		pubKey = privKey.PubKey().SerializeCompressed()
+	}
+	pubKeyHash := btcutil.Hash160(pubKey)
+
+	var err error
+	switch ts.addressType {
+	case AddressP2PKH:
+		key.address, err = btcutil.NewAddressPubKeyHash(pubKeyHash, ts.netParams)
+	case AddressP2WPKH:
+		key.address, err = btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, ts.netParams)
+	case AddressP2SHP2WPKH:
+		var witnessAddr btcutil.Address
+		if witnessAddr, err = btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, ts.netParams); err != nil {
+			return nil, err
+		}
+		if key.redeemScript, err = txscript.PayToAddrScript(witnessAddr); err != nil {
+			return nil, err
+		}
+		key.address, err = btcutil.NewAddressScriptHash(key.redeemScript, ts.netParams)
+	default:
+		return nil, fmt.Errorf("unknown address type %s", ts.addressType)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return ts, nil
+	return key, nil
+}
+
+// Start runs the UTXO tracker, if any, until the context is canceled. The
+// tracker consolidates dust outputs using the timestamper.
+func (ts *Timestamper) Start(ctx context.Context) {
+	if ts.tracker == nil {
+		return
+	}
+	ts.tracker.Start(ctx, ts)
+}
+
+// Address returns the address of the current key, which must be funded.
+// The address changes when the key is rotated.
+func (ts *Timestamper) Address() btcutil.Address {
+	return ts.currentKey().address
+}
+
+// KeyIndex returns the index of the current key in the derivation path.
+func (ts *Timestamper) KeyIndex() uint32 {
+	return ts.currentKey().index
+}
+
+// Rotate rotates the key by the next transaction, which sends its change to
+// the address of the key at the next index of the derivation path.
+// The key must be derived from an extended key or a mnemonic.
+func (ts *Timestamper) Rotate() error {
+	if ts.wallet == nil {
+		return ErrNoWallet
+	}
+	if ts.tracker != nil {
+		return ErrRotationTracked
+	}
+
+	ts.keyMutex.Lock()
+	defer ts.keyMutex.Unlock()
+	ts.rotate = true
+
+	return nil
 }
 
 // Network implements fmt.Stringer.
@@ -117,64 +516,357 @@ func (ts *Timestamper) GetInfo() *blockchain.Info {
 // TimestampHash implements
 // github.com/stratumn/sdk/blockchain.HashTimestamper.
 func (ts *Timestamper) TimestampHash(hash *types.Bytes32) (types.TransactionID, error) {
-	var prevPKScripts [][]byte
+	fee, rate := ts.config.Fee, int64(0)
+	if ts.config.FeeEstimator != nil {
+		var err error
+		if rate, err = ts.estimateFeeRate(); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"fee":   fee,
+			}).Warn("Failed to estimate fee rate, using fixed fee")
+		} else {
+			fee = rate * minTxSize
+		}
+	}
 
-	addr := (*types.ReversedBytes20)(ts.address.Hash160())
-	outputs, total, err := ts.config.UnspentFinder.FindUnspent(addr, ts.config.Fee)
+	// The size of the transaction depends on the number of inputs, which
+	// depends on the fee, so find unspent outputs until they cover the
+	// fee of the signed transaction.
+	from, to, err := ts.keys()
 	if err != nil {
 		return nil, err
 	}
 
+	for {
+		outputs, total, err := ts.finder.FindUnspent(from.address, fee)
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err := ts.createTx(hash, outputs, total-fee, from, to)
+		if err != nil {
+			ts.release(outputs)
+			return nil, err
+		}
+
+		if required := rate * virtualSize(tx); required > fee {
+			ts.release(outputs)
+			fee = required
+			continue
+		}
+
+		if err := ts.broadcast(tx); err != nil {
+			ts.release(outputs)
+			return nil, err
+		}
+
+		atomic.StoreInt64(&ts.lastFee, fee)
+		ts.sent(from, to)
+		txid := transactionID(tx)
+		if ts.config.RBF {
+			ts.addPending(&pendingTx{
+				txid:    txid,
+				hash:    hash,
+				outputs: outputs,
+				total:   total,
+				fee:     fee,
+				from:    from,
+				to:      to,
+			})
+		}
+
+		return txid, nil
+	}
+}
+
+// BumpFee implements github.com/stratumn/sdk/blockchain.FeeBumper.
+// It replaces a transaction sent by the timestamper with a transaction
+// spending the same outputs and paying a higher fee, which must be at least
+// FeeBumpPercent higher. Replace-by-fee must be enabled.
+func (ts *Timestamper) BumpFee(txid types.TransactionID) (types.TransactionID, error) {
+	if !ts.config.RBF {
+		return nil, ErrRBFDisabled
+	}
+
+	ts.pendingMutex.Lock()
+	defer ts.pendingMutex.Unlock()
+
+	var p *pendingTx
+	for _, pending := range ts.pending {
+		if bytes.Equal(pending.txid, txid) {
+			p = pending
+			break
+		}
+	}
+	if p == nil {
+		return nil, ErrUnknownTransaction
+	}
+
+	// Both transactions have the same size, give or take a byte of
+	// signature.
+	tx, err := ts.createTx(p.hash, p.outputs, p.total-p.fee, p.from, p.to)
+	if err != nil {
+		return nil, err
+	}
+	size := virtualSize(tx)
+
+	fee := p.fee + size*IncrementalFeeRate
+	if bumped := p.fee * (100 + FeeBumpPercent) / 100; bumped > fee {
+		fee = bumped
+	}
+	if ts.config.FeeEstimator != nil {
+		if rate, err := ts.estimateFeeRate(); err == nil && rate*size > fee {
+			fee = rate * size
+		}
+	}
+	if max := ts.config.GetMaxFeeRate() * size; fee > max {
+		if max < p.fee+size*IncrementalFeeRate {
+			return nil, ErrMaxFeeRate
+		}
+		fee = max
+	}
+	if fee > p.total {
+		return nil, fmt.Errorf("Not enough Bitcoins in the inputs of transaction %s to pay a fee of %d satoshis", txid, fee)
+	}
+
+	if tx, err = ts.createTx(p.hash, p.outputs, p.total-fee, p.from, p.to); err != nil {
+		return nil, err
+	}
+	if err := ts.broadcast(tx); err != nil {
+		return nil, err
+	}
+
+	p.txid = transactionID(tx)
+	p.fee = fee
+
+	return p.txid, nil
+}
+
+// Consolidate implements
+// github.com/stratumn/sdk/blockchain/btc/utxo.Consolidator.
+// It spends outputs of the address to a single output to the same address,
+// paying the estimated fee rate or the minimum fee rate.
+func (ts *Timestamper) Consolidate(outputs []btc.Output) (types.TransactionID, error) {
+	var total int64
+	for _, output := range outputs {
+		total += output.Value
+	}
+
+	rate := ts.config.GetMinFeeRate()
+	if ts.config.FeeEstimator != nil {
+		if estimated, err := ts.estimateFeeRate(); err == nil {
+			rate = estimated
+		}
+	}
+
+	key := ts.currentKey()
+	tx, err := ts.createTx(nil, outputs, total, key, key)
+	if err != nil {
+		return nil, err
+	}
+	fee := rate * virtualSize(tx)
+	if total-fee < dustLimit {
+		return nil, fmt.Errorf("Outputs of %d satoshis do not cover a consolidation fee of %d satoshis", total, fee)
+	}
+
+	if tx, err = ts.createTx(nil, outputs, total-fee, key, key); err != nil {
+		return nil, err
+	}
+	if err := ts.broadcast(tx); err != nil {
+		return nil, err
+	}
+
+	return transactionID(tx), nil
+}
+
+// Balance implements github.com/stratumn/sdk/blockchain.BalanceReporter.
+// It requires a UTXO store. The runway is the number of transactions paying
+// the fee of the last transaction, or the fixed fee, that the balance can
+// pay for.
+func (ts *Timestamper) Balance() (*blockchain.Balance, error) {
+	if ts.tracker == nil {
+		return nil, ErrNoUTXOStore
+	}
+
+	confirmed, unconfirmed := ts.tracker.Balance()
+	balance := &blockchain.Balance{
+		Confirmed:   confirmed,
+		Unconfirmed: unconfirmed,
+	}
+
+	fee := atomic.LoadInt64(&ts.lastFee)
+	if fee <= 0 {
+		fee = ts.config.Fee
+	}
+	if fee > 0 {
+		balance.Runway = (confirmed + unconfirmed) / fee
+	}
+
+	return balance, nil
+}
+
+// currentKey returns the current key.
+func (ts *Timestamper) currentKey() *signingKey {
+	ts.keyMutex.Lock()
+	defer ts.keyMutex.Unlock()
+	return ts.key
+}
+
+// keys returns the key spending the outputs of the next transaction and the
+// key receiving its change, which is the next key if the key is rotated.
+func (ts *Timestamper) keys() (from, to *signingKey, err error) {
+	ts.keyMutex.Lock()
+	defer ts.keyMutex.Unlock()
+
+	rotateAfter := ts.config.RotateAfter
+	if ts.wallet == nil || !ts.rotate && (rotateAfter <= 0 || ts.txCount+1 < rotateAfter) {
+		return ts.key, ts.key, nil
+	}
+
+	index := ts.key.index + 1
+	privKey, err := ts.wallet.PrivateKey(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	if to, err = ts.newSigningKey(privKey, true); err != nil {
+		return nil, nil, err
+	}
+	to.index = index
+
+	return ts.key, to, nil
+}
+
+// sent counts a transaction sent by the current key and switches to the next
+// key if the transaction rotated it.
+func (ts *Timestamper) sent(from, to *signingKey) {
+	ts.keyMutex.Lock()
+	if from == to {
+		ts.txCount++
+		ts.keyMutex.Unlock()
+		return
+	}
+	if ts.key != from {
+		// A concurrent transaction already rotated the key.
+		ts.keyMutex.Unlock()
+		return
+	}
+	ts.key, ts.txCount, ts.rotate = to, 0, false
+	ts.keyMutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"path":    ts.wallet.Path(to.index),
+		"address": to.address,
+	}).Info("Rotated Bitcoin timestamper key")
+
+	if ts.config.OnRotate != nil {
+		ts.config.OnRotate(to.index)
+	}
+}
+
+// release releases outputs reserved by the UTXO tracker.
+func (ts *Timestamper) release(outputs []btc.Output) {
+	if ts.tracker != nil {
+		ts.tracker.Release(outputs)
+	}
+}
+
+// estimateFeeRate returns the estimated fee rate within the configured floor
+// and ceiling.
+func (ts *Timestamper) estimateFeeRate() (int64, error) {
+	rate, err := ts.config.FeeEstimator.EstimateFee(ts.config.GetFeeTarget())
+	if err != nil {
+		return 0, err
+	}
+	if min := ts.config.GetMinFeeRate(); rate < min {
+		rate = min
+	}
+	if max := ts.config.GetMaxFeeRate(); rate > max {
+		rate = max
+	}
+	return rate, nil
+}
+
+func (ts *Timestamper) addPending(p *pendingTx) {
+	ts.pendingMutex.Lock()
+	defer ts.pendingMutex.Unlock()
+
+	ts.pending = append(ts.pending, p)
+	if len(ts.pending) > maxPendingTxs {
+		ts.pending = ts.pending[len(ts.pending)-maxPendingTxs:]
+	}
+}
+
+// createTx creates a signed transaction timestamping a hash, spending outputs
+// of a key and sending the change to the address of a key, which is the same
+// key unless it is rotated. If the hash is nil, the transaction only sends the
+// change.
+func (ts *Timestamper) createTx(hash *types.Bytes32, outputs []btc.Output, change int64, from, to *signingKey) (*wire.MsgTx, error) {
 	tx := wire.NewMsgTx(wire.TxVersion)
 	for _, output := range outputs {
-		prevPKScripts = append(prevPKScripts, output.PKScript)
 		out := wire.NewOutPoint((*chainhash.Hash)(&output.TXHash), uint32(output.Index))
-		tx.AddTxIn(wire.NewTxIn(out, nil, nil))
+		txIn := wire.NewTxIn(out, nil, nil)
+		if ts.config.RBF {
+			txIn.Sequence = rbfSequence
+		}
+		tx.AddTxIn(txIn)
 	}
 
-	payToAddrOut, err := ts.createPayToAddrTxOut(total - ts.config.Fee)
+	payToAddrOut, err := ts.createPayToAddrTxOut(change, to.address)
 	if err != nil {
 		return nil, err
 	}
 	tx.AddTxOut(payToAddrOut)
 
-	nullDataOut, err := ts.createNullDataTxOut(hash)
-	if err != nil {
-		return nil, err
+	if hash != nil {
+		nullDataOut, err := ts.createNullDataTxOut(hash)
+		if err != nil {
+			return nil, err
+		}
+		tx.AddTxOut(nullDataOut)
 	}
-	tx.AddTxOut(nullDataOut)
 
-	if err = ts.signTx(tx, prevPKScripts); err != nil {
+	if err = ts.signTx(tx, outputs, from); err != nil {
 		return nil, err
 	}
-	if err = ts.validateTx(tx, prevPKScripts); err != nil {
+	if err = ts.validateTx(tx, outputs); err != nil {
 		return nil, err
 	}
 
+	return tx, nil
+}
+
+func (ts *Timestamper) broadcast(tx *wire.MsgTx) error {
 	buf := bytes.NewBuffer(nil)
-	if err = tx.Serialize(buf); err != nil {
-		return nil, err
+	if err := tx.Serialize(buf); err != nil {
+		return err
 	}
 	raw, err := ioutil.ReadAll(buf)
 	if err != nil {
-		return nil, err
-	}
-	err = ts.config.Broadcaster.Broadcast(raw)
-	if err != nil {
-		return nil, err
+		return err
 	}
+	return ts.broadcaster.Broadcast(raw)
+}
 
+// transactionID returns the ID of a transaction in the byte order used by
+// block explorers.
+func transactionID(tx *wire.MsgTx) types.TransactionID {
 	// Reverse the bytes!
 	var txHash32 types.Bytes32
 	for i, b := range tx.TxHash() {
 		txHash32[types.Bytes32Size-i-1] = b
 	}
 
-	return txHash32[:], nil
+	return txHash32[:]
+}
+
+// virtualSize returns the virtual size of a transaction as defined by BIP 141.
+func virtualSize(tx *wire.MsgTx) int64 {
+	weight := tx.SerializeSizeStripped()*3 + tx.SerializeSize()
+	return int64((weight + 3) / 4)
 }
 
-func (ts *Timestamper) createPayToAddrTxOut(amount int64) (*wire.TxOut, error) {
-	PKScript, err := txscript.PayToAddrScript(ts.address)
+func (ts *Timestamper) createPayToAddrTxOut(amount int64, address btcutil.Address) (*wire.TxOut, error) {
+	PKScript, err := txscript.PayToAddrScript(address)
 	if err != nil {
 		return nil, err
 	}
@@ -191,26 +883,56 @@ func (ts *Timestamper) createNullDataTxOut(hash *types.Bytes32) (*wire.TxOut, er
 	return wire.NewTxOut(0, PKScript), nil
 }
 
-func (ts *Timestamper) signTx(tx *wire.MsgTx, prevPKScripts [][]byte) error {
-	for index, PKScript := range prevPKScripts {
-		sig, err := txscript.SignTxOutput(ts.netParams, tx, 0, PKScript,
-			txscript.SigHashAll, txscript.KeyClosure(ts.lookupKey), nil, nil)
-		if err != nil {
-			return err
+func (ts *Timestamper) signTx(tx *wire.MsgTx, outputs []btc.Output, key *signingKey) error {
+	sigHashes := txscript.NewTxSigHashes(tx)
+
+	for index, output := range outputs {
+		txIn := tx.TxIn[index]
+
+		switch {
+		case key.redeemScript != nil:
+			// The signature script only pushes the witness program,
+			// which is signed like a native segwit output.
+			witness, err := txscript.WitnessSignature(tx, sigHashes, index, output.Value,
+				key.redeemScript, txscript.SigHashAll, key.privKey, true)
+			if err != nil {
+				return err
+			}
+			sig, err := txscript.NewScriptBuilder().AddData(key.redeemScript).Script()
+			if err != nil {
+				return err
+			}
+			txIn.Witness = witness
+			txIn.SignatureScript = sig
+		case txscript.IsPayToWitnessPubKeyHash(output.PKScript):
+			witness, err := txscript.WitnessSignature(tx, sigHashes, index, output.Value,
+				output.PKScript, txscript.SigHashAll, key.privKey, true)
+			if err != nil {
+				return err
+			}
+			txIn.Witness = witness
+		default:
+			sig, err := txscript.SignTxOutput(ts.netParams, tx, index, output.PKScript,
+				txscript.SigHashAll, txscript.KeyClosure(key.lookupKey), nil, nil)
+			if err != nil {
+				return err
+			}
+			txIn.SignatureScript = sig
 		}
-
-		tx.TxIn[index].SignatureScript = sig
 	}
 
 	return nil
 }
 
 const validateTxEngineFlags = txscript.ScriptBip16 | txscript.ScriptVerifyDERSignatures |
-	txscript.ScriptStrictMultiSig | txscript.ScriptDiscourageUpgradableNops
+	txscript.ScriptStrictMultiSig | txscript.ScriptDiscourageUpgradableNops |
+	txscript.ScriptVerifyWitness
+
+func (ts *Timestamper) validateTx(tx *wire.MsgTx, outputs []btc.Output) error {
+	sigHashes := txscript.NewTxSigHashes(tx)
 
-func (ts *Timestamper) validateTx(tx *wire.MsgTx, prevPKScripts [][]byte) error {
-	for _, PKScript := range prevPKScripts {
-		vm, err := txscript.NewEngine(PKScript, tx, 0, validateTxEngineFlags, nil, nil, 0)
+	for index, output := range outputs {
+		vm, err := txscript.NewEngine(output.PKScript, tx, index, validateTxEngineFlags, nil, sigHashes, output.Value)
 		if err != nil {
 			return err
 		}
@@ -222,7 +944,7 @@ func (ts *Timestamper) validateTx(tx *wire.MsgTx, prevPKScripts [][]byte) error
 	return nil
 }
 
-func (ts *Timestamper) lookupKey(btcutil.Address) (*btcec.PrivateKey, bool, error) {
-	// Second value means uncompressed.
-	return ts.privKey, false, nil
+func (key *signingKey) lookupKey(btcutil.Address) (*btcec.PrivateKey, bool, error) {
+	// Second value means compressed.
+	return key.privKey, key.compress, nil
 }
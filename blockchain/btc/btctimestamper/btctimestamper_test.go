@@ -15,13 +15,15 @@
 package btctimestamper
 
 import (
+	"bytes"
 	"encoding/hex"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
 	"github.com/stratumn/sdk/blockchain/btc"
 	"github.com/stratumn/sdk/blockchain/btc/btctesting"
 	"github.com/stratumn/sdk/testutil"
-	"github.com/stratumn/sdk/types"
 )
 
 func TestNetwork_NetworkTest3(t *testing.T) {
@@ -52,9 +54,53 @@ func TestNetwork_NetworkMain(t *testing.T) {
 	}
 }
 
+func TestNetwork_NetworkRegtest(t *testing.T) {
+	// Regtest keys are the same as testnet3 keys.
+	ts, err := New(&Config{
+		WIF:     "924v2d7ryXJjnbwB6M9GsZDEjAkfE9aHeQAG1j8muA4UEjozeAJ",
+		Network: btc.NetworkRegtest,
+		Fee:     int64(10000),
+	})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	if got := ts.Network(); got != btc.NetworkRegtest {
+		t.Errorf("ts.Network() = %q want %q", got, btc.NetworkRegtest)
+	}
+}
+
+func TestNetwork_NetworkSimnet(t *testing.T) {
+	privKey, _ := btcec.NewPrivateKey(btcec.S256())
+	wif, _ := btcutil.NewWIF(privKey, btc.NetworkSimnet.Params(), false)
+
+	ts, err := New(&Config{
+		WIF: wif.String(),
+		Fee: int64(10000),
+	})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	if got := ts.Network(); got != btc.NetworkSimnet {
+		t.Errorf("ts.Network() = %q want %q", got, btc.NetworkSimnet)
+	}
+}
+
+func TestNew_networkMismatch(t *testing.T) {
+	_, err := New(&Config{
+		WIF:     "L3Wbnfn57Fc547FLSkm6iCzAaHmLArNUBCYx6q8LdxWoEMoFZmLH",
+		Network: btc.NetworkRegtest,
+		Fee:     int64(10000),
+	})
+	if err == nil {
+		t.Error("New(): err = nil want Error")
+	}
+}
+
 func TestTimestamperTimestampHash(t *testing.T) {
 	mock := &btctesting.Mock{}
-	mock.MockFindUnspent.Fn = func(*types.ReversedBytes20, int64) ([]btc.Output, int64, error) {
+	mock.MockFindUnspent.Fn = func(btcutil.Address, int64) ([]btc.Output, int64, error) {
 		PKScriptHex := "76a914fc56f7f9f80cfba26f300c77b893c39ed89351ff88ac"
 		PKScript, _ := hex.DecodeString(PKScriptHex)
 		output := btc.Output{Index: 0, PKScript: PKScript}
@@ -82,3 +128,424 @@ func TestTimestamperTimestampHash(t *testing.T) {
 		t.Errorf("ts.TimestampHash(): Broadcast() called %d time(s) want 1 time", mock.MockBroadcast.CalledCount)
 	}
 }
+
+func newHarnessTimestamper(t *testing.T, config *Config) (*Timestamper, *btctesting.Harness) {
+	privKey, _ := btcec.NewPrivateKey(btcec.S256())
+	wif, _ := btcutil.NewWIF(privKey, btc.NetworkRegtest.Params(), false)
+	harness := btctesting.NewHarness(btc.NetworkRegtest)
+
+	config.UnspentFinder = harness
+	config.Broadcaster = harness
+	config.WIF = wif.String()
+	config.Network = btc.NetworkRegtest
+
+	ts, err := New(config)
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		harness.Fund(ts.Address(), 100000)
+	}
+
+	return ts, harness
+}
+
+func TestTimestampHash_feeEstimator(t *testing.T) {
+	ts, harness := newHarnessTimestamper(t, &Config{Fee: 10000})
+	harness.SetFeeRate(20)
+	ts.config.FeeEstimator = harness
+
+	txid, err := ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	tx, _ := harness.Transaction(txid)
+	fee, _ := harness.Fee(txid)
+	size := virtualSize(tx)
+	if fee < 20*size || fee > 20*(size+2) {
+		t.Errorf("fee = %d want about %d", fee, 20*size)
+	}
+}
+
+func TestTimestampHash_feeEstimatorMultipleInputs(t *testing.T) {
+	ts, harness := newHarnessTimestamper(t, &Config{MaxFeeRate: 1000})
+	harness.SetFeeRate(400)
+	ts.config.FeeEstimator = harness
+
+	// One output of 100000 satoshis cannot pay for a transaction of more
+	// than 250 bytes at 400 satoshis per byte.
+	txid, err := ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	tx, _ := harness.Transaction(txid)
+	if got := len(tx.TxIn); got < 2 {
+		t.Errorf("len(tx.TxIn) = %d want at least 2", got)
+	}
+	fee, _ := harness.Fee(txid)
+	if want := 400 * virtualSize(tx); fee < want {
+		t.Errorf("fee = %d want at least %d", fee, want)
+	}
+}
+
+func TestTimestampHash_feeRateLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		estimate int64
+		want     int64
+	}{
+		{"floor", 1, 5},
+		{"ceiling", 100, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, harness := newHarnessTimestamper(t, &Config{MinFeeRate: 5, MaxFeeRate: 50})
+			harness.SetFeeRate(tt.estimate)
+			ts.config.FeeEstimator = harness
+
+			txid, err := ts.TimestampHash(testutil.RandomHash())
+			if err != nil {
+				t.Fatalf("ts.TimestampHash(): err: %s", err)
+			}
+
+			tx, _ := harness.Transaction(txid)
+			fee, _ := harness.Fee(txid)
+			if got, want := fee/virtualSize(tx), tt.want; got != want {
+				t.Errorf("fee rate = %d want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestTimestampHash_feeEstimatorError(t *testing.T) {
+	// The harness has no fee rate, so the fixed fee is used.
+	ts, harness := newHarnessTimestamper(t, &Config{Fee: 12345})
+	ts.config.FeeEstimator = harness
+
+	txid, err := ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	if got, _ := harness.Fee(txid); got != 12345 {
+		t.Errorf("fee = %d want %d", got, 12345)
+	}
+}
+
+func TestTimestampHash_RBF(t *testing.T) {
+	ts, harness := newHarnessTimestamper(t, &Config{Fee: 10000, RBF: true})
+
+	txid, err := ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	tx, _ := harness.Transaction(txid)
+	for i, txIn := range tx.TxIn {
+		if got, want := txIn.Sequence, uint32(rbfSequence); got != want {
+			t.Errorf("tx.TxIn[%d].Sequence = %x want %x", i, got, want)
+		}
+	}
+}
+
+func TestBumpFee(t *testing.T) {
+	ts, harness := newHarnessTimestamper(t, &Config{Fee: 10000, RBF: true})
+
+	txid, err := ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	replaced, _ := harness.Transaction(txid)
+
+	bumped, err := ts.BumpFee(txid)
+	if err != nil {
+		t.Fatalf("ts.BumpFee(): err: %s", err)
+	}
+
+	if _, ok := harness.Transaction(txid); ok {
+		t.Error("replaced transaction is still in the mempool")
+	}
+	tx, ok := harness.Transaction(bumped)
+	if !ok {
+		t.Fatal("replacement transaction was not accepted")
+	}
+	if got, want := tx.TxOut[1].PkScript, replaced.TxOut[1].PkScript; !bytes.Equal(got, want) {
+		t.Errorf("tx.TxOut[1].PkScript = %x want %x", got, want)
+	}
+	if got, _ := harness.Fee(bumped); got != 12500 {
+		t.Errorf("fee = %d want %d", got, 12500)
+	}
+
+	// The replacement can be bumped again.
+	if _, err := ts.BumpFee(bumped); err != nil {
+		t.Fatalf("ts.BumpFee(): err: %s", err)
+	}
+	if _, err := ts.BumpFee(txid); err != ErrUnknownTransaction {
+		t.Errorf("ts.BumpFee(): err = %v want %v", err, ErrUnknownTransaction)
+	}
+}
+
+func TestBumpFee_maxFeeRate(t *testing.T) {
+	ts, harness := newHarnessTimestamper(t, &Config{MaxFeeRate: 10, RBF: true})
+	harness.SetFeeRate(10)
+	ts.config.FeeEstimator = harness
+
+	txid, err := ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	if _, err := ts.BumpFee(txid); err != ErrMaxFeeRate {
+		t.Errorf("ts.BumpFee(): err = %v want %v", err, ErrMaxFeeRate)
+	}
+}
+
+func TestBumpFee_RBFDisabled(t *testing.T) {
+	ts, _ := newHarnessTimestamper(t, &Config{Fee: 10000})
+
+	txid, err := ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	if _, err := ts.BumpFee(txid); err != ErrRBFDisabled {
+		t.Errorf("ts.BumpFee(): err = %v want %v", err, ErrRBFDisabled)
+	}
+}
+
+func TestNew_unknownAddressType(t *testing.T) {
+	_, err := New(&Config{
+		WIF:         "924v2d7ryXJjnbwB6M9GsZDEjAkfE9aHeQAG1j8muA4UEjozeAJ",
+		AddressType: "p2tr",
+	})
+	if err == nil {
+		t.Error("New(): err = nil want Error")
+	}
+}
+
+func TestAddress(t *testing.T) {
+	// The key of the P2WPKH input of the native segwit example of BIP 143.
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), mustDecodeHex(t, "619c335025c7f4012e556c2a58b2506e30b8511b53ade95ea316fd8c3286feb9"))
+	wif, _ := btcutil.NewWIF(privKey, btc.NetworkMain.Params(), true)
+
+	tests := []struct {
+		addressType AddressType
+		want        string
+	}{
+		{AddressP2PKH, "13eeg4y5wYGxNTxBEuWLPFauoMJQLxdoip"},
+		{AddressP2WPKH, "bc1qr583w2swedy2acd7rung055k8t3n7udp7vyzyg"},
+		{AddressP2SHP2WPKH, "3JzDhLxKTJ8sv3eE8zmxRQzzK4aNW4MkV5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.addressType), func(t *testing.T) {
+			ts, err := New(&Config{WIF: wif.String(), AddressType: tt.addressType})
+			if err != nil {
+				t.Fatalf("New(): err: %s", err)
+			}
+			if got := ts.Address().EncodeAddress(); got != tt.want {
+				t.Errorf("ts.Address() = %s want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimestampHash_addressTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		addressType AddressType
+		compress    bool
+	}{
+		{"p2pkh-uncompressed", AddressP2PKH, false},
+		{"p2pkh-compressed", AddressP2PKH, true},
+		{"p2sh-p2wpkh", AddressP2SHP2WPKH, true},
+		{"p2wpkh", AddressP2WPKH, true},
+	}
+
+	// Fees paid to anchor a hash at ten satoshis per virtual byte.
+	var fees []int64
+
+	for _, tt := range tests {
+		privKey, _ := btcec.NewPrivateKey(btcec.S256())
+		wif, _ := btcutil.NewWIF(privKey, btc.NetworkRegtest.Params(), tt.compress)
+		harness := btctesting.NewHarness(btc.NetworkRegtest)
+		harness.SetFeeRate(10)
+
+		ts, err := New(&Config{
+			UnspentFinder: harness,
+			Broadcaster:   harness,
+			FeeEstimator:  harness,
+			WIF:           wif.String(),
+			Network:       btc.NetworkRegtest,
+			AddressType:   tt.addressType,
+		})
+		if err != nil {
+			t.Fatalf("%s: New(): err: %s", tt.name, err)
+		}
+		harness.Fund(ts.Address(), 100000)
+
+		// Spend the change too, to check that it goes back to the
+		// address.
+		var fee int64
+		for i := 0; i < 2; i++ {
+			txid, err := ts.TimestampHash(testutil.RandomHash())
+			if err != nil {
+				t.Fatalf("%s: ts.TimestampHash(): err: %s", tt.name, err)
+			}
+			fee, _ = harness.Fee(txid)
+		}
+
+		t.Logf("%s: fee = %d satoshis", tt.name, fee)
+		fees = append(fees, fee)
+	}
+
+	for i := 1; i < len(fees); i++ {
+		if fees[i] >= fees[i-1] {
+			t.Errorf("%s: fee = %d want less than %s fee %d", tests[i].name, fees[i], tests[i-1].name, fees[i-1])
+		}
+	}
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("hex.DecodeString(): err: %s", err)
+	}
+	return b
+}
+
+// Mnemonic of the BIP39, BIP44 and BIP84 test vectors.
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestNew_extendedKey(t *testing.T) {
+	// Master key of BIP32 test vector 1, chain m/0'/1.
+	ts, err := New(&Config{
+		ExtendedKey: "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+		KeyPath:     "m/0'",
+		KeyIndex:    1,
+	})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+	if got := ts.Network(); got != btc.NetworkMain {
+		t.Errorf("ts.Network() = %q want %q", got, btc.NetworkMain)
+	}
+	if got, want := ts.Address().EncodeAddress(), "1JQheacLPdM5ySCkrZkV66G2ApAXe1mqLj"; got != want {
+		t.Errorf("ts.Address() = %s want %s", got, want)
+	}
+	if got, want := ts.KeyIndex(), uint32(1); got != want {
+		t.Errorf("ts.KeyIndex() = %d want %d", got, want)
+	}
+}
+
+func TestNew_mnemonic(t *testing.T) {
+	tests := []struct {
+		addressType AddressType
+		want        string
+	}{
+		{AddressP2PKH, "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		{AddressP2WPKH, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+	}
+	for _, tt := range tests {
+		ts, err := New(&Config{
+			Mnemonic:    testMnemonic,
+			Network:     btc.NetworkMain,
+			AddressType: tt.addressType,
+		})
+		if err != nil {
+			t.Fatalf("New(): err: %s", err)
+		}
+		if got := ts.Address().EncodeAddress(); got != tt.want {
+			t.Errorf("%s: ts.Address() = %s want %s", tt.addressType, got, tt.want)
+		}
+	}
+}
+
+func TestNew_invalidKeySource(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+	}{
+		{"no key", &Config{}},
+		{"two keys", &Config{WIF: "L3Wbnfn57Fc547FLSkm6iCzAaHmLArNUBCYx6q8LdxWoEMoFZmLH", Mnemonic: testMnemonic, Network: btc.NetworkMain}},
+		{"mnemonic without network", &Config{Mnemonic: testMnemonic}},
+		{"invalid path", &Config{Mnemonic: testMnemonic, Network: btc.NetworkMain, KeyPath: "0'"}},
+		{"network mismatch", &Config{ExtendedKey: "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi", Network: btc.NetworkTest3}},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.config); err == nil {
+			t.Errorf("%s: New(): err = nil want Error", tt.name)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	harness := btctesting.NewHarness(btc.NetworkRegtest)
+	var rotated []uint32
+
+	ts, err := New(&Config{
+		UnspentFinder: harness,
+		Broadcaster:   harness,
+		Mnemonic:      testMnemonic,
+		Network:       btc.NetworkRegtest,
+		AddressType:   AddressP2WPKH,
+		Fee:           10000,
+		RotateAfter:   2,
+		OnRotate:      func(index uint32) { rotated = append(rotated, index) },
+	})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+	first := ts.Address()
+	harness.Fund(first, 100000)
+
+	for i := 0; i < 2; i++ {
+		if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+			t.Fatalf("ts.TimestampHash(): err: %s", err)
+		}
+	}
+
+	// The change of the second transaction was sent to the next key.
+	if got, want := ts.KeyIndex(), uint32(1); got != want {
+		t.Errorf("ts.KeyIndex() = %d want %d", got, want)
+	}
+	if len(rotated) != 1 || rotated[0] != 1 {
+		t.Errorf("rotated = %v want [1]", rotated)
+	}
+	second := ts.Address()
+	if second.EncodeAddress() == first.EncodeAddress() {
+		t.Fatal("ts.Address() did not change")
+	}
+	if got, want := harness.Balance(first), int64(0); got != want {
+		t.Errorf("harness.Balance(first) = %d want %d", got, want)
+	}
+	if got, want := harness.Balance(second), int64(80000); got != want {
+		t.Errorf("harness.Balance(second) = %d want %d", got, want)
+	}
+
+	// The next transaction spends the outputs of the new key.
+	if err := ts.Rotate(); err != nil {
+		t.Fatalf("ts.Rotate(): err: %s", err)
+	}
+	if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	if got, want := harness.Balance(ts.Address()), int64(70000); got != want {
+		t.Errorf("harness.Balance() = %d want %d", got, want)
+	}
+	if len(rotated) != 2 || rotated[1] != 2 {
+		t.Errorf("rotated = %v want [1 2]", rotated)
+	}
+}
+
+func TestRotate_WIF(t *testing.T) {
+	ts, _ := newHarnessTimestamper(t, &Config{Fee: 10000})
+	if err := ts.Rotate(); err != ErrNoWallet {
+		t.Errorf("ts.Rotate(): err = %v want %v", err, ErrNoWallet)
+	}
+}
@@ -1,33 +1,215 @@
 package btctimestamper
 
 import (
+	"context"
 	"flag"
+	"os"
 
+	"github.com/btcsuite/btcutil"
+	"github.com/stratumn/sdk/blockchain"
 	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/bitcoind"
+	"github.com/stratumn/sdk/blockchain/btc/blockcypher"
+	"github.com/stratumn/sdk/blockchain/btc/hdwallet"
+	"github.com/stratumn/sdk/store"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// BackendBlockCypher uses the BlockCypher API to find unspent outputs
+	// and broadcast transactions.
+	BackendBlockCypher = "blockcypher"
+
+	// BackendBitcoind uses the JSON-RPC API of a Bitcoin Core node to find
+	// unspent outputs and broadcast transactions.
+	BackendBitcoind = "bitcoind"
+)
+
 var (
-	fee int64
+	fee           int64
+	feeEstimation bool
+	feeTarget     int
+	minFeeRate    int64
+	maxFeeRate    int64
+	rbf           bool
+	backend       string
+	network       string
+	addressType   string
+
+	keystoreFile     string
+	keystorePassword string
+	keyPath          string
+	keyIndex         int64
+	rotateAfter      int
+
+	// keystore is the key given by the flags, loaded once.
+	keystore *hdwallet.Keystore
 )
 
-// RegisterFlags registers the flags used by InitializeWithFlags.
+// RegisterFlags registers the flags used by InitializeWithFlags and
+// RunBackendWithFlags.
 func RegisterFlags() {
-	flag.Int64Var(&fee, "fee", DefaultFee, "transaction fee (satoshis)")
+	flag.Int64Var(&fee, "fee", DefaultFee, "transaction fee (satoshis), used if fee estimation is disabled or fails")
+	flag.BoolVar(&feeEstimation, "btc-fee-estimation", false, "whether to compute fees from the transaction size and the fee rate estimated by the backend")
+	flag.IntVar(&feeTarget, "btc-fee-target", DefaultFeeTarget, "number of blocks within which transactions should be mined when estimating fees")
+	flag.Int64Var(&minFeeRate, "btc-min-fee-rate", DefaultMinFeeRate, "minimum fee rate (satoshis per virtual byte)")
+	flag.Int64Var(&maxFeeRate, "btc-max-fee-rate", DefaultMaxFeeRate, "maximum fee rate (satoshis per virtual byte), including fee bumps")
+	flag.BoolVar(&rbf, "btc-rbf", false, "whether transactions signal replace-by-fee, which allows bumping their fee")
+	flag.StringVar(&backend, "btc-backend", BackendBlockCypher, "Bitcoin backend (blockcypher or bitcoind)")
+	flag.StringVar(&addressType, "btc-address-type", string(AddressP2PKH), "type of the address of the key (p2pkh, p2sh-p2wpkh or p2wpkh)")
+	flag.StringVar(&network, "btc-network", "", "Bitcoin network (bitcoin:main, bitcoin:test3, bitcoin:regtest or bitcoin:simnet), defaults to the network of the key")
+	flag.StringVar(&keystoreFile, "btc-keystore", os.Getenv("BTC_KEYSTORE"), "path of an encrypted keystore file containing the key, used instead of a key flag")
+	flag.StringVar(&keystorePassword, "btc-keystore-password", os.Getenv("BTC_KEYSTORE_PASSWORD"), "password of the keystore file")
+	flag.StringVar(&keyPath, "btc-key-path", "", "derivation path of the keys of an extended key or a mnemonic, defaults to the BIP44, BIP49 or BIP84 path of the address type")
+	flag.Int64Var(&keyIndex, "btc-key-index", -1, "index of the current derived key, defaults to the index of the keystore or zero")
+	flag.IntVar(&rotateAfter, "btc-rotate-after", 0, "number of transactions after which the derived key is rotated, zero disables rotation")
+}
+
+// keystoreWithFlags returns the key given by the -btc-keystore flag or the
+// key argument, which is either a WIF encoded key or an extended private key.
+func keystoreWithFlags(key string) *hdwallet.Keystore {
+	if keystore != nil {
+		return keystore
+	}
+
+	switch {
+	case key != "" && keystoreFile != "":
+		log.Fatal("A key and a keystore file cannot be used together")
+	case keystoreFile != "":
+		ks, err := hdwallet.ReadFile(keystoreFile, keystorePassword)
+		if err != nil {
+			log.WithField("error", err).Fatal("Failed to read keystore file")
+		}
+		keystore = ks
+	case hdwallet.IsExtendedKey(key):
+		keystore = &hdwallet.Keystore{ExtendedKey: key}
+	case key != "":
+		keystore = &hdwallet.Keystore{WIF: key}
+	default:
+		log.Fatal("A WIF encoded private key, an extended private key or a keystore file is required")
+	}
+
+	if keyPath != "" {
+		keystore.Path = keyPath
+	}
+	if keyIndex >= 0 {
+		keystore.Index = uint32(keyIndex)
+	}
+
+	return keystore
+}
+
+// saveKeyIndex persists the index of a rotated key in the keystore file.
+func saveKeyIndex(index uint32) {
+	if keystoreFile == "" {
+		log.WithField("index", index).Warn("Rotated key index is not persisted, set -btc-key-index when restarting")
+		return
+	}
+
+	keystore.Index = index
+	if err := hdwallet.WriteFile(keystoreFile, keystore, keystorePassword); err != nil {
+		log.WithFields(log.Fields{
+			"index": index,
+			"error": err,
+		}).Error("Failed to save rotated key index in keystore file")
+	}
+}
+
+// networkWithFlags returns the network given by the -btc-network flag or the
+// network of the key.
+func networkWithFlags(key string) btc.Network {
+	if network != "" {
+		return btc.Network(network)
+	}
+
+	ks := keystoreWithFlags(key)
+	switch {
+	case ks.Network != "":
+		return ks.Network
+	case ks.ExtendedKey != "":
+		net, err := hdwallet.NetworkFromExtendedKey(ks.ExtendedKey)
+		if err != nil {
+			log.WithField("error", err).Fatal("Extended private key uses unknown Bitcoin network")
+		}
+		return net
+	}
+
+	WIF, err := btcutil.DecodeWIF(ks.WIF)
+	if err != nil {
+		log.WithField("error", err).Fatal("Failed to decode WIF encoded private key")
+	}
+	net, err := btc.NetworkFromWIF(WIF)
+	if err != nil {
+		log.WithField("error", err).Fatal("WIF encoded private key uses unknown Bitcoin network")
+	}
+
+	return net
+}
+
+// RunBackendWithFlags should be called after RegisterFlags and flag.Parse to
+// initialize the Bitcoin backend selected by the -btc-backend flag.
+// The flags of the backend's package must have been registered.
+// The key is a WIF encoded key or an extended private key, it can be empty if
+// a keystore file is given.
+func RunBackendWithFlags(ctx context.Context, key string) (btc.UnspentFinder, btc.Broadcaster, blockchain.ChainQuerier) {
+	switch backend {
+	case BackendBlockCypher:
+		bcy := blockcypher.RunWithNetworkFlags(ctx, networkWithFlags(key))
+		return bcy, bcy, bcy
+	case BackendBitcoind:
+		client := bitcoind.InitializeWithFlags(networkWithFlags(key))
+		return client, client, client
+	}
+
+	log.WithField("backend", backend).Fatal("Unknown Bitcoin backend")
+	return nil, nil, nil
 }
 
 // InitializeWithFlags should be called after RegisterFlags and flag.Parse to initialize
 // a bcbatchfossilizer using flag values.
-func InitializeWithFlags(version, commit string, key string, unspentFinder btc.UnspentFinder, broadcaster btc.Broadcaster) *Timestamper {
+// The key is a WIF encoded key or an extended private key, it can be empty if
+// a keystore file is given. The index of a rotated key is saved in the keystore
+// file.
+// If fee estimation is enabled, the broadcaster must implement
+// github.com/stratumn/sdk/blockchain/btc.FeeEstimator.
+// The UTXO store is optional, unspent outputs are tracked if it is set, which
+// requires the chain querier.
+func InitializeWithFlags(version, commit string, key string, unspentFinder btc.UnspentFinder, broadcaster btc.Broadcaster, querier blockchain.ChainQuerier, utxoStore store.KeyValueStore) *Timestamper {
+	var feeEstimator btc.FeeEstimator
+	if feeEstimation {
+		var ok bool
+		if feeEstimator, ok = broadcaster.(btc.FeeEstimator); !ok {
+			log.Fatal("The Bitcoin backend cannot estimate fees")
+		}
+	}
+
+	ks := keystoreWithFlags(key)
 	ts, err := New(&Config{
-		UnspentFinder: unspentFinder,
-		Broadcaster:   broadcaster,
-		WIF:           key,
-		Fee:           fee,
+		UnspentFinder:      unspentFinder,
+		Broadcaster:        broadcaster,
+		WIF:                ks.WIF,
+		ExtendedKey:        ks.ExtendedKey,
+		Mnemonic:           ks.Mnemonic,
+		MnemonicPassphrase: ks.Passphrase,
+		KeyPath:            ks.Path,
+		KeyIndex:           ks.Index,
+		RotateAfter:        rotateAfter,
+		OnRotate:           saveKeyIndex,
+		Network:            networkWithFlags(key),
+		AddressType:        AddressType(addressType),
+		Fee:                fee,
+		FeeEstimator:       feeEstimator,
+		FeeTarget:          feeTarget,
+		MinFeeRate:         minFeeRate,
+		MaxFeeRate:         maxFeeRate,
+		RBF:                rbf,
+		UTXOStore:          utxoStore,
+		ChainQuerier:       querier,
 	})
 	if err != nil {
 		log.WithField("error", err).Fatal("Failed to create Bitcoin timestamper")
 	}
+	log.WithField("address", ts.Address()).Info("Bitcoin timestamper address")
 	return ts
 }
@@ -0,0 +1,225 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hdwallet derives Bitcoin keys from a BIP32 extended private key or
+// a BIP39 mnemonic, and stores them in encrypted keystore files.
+package hdwallet
+
+import (
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Purposes of BIP43 derivation paths, which depend on the type of address.
+const (
+	// PurposeBIP44 is the purpose of pay-to-pubkey-hash addresses.
+	PurposeBIP44 = 44
+
+	// PurposeBIP49 is the purpose of pay-to-witness-pubkey-hash addresses
+	// nested in pay-to-script-hash addresses.
+	PurposeBIP49 = 49
+
+	// PurposeBIP84 is the purpose of native pay-to-witness-pubkey-hash
+	// addresses.
+	PurposeBIP84 = 84
+)
+
+const (
+	// mnemonicIterations is the number of PBKDF2 iterations of BIP39.
+	mnemonicIterations = 2048
+
+	// mnemonicSeedSize is the size of a BIP39 seed.
+	mnemonicSeedSize = 64
+)
+
+var (
+	// ErrPublicKey is returned when an extended key is not private.
+	ErrPublicKey = errors.New("extended key is not private")
+
+	// ErrInvalidMnemonic is returned when a mnemonic does not have a valid
+	// number of words.
+	ErrInvalidMnemonic = errors.New("mnemonic must have 12, 15, 18, 21 or 24 words")
+
+	// ErrHardenedIndex is returned when deriving a key at a hardened index
+	// of the last level of a path.
+	ErrHardenedIndex = errors.New("key index must not be hardened")
+)
+
+// DefaultPath returns the BIP44 derivation path of the external chain of the
+// first account for a purpose and a network, for instance m/84'/1'/0'/0 for
+// native segwit addresses on testnet.
+func DefaultPath(purpose uint32, network btc.Network) string {
+	coin := 1
+	if network == btc.NetworkMain {
+		coin = 0
+	}
+	return fmt.Sprintf("m/%d'/%d'/0'/0", purpose, coin)
+}
+
+// ParsePath parses a derivation path such as m/44'/0'/0'/0 and returns the
+// indexes of its levels. Hardened levels end with ' or h.
+func ParsePath(path string) ([]uint32, error) {
+	levels := strings.Split(strings.TrimSpace(path), "/")
+	if levels[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q must start with m", path)
+	}
+
+	indexes := make([]uint32, 0, len(levels)-1)
+	for _, level := range levels[1:] {
+		hardened := strings.HasSuffix(level, "'") || strings.HasSuffix(level, "h")
+		if hardened {
+			level = level[:len(level)-1]
+		}
+		index, err := strconv.ParseUint(level, 10, 32)
+		if err != nil || index >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("invalid level %q in derivation path %q", level, path)
+		}
+		if hardened {
+			index += hdkeychain.HardenedKeyStart
+		}
+		indexes = append(indexes, uint32(index))
+	}
+
+	return indexes, nil
+}
+
+// MnemonicSeed returns the BIP39 seed of a mnemonic and an optional
+// passphrase.
+// The words are not checked against a wordlist, so the checksum of the
+// mnemonic is not verified. A mistyped mnemonic derives different keys.
+func MnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, ErrInvalidMnemonic
+	}
+
+	password := []byte(strings.Join(words, " "))
+	salt := []byte("mnemonic" + passphrase)
+
+	return pbkdf2.Key(password, salt, mnemonicIterations, mnemonicSeedSize, sha512.New), nil
+}
+
+// NetworkFromExtendedKey returns the network of an extended key.
+// Regtest keys use the same prefix as testnet keys, so NetworkTest3 is
+// returned for both.
+func NetworkFromExtendedKey(key string) (btc.Network, error) {
+	extendedKey, err := hdkeychain.NewKeyFromString(key)
+	if err != nil {
+		return "", err
+	}
+
+	for _, n := range []btc.Network{btc.NetworkMain, btc.NetworkTest3, btc.NetworkSimnet} {
+		if extendedKey.IsForNet(n.Params()) {
+			return n, nil
+		}
+	}
+
+	return "", btc.ErrUnsupportedNetwork
+}
+
+// IsExtendedKey returns whether a string is an encoded extended private key.
+func IsExtendedKey(key string) bool {
+	extendedKey, err := hdkeychain.NewKeyFromString(key)
+	return err == nil && extendedKey.IsPrivate()
+}
+
+// Wallet derives private keys from the extended key at a derivation path.
+type Wallet struct {
+	path    string
+	account *hdkeychain.ExtendedKey
+}
+
+// New creates a wallet deriving keys from a master extended private key.
+func New(master *hdkeychain.ExtendedKey, path string) (*Wallet, error) {
+	if !master.IsPrivate() {
+		return nil, ErrPublicKey
+	}
+
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	account := master
+	for _, index := range indexes {
+		if account, err = account.Child(index); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Wallet{path: strings.TrimSpace(path), account: account}, nil
+}
+
+// NewFromExtendedKey creates a wallet deriving keys from an encoded master
+// extended private key.
+func NewFromExtendedKey(key, path string) (*Wallet, error) {
+	master, err := hdkeychain.NewKeyFromString(key)
+	if err != nil {
+		return nil, err
+	}
+	return New(master, path)
+}
+
+// NewFromMnemonic creates a wallet deriving keys from a BIP39 mnemonic and
+// an optional passphrase.
+func NewFromMnemonic(mnemonic, passphrase string, network btc.Network, path string) (*Wallet, error) {
+	params := network.Params()
+	if params == nil {
+		return nil, btc.ErrUnsupportedNetwork
+	}
+
+	seed, err := MnemonicSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	master, err := hdkeychain.NewMaster(seed, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(master, path)
+}
+
+// PrivateKey returns the private key at an index of the derivation path.
+func (w *Wallet) PrivateKey(index uint32) (*btcec.PrivateKey, error) {
+	if index >= hdkeychain.HardenedKeyStart {
+		return nil, ErrHardenedIndex
+	}
+
+	child, err := w.account.Child(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return child.ECPrivKey()
+}
+
+// IsForNetwork returns whether the keys of the wallet are for a network.
+func (w *Wallet) IsForNetwork(network btc.Network) bool {
+	params := network.Params()
+	return params != nil && w.account.IsForNet(params)
+}
+
+// Path returns the full derivation path of the key at an index.
+func (w *Wallet) Path(index uint32) string {
+	return fmt.Sprintf("%s/%d", w.path, index)
+}
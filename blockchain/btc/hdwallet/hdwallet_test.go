@@ -0,0 +1,199 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdwallet
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/stratumn/sdk/blockchain/btc"
+)
+
+const (
+	// Master key of BIP32 test vector 1.
+	testXPRV = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+	testXPUB = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	testTPRV = "tprv8ZgxMBicQKsPeDgjzdC36fs6bMjGApWDNLR9erAXMs5skhMv36j9MV5ecvfavji5khqjWaWSFhN3YcCUUdiKH6isR4Pwy3U5y5egddBr16m"
+
+	// Mnemonic of the BIP39, BIP44 and BIP84 test vectors.
+	testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+)
+
+func TestDefaultPath(t *testing.T) {
+	if got, want := DefaultPath(PurposeBIP84, btc.NetworkMain), "m/84'/0'/0'/0"; got != want {
+		t.Errorf("DefaultPath() = %s want %s", got, want)
+	}
+	if got, want := DefaultPath(PurposeBIP44, btc.NetworkRegtest), "m/44'/1'/0'/0"; got != want {
+		t.Errorf("DefaultPath() = %s want %s", got, want)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []uint32
+	}{
+		{"m", []uint32{}},
+		{"m/0", []uint32{0}},
+		{"m/44'/1h/0'/0", []uint32{0x8000002C, 0x80000001, 0x80000000, 0}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePath(tt.path)
+		if err != nil {
+			t.Errorf("ParsePath(%q): err: %s", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePath(%q) = %v want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParsePath_invalid(t *testing.T) {
+	for _, path := range []string{"", "44'/0'", "m/", "m/a", "m/2147483648", "m/-1"} {
+		if _, err := ParsePath(path); err == nil {
+			t.Errorf("ParsePath(%q): err = nil want Error", path)
+		}
+	}
+}
+
+func TestMnemonicSeed(t *testing.T) {
+	seed, err := MnemonicSeed(testMnemonic, "TREZOR")
+	if err != nil {
+		t.Fatalf("MnemonicSeed(): err: %s", err)
+	}
+	want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if got := hex.EncodeToString(seed); got != want {
+		t.Errorf("MnemonicSeed() = %s want %s", got, want)
+	}
+}
+
+func TestMnemonicSeed_invalid(t *testing.T) {
+	if _, err := MnemonicSeed("abandon about", ""); err != ErrInvalidMnemonic {
+		t.Errorf("MnemonicSeed(): err = %v want %v", err, ErrInvalidMnemonic)
+	}
+}
+
+func TestNetworkFromExtendedKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		network btc.Network
+	}{
+		{testXPRV, btc.NetworkMain},
+		{testTPRV, btc.NetworkTest3},
+	}
+	for _, tt := range tests {
+		network, err := NetworkFromExtendedKey(tt.key)
+		if err != nil {
+			t.Errorf("NetworkFromExtendedKey(): err: %s", err)
+			continue
+		}
+		if network != tt.network {
+			t.Errorf("NetworkFromExtendedKey() = %s want %s", network, tt.network)
+		}
+	}
+}
+
+func TestIsExtendedKey(t *testing.T) {
+	if !IsExtendedKey(testXPRV) {
+		t.Error("IsExtendedKey(xprv) = false want true")
+	}
+	if IsExtendedKey(testXPUB) {
+		t.Error("IsExtendedKey(xpub) = true want false")
+	}
+	if IsExtendedKey("L3Wbnfn57Fc547FLSkm6iCzAaHmLArNUBCYx6q8LdxWoEMoFZmLH") {
+		t.Error("IsExtendedKey(wif) = true want false")
+	}
+}
+
+func TestNewFromExtendedKey(t *testing.T) {
+	wallet, err := NewFromExtendedKey(testXPRV, "m/0'")
+	if err != nil {
+		t.Fatalf("NewFromExtendedKey(): err: %s", err)
+	}
+	if !wallet.IsForNetwork(btc.NetworkMain) || wallet.IsForNetwork(btc.NetworkTest3) {
+		t.Error("wallet.IsForNetwork() returned the wrong network")
+	}
+	if got, want := wallet.Path(1), "m/0'/1"; got != want {
+		t.Errorf("wallet.Path() = %s want %s", got, want)
+	}
+
+	// Chain m/0'/1 of BIP32 test vector 1.
+	privKey, err := wallet.PrivateKey(1)
+	if err != nil {
+		t.Fatalf("wallet.PrivateKey(): err: %s", err)
+	}
+	wif, _ := btcutil.NewWIF(privKey, btc.NetworkMain.Params(), true)
+	if got, want := wif.String(), "KyFAjQ5rgrKvhXvNMtFB5PCSKUYD1yyPEe3xr3T34TZSUHycXtMM"; got != want {
+		t.Errorf("wallet.PrivateKey() = %s want %s", got, want)
+	}
+
+	if _, err := wallet.PrivateKey(0x80000000); err != ErrHardenedIndex {
+		t.Errorf("wallet.PrivateKey(): err = %v want %v", err, ErrHardenedIndex)
+	}
+}
+
+func TestNewFromExtendedKey_public(t *testing.T) {
+	if _, err := NewFromExtendedKey(testXPUB, "m/0"); err != ErrPublicKey {
+		t.Errorf("NewFromExtendedKey(): err = %v want %v", err, ErrPublicKey)
+	}
+}
+
+func TestNewFromMnemonic(t *testing.T) {
+	tests := []struct {
+		network btc.Network
+		purpose uint32
+		index   uint32
+		address func(hash []byte, network btc.Network) (btcutil.Address, error)
+		want    string
+	}{
+		{btc.NetworkMain, PurposeBIP44, 0, p2pkh, "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		{btc.NetworkMain, PurposeBIP84, 0, p2wpkh, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{btc.NetworkTest3, PurposeBIP44, 1, p2pkh, "mzpbWabUQm1w8ijuJnAof5eiSTep27deVH"},
+	}
+	for _, tt := range tests {
+		wallet, err := NewFromMnemonic(testMnemonic, "", tt.network, DefaultPath(tt.purpose, tt.network))
+		if err != nil {
+			t.Fatalf("NewFromMnemonic(): err: %s", err)
+		}
+		privKey, err := wallet.PrivateKey(tt.index)
+		if err != nil {
+			t.Fatalf("wallet.PrivateKey(): err: %s", err)
+		}
+		address, err := tt.address(btcutil.Hash160(privKey.PubKey().SerializeCompressed()), tt.network)
+		if err != nil {
+			t.Fatalf("address: err: %s", err)
+		}
+		if got := address.EncodeAddress(); got != tt.want {
+			t.Errorf("%s: address = %s want %s", wallet.Path(tt.index), got, tt.want)
+		}
+	}
+}
+
+func TestNewFromMnemonic_unsupportedNetwork(t *testing.T) {
+	if _, err := NewFromMnemonic(testMnemonic, "", "bitcoin:unknown", "m/0"); err != btc.ErrUnsupportedNetwork {
+		t.Errorf("NewFromMnemonic(): err = %v want %v", err, btc.ErrUnsupportedNetwork)
+	}
+}
+
+func p2pkh(hash []byte, network btc.Network) (btcutil.Address, error) {
+	return btcutil.NewAddressPubKeyHash(hash, network.Params())
+}
+
+func p2wpkh(hash []byte, network btc.Network) (btcutil.Address, error) {
+	return btcutil.NewAddressWitnessPubKeyHash(hash, network.Params())
+}
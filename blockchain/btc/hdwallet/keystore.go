@@ -0,0 +1,237 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdwallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/stratumn/sdk/blockchain/btc"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// KeystoreVersion is the version of the format of keystore files.
+	KeystoreVersion = 1
+
+	// ScryptN is the CPU/memory cost of the scrypt key derivation of new
+	// keystore files.
+	ScryptN = 1 << 15
+
+	// ScryptR is the block size of the scrypt key derivation.
+	ScryptR = 8
+
+	// ScryptP is the parallelization of the scrypt key derivation.
+	ScryptP = 1
+
+	// saltSize is the size of the scrypt salt.
+	saltSize = 32
+
+	// encryptionKeySize is the size of the AES-256 key.
+	encryptionKeySize = 32
+)
+
+var (
+	// ErrWrongPassword is returned when a keystore cannot be decrypted.
+	ErrWrongPassword = errors.New("could not decrypt keystore, wrong password")
+
+	// ErrEmptyPassword is returned when encrypting a keystore without a
+	// password.
+	ErrEmptyPassword = errors.New("keystore password is empty")
+)
+
+// Keystore contains the key of a timestamper. Exactly one of the WIF encoded
+// key, the extended key or the mnemonic must be set.
+type Keystore struct {
+	// A wallet import format key.
+	WIF string `json:"wif,omitempty"`
+
+	// A master extended private key.
+	ExtendedKey string `json:"extendedKey,omitempty"`
+
+	// A BIP39 mnemonic and its optional passphrase.
+	Mnemonic   string `json:"mnemonic,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+
+	// The Bitcoin network, required by mnemonics.
+	Network btc.Network `json:"network,omitempty"`
+
+	// The derivation path of the keys and the index of the current key,
+	// which is updated when the key is rotated.
+	Path  string `json:"path,omitempty"`
+	Index uint32 `json:"index"`
+}
+
+// Validate checks that exactly one key is set.
+func (k *Keystore) Validate() error {
+	count := 0
+	for _, key := range []string{k.WIF, k.ExtendedKey, k.Mnemonic} {
+		if key != "" {
+			count++
+		}
+	}
+	if count != 1 {
+		return errors.New("keystore must contain exactly one of a WIF encoded key, an extended key or a mnemonic")
+	}
+	if k.Mnemonic != "" && k.Network.Params() == nil {
+		return fmt.Errorf("keystore mnemonic requires a supported network, got %q", k.Network)
+	}
+	return nil
+}
+
+// encryptedKeystore is the format of keystore files.
+type encryptedKeystore struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Encrypt encrypts a keystore with a password. The encryption key is derived
+// with scrypt and the keystore is encrypted with AES-256-GCM.
+func Encrypt(keystore *Keystore, password string) ([]byte, error) {
+	if password == "" {
+		return nil, ErrEmptyPassword
+	}
+	if err := keystore.Validate(); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(keystore)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := encryptedKeystore{
+		Version: KeystoreVersion,
+		KDF:     "scrypt",
+		N:       ScryptN,
+		R:       ScryptR,
+		P:       ScryptP,
+		Salt:    make([]byte, saltSize),
+		Cipher:  "aes-256-gcm",
+	}
+	if _, err := rand.Read(encrypted.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := encrypted.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	encrypted.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(encrypted.Nonce); err != nil {
+		return nil, err
+	}
+	encrypted.Ciphertext = aead.Seal(nil, encrypted.Nonce, plaintext, nil)
+
+	return json.MarshalIndent(encrypted, "", "  ")
+}
+
+// Decrypt decrypts a keystore encrypted by Encrypt.
+func Decrypt(data []byte, password string) (*Keystore, error) {
+	var encrypted encryptedKeystore
+	if err := json.Unmarshal(data, &encrypted); err != nil {
+		return nil, err
+	}
+	if encrypted.Version != KeystoreVersion || encrypted.KDF != "scrypt" || encrypted.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported keystore version %d", encrypted.Version)
+	}
+
+	aead, err := encrypted.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid keystore nonce")
+	}
+	plaintext, err := aead.Open(nil, encrypted.Nonce, encrypted.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+
+	var keystore Keystore
+	if err := json.Unmarshal(plaintext, &keystore); err != nil {
+		return nil, err
+	}
+	if err := keystore.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &keystore, nil
+}
+
+// ReadFile reads and decrypts a keystore file.
+func ReadFile(filename, password string) (*Keystore, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Decrypt(data, password)
+}
+
+// WriteFile encrypts a keystore and writes it to a file that only its owner
+// can read. The file is replaced atomically.
+func WriteFile(filename string, keystore *Keystore, password string) error {
+	data, err := Encrypt(keystore, password)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// aead returns the cipher of a keystore derived from a password.
+func (e *encryptedKeystore) aead(password string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(password), e.Salt, e.N, e.R, e.P, encryptionKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
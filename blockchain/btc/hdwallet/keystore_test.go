@@ -0,0 +1,121 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdwallet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stratumn/sdk/blockchain/btc"
+)
+
+func TestEncrypt(t *testing.T) {
+	keystore := &Keystore{
+		Mnemonic:   testMnemonic,
+		Passphrase: "TREZOR",
+		Network:    btc.NetworkTest3,
+		Path:       "m/84'/1'/0'/0",
+		Index:      3,
+	}
+
+	data, err := Encrypt(keystore, "secret")
+	if err != nil {
+		t.Fatalf("Encrypt(): err: %s", err)
+	}
+	if bytes.Contains(data, []byte("abandon")) {
+		t.Error("Encrypt() did not encrypt the mnemonic")
+	}
+
+	got, err := Decrypt(data, "secret")
+	if err != nil {
+		t.Fatalf("Decrypt(): err: %s", err)
+	}
+	if !reflect.DeepEqual(got, keystore) {
+		t.Errorf("Decrypt() = %#v want %#v", got, keystore)
+	}
+}
+
+func TestDecrypt_wrongPassword(t *testing.T) {
+	data, err := Encrypt(&Keystore{ExtendedKey: testXPRV}, "secret")
+	if err != nil {
+		t.Fatalf("Encrypt(): err: %s", err)
+	}
+	if _, err := Decrypt(data, "wrong"); err != ErrWrongPassword {
+		t.Errorf("Decrypt(): err = %v want %v", err, ErrWrongPassword)
+	}
+}
+
+func TestEncrypt_invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		keystore *Keystore
+		password string
+	}{
+		{"no key", &Keystore{}, "secret"},
+		{"two keys", &Keystore{ExtendedKey: testXPRV, Mnemonic: testMnemonic, Network: btc.NetworkMain}, "secret"},
+		{"mnemonic without network", &Keystore{Mnemonic: testMnemonic}, "secret"},
+		{"empty password", &Keystore{ExtendedKey: testXPRV}, ""},
+	}
+	for _, tt := range tests {
+		if _, err := Encrypt(tt.keystore, tt.password); err == nil {
+			t.Errorf("%s: Encrypt(): err = nil want Error", tt.name)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdwallet")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "keystore.json")
+	keystore := &Keystore{ExtendedKey: testXPRV, Path: "m/0'"}
+	if err := WriteFile(filename, keystore, "secret"); err != nil {
+		t.Fatalf("WriteFile(): err: %s", err)
+	}
+
+	// Replace the file with an updated index.
+	keystore.Index = 1
+	if err := WriteFile(filename, keystore, "secret"); err != nil {
+		t.Fatalf("WriteFile(): err: %s", err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("os.Stat(): err: %s", err)
+	}
+	if got, want := info.Mode().Perm(), os.FileMode(0600); got != want {
+		t.Errorf("keystore file mode = %s want %s", got, want)
+	}
+
+	got, err := ReadFile(filename, "secret")
+	if err != nil {
+		t.Fatalf("ReadFile(): err: %s", err)
+	}
+	if !reflect.DeepEqual(got, keystore) {
+		t.Errorf("ReadFile() = %#v want %#v", got, keystore)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("len(files) = %d want 1", len(files))
+	}
+}
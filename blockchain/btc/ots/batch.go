@@ -0,0 +1,101 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ots
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/types"
+)
+
+// FromBatch creates the detached timestamp of a hash fossilized in a batch
+// whose Merkle root was anchored by a Bitcoin transaction.
+//
+// The operations climb the Merkle path of the batch to its root, rebuild the
+// anchoring transaction around the root, and climb the Merkle branch of the
+// block to its Merkle root, which is attested by the block.
+//
+// The digest of the timestamp is the hash itself, hashed with SHA-256. For a
+// link hash, the timestamped file is the canonical JSON of the link.
+func FromBatch(hash *types.Bytes32, path types.Path, root *types.Bytes32, tx *btc.TransactionProof) (*DetachedTimestamp, error) {
+	var ops []Op
+	msg := *hash
+
+	if len(path) == 0 && msg != *root {
+		return nil, errors.New("hash is not the root of a batch without a Merkle path")
+	}
+	for i, node := range path {
+		switch msg {
+		case node.Left:
+			ops = append(ops, Append(append([]byte(nil), node.Right[:]...)), SHA256())
+		case node.Right:
+			ops = append(ops, Prepend(append([]byte(nil), node.Left[:]...)), SHA256())
+		default:
+			return nil, fmt.Errorf("hash is not a child of level %d of the Merkle path", i)
+		}
+		msg = node.Parent
+	}
+	if msg != *root {
+		return nil, errors.New("Merkle path does not lead to the root of the batch")
+	}
+
+	// The transaction contains the root in a null data output.
+	i := bytes.Index(tx.Raw, root[:])
+	if i < 0 {
+		return nil, errors.New("transaction does not contain the root of the batch")
+	}
+	prefix, suffix := tx.Raw[:i], tx.Raw[i+len(root):]
+	if len(prefix) > MaxMessageSize || len(suffix) > MaxMessageSize {
+		return nil, errors.New("transaction is too big for an OpenTimestamps operation")
+	}
+	if len(prefix) > 0 {
+		ops = append(ops, Prepend(prefix))
+	}
+	if len(suffix) > 0 {
+		ops = append(ops, Append(suffix))
+	}
+	ops = append(ops, SHA256(), SHA256())
+
+	index := tx.Index
+	for _, sibling := range tx.MerkleBranch {
+		if index%2 == 0 {
+			ops = append(ops, Append(append([]byte(nil), sibling[:]...)))
+		} else {
+			ops = append(ops, Prepend(append([]byte(nil), sibling[:]...)))
+		}
+		ops = append(ops, SHA256(), SHA256())
+		index /= 2
+	}
+
+	d := &DetachedTimestamp{
+		FileHashOp: SHA256(),
+		Digest:     append([]byte(nil), hash[:]...),
+		Timestamp:  NewTimestamp(ops, BitcoinAttestation(uint64(tx.BlockHeight))),
+	}
+
+	// Check that the operations lead to the Merkle root of the block.
+	attested, err := d.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(attested[0].Message, tx.MerkleRoot[:]) {
+		return nil, errors.New("transaction proof does not lead to the Merkle root of the block")
+	}
+
+	return d, nil
+}
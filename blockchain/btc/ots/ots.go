@@ -0,0 +1,501 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ots reads and writes timestamps in the OpenTimestamps format, which
+// can be verified by the standard OpenTimestamps tools.
+//
+// A timestamp is a tree of operations applied to a message. Each path of the
+// tree ends with an attestation that the message obtained at the end of the
+// path existed at some point in time, for instance because it is the Merkle
+// root of a Bitcoin block.
+package ots
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/sha3"
+)
+
+// Magic is the header of detached timestamp files.
+var Magic = []byte("\x00OpenTimestamps\x00\x00Proof\x00\xbf\x89\xe2\xe8\x84\xe8\x92\x94")
+
+// Version is the major version of the format of detached timestamp files.
+const Version = 1
+
+// Tags of operations.
+const (
+	OpSHA1      = byte(0x02)
+	OpRIPEMD160 = byte(0x03)
+	OpSHA256    = byte(0x08)
+	OpKeccak256 = byte(0x67)
+	OpAppend    = byte(0xf0)
+	OpPrepend   = byte(0xf1)
+	OpReverse   = byte(0xf2)
+	OpHexlify   = byte(0xf3)
+)
+
+const (
+	// MaxMessageSize is the maximum size of the argument of an operation
+	// and of the message it returns.
+	MaxMessageSize = 4096
+
+	// maxPayloadSize is the maximum size of the payload of an attestation.
+	maxPayloadSize = 8192
+
+	// maxDepth is the maximum depth of a timestamp tree.
+	maxDepth = 256
+
+	// tagAttestation precedes an attestation and tagFork precedes each
+	// item of a timestamp but the last one.
+	tagAttestation = byte(0x00)
+	tagFork        = byte(0xff)
+)
+
+// Tags of attestations.
+var (
+	// BitcoinTag attests that the message is the Merkle root of the
+	// Bitcoin block at the height given by the payload.
+	BitcoinTag = [8]byte{0x05, 0x88, 0x96, 0x0d, 0x73, 0xd7, 0x19, 0x01}
+
+	// PendingTag says that a calendar server, whose URI is the payload,
+	// will be able to complete the timestamp later.
+	PendingTag = [8]byte{0x83, 0xdf, 0xe3, 0x0d, 0x2e, 0xf9, 0x0c, 0x8e}
+)
+
+var (
+	// ErrInvalidMagic is returned when decoding a file which is not a
+	// detached timestamp.
+	ErrInvalidMagic = errors.New("not an OpenTimestamps file")
+
+	// ErrEmptyTimestamp is returned when encoding a timestamp without
+	// attestations or operations.
+	ErrEmptyTimestamp = errors.New("timestamp is empty")
+)
+
+// Op is an operation applied to a message.
+type Op struct {
+	Tag byte
+
+	// The argument of append and prepend operations.
+	Arg []byte
+}
+
+// Append returns an operation appending data to the message.
+func Append(data []byte) Op {
+	return Op{Tag: OpAppend, Arg: data}
+}
+
+// Prepend returns an operation prepending data to the message.
+func Prepend(data []byte) Op {
+	return Op{Tag: OpPrepend, Arg: data}
+}
+
+// SHA256 returns an operation hashing the message with SHA-256.
+func SHA256() Op {
+	return Op{Tag: OpSHA256}
+}
+
+// Apply applies the operation to a message.
+func (op Op) Apply(msg []byte) ([]byte, error) {
+	var res []byte
+
+	switch op.Tag {
+	case OpSHA1:
+		sum := sha1.Sum(msg)
+		res = sum[:]
+	case OpRIPEMD160:
+		h := ripemd160.New()
+		h.Write(msg)
+		res = h.Sum(nil)
+	case OpSHA256:
+		sum := sha256.Sum256(msg)
+		res = sum[:]
+	case OpKeccak256:
+		h := sha3.NewLegacyKeccak256()
+		h.Write(msg)
+		res = h.Sum(nil)
+	case OpAppend:
+		res = append(append([]byte{}, msg...), op.Arg...)
+	case OpPrepend:
+		res = append(append([]byte{}, op.Arg...), msg...)
+	case OpReverse:
+		res = make([]byte, len(msg))
+		for i, b := range msg {
+			res[len(msg)-1-i] = b
+		}
+	case OpHexlify:
+		res = []byte(hex.EncodeToString(msg))
+	default:
+		return nil, fmt.Errorf("unknown operation 0x%02x", op.Tag)
+	}
+
+	if len(res) > MaxMessageSize {
+		return nil, fmt.Errorf("operation 0x%02x returns a message of %d bytes", op.Tag, len(res))
+	}
+
+	return res, nil
+}
+
+// String implements fmt.Stringer.
+func (op Op) String() string {
+	switch op.Tag {
+	case OpSHA1:
+		return "sha1"
+	case OpRIPEMD160:
+		return "ripemd160"
+	case OpSHA256:
+		return "sha256"
+	case OpKeccak256:
+		return "keccak256"
+	case OpAppend:
+		return "append " + hex.EncodeToString(op.Arg)
+	case OpPrepend:
+		return "prepend " + hex.EncodeToString(op.Arg)
+	case OpReverse:
+		return "reverse"
+	case OpHexlify:
+		return "hexlify"
+	}
+	return fmt.Sprintf("unknown 0x%02x", op.Tag)
+}
+
+// Attestation attests the existence of the message at the end of a path.
+type Attestation struct {
+	Tag     [8]byte
+	Payload []byte
+}
+
+// BitcoinAttestation returns an attestation that the message is the Merkle
+// root of the Bitcoin block at a height.
+func BitcoinAttestation(height uint64) Attestation {
+	var buf bytes.Buffer
+	writeVaruint(&buf, height)
+	return Attestation{Tag: BitcoinTag, Payload: buf.Bytes()}
+}
+
+// BitcoinHeight returns the height of the block of a Bitcoin attestation.
+func (a Attestation) BitcoinHeight() (uint64, bool) {
+	if a.Tag != BitcoinTag {
+		return 0, false
+	}
+	height, err := readVaruint(bytes.NewReader(a.Payload))
+	if err != nil {
+		return 0, false
+	}
+	return height, true
+}
+
+// Timestamp is a tree of operations and attestations.
+type Timestamp struct {
+	Attestations []Attestation
+	Branches     []*Branch
+}
+
+// Branch is an operation and the timestamp of the message it returns.
+type Branch struct {
+	Op        Op
+	Timestamp *Timestamp
+}
+
+// NewTimestamp creates a linear timestamp applying operations in order and
+// ending with an attestation.
+func NewTimestamp(ops []Op, attestation Attestation) *Timestamp {
+	leaf := &Timestamp{Attestations: []Attestation{attestation}}
+	t := leaf
+	for i := len(ops) - 1; i >= 0; i-- {
+		t = &Timestamp{Branches: []*Branch{{Op: ops[i], Timestamp: t}}}
+	}
+	return t
+}
+
+// AttestedMessage is a message reached by applying the operations of a path
+// of a timestamp, and its attestation.
+type AttestedMessage struct {
+	Message     []byte
+	Attestation Attestation
+}
+
+// Evaluate applies the operations of the timestamp to a message and returns
+// the messages of all its attestations.
+func (t *Timestamp) Evaluate(msg []byte) ([]AttestedMessage, error) {
+	var res []AttestedMessage
+	for _, attestation := range t.Attestations {
+		res = append(res, AttestedMessage{Message: msg, Attestation: attestation})
+	}
+	for _, branch := range t.Branches {
+		next, err := branch.Op.Apply(msg)
+		if err != nil {
+			return nil, err
+		}
+		attested, err := branch.Timestamp.Evaluate(next)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, attested...)
+	}
+	return res, nil
+}
+
+// DetachedTimestamp is the timestamp of a file, the content of .ots files.
+type DetachedTimestamp struct {
+	// The operation hashing the file, typically SHA-256, and the digest of
+	// the file, which is the first message of the timestamp.
+	FileHashOp Op
+	Digest     []byte
+
+	Timestamp *Timestamp
+}
+
+// Evaluate returns the messages of all the attestations of the timestamp.
+func (d *DetachedTimestamp) Evaluate() ([]AttestedMessage, error) {
+	return d.Timestamp.Evaluate(d.Digest)
+}
+
+// Encode serializes a detached timestamp.
+func (d *DetachedTimestamp) Encode() ([]byte, error) {
+	size, err := digestSize(d.FileHashOp.Tag)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Digest) != size {
+		return nil, fmt.Errorf("digest has %d bytes want %d", len(d.Digest), size)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(Magic)
+	writeVaruint(&buf, Version)
+	buf.WriteByte(d.FileHashOp.Tag)
+	buf.Write(d.Digest)
+	if err := writeTimestamp(&buf, d.Timestamp); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode deserializes a detached timestamp.
+func Decode(data []byte) (*DetachedTimestamp, error) {
+	r := bytes.NewReader(data)
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, Magic) {
+		return nil, ErrInvalidMagic
+	}
+	version, err := readVaruint(r)
+	if err != nil {
+		return nil, err
+	}
+	if version != Version {
+		return nil, fmt.Errorf("unsupported OpenTimestamps version %d", version)
+	}
+
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	size, err := digestSize(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DetachedTimestamp{
+		FileHashOp: Op{Tag: tag},
+		Digest:     make([]byte, size),
+	}
+	if _, err := io.ReadFull(r, d.Digest); err != nil {
+		return nil, err
+	}
+	if d.Timestamp, err = readTimestamp(r, d.Digest, maxDepth); err != nil {
+		return nil, err
+	}
+	if r.Len() > 0 {
+		return nil, errors.New("trailing data after timestamp")
+	}
+
+	return d, nil
+}
+
+// digestSize returns the size of the digest of a hash operation.
+func digestSize(tag byte) (int, error) {
+	switch tag {
+	case OpSHA1, OpRIPEMD160:
+		return 20, nil
+	case OpSHA256, OpKeccak256:
+		return 32, nil
+	}
+	return 0, fmt.Errorf("operation 0x%02x is not a file hash", tag)
+}
+
+func writeTimestamp(w *bytes.Buffer, t *Timestamp) error {
+	if t == nil || len(t.Attestations) == 0 && len(t.Branches) == 0 {
+		return ErrEmptyTimestamp
+	}
+
+	// Items are sorted like the reference implementation so that a
+	// timestamp has a single encoding.
+	attestations := append([]Attestation(nil), t.Attestations...)
+	sort.Slice(attestations, func(i, j int) bool {
+		if c := bytes.Compare(attestations[i].Tag[:], attestations[j].Tag[:]); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(attestations[i].Payload, attestations[j].Payload) < 0
+	})
+	branches := append([]*Branch(nil), t.Branches...)
+	sort.Slice(branches, func(i, j int) bool {
+		if branches[i].Op.Tag != branches[j].Op.Tag {
+			return branches[i].Op.Tag < branches[j].Op.Tag
+		}
+		return bytes.Compare(branches[i].Op.Arg, branches[j].Op.Arg) < 0
+	})
+
+	items := len(attestations) + len(branches)
+	for i, attestation := range attestations {
+		if i < items-1 {
+			w.WriteByte(tagFork)
+		}
+		w.WriteByte(tagAttestation)
+		w.Write(attestation.Tag[:])
+		writeVarbytes(w, attestation.Payload)
+	}
+	for i, branch := range branches {
+		if len(attestations)+i < items-1 {
+			w.WriteByte(tagFork)
+		}
+		if err := writeOp(w, branch.Op); err != nil {
+			return err
+		}
+		if err := writeTimestamp(w, branch.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeOp(w *bytes.Buffer, op Op) error {
+	w.WriteByte(op.Tag)
+	switch op.Tag {
+	case OpAppend, OpPrepend:
+		if len(op.Arg) == 0 || len(op.Arg) > MaxMessageSize {
+			return fmt.Errorf("argument of operation %s has %d bytes", op, len(op.Arg))
+		}
+		writeVarbytes(w, op.Arg)
+	case OpSHA1, OpRIPEMD160, OpSHA256, OpKeccak256, OpReverse, OpHexlify:
+	default:
+		return fmt.Errorf("unknown operation 0x%02x", op.Tag)
+	}
+	return nil
+}
+
+// readTimestamp reads a timestamp, applying its operations to the message to
+// check that they are valid.
+func readTimestamp(r *bytes.Reader, msg []byte, depth int) (*Timestamp, error) {
+	if depth <= 0 {
+		return nil, errors.New("timestamp is too deep")
+	}
+
+	t := &Timestamp{}
+	for {
+		tag, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		fork := tag == tagFork
+		if fork {
+			if tag, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		}
+
+		if tag == tagAttestation {
+			var attestation Attestation
+			if _, err := io.ReadFull(r, attestation.Tag[:]); err != nil {
+				return nil, err
+			}
+			if attestation.Payload, err = readVarbytes(r, maxPayloadSize); err != nil {
+				return nil, err
+			}
+			t.Attestations = append(t.Attestations, attestation)
+		} else {
+			op := Op{Tag: tag}
+			if tag == OpAppend || tag == OpPrepend {
+				if op.Arg, err = readVarbytes(r, MaxMessageSize); err != nil {
+					return nil, err
+				}
+			}
+			next, err := op.Apply(msg)
+			if err != nil {
+				return nil, err
+			}
+			child, err := readTimestamp(r, next, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			t.Branches = append(t.Branches, &Branch{Op: op, Timestamp: child})
+		}
+
+		if !fork {
+			return t, nil
+		}
+	}
+}
+
+func writeVaruint(w *bytes.Buffer, value uint64) {
+	for value > 0x7f {
+		w.WriteByte(byte(value&0x7f) | 0x80)
+		value >>= 7
+	}
+	w.WriteByte(byte(value))
+}
+
+func readVaruint(r io.ByteReader) (uint64, error) {
+	var value uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, errors.New("varuint overflows 64 bits")
+}
+
+func writeVarbytes(w *bytes.Buffer, data []byte) {
+	writeVaruint(w, uint64(len(data)))
+	w.Write(data)
+}
+
+func readVarbytes(r *bytes.Reader, max int) ([]byte, error) {
+	size, err := readVaruint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(max) || size > uint64(r.Len()) {
+		return nil, fmt.Errorf("varbytes of %d bytes exceeds %d bytes", size, max)
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	return data, err
+}
@@ -0,0 +1,298 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ots
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/btctesting"
+	"github.com/stratumn/sdk/blockchain/btc/btctimestamper"
+	"github.com/stratumn/sdk/merkle"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/types"
+)
+
+func TestEncode(t *testing.T) {
+	digest := bytes.Repeat([]byte{0x01}, 32)
+	d := &DetachedTimestamp{
+		FileHashOp: SHA256(),
+		Digest:     digest,
+		Timestamp:  NewTimestamp([]Op{Append([]byte{0xaa, 0xbb}), SHA256()}, BitcoinAttestation(300)),
+	}
+
+	data, err := d.Encode()
+	if err != nil {
+		t.Fatalf("d.Encode(): err: %s", err)
+	}
+
+	want := append(append([]byte{}, Magic...), 0x01, 0x08)
+	want = append(want, digest...)
+	want = append(want, mustDecodeHex(t, "f002aabb08000588960d73d7190102ac02")...)
+	if !bytes.Equal(data, want) {
+		t.Errorf("d.Encode() = %x want %x", data, want)
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode(): err: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, d) {
+		t.Errorf("Decode() = %#v want %#v", decoded, d)
+	}
+
+	attested, err := decoded.Evaluate()
+	if err != nil {
+		t.Fatalf("decoded.Evaluate(): err: %s", err)
+	}
+	sum := sha256.Sum256(append(digest, 0xaa, 0xbb))
+	if len(attested) != 1 || !bytes.Equal(attested[0].Message, sum[:]) {
+		t.Fatalf("decoded.Evaluate() = %v want message %x", attested, sum)
+	}
+	if height, ok := attested[0].Attestation.BitcoinHeight(); !ok || height != 300 {
+		t.Errorf("BitcoinHeight() = %d, %t want 300, true", height, ok)
+	}
+}
+
+func TestEncode_fork(t *testing.T) {
+	pending := Attestation{Tag: PendingTag, Payload: []byte("\x1ehttps://alice.btc.calendar.org")}
+	d := &DetachedTimestamp{
+		FileHashOp: SHA256(),
+		Digest:     testutil.RandomHash()[:],
+		Timestamp: &Timestamp{
+			Branches: []*Branch{{
+				Op: Prepend([]byte{0x42}),
+				Timestamp: &Timestamp{
+					Attestations: []Attestation{pending},
+					Branches: []*Branch{
+						{Op: SHA256(), Timestamp: NewTimestamp(nil, BitcoinAttestation(1))},
+						{Op: Append([]byte{0x43}), Timestamp: NewTimestamp([]Op{SHA256()}, BitcoinAttestation(2))},
+					},
+				},
+			}},
+		},
+	}
+
+	data, err := d.Encode()
+	if err != nil {
+		t.Fatalf("d.Encode(): err: %s", err)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode(): err: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, d) {
+		t.Errorf("Decode() = %#v want %#v", decoded, d)
+	}
+
+	attested, err := decoded.Evaluate()
+	if err != nil {
+		t.Fatalf("decoded.Evaluate(): err: %s", err)
+	}
+	if got, want := len(attested), 3; got != want {
+		t.Errorf("len(attested) = %d want %d", got, want)
+	}
+}
+
+func TestEncode_empty(t *testing.T) {
+	d := &DetachedTimestamp{
+		FileHashOp: SHA256(),
+		Digest:     testutil.RandomHash()[:],
+		Timestamp:  &Timestamp{},
+	}
+	if _, err := d.Encode(); err != ErrEmptyTimestamp {
+		t.Errorf("d.Encode(): err = %v want %v", err, ErrEmptyTimestamp)
+	}
+}
+
+func TestDecode_invalid(t *testing.T) {
+	valid, err := (&DetachedTimestamp{
+		FileHashOp: SHA256(),
+		Digest:     testutil.RandomHash()[:],
+		Timestamp:  NewTimestamp([]Op{SHA256()}, BitcoinAttestation(1)),
+	}).Encode()
+	if err != nil {
+		t.Fatalf("Encode(): err: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"magic", append([]byte("not ots"), valid[7:]...)},
+		{"truncated", valid[:len(valid)-1]},
+		{"trailing data", append(append([]byte{}, valid...), 0x00)},
+		{"unknown operation", append(append([]byte{}, valid[:len(Magic)+34]...), 0x42)},
+	}
+	for _, tt := range tests {
+		if _, err := Decode(tt.data); err == nil {
+			t.Errorf("%s: Decode(): err = nil want Error", tt.name)
+		}
+	}
+}
+
+// TestDecode_genesis decodes a timestamp of 32 bytes of the coinbase of the
+// genesis block of the main network, written by hand following the
+// OpenTimestamps format and attested by block 0, so that it can also be
+// checked with the standard OpenTimestamps tools.
+func TestDecode_genesis(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "genesis.ots"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile(): err: %s", err)
+	}
+
+	d, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode(): err: %s", err)
+	}
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	coinbase := genesis.Transactions[0].TxOut[0].PkScript
+	if !bytes.Equal(d.Digest, coinbase[2:34]) {
+		t.Errorf("d.Digest = %x want %x", d.Digest, coinbase[2:34])
+	}
+
+	attested, err := d.Evaluate()
+	if err != nil {
+		t.Fatalf("d.Evaluate(): err: %s", err)
+	}
+	if len(attested) != 1 {
+		t.Fatalf("len(attested) = %d want 1", len(attested))
+	}
+	if height, ok := attested[0].Attestation.BitcoinHeight(); !ok || height != 0 {
+		t.Errorf("attested height = %d, %t want 0, true", height, ok)
+	}
+	if root := genesis.Header.MerkleRoot; !bytes.Equal(attested[0].Message, root[:]) {
+		t.Errorf("attested message = %x want %x", attested[0].Message, root[:])
+	}
+
+	encoded, err := d.Encode()
+	if err != nil {
+		t.Fatalf("d.Encode(): err: %s", err)
+	}
+	if !bytes.Equal(encoded, data) {
+		t.Errorf("d.Encode() = %x want %x", encoded, data)
+	}
+}
+
+func TestFromBatch(t *testing.T) {
+	// Five leaves give a Merkle path of several nodes.
+	leaves := make([]types.Bytes32, 5)
+	for i := range leaves {
+		leaves[i] = *testutil.RandomHash()
+	}
+	tree, err := merkle.NewStaticTree(leaves)
+	if err != nil {
+		t.Fatalf("merkle.NewStaticTree(): err: %s", err)
+	}
+
+	harness := btctesting.NewHarness(btc.NetworkRegtest)
+	privKey, _ := btcec.NewPrivateKey(btcec.S256())
+	wif, _ := btcutil.NewWIF(privKey, btc.NetworkRegtest.Params(), true)
+	ts, err := btctimestamper.New(&btctimestamper.Config{
+		UnspentFinder: harness,
+		Broadcaster:   harness,
+		WIF:           wif.String(),
+		Network:       btc.NetworkRegtest,
+		AddressType:   btctimestamper.AddressP2WPKH,
+		Fee:           1000,
+	})
+	if err != nil {
+		t.Fatalf("btctimestamper.New(): err: %s", err)
+	}
+	harness.Fund(ts.Address(), 100000)
+
+	// Other transactions in the block.
+	for i := 0; i < 2; i++ {
+		if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+			t.Fatalf("ts.TimestampHash(): err: %s", err)
+		}
+	}
+	txid, err := ts.TimestampHash(tree.Root())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	if _, err := harness.TransactionProof(txid); err != btc.ErrTransactionNotMined {
+		t.Fatalf("harness.TransactionProof(): err = %v want %v", err, btc.ErrTransactionNotMined)
+	}
+	harness.Mine(1)
+
+	proof, err := harness.TransactionProof(txid)
+	if err != nil {
+		t.Fatalf("harness.TransactionProof(): err: %s", err)
+	}
+
+	for i := range leaves {
+		d, err := FromBatch(&leaves[i], tree.Path(i), tree.Root(), proof)
+		if err != nil {
+			t.Fatalf("FromBatch(): err: %s", err)
+		}
+
+		data, err := d.Encode()
+		if err != nil {
+			t.Fatalf("d.Encode(): err: %s", err)
+		}
+		decoded, err := Decode(data)
+		if err != nil {
+			t.Fatalf("Decode(): err: %s", err)
+		}
+		if !bytes.Equal(decoded.Digest, leaves[i][:]) {
+			t.Errorf("decoded.Digest = %x want %x", decoded.Digest, leaves[i])
+		}
+
+		attested, err := decoded.Evaluate()
+		if err != nil {
+			t.Fatalf("decoded.Evaluate(): err: %s", err)
+		}
+		if len(attested) != 1 {
+			t.Fatalf("len(attested) = %d want 1", len(attested))
+		}
+		root := harness.MerkleRoot(proof.BlockHeight)
+		if !bytes.Equal(attested[0].Message, root[:]) {
+			t.Errorf("attested message = %x want %x", attested[0].Message, root)
+		}
+		if height, _ := attested[0].Attestation.BitcoinHeight(); int64(height) != proof.BlockHeight {
+			t.Errorf("attested height = %d want %d", height, proof.BlockHeight)
+		}
+	}
+}
+
+func TestFromBatch_wrongHash(t *testing.T) {
+	leaves := []types.Bytes32{*testutil.RandomHash(), *testutil.RandomHash()}
+	tree, _ := merkle.NewStaticTree(leaves)
+
+	if _, err := FromBatch(testutil.RandomHash(), tree.Path(0), tree.Root(), &btc.TransactionProof{}); err == nil {
+		t.Error("FromBatch(): err = nil want Error")
+	}
+	if _, err := FromBatch(&leaves[0], tree.Path(0), tree.Root(), &btc.TransactionProof{Raw: []byte{0x01}}); err == nil {
+		t.Error("FromBatch(): err = nil want Error")
+	}
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("hex.DecodeString(): err: %s", err)
+	}
+	return b
+}
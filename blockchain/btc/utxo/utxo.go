@@ -0,0 +1,717 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package utxo implements a local tracker of the unspent outputs of a Bitcoin
+// address.
+//
+// The tracker sits between a timestamper and a Bitcoin backend. It reserves
+// the outputs it returns so that successive transactions never spend the
+// same outputs, makes the change of unconfirmed transactions spendable right
+// away, and follows transactions until they are confirmed.
+package utxo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/store"
+	"github.com/stratumn/sdk/types"
+)
+
+const (
+	// DefaultMaxChainDepth is the default maximum number of unconfirmed
+	// transactions in a chain of change outputs. Nodes do not relay
+	// transactions with more than 25 unconfirmed ancestors by default.
+	DefaultMaxChainDepth = 24
+
+	// DefaultReservationTimeout is the default duration after which a
+	// reserved output that was neither spent nor released is available
+	// again.
+	DefaultReservationTimeout = 10 * time.Minute
+
+	// DefaultPollInterval is the default interval between queries of the
+	// status of transactions.
+	DefaultPollInterval = time.Minute
+
+	// DefaultMaxMissingPolls is the default number of consecutive polls
+	// after which a missing transaction is considered dropped.
+	DefaultMaxMissingPolls = 10
+
+	// DefaultConsolidateInterval is the default interval between
+	// consolidations of dust outputs.
+	DefaultConsolidateInterval = time.Hour
+
+	// DefaultDustThreshold is the default value in satoshis under which an
+	// output is consolidated.
+	DefaultDustThreshold = int64(10000)
+
+	// DefaultMinConsolidation is the default minimum number of dust outputs
+	// worth consolidating.
+	DefaultMinConsolidation = 5
+
+	// maxConsolidation is the maximum number of outputs consolidated in a
+	// single transaction.
+	maxConsolidation = 100
+
+	// forgetConfirmations is the number of confirmations after which a
+	// transaction is no longer tracked.
+	forgetConfirmations = 6
+
+	// keyPrefix is the prefix of the key of the state in the store.
+	keyPrefix = "btc-utxo:"
+)
+
+// Consolidator must be able to spend outputs to the tracked address in a
+// single transaction.
+type Consolidator interface {
+	// Consolidate broadcasts a transaction spending outputs of the
+	// tracked address to the same address.
+	Consolidate(outputs []btc.Output) (types.TransactionID, error)
+}
+
+// Config contains configuration options for the tracker.
+type Config struct {
+	// The store where the state of the tracker is saved.
+	Store store.KeyValueStore
+
+	// The tracked address.
+	Address btcutil.Address
+
+	// The backend used to find outputs the tracker does not know about,
+	// such as the outputs funding the address.
+	UnspentFinder btc.UnspentFinder
+
+	// The backend used to broadcast transactions.
+	Broadcaster btc.Broadcaster
+
+	// The backend used to follow transactions until they are confirmed.
+	ChainQuerier blockchain.ChainQuerier
+
+	// Maximum number of unconfirmed transactions in a chain of change
+	// outputs.
+	MaxChainDepth int
+
+	// Duration after which a reserved output is available again.
+	ReservationTimeout time.Duration
+
+	// Interval between queries of the status of transactions.
+	PollInterval time.Duration
+
+	// Number of consecutive polls after which a missing transaction is
+	// considered dropped and the outputs it spent are available again.
+	MaxMissingPolls int
+
+	// Interval between consolidations of dust outputs.
+	ConsolidateInterval time.Duration
+
+	// Value in satoshis under which an output is consolidated.
+	DustThreshold int64
+
+	// Minimum number of dust outputs worth consolidating.
+	MinConsolidation int
+}
+
+// GetMaxChainDepth returns the configuration's maximum chain depth or the
+// default value.
+func (c *Config) GetMaxChainDepth() int {
+	if c.MaxChainDepth > 0 {
+		return c.MaxChainDepth
+	}
+	return DefaultMaxChainDepth
+}
+
+// GetReservationTimeout returns the configuration's reservation timeout or the
+// default value.
+func (c *Config) GetReservationTimeout() time.Duration {
+	if c.ReservationTimeout > 0 {
+		return c.ReservationTimeout
+	}
+	return DefaultReservationTimeout
+}
+
+// GetPollInterval returns the configuration's poll interval or the default
+// value.
+func (c *Config) GetPollInterval() time.Duration {
+	if c.PollInterval > 0 {
+		return c.PollInterval
+	}
+	return DefaultPollInterval
+}
+
+// GetMaxMissingPolls returns the configuration's maximum number of missing
+// polls or the default value.
+func (c *Config) GetMaxMissingPolls() int {
+	if c.MaxMissingPolls > 0 {
+		return c.MaxMissingPolls
+	}
+	return DefaultMaxMissingPolls
+}
+
+// GetConsolidateInterval returns the configuration's consolidation interval or
+// the default value.
+func (c *Config) GetConsolidateInterval() time.Duration {
+	if c.ConsolidateInterval > 0 {
+		return c.ConsolidateInterval
+	}
+	return DefaultConsolidateInterval
+}
+
+// GetDustThreshold returns the configuration's dust threshold or the default
+// value.
+func (c *Config) GetDustThreshold() int64 {
+	if c.DustThreshold > 0 {
+		return c.DustThreshold
+	}
+	return DefaultDustThreshold
+}
+
+// GetMinConsolidation returns the configuration's minimum number of outputs to
+// consolidate or the default value.
+func (c *Config) GetMinConsolidation() int {
+	if c.MinConsolidation > 0 {
+		return c.MinConsolidation
+	}
+	return DefaultMinConsolidation
+}
+
+// output is an unspent output of the tracked address.
+type output struct {
+	TXHash   string `json:"txHash"`
+	Index    int    `json:"index"`
+	PKScript []byte `json:"pkScript"`
+	Value    int64  `json:"value"`
+
+	// Reservations are not saved, all outputs are available after a
+	// restart.
+	reservedAt time.Time
+}
+
+func (o *output) key() string {
+	return outPointKey(o.TXHash, o.Index)
+}
+
+func (o *output) toBTC() (btc.Output, error) {
+	out := btc.Output{PKScript: o.PKScript, Index: o.Index, Value: o.Value}
+	err := out.TXHash.Unstring(o.TXHash)
+	return out, err
+}
+
+// transaction is a transaction broadcast by the tracker that does not have
+// enough confirmations yet.
+type transaction struct {
+	Hash  string    `json:"hash"`
+	Spent []*output `json:"spent"`
+	Mined bool      `json:"mined"`
+
+	missing int
+}
+
+// state is the state of the tracker saved in the store.
+type state struct {
+	Outputs      []*output      `json:"outputs"`
+	Transactions []*transaction `json:"transactions"`
+}
+
+// Tracker tracks the unspent outputs of an address.
+//
+// It implements github.com/stratumn/sdk/blockchain/btc.UnspentFinder and
+// github.com/stratumn/sdk/blockchain/btc.Broadcaster. It must be used as
+// both by the timestamper of the address so that it sees all the
+// transactions spending its outputs.
+type Tracker struct {
+	config   *Config
+	key      []byte
+	pkScript []byte
+
+	mu      sync.Mutex
+	outputs map[string]*output
+	txs     map[string]*transaction
+}
+
+// New creates a tracker and loads its state from the store.
+func New(config *Config) (*Tracker, error) {
+	if config.Store == nil || config.Address == nil || config.UnspentFinder == nil ||
+		config.Broadcaster == nil || config.ChainQuerier == nil {
+		return nil, errors.New("the store, the address, the unspent finder, the broadcaster and the chain querier are required")
+	}
+
+	PKScript, err := txscript.PayToAddrScript(config.Address)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	t := &Tracker{
+		config:   config,
+		key:      []byte(keyPrefix + config.Address.EncodeAddress()),
+		pkScript: PKScript,
+		outputs:  map[string]*output{},
+		txs:      map[string]*transaction{},
+	}
+
+	data, err := config.Store.GetValue(t.key)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		var s state
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, errors.Wrap(err, "invalid UTXO tracker state")
+		}
+		for _, out := range s.Outputs {
+			t.outputs[out.key()] = out
+		}
+		for _, tx := range s.Transactions {
+			t.txs[tx.Hash] = tx
+		}
+	}
+
+	return t, nil
+}
+
+// FindUnspent implements
+// github.com/stratumn/sdk/blockchain/btc.UnspentFinder.FindUnspent.
+// The outputs are reserved until a transaction spending them is broadcast or
+// they are released. Confirmed outputs are spent first. If the tracker does
+// not know enough outputs, it asks the backend for more.
+func (t *Tracker) FindUnspent(address btcutil.Address, amount int64) ([]btc.Output, int64, error) {
+	if address.EncodeAddress() != t.config.Address.EncodeAddress() {
+		return nil, 0, fmt.Errorf("address %s is not tracked", address)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	selected, total := t.selectOutputs(amount)
+	if total < amount {
+		if err := t.importOutputs(amount); err != nil {
+			return nil, 0, err
+		}
+		if selected, total = t.selectOutputs(amount); total < amount {
+			return nil, 0, fmt.Errorf("Not enough Bitcoins available on %s, expected at least %d satoshis got %d", address, amount, total)
+		}
+	}
+
+	outputs := make([]btc.Output, len(selected))
+	now := time.Now()
+	for i, out := range selected {
+		var err error
+		if outputs[i], err = out.toBTC(); err != nil {
+			return nil, 0, err
+		}
+		out.reservedAt = now
+	}
+
+	return outputs, total, nil
+}
+
+// Release releases reserved outputs that will not be spent.
+func (t *Tracker) Release(outputs []btc.Output) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, o := range outputs {
+		if out, ok := t.outputs[outPointKey(o.TXHash.String(), o.Index)]; ok {
+			out.reservedAt = time.Time{}
+		}
+	}
+}
+
+// Broadcast implements
+// github.com/stratumn/sdk/blockchain/btc.Broadcaster.Broadcast.
+// If the transaction is accepted, the outputs it spends are removed and its
+// outputs to the tracked address become available. Otherwise the outputs it
+// spends are released. A transaction spending the same outputs as a tracked
+// transaction replaces it.
+func (t *Tracker) Broadcast(raw []byte) error {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := t.config.Broadcaster.Broadcast(raw); err != nil {
+		t.mu.Lock()
+		for _, txIn := range tx.TxIn {
+			if out, ok := t.outputs[outPointKey(txIn.PreviousOutPoint.Hash.String(), int(txIn.PreviousOutPoint.Index))]; ok {
+				out.reservedAt = time.Time{}
+			}
+		}
+		t.mu.Unlock()
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.record(tx)
+
+	return t.save()
+}
+
+// Balance returns the confirmed and unconfirmed balance of the address, in
+// satoshis, including reserved outputs.
+func (t *Tracker) Balance() (confirmed, unconfirmed int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, out := range t.outputs {
+		if t.depth(out.TXHash) == 0 {
+			confirmed += out.Value
+		} else {
+			unconfirmed += out.Value
+		}
+	}
+
+	return
+}
+
+// Start polls the status of transactions and consolidates dust outputs until
+// the context is canceled. The consolidator is optional.
+func (t *Tracker) Start(ctx context.Context, consolidator Consolidator) {
+	pollTicker := time.NewTicker(t.config.GetPollInterval())
+	defer pollTicker.Stop()
+
+	consolidateTicker := time.NewTicker(t.config.GetConsolidateInterval())
+	defer consolidateTicker.Stop()
+
+	for {
+		select {
+		case <-pollTicker.C:
+			if err := t.Poll(); err != nil {
+				log.WithField("error", err).Error("Failed to save UTXO tracker state")
+			}
+		case <-consolidateTicker.C:
+			if consolidator == nil {
+				continue
+			}
+			if _, err := t.Consolidate(consolidator); err != nil {
+				log.WithField("error", err).Error("Failed to consolidate dust outputs")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Poll queries the status of the tracked transactions.
+func (t *Tracker) Poll() error {
+	t.mu.Lock()
+	hashes := make([]string, 0, len(t.txs))
+	for hash := range t.txs {
+		hashes = append(hashes, hash)
+	}
+	t.mu.Unlock()
+
+	for _, hash := range hashes {
+		txid, err := types.NewBytes32FromString(hash)
+		if err != nil {
+			return err
+		}
+		status, err := t.config.ChainQuerier.TransactionStatus(txid[:])
+
+		t.mu.Lock()
+		tx, ok := t.txs[hash]
+		switch {
+		case !ok:
+			// The transaction was replaced in the meantime.
+		case errors.Cause(err) == blockchain.ErrTransactionNotFound:
+			if tx.missing++; tx.missing >= t.config.GetMaxMissingPolls() {
+				log.WithField("txid", hash).Warn("Transaction dropped, its outputs are available again")
+				t.remove(tx, true)
+			}
+		case err != nil:
+			log.WithFields(log.Fields{
+				"txid":  hash,
+				"error": err,
+			}).Error("Failed to query transaction status")
+		case !status.Mined:
+			tx.missing = 0
+			tx.Mined = false
+		case status.Confirmations >= forgetConfirmations:
+			delete(t.txs, hash)
+		default:
+			tx.missing = 0
+			tx.Mined = true
+		}
+		t.mu.Unlock()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.save()
+}
+
+// Consolidate spends the confirmed outputs whose value is under the dust
+// threshold in a single transaction if there are enough of them. It returns
+// nil if there was nothing to consolidate.
+func (t *Tracker) Consolidate(consolidator Consolidator) (types.TransactionID, error) {
+	t.mu.Lock()
+	var dust []*output
+	for _, out := range t.available() {
+		if t.depth(out.TXHash) == 0 && out.Value < t.config.GetDustThreshold() {
+			dust = append(dust, out)
+		}
+	}
+	if len(dust) < t.config.GetMinConsolidation() {
+		t.mu.Unlock()
+		return nil, nil
+	}
+
+	// Consolidate the smallest outputs first.
+	sort.Slice(dust, func(i, j int) bool { return dust[i].Value < dust[j].Value })
+	if len(dust) > maxConsolidation {
+		dust = dust[:maxConsolidation]
+	}
+
+	outputs := make([]btc.Output, len(dust))
+	now := time.Now()
+	for i, out := range dust {
+		var err error
+		if outputs[i], err = out.toBTC(); err != nil {
+			t.mu.Unlock()
+			return nil, err
+		}
+		out.reservedAt = now
+	}
+	t.mu.Unlock()
+
+	txid, err := consolidator.Consolidate(outputs)
+	if err != nil {
+		t.Release(outputs)
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"txid":    txid,
+		"outputs": len(outputs),
+	}).Info("Consolidated dust outputs")
+
+	return txid, nil
+}
+
+// available returns the outputs that are not reserved and can be spent
+// without exceeding the maximum chain depth.
+func (t *Tracker) available() []*output {
+	var outputs []*output
+	expired := time.Now().Add(-t.config.GetReservationTimeout())
+	for _, out := range t.outputs {
+		if !out.reservedAt.IsZero() && out.reservedAt.After(expired) {
+			continue
+		}
+		if t.depth(out.TXHash) >= t.config.GetMaxChainDepth() {
+			continue
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs
+}
+
+// selectOutputs selects available outputs until their total covers the
+// amount, preferring confirmed outputs then large outputs.
+func (t *Tracker) selectOutputs(amount int64) ([]*output, int64) {
+	outputs := t.available()
+	depths := map[string]int{}
+	for _, out := range outputs {
+		depths[out.TXHash] = t.depth(out.TXHash)
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		a, b := outputs[i], outputs[j]
+		if depths[a.TXHash] != depths[b.TXHash] {
+			return depths[a.TXHash] < depths[b.TXHash]
+		}
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		return a.key() < b.key()
+	})
+
+	var total int64
+	for i, out := range outputs {
+		total += out.Value
+		if total >= amount {
+			return outputs[:i+1], total
+		}
+	}
+
+	return outputs, total
+}
+
+// importOutputs asks the backend for outputs of the address the tracker does
+// not know about.
+func (t *Tracker) importOutputs(amount int64) error {
+	// The backend may return outputs that cannot be used, such as
+	// reserved outputs and outputs spent by unconfirmed transactions, so
+	// ask for enough to cover them as well, unless it does not have that
+	// much.
+	var unusable int64
+	expired := time.Now().Add(-t.config.GetReservationTimeout())
+	for _, out := range t.outputs {
+		if !out.reservedAt.IsZero() && out.reservedAt.After(expired) {
+			unusable += out.Value
+		}
+	}
+	for _, tx := range t.txs {
+		if !tx.Mined {
+			for _, out := range tx.Spent {
+				unusable += out.Value
+			}
+		}
+	}
+
+	found, _, err := t.config.UnspentFinder.FindUnspent(t.config.Address, amount+unusable)
+	if err != nil && unusable > 0 {
+		found, _, err = t.config.UnspentFinder.FindUnspent(t.config.Address, amount)
+	}
+	if err != nil {
+		return err
+	}
+
+	imported := 0
+	for _, o := range found {
+		key := outPointKey(o.TXHash.String(), o.Index)
+		if _, ok := t.outputs[key]; ok || t.spender(key) != nil {
+			continue
+		}
+		t.outputs[key] = &output{
+			TXHash:   o.TXHash.String(),
+			Index:    o.Index,
+			PKScript: o.PKScript,
+			Value:    o.Value,
+		}
+		imported++
+	}
+
+	if imported == 0 {
+		return nil
+	}
+	return t.save()
+}
+
+// record records a broadcast transaction.
+func (t *Tracker) record(msgTx *wire.MsgTx) {
+	tx := &transaction{Hash: msgTx.TxHash().String()}
+
+	for _, txIn := range msgTx.TxIn {
+		key := outPointKey(txIn.PreviousOutPoint.Hash.String(), int(txIn.PreviousOutPoint.Index))
+		if out, ok := t.outputs[key]; ok {
+			delete(t.outputs, key)
+			out.reservedAt = time.Time{}
+			tx.Spent = append(tx.Spent, out)
+			continue
+		}
+		if replaced := t.spender(key); replaced != nil {
+			t.remove(replaced, true)
+			if out, ok := t.outputs[key]; ok {
+				delete(t.outputs, key)
+				out.reservedAt = time.Time{}
+				tx.Spent = append(tx.Spent, out)
+			}
+		}
+	}
+
+	for i, txOut := range msgTx.TxOut {
+		if bytes.Equal(txOut.PkScript, t.pkScript) {
+			out := &output{TXHash: tx.Hash, Index: i, PKScript: txOut.PkScript, Value: txOut.Value}
+			t.outputs[out.key()] = out
+		}
+	}
+
+	t.txs[tx.Hash] = tx
+}
+
+// remove removes a replaced or dropped transaction and its outputs. If
+// restore is true, the outputs it spent are available again.
+func (t *Tracker) remove(tx *transaction, restore bool) {
+	delete(t.txs, tx.Hash)
+	for key, out := range t.outputs {
+		if out.TXHash == tx.Hash {
+			delete(t.outputs, key)
+		}
+	}
+	if restore {
+		for _, out := range tx.Spent {
+			if t.spender(out.key()) == nil {
+				t.outputs[out.key()] = out
+			}
+		}
+	}
+}
+
+// spender returns the tracked transaction spending an output.
+func (t *Tracker) spender(key string) *transaction {
+	for _, tx := range t.txs {
+		for _, out := range tx.Spent {
+			if out.key() == key {
+				return tx
+			}
+		}
+	}
+	return nil
+}
+
+// depth returns the number of unconfirmed transactions in the chain ending
+// with a transaction. It is zero if the transaction is confirmed.
+func (t *Tracker) depth(hash string) int {
+	tx, ok := t.txs[hash]
+	if !ok || tx.Mined {
+		return 0
+	}
+
+	max := 0
+	for _, out := range tx.Spent {
+		if d := t.depth(out.TXHash); d > max {
+			max = d
+		}
+	}
+
+	return max + 1
+}
+
+func (t *Tracker) save() error {
+	s := state{
+		Outputs:      make([]*output, 0, len(t.outputs)),
+		Transactions: make([]*transaction, 0, len(t.txs)),
+	}
+	for _, out := range t.outputs {
+		s.Outputs = append(s.Outputs, out)
+	}
+	for _, tx := range t.txs {
+		s.Transactions = append(s.Transactions, tx)
+	}
+	sort.Slice(s.Outputs, func(i, j int) bool { return s.Outputs[i].key() < s.Outputs[j].key() })
+	sort.Slice(s.Transactions, func(i, j int) bool { return s.Transactions[i].Hash < s.Transactions[j].Hash })
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return t.config.Store.SetValue(t.key, data)
+}
+
+func outPointKey(hash string, index int) string {
+	return fmt.Sprintf("%s:%d", hash, index)
+}
@@ -0,0 +1,303 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utxo_test
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/btctesting"
+	"github.com/stratumn/sdk/blockchain/btc/btctimestamper"
+	"github.com/stratumn/sdk/blockchain/btc/utxo"
+	"github.com/stratumn/sdk/dummystore"
+	"github.com/stratumn/sdk/store"
+	"github.com/stratumn/sdk/testutil"
+)
+
+const testFee = 1000
+
+type testEnv struct {
+	harness *btctesting.Harness
+	store   store.KeyValueStore
+	config  *utxo.Config
+	tracker *utxo.Tracker
+	ts      *btctimestamper.Timestamper
+}
+
+// newTestEnv creates a timestamper spending the outputs of a tracker.
+func newTestEnv(t *testing.T, config *utxo.Config) *testEnv {
+	privKey, _ := btcec.NewPrivateKey(btcec.S256())
+	wif, _ := btcutil.NewWIF(privKey, btc.NetworkRegtest.Params(), true)
+	address, _ := btcutil.NewAddressWitnessPubKeyHash(
+		btcutil.Hash160(privKey.PubKey().SerializeCompressed()),
+		btc.NetworkRegtest.Params(),
+	)
+
+	env := &testEnv{
+		harness: btctesting.NewHarness(btc.NetworkRegtest),
+		store:   dummystore.New(&dummystore.Config{}),
+		config:  config,
+	}
+
+	config.Store = env.store
+	config.Address = address
+	config.UnspentFinder = env.harness
+	config.Broadcaster = env.harness
+	config.ChainQuerier = env.harness
+
+	var err error
+	if env.tracker, err = utxo.New(config); err != nil {
+		t.Fatalf("utxo.New(): err: %s", err)
+	}
+
+	env.ts, err = btctimestamper.New(&btctimestamper.Config{
+		UnspentFinder: env.tracker,
+		Broadcaster:   env.tracker,
+		WIF:           wif.String(),
+		Network:       btc.NetworkRegtest,
+		AddressType:   btctimestamper.AddressP2WPKH,
+		Fee:           testFee,
+		RBF:           true,
+	})
+	if err != nil {
+		t.Fatalf("btctimestamper.New(): err: %s", err)
+	}
+
+	return env
+}
+
+func (env *testEnv) checkBalance(t *testing.T, confirmed, unconfirmed int64) {
+	gotConfirmed, gotUnconfirmed := env.tracker.Balance()
+	if gotConfirmed != confirmed || gotUnconfirmed != unconfirmed {
+		t.Errorf("tracker.Balance() = %d, %d want %d, %d", gotConfirmed, gotUnconfirmed, confirmed, unconfirmed)
+	}
+}
+
+func TestNew_missingConfig(t *testing.T) {
+	if _, err := utxo.New(&utxo.Config{}); err == nil {
+		t.Error("utxo.New(): err = nil want Error")
+	}
+}
+
+func TestTracker_reserve(t *testing.T) {
+	env := newTestEnv(t, &utxo.Config{})
+	env.harness.Fund(env.ts.Address(), 10000)
+	env.harness.Fund(env.ts.Address(), 20000)
+
+	first, _, err := env.tracker.FindUnspent(env.ts.Address(), 5000)
+	if err != nil {
+		t.Fatalf("tracker.FindUnspent(): err: %s", err)
+	}
+	second, _, err := env.tracker.FindUnspent(env.ts.Address(), 5000)
+	if err != nil {
+		t.Fatalf("tracker.FindUnspent(): err: %s", err)
+	}
+	if len(first) != 1 || len(second) != 1 || first[0].TXHash == second[0].TXHash {
+		t.Fatalf("tracker.FindUnspent() returned the same outputs twice: %v, %v", first, second)
+	}
+
+	// Both outputs are reserved.
+	if _, _, err := env.tracker.FindUnspent(env.ts.Address(), 5000); err == nil {
+		t.Error("tracker.FindUnspent(): err = nil want Error")
+	}
+
+	env.tracker.Release(first)
+	released, _, err := env.tracker.FindUnspent(env.ts.Address(), 5000)
+	if err != nil {
+		t.Fatalf("tracker.FindUnspent(): err: %s", err)
+	}
+	if released[0].TXHash != first[0].TXHash {
+		t.Errorf("tracker.FindUnspent() = %v want %v", released, first)
+	}
+}
+
+func TestTracker_FindUnspent_otherAddress(t *testing.T) {
+	env := newTestEnv(t, &utxo.Config{})
+	address, _ := btcutil.NewAddressPubKeyHash(testutil.RandomHash()[:20], btc.NetworkRegtest.Params())
+
+	if _, _, err := env.tracker.FindUnspent(address, 1000); err == nil {
+		t.Error("tracker.FindUnspent(): err = nil want Error")
+	}
+}
+
+func TestTracker_chainChange(t *testing.T) {
+	env := newTestEnv(t, &utxo.Config{MaxChainDepth: 3})
+	env.harness.Fund(env.ts.Address(), 100000)
+
+	// Each transaction spends the unconfirmed change of the previous one.
+	for i := 0; i < 3; i++ {
+		if _, err := env.ts.TimestampHash(testutil.RandomHash()); err != nil {
+			t.Fatalf("ts.TimestampHash(): err: %s", err)
+		}
+	}
+	env.checkBalance(t, 0, 100000-3*testFee)
+
+	// The chain is too long.
+	if _, err := env.ts.TimestampHash(testutil.RandomHash()); err == nil {
+		t.Error("ts.TimestampHash(): err = nil want Error")
+	}
+
+	env.harness.Mine(1)
+	if err := env.tracker.Poll(); err != nil {
+		t.Fatalf("tracker.Poll(): err: %s", err)
+	}
+	env.checkBalance(t, 100000-3*testFee, 0)
+
+	if _, err := env.ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+}
+
+func TestTracker_persist(t *testing.T) {
+	env := newTestEnv(t, &utxo.Config{})
+	env.harness.Fund(env.ts.Address(), 100000)
+
+	if _, err := env.ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	tracker, err := utxo.New(env.config)
+	if err != nil {
+		t.Fatalf("utxo.New(): err: %s", err)
+	}
+	confirmed, unconfirmed := tracker.Balance()
+	if confirmed != 0 || unconfirmed != 100000-testFee {
+		t.Errorf("tracker.Balance() = %d, %d want %d, %d", confirmed, unconfirmed, 0, 100000-testFee)
+	}
+}
+
+func TestTracker_dropped(t *testing.T) {
+	env := newTestEnv(t, &utxo.Config{MaxMissingPolls: 2})
+	env.harness.Fund(env.ts.Address(), 100000)
+
+	txid, err := env.ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	env.harness.Drop(txid)
+
+	for i := 0; i < 2; i++ {
+		if err := env.tracker.Poll(); err != nil {
+			t.Fatalf("tracker.Poll(): err: %s", err)
+		}
+	}
+	env.checkBalance(t, 100000, 0)
+
+	if _, err := env.ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+}
+
+func TestTracker_replace(t *testing.T) {
+	env := newTestEnv(t, &utxo.Config{})
+	env.harness.Fund(env.ts.Address(), 100000)
+
+	txid, err := env.ts.TimestampHash(testutil.RandomHash())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	bumped, err := env.ts.BumpFee(txid)
+	if err != nil {
+		t.Fatalf("ts.BumpFee(): err: %s", err)
+	}
+
+	fee, _ := env.harness.Fee(bumped)
+	env.checkBalance(t, 0, 100000-fee)
+}
+
+func TestTracker_Consolidate(t *testing.T) {
+	env := newTestEnv(t, &utxo.Config{DustThreshold: 5000, MinConsolidation: 3})
+	for i := 0; i < 2; i++ {
+		env.harness.Fund(env.ts.Address(), 4000)
+	}
+	env.harness.Fund(env.ts.Address(), 50000)
+
+	// Import the outputs.
+	outputs, _, err := env.tracker.FindUnspent(env.ts.Address(), 58000)
+	if err != nil {
+		t.Fatalf("tracker.FindUnspent(): err: %s", err)
+	}
+	env.tracker.Release(outputs)
+
+	// Only two outputs are dust.
+	txid, err := env.tracker.Consolidate(env.ts)
+	if err != nil {
+		t.Fatalf("tracker.Consolidate(): err: %s", err)
+	}
+	if txid != nil {
+		t.Fatalf("tracker.Consolidate() = %s want nil", txid)
+	}
+
+	env.harness.Fund(env.ts.Address(), 3000)
+	outputs, _, err = env.tracker.FindUnspent(env.ts.Address(), 61000)
+	if err != nil {
+		t.Fatalf("tracker.FindUnspent(): err: %s", err)
+	}
+	env.tracker.Release(outputs)
+
+	if txid, err = env.tracker.Consolidate(env.ts); err != nil {
+		t.Fatalf("tracker.Consolidate(): err: %s", err)
+	}
+	tx, ok := env.harness.Transaction(txid)
+	if !ok {
+		t.Fatal("consolidation transaction was not broadcast")
+	}
+	if got, want := len(tx.TxIn), 3; got != want {
+		t.Errorf("len(tx.TxIn) = %d want %d", got, want)
+	}
+	if got, want := len(tx.TxOut), 1; got != want {
+		t.Errorf("len(tx.TxOut) = %d want %d", got, want)
+	}
+
+	fee, _ := env.harness.Fee(txid)
+	env.checkBalance(t, 50000, 11000-fee)
+}
+
+func TestTimestamper_Balance(t *testing.T) {
+	privKey, _ := btcec.NewPrivateKey(btcec.S256())
+	wif, _ := btcutil.NewWIF(privKey, btc.NetworkRegtest.Params(), true)
+	harness := btctesting.NewHarness(btc.NetworkRegtest)
+
+	ts, err := btctimestamper.New(&btctimestamper.Config{
+		UnspentFinder: harness,
+		Broadcaster:   harness,
+		WIF:           wif.String(),
+		Network:       btc.NetworkRegtest,
+		Fee:           testFee,
+		UTXOStore:     dummystore.New(&dummystore.Config{}),
+		ChainQuerier:  harness,
+	})
+	if err != nil {
+		t.Fatalf("btctimestamper.New(): err: %s", err)
+	}
+	harness.Fund(ts.Address(), 100000)
+
+	if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	balance, err := ts.Balance()
+	if err != nil {
+		t.Fatalf("ts.Balance(): err: %s", err)
+	}
+	if got, want := balance.Unconfirmed, int64(100000-testFee); got != want {
+		t.Errorf("balance.Unconfirmed = %d want %d", got, want)
+	}
+	if got, want := balance.Runway, int64(99); got != want {
+		t.Errorf("balance.Runway = %d want %d", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package eth defines primitives to work with Ethereum.
+package eth
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/stratumn/sdk/types"
+	"golang.org/x/crypto/sha3"
+)
+
+// Network represents an Ethereum network.
+type Network string
+
+const (
+	// NetworkMain is an identifier for the main Ethereum network.
+	NetworkMain Network = "ethereum:main"
+
+	// NetworkRopsten is an identifier for the Ropsten test network.
+	NetworkRopsten Network = "ethereum:ropsten"
+
+	// NetworkRinkeby is an identifier for the Rinkeby test network.
+	NetworkRinkeby Network = "ethereum:rinkeby"
+
+	// NetworkKovan is an identifier for the Kovan test network.
+	NetworkKovan Network = "ethereum:kovan"
+)
+
+var chainIDs = map[Network]int64{
+	NetworkMain:    1,
+	NetworkRopsten: 3,
+	NetworkRinkeby: 4,
+	NetworkKovan:   42,
+}
+
+// String implements fmt.Stringer.
+func (n Network) String() string {
+	return string(n)
+}
+
+// ChainID returns the EIP-155 chain ID of the network.
+// It returns nil if the network is unknown.
+func (n Network) ChainID() *big.Int {
+	if id, ok := chainIDs[n]; ok {
+		return big.NewInt(id)
+	}
+	return nil
+}
+
+// NetworkFromChainID returns the network of an EIP-155 chain ID.
+// Unknown chains, such as private networks, are named after their ID.
+func NetworkFromChainID(chainID *big.Int) Network {
+	for n, id := range chainIDs {
+		if chainID.Cmp(big.NewInt(id)) == 0 {
+			return n
+		}
+	}
+	return Network("ethereum:" + chainID.String())
+}
+
+var (
+	// ErrNonceTooLow is returned when the nonce of a transaction was
+	// already used.
+	ErrNonceTooLow = errors.New("nonce too low")
+
+	// ErrInvalidSignature is returned when the sender of a transaction
+	// cannot be recovered from its signature.
+	ErrInvalidSignature = errors.New("invalid transaction signature")
+)
+
+// CallMsg contains the parameters of a message call, used to estimate gas.
+type CallMsg struct {
+	From     *types.Bytes20
+	To       *types.Bytes20
+	Gas      uint64
+	GasPrice *big.Int
+	Value    *big.Int
+	Data     []byte
+}
+
+// Client is the subset of the Ethereum JSON-RPC API needed to send
+// transactions.
+type Client interface {
+	// ChainID returns the EIP-155 chain ID of the network.
+	ChainID() (*big.Int, error)
+
+	// PendingNonceAt returns the next nonce of an account, including
+	// pending transactions.
+	PendingNonceAt(address *types.Bytes20) (uint64, error)
+
+	// SuggestGasPrice returns a gas price that should get a transaction
+	// mined in a timely manner.
+	SuggestGasPrice() (*big.Int, error)
+
+	// EstimateGas returns the gas needed to execute a message call.
+	EstimateGas(msg *CallMsg) (uint64, error)
+
+	// SendRawTransaction broadcasts a signed transaction and returns its
+	// hash.
+	SendRawTransaction(raw []byte) (*types.Bytes32, error)
+}
+
+// Keccak256 returns the Keccak-256 hash of the concatenation of data.
+func Keccak256(data ...[]byte) *types.Bytes32 {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	var hash types.Bytes32
+	h.Sum(hash[:0])
+	return &hash
+}
+
+// PubKeyToAddress returns the address of a public key.
+func PubKeyToAddress(pubKey *ecdsa.PublicKey) *types.Bytes20 {
+	raw := (*btcec.PublicKey)(pubKey).SerializeUncompressed()
+	var address types.Bytes20
+	copy(address[:], Keccak256(raw[1:])[12:])
+	return &address
+}
+
+// ParsePrivateKey parses a hex encoded private key.
+func ParsePrivateKey(s string) (*btcec.PrivateKey, error) {
+	b, err := DecodeData(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 32 {
+		return nil, errors.New("private key must be 32 bytes long")
+	}
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), b)
+	return privKey, nil
+}
+
+// NewAddress parses a hex encoded address.
+func NewAddress(s string) (*types.Bytes20, error) {
+	b, err := DecodeData(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != types.Bytes20Size {
+		return nil, errors.New("address must be 20 bytes long")
+	}
+	var address types.Bytes20
+	copy(address[:], b)
+	return &address, nil
+}
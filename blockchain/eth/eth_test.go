@@ -0,0 +1,129 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/stratumn/sdk/types"
+)
+
+func TestNetworkString(t *testing.T) {
+	if got, want := NetworkMain.String(), "ethereum:main"; got != want {
+		t.Errorf("NetworkMain.String() = %s want %s", got, want)
+	}
+}
+
+func TestNetworkChainID(t *testing.T) {
+	if got, want := NetworkRopsten.ChainID().Int64(), int64(3); got != want {
+		t.Errorf("NetworkRopsten.ChainID() = %d want %d", got, want)
+	}
+	if got := Network("ethereum:unknown").ChainID(); got != nil {
+		t.Errorf("Network.ChainID() = %d want nil", got)
+	}
+}
+
+func TestNetworkFromChainID(t *testing.T) {
+	if got, want := NetworkFromChainID(big.NewInt(4)), NetworkRinkeby; got != want {
+		t.Errorf("NetworkFromChainID(4) = %s want %s", got, want)
+	}
+	if got, want := NetworkFromChainID(big.NewInt(1337)), Network("ethereum:1337"); got != want {
+		t.Errorf("NetworkFromChainID(1337) = %s want %s", got, want)
+	}
+}
+
+// Example from EIP-155.
+func TestTransactionSign(t *testing.T) {
+	privKey, err := ParsePrivateKey("0x4646464646464646464646464646464646464646464646464646464646464646")
+	if err != nil {
+		t.Fatalf("ParsePrivateKey(): err: %s", err)
+	}
+	to, _ := NewAddress("0x3535353535353535353535353535353535353535")
+	value, _ := new(big.Int).SetString("1000000000000000000", 10)
+	tx := &Transaction{
+		Nonce:    9,
+		GasPrice: big.NewInt(20000000000),
+		Gas:      21000,
+		To:       to,
+		Value:    value,
+	}
+	chainID := big.NewInt(1)
+
+	if got, want := tx.SigningHash(chainID).String(), "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53"; got != want {
+		t.Errorf("tx.SigningHash() = %s want %s", got, want)
+	}
+
+	if err := tx.Sign(privKey, chainID); err != nil {
+		t.Fatalf("tx.Sign(): err: %s", err)
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("tx.MarshalBinary(): err: %s", err)
+	}
+	want := "0xf86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+	if got := EncodeData(raw); got != want {
+		t.Errorf("tx.MarshalBinary() = %s want %s", got, want)
+	}
+
+	sender, err := tx.Sender(chainID)
+	if err != nil {
+		t.Fatalf("tx.Sender(): err: %s", err)
+	}
+	if got, want := sender, PubKeyToAddress(privKey.PubKey().ToECDSA()); *got != *want {
+		t.Errorf("tx.Sender() = %s want %s", got, want)
+	}
+	if _, err := tx.Sender(big.NewInt(3)); err == nil {
+		t.Error("tx.Sender(3): err = nil want Error")
+	}
+}
+
+func TestTransactionUnmarshalBinary(t *testing.T) {
+	privKey, _ := ParsePrivateKey("4646464646464646464646464646464646464646464646464646464646464646")
+	tx := &Transaction{
+		Nonce:    1000,
+		GasPrice: big.NewInt(1),
+		Gas:      100000,
+		To:       &types.Bytes20{1, 2, 3},
+		Value:    big.NewInt(0),
+		Data:     make([]byte, 100),
+	}
+	if err := tx.Sign(privKey, big.NewInt(42)); err != nil {
+		t.Fatalf("tx.Sign(): err: %s", err)
+	}
+	raw, _ := tx.MarshalBinary()
+
+	var got Transaction
+	if err := got.UnmarshalBinary(raw); err != nil {
+		t.Fatalf("got.UnmarshalBinary(): err: %s", err)
+	}
+	if !reflect.DeepEqual(got.Hash(), tx.Hash()) {
+		t.Errorf("got.Hash() = %s want %s", got.Hash(), tx.Hash())
+	}
+	if got.Nonce != tx.Nonce || got.Gas != tx.Gas || *got.To != *tx.To || len(got.Data) != 100 {
+		t.Errorf("got = %#v want %#v", got, tx)
+	}
+
+	if err := got.UnmarshalBinary(raw[:len(raw)-1]); err == nil {
+		t.Error("got.UnmarshalBinary(): err = nil want Error")
+	}
+}
+
+func TestKeccak256(t *testing.T) {
+	if got, want := Keccak256(nil).String(), "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"; got != want {
+		t.Errorf("Keccak256() = %s want %s", got, want)
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ethtesting defines helpers to test Ethereum.
+package ethtesting
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/eth"
+	"github.com/stratumn/sdk/types"
+)
+
+const (
+	// DefaultGasPrice is the gas price suggested by the backend.
+	DefaultGasPrice = 1000000000
+
+	txGas             = 21000
+	txDataZeroGas     = 4
+	txDataNonZeroGas  = 68
+	simulatedGasLimit = 8000000
+)
+
+var (
+	// ErrInsufficientFunds is returned when an account cannot pay for a
+	// transaction.
+	ErrInsufficientFunds = errors.New("insufficient funds for gas * price + value")
+
+	// ErrIntrinsicGas is returned when the gas of a transaction is too low.
+	ErrIntrinsicGas = errors.New("intrinsic gas too low")
+
+	// ErrNonceTooHigh is returned when the nonce of a transaction is
+	// higher than the next nonce of the account.
+	ErrNonceTooHigh = errors.New("nonce too high")
+)
+
+// SimulatedBackend is an in-memory Ethereum network which mines a block for
+// every transaction it receives. It does not execute contract code.
+//
+// It implements github.com/stratumn/sdk/blockchain/eth.Client and
+// github.com/stratumn/sdk/blockchain.ChainQuerier, and serves the same
+// methods over JSON-RPC through net/http.Handler.
+type SimulatedBackend struct {
+	// GasPrice is the gas price suggested by the backend.
+	GasPrice *big.Int
+
+	// SendErr, if set, is returned by the next call to SendRawTransaction.
+	SendErr error
+
+	chainID  *big.Int
+	mu       sync.Mutex
+	balances map[types.Bytes20]*big.Int
+	nonces   map[types.Bytes20]uint64
+	txs      []*minedTx
+	height   uint64
+}
+
+type minedTx struct {
+	tx        *eth.Transaction
+	hash      *types.Bytes32
+	height    uint64
+	blockHash *types.Bytes32
+}
+
+// NewSimulatedBackend creates a new simulated network with the given
+// account balances.
+func NewSimulatedBackend(chainID *big.Int, alloc map[types.Bytes20]*big.Int) *SimulatedBackend {
+	balances := map[types.Bytes20]*big.Int{}
+	for address, balance := range alloc {
+		balances[address] = new(big.Int).Set(balance)
+	}
+	return &SimulatedBackend{
+		GasPrice: big.NewInt(DefaultGasPrice),
+		chainID:  chainID,
+		balances: balances,
+		nonces:   map[types.Bytes20]uint64{},
+	}
+}
+
+// ChainID implements github.com/stratumn/sdk/blockchain/eth.Client.ChainID.
+func (b *SimulatedBackend) ChainID() (*big.Int, error) {
+	return new(big.Int).Set(b.chainID), nil
+}
+
+// PendingNonceAt implements
+// github.com/stratumn/sdk/blockchain/eth.Client.PendingNonceAt.
+func (b *SimulatedBackend) PendingNonceAt(address *types.Bytes20) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nonces[*address], nil
+}
+
+// SuggestGasPrice implements
+// github.com/stratumn/sdk/blockchain/eth.Client.SuggestGasPrice.
+func (b *SimulatedBackend) SuggestGasPrice() (*big.Int, error) {
+	return new(big.Int).Set(b.GasPrice), nil
+}
+
+// EstimateGas implements
+// github.com/stratumn/sdk/blockchain/eth.Client.EstimateGas.
+// It returns the intrinsic gas of the message.
+func (b *SimulatedBackend) EstimateGas(msg *eth.CallMsg) (uint64, error) {
+	return IntrinsicGas(msg.Data), nil
+}
+
+// SendRawTransaction implements
+// github.com/stratumn/sdk/blockchain/eth.Client.SendRawTransaction.
+func (b *SimulatedBackend) SendRawTransaction(raw []byte) (*types.Bytes32, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.SendErr; err != nil {
+		b.SendErr = nil
+		return nil, err
+	}
+
+	tx := &eth.Transaction{}
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, err
+	}
+	from, err := tx.Sender(b.chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch nonce := b.nonces[*from]; {
+	case tx.Nonce < nonce:
+		return nil, eth.ErrNonceTooLow
+	case tx.Nonce > nonce:
+		return nil, ErrNonceTooHigh
+	}
+
+	gasUsed := IntrinsicGas(tx.Data)
+	if tx.Gas < gasUsed || tx.Gas > simulatedGasLimit {
+		return nil, ErrIntrinsicGas
+	}
+
+	balance := b.balance(from)
+	cost := new(big.Int).Mul(tx.GasPrice, new(big.Int).SetUint64(tx.Gas))
+	cost.Add(cost, tx.Value)
+	if balance.Cmp(cost) < 0 {
+		return nil, ErrInsufficientFunds
+	}
+
+	spent := new(big.Int).Mul(tx.GasPrice, new(big.Int).SetUint64(gasUsed))
+	spent.Add(spent, tx.Value)
+	balance.Sub(balance, spent)
+	if tx.To != nil {
+		to := b.balance(tx.To)
+		to.Add(to, tx.Value)
+	}
+
+	b.nonces[*from]++
+	b.height++
+	hash := tx.Hash()
+	b.txs = append(b.txs, &minedTx{
+		tx:        tx,
+		hash:      hash,
+		height:    b.height,
+		blockHash: blockHash(b.height),
+	})
+
+	return hash, nil
+}
+
+// TransactionStatus implements
+// github.com/stratumn/sdk/blockchain.ChainQuerier.TransactionStatus.
+func (b *SimulatedBackend) TransactionStatus(txid types.TransactionID) (*blockchain.TransactionStatus, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	mined := b.find(types.NewBytes32FromBytes(txid))
+	if mined == nil {
+		return nil, blockchain.ErrTransactionNotFound
+	}
+
+	return &blockchain.TransactionStatus{
+		Mined:         true,
+		BlockHash:     mined.blockHash,
+		BlockHeight:   mined.height,
+		Confirmations: b.height - mined.height + 1,
+	}, nil
+}
+
+// Mine adds empty blocks to the chain.
+func (b *SimulatedBackend) Mine(blocks int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.height += uint64(blocks)
+}
+
+// BlockNumber returns the height of the chain.
+func (b *SimulatedBackend) BlockNumber() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.height
+}
+
+// Drop removes a transaction from the chain, as if its block was orphaned
+// and the transaction evicted from the pool. The nonce of the sender is
+// rolled back so that it can be used again.
+func (b *SimulatedBackend) Drop(hash *types.Bytes32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, mined := range b.txs {
+		if *mined.hash == *hash {
+			b.txs = append(b.txs[:i], b.txs[i+1:]...)
+			if from, err := mined.tx.Sender(b.chainID); err == nil && b.nonces[*from] > mined.tx.Nonce {
+				b.nonces[*from] = mined.tx.Nonce
+			}
+			return
+		}
+	}
+}
+
+// BalanceAt returns the balance of an account.
+func (b *SimulatedBackend) BalanceAt(address *types.Bytes20) *big.Int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return new(big.Int).Set(b.balance(address))
+}
+
+// Transactions returns the transactions mined by the backend.
+func (b *SimulatedBackend) Transactions() []*eth.Transaction {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	txs := make([]*eth.Transaction, len(b.txs))
+	for i, mined := range b.txs {
+		txs[i] = mined.tx
+	}
+	return txs
+}
+
+// TransactionByHash returns a mined transaction.
+func (b *SimulatedBackend) TransactionByHash(hash *types.Bytes32) (*eth.Transaction, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if mined := b.find(hash); mined != nil {
+		return mined.tx, true
+	}
+	return nil, false
+}
+
+func (b *SimulatedBackend) find(hash *types.Bytes32) *minedTx {
+	for _, mined := range b.txs {
+		if *mined.hash == *hash {
+			return mined
+		}
+	}
+	return nil
+}
+
+func blockHash(height uint64) *types.Bytes32 {
+	return eth.Keccak256([]byte(eth.EncodeUint64(height)))
+}
+
+func (b *SimulatedBackend) balance(address *types.Bytes20) *big.Int {
+	balance, ok := b.balances[*address]
+	if !ok {
+		balance = new(big.Int)
+		b.balances[*address] = balance
+	}
+	return balance
+}
+
+// IntrinsicGas returns the gas used by a transaction with the given data
+// that does not execute code.
+func IntrinsicGas(data []byte) uint64 {
+	gas := uint64(txGas)
+	for _, c := range data {
+		if c == 0 {
+			gas += txDataZeroGas
+		} else {
+			gas += txDataNonZeroGas
+		}
+	}
+	return gas
+}
+
+type rpcRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcCallMsg struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Gas      string `json:"gas"`
+	GasPrice string `json:"gasPrice"`
+	Value    string `json:"value"`
+	Data     string `json:"data"`
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+// It serves the methods of eth.Client using the Ethereum JSON-RPC API.
+func (b *SimulatedBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	result, err := b.serveRPC(&req)
+	if err != nil {
+		res.Error = &rpcError{Code: -32000, Message: err.Error()}
+	} else {
+		res.Result = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (b *SimulatedBackend) serveRPC(req *rpcRequest) (interface{}, error) {
+	var param string
+	if len(req.Params) > 0 {
+		json.Unmarshal(req.Params[0], &param)
+	}
+
+	switch req.Method {
+	case "eth_chainId":
+		return eth.EncodeQuantity(b.chainID), nil
+	case "eth_getTransactionCount":
+		address, err := eth.NewAddress(param)
+		if err != nil {
+			return nil, err
+		}
+		nonce, err := b.PendingNonceAt(address)
+		if err != nil {
+			return nil, err
+		}
+		return eth.EncodeUint64(nonce), nil
+	case "eth_gasPrice":
+		return eth.EncodeQuantity(b.GasPrice), nil
+	case "eth_estimateGas":
+		var msg rpcCallMsg
+		if len(req.Params) == 0 {
+			return nil, errors.New("missing call message")
+		}
+		if err := json.Unmarshal(req.Params[0], &msg); err != nil {
+			return nil, err
+		}
+		data, err := eth.DecodeData(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		gas, err := b.EstimateGas(&eth.CallMsg{Data: data})
+		if err != nil {
+			return nil, err
+		}
+		return eth.EncodeUint64(gas), nil
+	case "eth_blockNumber":
+		return eth.EncodeUint64(b.BlockNumber()), nil
+	case "eth_getTransactionByHash":
+		hash, err := eth.DecodeData(param)
+		if err != nil {
+			return nil, err
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		mined := b.find(types.NewBytes32FromBytes(hash))
+		if mined == nil {
+			return nil, nil
+		}
+		return map[string]interface{}{
+			"hash":        eth.EncodeData(mined.hash[:]),
+			"nonce":       eth.EncodeUint64(mined.tx.Nonce),
+			"blockHash":   eth.EncodeData(mined.blockHash[:]),
+			"blockNumber": eth.EncodeUint64(mined.height),
+			"input":       eth.EncodeData(mined.tx.Data),
+		}, nil
+	case "eth_sendRawTransaction":
+		raw, err := eth.DecodeData(param)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := b.SendRawTransaction(raw)
+		if err != nil {
+			return nil, err
+		}
+		return eth.EncodeData(hash[:]), nil
+	}
+
+	return nil, errors.New("the method " + req.Method + " does not exist")
+}
@@ -0,0 +1,47 @@
+package ethtimestamper
+
+import (
+	"flag"
+	"math/big"
+
+	"github.com/stratumn/sdk/blockchain/eth"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	contract string
+	gasPrice int64
+	gasLimit uint64
+)
+
+// RegisterFlags registers the flags used by InitializeWithFlags.
+func RegisterFlags() {
+	flag.StringVar(&contract, "ethcontract", "", "optional address of an anchoring contract")
+	flag.Int64Var(&gasPrice, "gasprice", 0, "gas price (wei), defaults to the price suggested by the node")
+	flag.Uint64Var(&gasLimit, "gaslimit", 0, "gas limit, defaults to the gas estimated by the node")
+}
+
+// InitializeWithFlags should be called after RegisterFlags and flag.Parse to initialize
+// an Ethereum timestamper using flag values.
+func InitializeWithFlags(version, commit string, key string, client eth.Client) *Timestamper {
+	if key == "" {
+		log.Fatal("A hex encoded private key is required")
+	}
+
+	config := &Config{
+		Client:          client,
+		PrivateKey:      key,
+		ContractAddress: contract,
+		GasLimit:        gasLimit,
+	}
+	if gasPrice > 0 {
+		config.GasPrice = big.NewInt(gasPrice)
+	}
+
+	ts, err := New(config)
+	if err != nil {
+		log.WithField("error", err).Fatal("Failed to create Ethereum timestamper")
+	}
+	return ts
+}
@@ -0,0 +1,223 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ethtimestamper implements an Ethereum timestamper.
+//
+// Hashes are either sent as the data of a transaction to the timestamper's
+// own address, or passed to the anchor function of a contract such as:
+//
+//	contract Anchor {
+//	    event Anchored(address indexed sender, bytes32 hash);
+//
+//	    function anchor(bytes32 hash) public {
+//	        Anchored(msg.sender, hash);
+//	    }
+//	}
+package ethtimestamper
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/pkg/errors"
+
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/eth"
+	"github.com/stratumn/sdk/types"
+)
+
+const (
+	// Description describes this Timestamper.
+	Description = "Ethereum Timestamper"
+
+	// AnchorMethod is the signature of the contract function called to
+	// anchor a hash.
+	AnchorMethod = "anchor(bytes32)"
+)
+
+// Config contains configuration options for the timestamper.
+type Config struct {
+	// A client to the Ethereum network.
+	Client eth.Client
+
+	// A hex encoded private key.
+	PrivateKey string
+
+	// An optional address of an anchoring contract. If empty, hashes are
+	// sent as transaction data.
+	ContractAddress string
+
+	// An optional gas price in wei. Defaults to the price suggested by
+	// the client.
+	GasPrice *big.Int
+
+	// An optional gas limit. Defaults to the gas estimated by the client.
+	GasLimit uint64
+}
+
+// Timestamper is the type that implements
+// github.com/stratumn/sdk/blockchain.HashTimestamper.
+type Timestamper struct {
+	config   *Config
+	chainID  *big.Int
+	net      eth.Network
+	privKey  *btcec.PrivateKey
+	address  *types.Bytes20
+	contract *types.Bytes20
+
+	mu          sync.Mutex
+	nonce       uint64
+	nonceSynced bool
+}
+
+// New creates an instance of a Timestamper.
+func New(config *Config) (*Timestamper, error) {
+	privKey, err := eth.ParsePrivateKey(config.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &Timestamper{
+		config:  config,
+		privKey: privKey,
+		address: eth.PubKeyToAddress(privKey.PubKey().ToECDSA()),
+	}
+
+	if config.ContractAddress != "" {
+		if ts.contract, err = eth.NewAddress(config.ContractAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	if ts.chainID, err = config.Client.ChainID(); err != nil {
+		return nil, err
+	}
+	ts.net = eth.NetworkFromChainID(ts.chainID)
+
+	return ts, nil
+}
+
+// Network returns the Ethereum network of the timestamper.
+func (ts *Timestamper) Network() blockchain.Network {
+	return ts.net
+}
+
+// Address returns the address of the account sending transactions.
+func (ts *Timestamper) Address() *types.Bytes20 {
+	return ts.address
+}
+
+// GetInfo implements
+// github.com/stratumn/sdk/blockchain.HashTimestamper.
+func (ts *Timestamper) GetInfo() *blockchain.Info {
+	return &blockchain.Info{
+		Network:     ts.net,
+		Description: Description,
+	}
+}
+
+// TimestampHash implements
+// github.com/stratumn/sdk/blockchain.HashTimestamper.
+func (ts *Timestamper) TimestampHash(hash *types.Bytes32) (types.TransactionID, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	txHash, err := ts.send(hash)
+	if errors.Cause(err) == eth.ErrNonceTooLow {
+		// Another process used the account, get the nonce from the
+		// network and try again.
+		ts.nonceSynced = false
+		txHash, err = ts.send(hash)
+	}
+	if err != nil {
+		// The local nonce may be out of sync, for instance if a previous
+		// transaction was dropped, so get it from the network next time.
+		ts.nonceSynced = false
+		return nil, err
+	}
+
+	return txHash[:], nil
+}
+
+func (ts *Timestamper) send(hash *types.Bytes32) (*types.Bytes32, error) {
+	client := ts.config.Client
+
+	if !ts.nonceSynced {
+		nonce, err := client.PendingNonceAt(ts.address)
+		if err != nil {
+			return nil, err
+		}
+		ts.nonce = nonce
+		ts.nonceSynced = true
+	}
+
+	to, data := ts.address, hash[:]
+	if ts.contract != nil {
+		to, data = ts.contract, AnchorCallData(hash)
+	}
+
+	gasPrice := ts.config.GasPrice
+	if gasPrice == nil {
+		var err error
+		if gasPrice, err = client.SuggestGasPrice(); err != nil {
+			return nil, err
+		}
+	}
+
+	gas := ts.config.GasLimit
+	if gas == 0 {
+		var err error
+		gas, err = client.EstimateGas(&eth.CallMsg{
+			From:     ts.address,
+			To:       to,
+			GasPrice: gasPrice,
+			Data:     data,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx := &eth.Transaction{
+		Nonce:    ts.nonce,
+		GasPrice: gasPrice,
+		Gas:      gas,
+		To:       to,
+		Value:    big.NewInt(0),
+		Data:     data,
+	}
+	if err := tx.Sign(ts.privKey, ts.chainID); err != nil {
+		return nil, err
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	txHash, err := client.SendRawTransaction(raw)
+	if err != nil {
+		return nil, err
+	}
+	ts.nonce++
+
+	return txHash, nil
+}
+
+// AnchorCallData returns the data of a call to the anchor function of a
+// contract.
+func AnchorCallData(hash *types.Bytes32) []byte {
+	selector := eth.Keccak256([]byte(AnchorMethod))
+	return append(selector[:4:4], hash[:]...)
+}
@@ -0,0 +1,202 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethtimestamper
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stratumn/sdk/blockchain/eth"
+	"github.com/stratumn/sdk/blockchain/eth/ethtesting"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/types"
+)
+
+const (
+	testKey      = "4646464646464646464646464646464646464646464646464646464646464646"
+	testContract = "0x3535353535353535353535353535353535353535"
+)
+
+func newTimestamper(t *testing.T, config *Config) (*Timestamper, *ethtesting.SimulatedBackend) {
+	privKey, _ := eth.ParsePrivateKey(testKey)
+	backend := ethtesting.NewSimulatedBackend(eth.NetworkRopsten.ChainID(), map[types.Bytes20]*big.Int{
+		*eth.PubKeyToAddress(privKey.PubKey().ToECDSA()): big.NewInt(1e18),
+	})
+
+	config.Client = backend
+	config.PrivateKey = testKey
+	ts, err := New(config)
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	return ts, backend
+}
+
+func TestNew_invalidKey(t *testing.T) {
+	backend := ethtesting.NewSimulatedBackend(big.NewInt(1), nil)
+	if _, err := New(&Config{Client: backend, PrivateKey: "abcd"}); err == nil {
+		t.Error("New(): err = nil want Error")
+	}
+}
+
+func TestNew_invalidContract(t *testing.T) {
+	backend := ethtesting.NewSimulatedBackend(big.NewInt(1), nil)
+	if _, err := New(&Config{Client: backend, PrivateKey: testKey, ContractAddress: "0x1234"}); err == nil {
+		t.Error("New(): err = nil want Error")
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	ts, _ := newTimestamper(t, &Config{})
+	if got := ts.Network(); got != eth.NetworkRopsten {
+		t.Errorf("ts.Network() = %q want %q", got, eth.NetworkRopsten)
+	}
+	if got := ts.GetInfo().Network; got != eth.NetworkRopsten {
+		t.Errorf("ts.GetInfo().Network = %q want %q", got, eth.NetworkRopsten)
+	}
+}
+
+func TestTimestampHash(t *testing.T) {
+	ts, backend := newTimestamper(t, &Config{})
+
+	hash := testutil.RandomHash()
+	txid, err := ts.TimestampHash(hash)
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	tx, ok := backend.TransactionByHash(types.NewBytes32FromBytes(txid))
+	if !ok {
+		t.Fatalf("transaction %s was not mined", txid)
+	}
+	if got, want := tx.Data, hash[:]; !bytes.Equal(got, want) {
+		t.Errorf("tx.Data = %x want %x", got, want)
+	}
+	if got, want := tx.To, ts.Address(); *got != *want {
+		t.Errorf("tx.To = %s want %s", got, want)
+	}
+	if got, want := tx.GasPrice.Int64(), int64(ethtesting.DefaultGasPrice); got != want {
+		t.Errorf("tx.GasPrice = %d want %d", got, want)
+	}
+	sender, err := tx.Sender(eth.NetworkRopsten.ChainID())
+	if err != nil {
+		t.Fatalf("tx.Sender(): err: %s", err)
+	}
+	if got, want := sender, ts.Address(); *got != *want {
+		t.Errorf("tx.Sender() = %s want %s", got, want)
+	}
+}
+
+func TestTimestampHash_contract(t *testing.T) {
+	ts, backend := newTimestamper(t, &Config{
+		ContractAddress: testContract,
+		GasPrice:        big.NewInt(42),
+		GasLimit:        100000,
+	})
+
+	hash := testutil.RandomHash()
+	txid, err := ts.TimestampHash(hash)
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	tx, ok := backend.TransactionByHash(types.NewBytes32FromBytes(txid))
+	if !ok {
+		t.Fatalf("transaction %s was not mined", txid)
+	}
+	if got, want := tx.Data, AnchorCallData(hash); !bytes.Equal(got, want) {
+		t.Errorf("tx.Data = %x want %x", got, want)
+	}
+	// First four bytes of keccak256("anchor(bytes32)").
+	if got, want := eth.EncodeData(tx.Data[:4]), "0xeecdf927"; got != want {
+		t.Errorf("selector = %s want %s", got, want)
+	}
+	if got, want := eth.EncodeData(tx.To[:]), testContract; got != want {
+		t.Errorf("tx.To = %s want %s", got, want)
+	}
+	if got, want := tx.GasPrice.Int64(), int64(42); got != want {
+		t.Errorf("tx.GasPrice = %d want %d", got, want)
+	}
+	if got, want := tx.Gas, uint64(100000); got != want {
+		t.Errorf("tx.Gas = %d want %d", got, want)
+	}
+}
+
+func TestTimestampHash_nonces(t *testing.T) {
+	ts, backend := newTimestamper(t, &Config{})
+
+	for i := 0; i < 3; i++ {
+		if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+			t.Fatalf("ts.TimestampHash(): err: %s", err)
+		}
+	}
+
+	for i, tx := range backend.Transactions() {
+		if got, want := tx.Nonce, uint64(i); got != want {
+			t.Errorf("tx#%d.Nonce = %d want %d", i, got, want)
+		}
+	}
+}
+
+func TestTimestampHash_nonceTooLow(t *testing.T) {
+	ts, backend := newTimestamper(t, &Config{})
+
+	if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+
+	// Simulate another process sending a transaction from the same account.
+	privKey, _ := eth.ParsePrivateKey(testKey)
+	tx := &eth.Transaction{
+		Nonce:    1,
+		GasPrice: big.NewInt(1),
+		Gas:      ethtesting.IntrinsicGas(nil),
+		To:       ts.Address(),
+		Value:    big.NewInt(0),
+	}
+	tx.Sign(privKey, eth.NetworkRopsten.ChainID())
+	raw, _ := tx.MarshalBinary()
+	if _, err := backend.SendRawTransaction(raw); err != nil {
+		t.Fatalf("backend.SendRawTransaction(): err: %s", err)
+	}
+
+	if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	txs := backend.Transactions()
+	if got, want := txs[len(txs)-1].Nonce, uint64(2); got != want {
+		t.Errorf("tx.Nonce = %d want %d", got, want)
+	}
+}
+
+func TestTimestampHash_error(t *testing.T) {
+	ts, backend := newTimestamper(t, &Config{})
+
+	backend.SendErr = errors.New("test")
+	if _, err := ts.TimestampHash(testutil.RandomHash()); err == nil {
+		t.Fatal("ts.TimestampHash(): err = nil want Error")
+	}
+
+	// The nonce must not be consumed by a failed transaction.
+	if _, err := ts.TimestampHash(testutil.RandomHash()); err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	if got, want := backend.Transactions()[0].Nonce, uint64(0); got != want {
+		t.Errorf("tx.Nonce = %d want %d", got, want)
+	}
+}
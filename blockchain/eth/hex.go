@@ -0,0 +1,70 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// The functions below encode values the way the Ethereum JSON-RPC API
+// expects them.
+
+// EncodeQuantity encodes an integer as a 0x-prefixed hex string without
+// leading zeros.
+func EncodeQuantity(n *big.Int) string {
+	return "0x" + n.Text(16)
+}
+
+// EncodeUint64 encodes an unsigned integer as a quantity.
+func EncodeUint64(n uint64) string {
+	return EncodeQuantity(new(big.Int).SetUint64(n))
+}
+
+// DecodeQuantity decodes a 0x-prefixed hex quantity.
+func DecodeQuantity(s string) (*big.Int, error) {
+	if !strings.HasPrefix(s, "0x") || len(s) < 3 {
+		return nil, errors.New("invalid quantity")
+	}
+	n, ok := new(big.Int).SetString(s[2:], 16)
+	if !ok {
+		return nil, errors.New("invalid quantity")
+	}
+	return n, nil
+}
+
+// DecodeUint64 decodes a 0x-prefixed hex quantity that fits in 64 bits.
+func DecodeUint64(s string) (uint64, error) {
+	n, err := DecodeQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsUint64() {
+		return 0, errors.New("quantity overflows 64 bits")
+	}
+	return n.Uint64(), nil
+}
+
+// EncodeData encodes bytes as a 0x-prefixed hex string.
+func EncodeData(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+// DecodeData decodes a hex string, with or without the 0x prefix.
+func DecodeData(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
@@ -0,0 +1,26 @@
+package jsonrpc
+
+import (
+	"flag"
+	"time"
+)
+
+var (
+	url     string
+	timeout time.Duration
+)
+
+// RegisterFlags registers the flags used by InitializeWithFlags.
+func RegisterFlags() {
+	flag.StringVar(&url, "ethrpc", DefaultURL, "URL of the Ethereum JSON-RPC endpoint")
+	flag.DurationVar(&timeout, "ethrpctimeout", DefaultTimeout, "timeout of requests to the Ethereum JSON-RPC endpoint")
+}
+
+// InitializeWithFlags should be called after RegisterFlags and flag.Parse to
+// initialize a JSON-RPC client using flag values.
+func InitializeWithFlags() *Client {
+	return New(&Config{
+		URL:     url,
+		Timeout: timeout,
+	})
+}
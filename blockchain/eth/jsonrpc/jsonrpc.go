@@ -0,0 +1,276 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jsonrpc implements an Ethereum client using the JSON-RPC API of a
+// node such as Geth or Parity.
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/eth"
+	"github.com/stratumn/sdk/types"
+)
+
+const (
+	// DefaultURL is the default URL of the JSON-RPC endpoint.
+	DefaultURL = "http://localhost:8545"
+
+	// DefaultTimeout is the default timeout of requests.
+	DefaultTimeout = 30 * time.Second
+)
+
+// Config contains configuration options for the client.
+type Config struct {
+	// The URL of the JSON-RPC endpoint.
+	URL string
+
+	// The timeout of requests.
+	Timeout time.Duration
+}
+
+// Error is an error returned by the JSON-RPC endpoint.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements error.Error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Client is a JSON-RPC client that implements
+// github.com/stratumn/sdk/blockchain/eth.Client and
+// github.com/stratumn/sdk/blockchain.ChainQuerier.
+type Client struct {
+	config *Config
+	client *http.Client
+	id     uint64
+
+	mu      sync.Mutex
+	chainID *big.Int
+}
+
+// New creates an instance of a Client.
+func New(config *Config) *Client {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Client{
+		config: config,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// ChainID implements github.com/stratumn/sdk/blockchain/eth.Client.ChainID.
+// The chain ID is cached after the first call.
+func (c *Client) ChainID() (*big.Int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.chainID == nil {
+		var result string
+		if err := c.call("eth_chainId", &result); err != nil {
+			// Nodes predating EIP-695 only expose the network ID, which
+			// matches the chain ID on public networks.
+			if err = c.call("net_version", &result); err != nil {
+				return nil, err
+			}
+			id, ok := new(big.Int).SetString(result, 10)
+			if !ok {
+				return nil, errors.Errorf("invalid network ID %q", result)
+			}
+			c.chainID = id
+		} else if c.chainID, err = eth.DecodeQuantity(result); err != nil {
+			return nil, err
+		}
+	}
+
+	return new(big.Int).Set(c.chainID), nil
+}
+
+// PendingNonceAt implements
+// github.com/stratumn/sdk/blockchain/eth.Client.PendingNonceAt.
+func (c *Client) PendingNonceAt(address *types.Bytes20) (uint64, error) {
+	var result string
+	if err := c.call("eth_getTransactionCount", &result, eth.EncodeData(address[:]), "pending"); err != nil {
+		return 0, err
+	}
+	return eth.DecodeUint64(result)
+}
+
+// SuggestGasPrice implements
+// github.com/stratumn/sdk/blockchain/eth.Client.SuggestGasPrice.
+func (c *Client) SuggestGasPrice() (*big.Int, error) {
+	var result string
+	if err := c.call("eth_gasPrice", &result); err != nil {
+		return nil, err
+	}
+	return eth.DecodeQuantity(result)
+}
+
+// EstimateGas implements
+// github.com/stratumn/sdk/blockchain/eth.Client.EstimateGas.
+func (c *Client) EstimateGas(msg *eth.CallMsg) (uint64, error) {
+	arg := map[string]string{}
+	if msg.From != nil {
+		arg["from"] = eth.EncodeData(msg.From[:])
+	}
+	if msg.To != nil {
+		arg["to"] = eth.EncodeData(msg.To[:])
+	}
+	if msg.Gas != 0 {
+		arg["gas"] = eth.EncodeUint64(msg.Gas)
+	}
+	if msg.GasPrice != nil {
+		arg["gasPrice"] = eth.EncodeQuantity(msg.GasPrice)
+	}
+	if msg.Value != nil {
+		arg["value"] = eth.EncodeQuantity(msg.Value)
+	}
+	if len(msg.Data) > 0 {
+		arg["data"] = eth.EncodeData(msg.Data)
+	}
+
+	var result string
+	if err := c.call("eth_estimateGas", &result, arg); err != nil {
+		return 0, err
+	}
+	return eth.DecodeUint64(result)
+}
+
+// SendRawTransaction implements
+// github.com/stratumn/sdk/blockchain/eth.Client.SendRawTransaction.
+func (c *Client) SendRawTransaction(raw []byte) (*types.Bytes32, error) {
+	var result string
+	if err := c.call("eth_sendRawTransaction", &result, eth.EncodeData(raw)); err != nil {
+		if strings.Contains(err.Error(), eth.ErrNonceTooLow.Error()) {
+			return nil, errors.Wrap(eth.ErrNonceTooLow, err.Error())
+		}
+		return nil, err
+	}
+	b, err := eth.DecodeData(result)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != types.Bytes32Size {
+		return nil, errors.Errorf("invalid transaction hash %q", result)
+	}
+	return types.NewBytes32FromBytes(b), nil
+}
+
+type rpcTransaction struct {
+	BlockHash   *string `json:"blockHash"`
+	BlockNumber *string `json:"blockNumber"`
+}
+
+// TransactionStatus implements
+// github.com/stratumn/sdk/blockchain.ChainQuerier.TransactionStatus.
+func (c *Client) TransactionStatus(txid types.TransactionID) (*blockchain.TransactionStatus, error) {
+	var tx *rpcTransaction
+	if err := c.call("eth_getTransactionByHash", &tx, eth.EncodeData(txid)); err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, blockchain.ErrTransactionNotFound
+	}
+
+	status := &blockchain.TransactionStatus{}
+	if tx.BlockNumber == nil || tx.BlockHash == nil {
+		return status, nil
+	}
+
+	height, err := eth.DecodeUint64(*tx.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	blockHash, err := eth.DecodeData(*tx.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var result string
+	if err := c.call("eth_blockNumber", &result); err != nil {
+		return nil, err
+	}
+	head, err := eth.DecodeUint64(result)
+	if err != nil {
+		return nil, err
+	}
+
+	status.Mined = true
+	status.BlockHash = types.NewBytes32FromBytes(blockHash)
+	status.BlockHeight = height
+	if head >= height {
+		status.Confirmations = head - height + 1
+	}
+
+	return status, nil
+}
+
+type request struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+func (c *Client) call(method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(request{
+		JSONRPC: "2.0",
+		ID:      atomic.AddUint64(&c.id, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	res, err := c.client.Post(c.config.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	var r response
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return errors.Wrapf(err, "%s: invalid response with HTTP status %d", method, res.StatusCode)
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+
+	return errors.WithStack(json.Unmarshal(r.Result, result))
+}
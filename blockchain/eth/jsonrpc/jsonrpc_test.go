@@ -0,0 +1,191 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonrpc
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/eth"
+	"github.com/stratumn/sdk/blockchain/eth/ethtesting"
+	"github.com/stratumn/sdk/types"
+)
+
+const testKey = "4646464646464646464646464646464646464646464646464646464646464646"
+
+func newClient(t *testing.T) (*Client, *ethtesting.SimulatedBackend, *types.Bytes20, func()) {
+	privKey, err := eth.ParsePrivateKey(testKey)
+	if err != nil {
+		t.Fatalf("eth.ParsePrivateKey(): err: %s", err)
+	}
+	address := eth.PubKeyToAddress(privKey.PubKey().ToECDSA())
+
+	backend := ethtesting.NewSimulatedBackend(big.NewInt(1337), map[types.Bytes20]*big.Int{
+		*address: big.NewInt(1e18),
+	})
+	server := httptest.NewServer(backend)
+
+	return New(&Config{URL: server.URL}), backend, address, server.Close
+}
+
+func TestClient_ChainID(t *testing.T) {
+	c, _, _, close := newClient(t)
+	defer close()
+
+	id, err := c.ChainID()
+	if err != nil {
+		t.Fatalf("c.ChainID(): err: %s", err)
+	}
+	if got, want := id.Int64(), int64(1337); got != want {
+		t.Errorf("c.ChainID() = %d want %d", got, want)
+	}
+}
+
+func TestClient_ChainID_netVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Method == "net_version" {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"3"}`))
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`))
+	}))
+	defer server.Close()
+
+	id, err := New(&Config{URL: server.URL}).ChainID()
+	if err != nil {
+		t.Fatalf("c.ChainID(): err: %s", err)
+	}
+	if got, want := id.Int64(), int64(3); got != want {
+		t.Errorf("c.ChainID() = %d want %d", got, want)
+	}
+}
+
+func TestClient_SuggestGasPrice(t *testing.T) {
+	c, backend, _, close := newClient(t)
+	defer close()
+
+	backend.GasPrice = big.NewInt(42)
+	price, err := c.SuggestGasPrice()
+	if err != nil {
+		t.Fatalf("c.SuggestGasPrice(): err: %s", err)
+	}
+	if got, want := price.Int64(), int64(42); got != want {
+		t.Errorf("c.SuggestGasPrice() = %d want %d", got, want)
+	}
+}
+
+func TestClient_EstimateGas(t *testing.T) {
+	c, _, address, close := newClient(t)
+	defer close()
+
+	data := []byte{0, 1}
+	gas, err := c.EstimateGas(&eth.CallMsg{From: address, To: address, Data: data})
+	if err != nil {
+		t.Fatalf("c.EstimateGas(): err: %s", err)
+	}
+	if got, want := gas, ethtesting.IntrinsicGas(data); got != want {
+		t.Errorf("c.EstimateGas() = %d want %d", got, want)
+	}
+}
+
+func TestClient_SendRawTransaction(t *testing.T) {
+	c, backend, address, close := newClient(t)
+	defer close()
+
+	privKey, _ := eth.ParsePrivateKey(testKey)
+	chainID, _ := c.ChainID()
+
+	send := func(nonce uint64) (*types.Bytes32, error) {
+		tx := &eth.Transaction{
+			Nonce:    nonce,
+			GasPrice: big.NewInt(1),
+			Gas:      ethtesting.IntrinsicGas(nil),
+			To:       address,
+			Value:    big.NewInt(0),
+		}
+		if err := tx.Sign(privKey, chainID); err != nil {
+			t.Fatalf("tx.Sign(): err: %s", err)
+		}
+		raw, _ := tx.MarshalBinary()
+		return c.SendRawTransaction(raw)
+	}
+
+	hash, err := send(0)
+	if err != nil {
+		t.Fatalf("c.SendRawTransaction(): err: %s", err)
+	}
+	if _, ok := backend.TransactionByHash(hash); !ok {
+		t.Errorf("transaction %s was not mined", hash)
+	}
+
+	nonce, err := c.PendingNonceAt(address)
+	if err != nil {
+		t.Fatalf("c.PendingNonceAt(): err: %s", err)
+	}
+	if got, want := nonce, uint64(1); got != want {
+		t.Errorf("c.PendingNonceAt() = %d want %d", got, want)
+	}
+
+	if _, err := send(0); errors.Cause(err) != eth.ErrNonceTooLow {
+		t.Errorf("c.SendRawTransaction(): err = %v want %s", err, eth.ErrNonceTooLow)
+	}
+}
+
+func TestClient_TransactionStatus(t *testing.T) {
+	c, backend, address, close := newClient(t)
+	defer close()
+
+	if _, err := c.TransactionStatus(make(types.TransactionID, 32)); err != blockchain.ErrTransactionNotFound {
+		t.Errorf("c.TransactionStatus(): err = %v want %s", err, blockchain.ErrTransactionNotFound)
+	}
+
+	privKey, _ := eth.ParsePrivateKey(testKey)
+	tx := &eth.Transaction{
+		GasPrice: big.NewInt(1),
+		Gas:      ethtesting.IntrinsicGas(nil),
+		To:       address,
+		Value:    big.NewInt(0),
+	}
+	tx.Sign(privKey, big.NewInt(1337))
+	raw, _ := tx.MarshalBinary()
+	hash, err := c.SendRawTransaction(raw)
+	if err != nil {
+		t.Fatalf("c.SendRawTransaction(): err: %s", err)
+	}
+	backend.Mine(2)
+
+	status, err := c.TransactionStatus(hash[:])
+	if err != nil {
+		t.Fatalf("c.TransactionStatus(): err: %s", err)
+	}
+	want, _ := backend.TransactionStatus(hash[:])
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("c.TransactionStatus() = %#v want %#v", status, want)
+	}
+	if got, want := status.Confirmations, uint64(3); got != want {
+		t.Errorf("status.Confirmations = %d want %d", got, want)
+	}
+}
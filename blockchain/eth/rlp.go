@@ -0,0 +1,129 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+// This file implements the subset of the RLP encoding needed to serialize
+// transactions.
+
+var errInvalidRLP = errors.New("invalid RLP encoding")
+
+func rlpEncodeBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(rlpHead(0x80, len(b)), b...)
+}
+
+func rlpEncodeUint(n uint64) []byte {
+	return rlpEncodeBig(new(big.Int).SetUint64(n))
+}
+
+func rlpEncodeBig(n *big.Int) []byte {
+	if n == nil {
+		return rlpEncodeBytes(nil)
+	}
+	return rlpEncodeBytes(n.Bytes())
+}
+
+func rlpEncodeList(items ...[]byte) []byte {
+	var payload []byte
+	for _, item := range items {
+		payload = append(payload, item...)
+	}
+	return append(rlpHead(0xc0, len(payload)), payload...)
+}
+
+func rlpHead(offset byte, size int) []byte {
+	if size < 56 {
+		return []byte{offset + byte(size)}
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(size))
+	i := 0
+	for buf[i] == 0 {
+		i++
+	}
+	return append([]byte{offset + 55 + byte(8-i)}, buf[i:]...)
+}
+
+// rlpDecode decodes a single item. Strings are returned as []byte and lists
+// as []interface{}.
+func rlpDecode(data []byte) (item interface{}, rest []byte, err error) {
+	if len(data) == 0 {
+		return nil, nil, errInvalidRLP
+	}
+
+	b := data[0]
+	switch {
+	case b < 0x80:
+		return data[:1], data[1:], nil
+	case b < 0xc0:
+		content, rest, err := rlpContent(data, 0x80)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(content) == 1 && content[0] < 0x80 {
+			return nil, nil, errInvalidRLP
+		}
+		return content, rest, nil
+	default:
+		content, rest, err := rlpContent(data, 0xc0)
+		if err != nil {
+			return nil, nil, err
+		}
+		list := []interface{}{}
+		for len(content) > 0 {
+			var elem interface{}
+			if elem, content, err = rlpDecode(content); err != nil {
+				return nil, nil, err
+			}
+			list = append(list, elem)
+		}
+		return list, rest, nil
+	}
+}
+
+func rlpContent(data []byte, offset byte) (content, rest []byte, err error) {
+	b := data[0] - offset
+	data = data[1:]
+
+	var size uint64
+	if b < 56 {
+		size = uint64(b)
+	} else {
+		n := int(b - 55)
+		if n > 8 || len(data) < n || data[0] == 0 {
+			return nil, nil, errInvalidRLP
+		}
+		for _, c := range data[:n] {
+			size = size<<8 | uint64(c)
+		}
+		if size < 56 {
+			return nil, nil, errInvalidRLP
+		}
+		data = data[n:]
+	}
+
+	if uint64(len(data)) < size {
+		return nil, nil, errInvalidRLP
+	}
+	return data[:size], data[size:], nil
+}
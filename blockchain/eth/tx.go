@@ -0,0 +1,178 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/stratumn/sdk/types"
+)
+
+// Transaction is an Ethereum transaction signed according to EIP-155.
+type Transaction struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+
+	// To is nil for contract creations.
+	To *types.Bytes20
+
+	Value *big.Int
+	Data  []byte
+
+	// Signature values.
+	V *big.Int
+	R *big.Int
+	S *big.Int
+}
+
+func (tx *Transaction) fields() [][]byte {
+	var to []byte
+	if tx.To != nil {
+		to = tx.To[:]
+	}
+	return [][]byte{
+		rlpEncodeUint(tx.Nonce),
+		rlpEncodeBig(tx.GasPrice),
+		rlpEncodeUint(tx.Gas),
+		rlpEncodeBytes(to),
+		rlpEncodeBig(tx.Value),
+		rlpEncodeBytes(tx.Data),
+	}
+}
+
+// SigningHash returns the EIP-155 hash that is signed for the given chain ID.
+func (tx *Transaction) SigningHash(chainID *big.Int) *types.Bytes32 {
+	fields := append(tx.fields(), rlpEncodeBig(chainID), rlpEncodeUint(0), rlpEncodeUint(0))
+	return Keccak256(rlpEncodeList(fields...))
+}
+
+// Sign signs the transaction for the given chain ID.
+func (tx *Transaction) Sign(privKey *btcec.PrivateKey, chainID *big.Int) error {
+	hash := tx.SigningHash(chainID)
+	sig, err := btcec.SignCompact(btcec.S256(), privKey, hash[:], false)
+	if err != nil {
+		return err
+	}
+
+	// The first byte of a compact signature is 27 + the recovery ID.
+	recID := int64(sig[0] - 27)
+	tx.V = new(big.Int).Add(big.NewInt(recID+35), new(big.Int).Mul(chainID, big.NewInt(2)))
+	tx.R = new(big.Int).SetBytes(sig[1:33])
+	tx.S = new(big.Int).SetBytes(sig[33:65])
+
+	return nil
+}
+
+// Sender recovers the address that signed the transaction.
+func (tx *Transaction) Sender(chainID *big.Int) (*types.Bytes20, error) {
+	if tx.V == nil || tx.R == nil || tx.S == nil {
+		return nil, ErrInvalidSignature
+	}
+
+	recID := new(big.Int).Sub(tx.V, new(big.Int).Mul(chainID, big.NewInt(2)))
+	recID.Sub(recID, big.NewInt(35))
+	if recID.Sign() < 0 || recID.Cmp(big.NewInt(1)) > 0 {
+		return nil, ErrInvalidSignature
+	}
+	if tx.R.BitLen() > 256 || tx.S.BitLen() > 256 {
+		return nil, ErrInvalidSignature
+	}
+
+	sig := make([]byte, 65)
+	sig[0] = byte(27 + recID.Int64())
+	rb, sb := tx.R.Bytes(), tx.S.Bytes()
+	copy(sig[33-len(rb):33], rb)
+	copy(sig[65-len(sb):], sb)
+
+	hash := tx.SigningHash(chainID)
+	pubKey, _, err := btcec.RecoverCompact(btcec.S256(), sig, hash[:])
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	return PubKeyToAddress(pubKey.ToECDSA()), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// It returns the RLP encoding of the signed transaction.
+func (tx *Transaction) MarshalBinary() ([]byte, error) {
+	fields := append(tx.fields(), rlpEncodeBig(tx.V), rlpEncodeBig(tx.R), rlpEncodeBig(tx.S))
+	return rlpEncodeList(fields...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (tx *Transaction) UnmarshalBinary(data []byte) error {
+	item, rest, err := rlpDecode(data)
+	if err != nil {
+		return err
+	}
+	fields, ok := item.([]interface{})
+	if !ok || len(rest) > 0 || len(fields) != 9 {
+		return errInvalidRLP
+	}
+
+	var values [9][]byte
+	for i, f := range fields {
+		if values[i], ok = f.([]byte); !ok {
+			return errInvalidRLP
+		}
+	}
+
+	var decoded Transaction
+	if decoded.Nonce, err = rlpUint(values[0]); err != nil {
+		return err
+	}
+	if decoded.Gas, err = rlpUint(values[2]); err != nil {
+		return err
+	}
+	decoded.GasPrice = new(big.Int).SetBytes(values[1])
+
+	switch len(values[3]) {
+	case 0:
+	case types.Bytes20Size:
+		decoded.To = &types.Bytes20{}
+		copy(decoded.To[:], values[3])
+	default:
+		return errInvalidRLP
+	}
+
+	decoded.Value = new(big.Int).SetBytes(values[4])
+	decoded.Data = values[5]
+	decoded.V = new(big.Int).SetBytes(values[6])
+	decoded.R = new(big.Int).SetBytes(values[7])
+	decoded.S = new(big.Int).SetBytes(values[8])
+
+	*tx = decoded
+	return nil
+}
+
+// Hash returns the hash of the signed transaction.
+func (tx *Transaction) Hash() *types.Bytes32 {
+	raw, _ := tx.MarshalBinary()
+	return Keccak256(raw)
+}
+
+func rlpUint(b []byte) (uint64, error) {
+	if len(b) > 8 || (len(b) > 0 && b[0] == 0) {
+		return 0, errInvalidRLP
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
@@ -19,16 +19,22 @@ import (
 	"flag"
 	"os"
 
+	log "github.com/sirupsen/logrus"
+
 	"github.com/stratumn/sdk/fossilizer/fossilizerhttp"
+	"github.com/stratumn/sdk/leveldbstore"
+	"github.com/stratumn/sdk/store"
 	"github.com/stratumn/sdk/utils"
 
 	"github.com/stratumn/sdk/bcbatchfossilizer"
+	"github.com/stratumn/sdk/blockchain/btc/bitcoind"
 	"github.com/stratumn/sdk/blockchain/btc/blockcypher"
 	"github.com/stratumn/sdk/blockchain/btc/btctimestamper"
 )
 
 var (
-	key = flag.String("wif", os.Getenv("BTCFOSSILIZER_WIF"), "wallet import format key")
+	key    = flag.String("wif", os.Getenv("BTCFOSSILIZER_WIF"), "wallet import format key or extended private key, use -btc-keystore to load the key from an encrypted file instead")
+	utxoDB = flag.String("utxodb", os.Getenv("BTCFOSSILIZER_UTXODB"), "an optional path to a LevelDB database in which to track unspent outputs")
 
 	version = "x.x.x"
 	commit  = "00000000000000000000000000000000"
@@ -37,6 +43,7 @@ var (
 func init() {
 	fossilizerhttp.RegisterFlags()
 	blockcypher.RegisterFlags()
+	bitcoind.RegisterFlags()
 	btctimestamper.RegisterFlags()
 	bcbatchfossilizer.RegisterFlags()
 }
@@ -47,8 +54,19 @@ func main() {
 	ctx := context.Background()
 	ctx = utils.CancelOnInterrupt(ctx)
 
-	bcy := blockcypher.RunWithFlags(ctx, *key)
-	ts := btctimestamper.InitializeWithFlags(version, commit, *key, bcy, bcy)
-	a := bcbatchfossilizer.RunWithFlags(ctx, version, commit, ts)
+	finder, broadcaster, querier := btctimestamper.RunBackendWithFlags(ctx, *key)
+
+	var utxoStore store.KeyValueStore
+	if *utxoDB != "" {
+		db, err := leveldbstore.New(&leveldbstore.Config{Path: *utxoDB})
+		if err != nil {
+			log.WithField("error", err).Fatal("Failed to open UTXO database")
+		}
+		utxoStore = db
+	}
+
+	ts := btctimestamper.InitializeWithFlags(version, commit, *key, finder, broadcaster, querier, utxoStore)
+	go ts.Start(ctx)
+	a := bcbatchfossilizer.RunWithFlags(ctx, version, commit, ts, querier)
 	fossilizerhttp.RunWithFlags(ctx, a)
 }
@@ -41,6 +41,6 @@ func main() {
 	ctx := context.Background()
 	ctx = utils.CancelOnInterrupt(ctx)
 
-	a := bcbatchfossilizer.RunWithFlags(ctx, version, commit, dummytimestamper.Timestamper{})
+	a := bcbatchfossilizer.RunWithFlags(ctx, version, commit, dummytimestamper.Timestamper{}, nil)
 	fossilizerhttp.RunWithFlags(ctx, a)
 }
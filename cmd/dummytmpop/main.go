@@ -21,23 +21,22 @@ import (
 	"github.com/stratumn/sdk/dummystore"
 	"github.com/stratumn/sdk/tendermint"
 	"github.com/stratumn/sdk/tmpop"
-	"github.com/stratumn/sdk/validator"
 )
 
 var (
-	validatorFilename = flag.String("rules_filename", validator.DefaultFilename, "Path to filename containing validation rules")
-	version           = "x.x.x"
-	commit            = "00000000000000000000000000000000"
+	version = "x.x.x"
+	commit  = "00000000000000000000000000000000"
 )
 
 func init() {
 	tendermint.RegisterFlags()
+	tmpop.RegisterFlags()
 }
 
 func main() {
 	flag.Parse()
 
 	a := dummystore.New(&dummystore.Config{Version: version, Commit: commit})
-	tmpopConfig := &tmpop.Config{Commit: commit, Version: version, ValidatorFilename: *validatorFilename}
-	tmpop.Run(a, a, tmpopConfig)
+
+	tmpop.Run(a, a, tmpop.ConfigFromFlags(version, commit))
 }
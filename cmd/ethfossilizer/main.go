@@ -0,0 +1,56 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The command ethfossilizer starts a fossilizerhttp server with a
+// bcbatchfossilizer using an Ethereum timestamper.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/stratumn/sdk/fossilizer/fossilizerhttp"
+	"github.com/stratumn/sdk/utils"
+
+	"github.com/stratumn/sdk/bcbatchfossilizer"
+	"github.com/stratumn/sdk/blockchain/eth/ethtimestamper"
+	"github.com/stratumn/sdk/blockchain/eth/jsonrpc"
+)
+
+var (
+	key = flag.String("ethkey", os.Getenv("ETHFOSSILIZER_KEY"), "hex encoded private key")
+
+	version = "x.x.x"
+	commit  = "00000000000000000000000000000000"
+)
+
+func init() {
+	fossilizerhttp.RegisterFlags()
+	jsonrpc.RegisterFlags()
+	ethtimestamper.RegisterFlags()
+	bcbatchfossilizer.RegisterFlags()
+}
+
+func main() {
+	flag.Parse()
+
+	ctx := context.Background()
+	ctx = utils.CancelOnInterrupt(ctx)
+
+	client := jsonrpc.InitializeWithFlags()
+	ts := ethtimestamper.InitializeWithFlags(version, commit, *key, client)
+	a := bcbatchfossilizer.RunWithFlags(ctx, version, commit, ts, client)
+	fossilizerhttp.RunWithFlags(ctx, a)
+}
@@ -23,18 +23,17 @@ import (
 	"github.com/stratumn/sdk/filestore"
 	"github.com/stratumn/sdk/tendermint"
 	"github.com/stratumn/sdk/tmpop"
-	"github.com/stratumn/sdk/validator"
 )
 
 var (
-	path              = flag.String("path", filestore.DefaultPath, "Path to directory where files are stored")
-	validatorFilename = flag.String("rules_filename", validator.DefaultFilename, "Path to filename containing validation rules")
-	version           = "x.x.x"
-	commit            = "00000000000000000000000000000000"
+	path    = flag.String("path", filestore.DefaultPath, "Path to directory where files are stored")
+	version = "x.x.x"
+	commit  = "00000000000000000000000000000000"
 )
 
 func init() {
 	tendermint.RegisterFlags()
+	tmpop.RegisterFlags()
 }
 
 func main() {
@@ -45,6 +44,5 @@ func main() {
 		log.Fatal(err)
 	}
 
-	tmpopConfig := &tmpop.Config{Commit: commit, Version: version, ValidatorFilename: *validatorFilename}
-	tmpop.Run(a, a, tmpopConfig)
+	tmpop.Run(a, a, tmpop.ConfigFromFlags(version, commit))
 }
@@ -21,17 +21,16 @@ import (
 	"github.com/stratumn/sdk/postgresstore"
 	"github.com/stratumn/sdk/tendermint"
 	"github.com/stratumn/sdk/tmpop"
-	"github.com/stratumn/sdk/validator"
 )
 
 var (
-	validatorFilename = flag.String("rules_filename", validator.DefaultFilename, "Path to filename containing validation rules")
-	version           = "x.x.x"
-	commit            = "00000000000000000000000000000000"
+	version = "x.x.x"
+	commit  = "00000000000000000000000000000000"
 )
 
 func init() {
 	tendermint.RegisterFlags()
+	tmpop.RegisterFlags()
 	postgresstore.RegisterFlags()
 }
 
@@ -39,7 +38,6 @@ func main() {
 	flag.Parse()
 
 	a := postgresstore.InitializeWithFlags(version, commit)
-	tmpopConfig := &tmpop.Config{Commit: commit, Version: version, ValidatorFilename: *validatorFilename}
 
-	tmpop.Run(a, a, tmpopConfig)
+	tmpop.Run(a, a, tmpop.ConfigFromFlags(version, commit))
 }
@@ -21,17 +21,16 @@ import (
 	"github.com/stratumn/sdk/rethinkstore"
 	"github.com/stratumn/sdk/tendermint"
 	"github.com/stratumn/sdk/tmpop"
-	"github.com/stratumn/sdk/validator"
 )
 
 var (
-	validatorFilename = flag.String("rules_filename", validator.DefaultFilename, "Path to filename containing validation rules")
-	version           = "x.x.x"
-	commit            = "00000000000000000000000000000000"
+	version = "x.x.x"
+	commit  = "00000000000000000000000000000000"
 )
 
 func init() {
 	tendermint.RegisterFlags()
+	tmpop.RegisterFlags()
 	rethinkstore.RegisterFlags()
 }
 
@@ -40,7 +39,5 @@ func main() {
 
 	a := rethinkstore.InitializeWithFlags(version, commit)
 
-	tmpopConfig := &tmpop.Config{Commit: commit, Version: version, ValidatorFilename: *validatorFilename}
-
-	tmpop.Run(a, a, tmpopConfig)
+	tmpop.Run(a, a, tmpop.ConfigFromFlags(version, commit))
 }
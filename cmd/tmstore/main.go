@@ -21,6 +21,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	_ "github.com/stratumn/sdk/cs/evidences"
 	"github.com/stratumn/sdk/store/storehttp"
+	"github.com/stratumn/sdk/tmpop"
 	"github.com/stratumn/sdk/tmstore"
 	"github.com/tendermint/tendermint/rpc/client"
 )
@@ -28,6 +29,10 @@ import (
 var (
 	endpoint          = flag.String("endpoint", tmstore.DefaultEndpoint, "Endpoint used to communicate with Tendermint Core")
 	tmWsRetryInterval = flag.Duration("tm_ws_retry_interval", tmstore.DefaultWsRetryInterval, "Interval between tendermint websocket connection tries")
+	verifyProofs      = flag.Bool("verify_proofs", false, "Verify that segments were committed using the block headers signed by the validators")
+	genesis           = flag.String("genesis", "", "Tendermint genesis file whose validators are trusted to verify proofs")
+	eventsFromHeight  = flag.Int64("events_from_height", 0, "Height of the last block whose events were notified before a restart, so that the events of the blocks committed since are notified")
+	evidenceKey       = flag.String("evidence_key", "", "Hex-encoded Ed25519 private key signing the evidences, registered for their providers in TMPop")
 	version           = "x.x.x"
 	commit            = "00000000000000000000000000000000"
 )
@@ -40,12 +45,33 @@ func main() {
 	flag.Parse()
 	log.Infof("%s v%s@%s", tmstore.Description, version, commit[:7])
 
+	config := &tmstore.Config{
+		Version:          version,
+		Commit:           commit,
+		VerifyProofs:     *verifyProofs,
+		EventsFromHeight: *eventsFromHeight,
+	}
+	if *verifyProofs {
+		if *genesis == "" {
+			log.Fatal("-verify_proofs requires a -genesis file")
+		}
+		validators, err := tmstore.ReadGenesisValidators(*genesis)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.TrustedValidators = validators
+	}
+	if *evidenceKey != "" {
+		key, err := tmpop.ParseEvidenceKey(*evidenceKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.EvidenceKey = key
+	}
+
 	tmClient := client.NewHTTP(*endpoint, "/websocket")
 	a := tmstore.New(
-		&tmstore.Config{
-			Version: version,
-			Commit:  commit,
-		},
+		config,
 		tmClient)
 
 	go a.RetryStartWebsocket(*tmWsRetryInterval)
@@ -0,0 +1,50 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The command tsafossilizer starts a fossilizerhttp server with a
+// tsabatchfossilizer using an RFC 3161 timestamp authority.
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/stratumn/sdk/fossilizer/fossilizerhttp"
+	"github.com/stratumn/sdk/utils"
+
+	"github.com/stratumn/sdk/tsa"
+	"github.com/stratumn/sdk/tsabatchfossilizer"
+)
+
+var (
+	version = "x.x.x"
+	commit  = "00000000000000000000000000000000"
+)
+
+func init() {
+	fossilizerhttp.RegisterFlags()
+	tsa.RegisterFlags()
+	tsabatchfossilizer.RegisterFlags()
+}
+
+func main() {
+	flag.Parse()
+
+	ctx := context.Background()
+	ctx = utils.CancelOnInterrupt(ctx)
+
+	ts := tsa.InitializeWithFlags()
+	a := tsabatchfossilizer.RunWithFlags(ctx, version, commit, ts)
+	fossilizerhttp.RunWithFlags(ctx, a)
+}
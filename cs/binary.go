@@ -0,0 +1,242 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cs
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// The binary encoding is CBOR with the following schema:
+//
+//	Link:         [state (map|null), meta (map|null)]
+//	Evidence:     [backend (text), provider (text), proof (any)]
+//	SegmentMeta:  [evidences ([Evidence]|null), linkHash (text)]
+//	Segment:      [Link, SegmentMeta]
+//	SegmentSlice: [Segment]
+//
+// Proofs are encoded from their JSON representation.
+// The link hash is always computed over the canonical JSON of the link,
+// so it does not depend on the wire encoding.
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (l *Link) MarshalBinary() ([]byte, error) {
+	e := cborEncoder{}
+	if err := e.writeLink(l); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (l *Link) UnmarshalBinary(data []byte) error {
+	v, err := decodeCBOR(data)
+	if err != nil {
+		return err
+	}
+	return l.fromGenericValue(v)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (e *Evidence) MarshalBinary() ([]byte, error) {
+	enc := cborEncoder{}
+	if err := enc.writeEvidence(e); err != nil {
+		return nil, err
+	}
+	return enc.buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (e *Evidence) UnmarshalBinary(data []byte) error {
+	v, err := decodeCBOR(data)
+	if err != nil {
+		return err
+	}
+	return e.fromGenericValue(v)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s *Segment) MarshalBinary() ([]byte, error) {
+	e := cborEncoder{}
+	if err := e.writeSegment(s); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *Segment) UnmarshalBinary(data []byte) error {
+	v, err := decodeCBOR(data)
+	if err != nil {
+		return err
+	}
+	return s.fromGenericValue(v)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s SegmentSlice) MarshalBinary() ([]byte, error) {
+	e := cborEncoder{}
+	e.writeHead(cborMajorArray, uint64(len(s)))
+	for _, seg := range s {
+		if err := e.writeSegment(seg); err != nil {
+			return nil, err
+		}
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *SegmentSlice) UnmarshalBinary(data []byte) error {
+	v, err := decodeCBOR(data)
+	if err != nil {
+		return err
+	}
+	arr, ok := v.([]interface{})
+	if !ok {
+		return ErrInvalidBinary
+	}
+	slice := make(SegmentSlice, len(arr))
+	for i, item := range arr {
+		slice[i] = &Segment{}
+		if err := slice[i].fromGenericValue(item); err != nil {
+			return err
+		}
+	}
+	*s = slice
+	return nil
+}
+
+func (e *cborEncoder) writeLink(l *Link) error {
+	e.writeHead(cborMajorArray, 2)
+	if err := e.writeValue(l.State); err != nil {
+		return err
+	}
+	return e.writeValue(l.Meta)
+}
+
+func (e *cborEncoder) writeEvidence(evidence *Evidence) error {
+	e.writeHead(cborMajorArray, 3)
+	e.writeString(evidence.Backend)
+	e.writeString(evidence.Provider)
+	if evidence.Proof == nil {
+		e.writeNull()
+		return nil
+	}
+	proof, err := toGenericValue(evidence.Proof)
+	if err != nil {
+		return err
+	}
+	return e.writeValue(proof)
+}
+
+func (e *cborEncoder) writeSegment(s *Segment) error {
+	e.writeHead(cborMajorArray, 2)
+	if err := e.writeLink(&s.Link); err != nil {
+		return err
+	}
+	e.writeHead(cborMajorArray, 2)
+	if s.Meta.Evidences == nil {
+		e.writeNull()
+	} else {
+		e.writeHead(cborMajorArray, uint64(len(s.Meta.Evidences)))
+		for _, evidence := range s.Meta.Evidences {
+			if err := e.writeEvidence(evidence); err != nil {
+				return err
+			}
+		}
+	}
+	e.writeString(s.Meta.LinkHash)
+	return nil
+}
+
+func (l *Link) fromGenericValue(v interface{}) error {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != 2 {
+		return ErrInvalidBinary
+	}
+	state, ok := normalizeNumbers(arr[0]).(map[string]interface{})
+	if !ok && arr[0] != nil {
+		return ErrInvalidBinary
+	}
+	meta, ok := normalizeNumbers(arr[1]).(map[string]interface{})
+	if !ok && arr[1] != nil {
+		return ErrInvalidBinary
+	}
+	*l = Link{State: state, Meta: meta}
+	return nil
+}
+
+func (e *Evidence) fromGenericValue(v interface{}) error {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != 3 {
+		return ErrInvalidBinary
+	}
+	backend, ok := arr[0].(string)
+	if !ok {
+		return ErrInvalidBinary
+	}
+	provider, ok := arr[1].(string)
+	if !ok {
+		return ErrInvalidBinary
+	}
+	rawProof, err := json.Marshal(arr[2])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	proof, err := deserializeProof(backend, rawProof)
+	if err != nil {
+		return err
+	}
+	*e = Evidence{
+		Backend:  backend,
+		Provider: provider,
+		Proof:    proof,
+	}
+	return nil
+}
+
+func (s *Segment) fromGenericValue(v interface{}) error {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != 2 {
+		return ErrInvalidBinary
+	}
+	seg := Segment{}
+	if err := seg.Link.fromGenericValue(arr[0]); err != nil {
+		return err
+	}
+	meta, ok := arr[1].([]interface{})
+	if !ok || len(meta) != 2 {
+		return ErrInvalidBinary
+	}
+	if meta[0] != nil {
+		evidences, ok := meta[0].([]interface{})
+		if !ok {
+			return ErrInvalidBinary
+		}
+		seg.Meta.Evidences = make(Evidences, len(evidences))
+		for i, item := range evidences {
+			seg.Meta.Evidences[i] = &Evidence{}
+			if err := seg.Meta.Evidences[i].fromGenericValue(item); err != nil {
+				return err
+			}
+		}
+	}
+	if seg.Meta.LinkHash, ok = meta[1].(string); !ok {
+		return ErrInvalidBinary
+	}
+	*s = seg
+	return nil
+}
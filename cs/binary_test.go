@@ -0,0 +1,126 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cs_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/cstesting"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkBinary(t *testing.T) {
+	l := cstesting.RandomLink()
+	l.State["number"] = float64(42)
+	l.State["float"] = 3.14
+	l.State["nested"] = map[string]interface{}{"list": []interface{}{true, nil, "a"}}
+
+	bin, err := l.MarshalBinary()
+	if err != nil {
+		t.Fatalf("l.MarshalBinary(): err: %s", err)
+	}
+
+	got := &cs.Link{}
+	if err := got.UnmarshalBinary(bin); err != nil {
+		t.Fatalf("got.UnmarshalBinary(): err: %s", err)
+	}
+
+	// Decoding from JSON gives the reference representation.
+	js, _ := json.Marshal(l)
+	want := &cs.Link{}
+	if err := json.Unmarshal(js, want); err != nil {
+		t.Fatalf("json.Unmarshal(): err: %s", err)
+	}
+	assert.Equal(t, want, got)
+
+	wantHash, _ := l.Hash()
+	gotHash, _ := got.Hash()
+	assert.Equal(t, wantHash, gotHash, "Link hash should not depend on the encoding")
+
+	assert.True(t, len(bin) < len(js), "Binary encoding should be smaller than JSON")
+}
+
+func TestSegmentBinary(t *testing.T) {
+	s := cstesting.RandomSegment()
+	s.Meta.AddEvidence(cs.Evidence{
+		Backend:  evidences.BcBatchFossilizerName,
+		Provider: "bitcoin",
+		Proof: &evidences.BcBatchProof{
+			Batch: evidences.BatchProof{
+				Timestamp: 1507187163,
+				Root:      testutil.RandomHash(),
+				Path:      types.Path{},
+			},
+			TransactionID: types.TransactionID{0x01, 0x02},
+		},
+	})
+	s.Meta.AddEvidence(cs.Evidence{
+		Backend:  "unknown",
+		Provider: "other",
+		Proof:    cs.NewUnknownProof(json.RawMessage(`{"big":18446744073709551615}`)),
+	})
+
+	bin, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("s.MarshalBinary(): err: %s", err)
+	}
+
+	got := &cs.Segment{}
+	if err := got.UnmarshalBinary(bin); err != nil {
+		t.Fatalf("got.UnmarshalBinary(): err: %s", err)
+	}
+
+	wantJS, _ := json.Marshal(s)
+	gotJS, _ := json.Marshal(got)
+	assert.JSONEq(t, string(wantJS), string(gotJS))
+	assert.NoError(t, got.Validate(nil), "got.Validate()")
+}
+
+func TestSegmentSliceBinary(t *testing.T) {
+	slice := cs.SegmentSlice{cstesting.RandomSegment(), cstesting.RandomSegment()}
+
+	bin, err := slice.MarshalBinary()
+	if err != nil {
+		t.Fatalf("slice.MarshalBinary(): err: %s", err)
+	}
+
+	var got cs.SegmentSlice
+	if err := got.UnmarshalBinary(bin); err != nil {
+		t.Fatalf("got.UnmarshalBinary(): err: %s", err)
+	}
+
+	assert.Len(t, got, len(slice))
+	for i := range slice {
+		assert.Equal(t, slice[i].GetLinkHashString(), got[i].GetLinkHashString())
+	}
+}
+
+func TestUnmarshalBinary_invalid(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		{0x82},
+		{0x82, 0xf6},
+		{0x83, 0xf6, 0xf6, 0xf6},
+		{0x82, 0xf6, 0xf6, 0x00},
+		{0x9f, 0xff},
+	} {
+		assert.Error(t, (&cs.Link{}).UnmarshalBinary(data), "UnmarshalBinary(%x)", data)
+	}
+}
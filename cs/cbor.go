@@ -0,0 +1,373 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the subset of CBOR (RFC 7049) needed to encode
+// JSON-like values: null, booleans, numbers, strings, byte strings, arrays
+// and maps with string keys. Map keys are sorted so the output is
+// deterministic.
+
+const (
+	cborMajorUint   = 0
+	cborMajorNegInt = 1
+	cborMajorBytes  = 2
+	cborMajorText   = 3
+	cborMajorArray  = 4
+	cborMajorMap    = 5
+	cborMajorSimple = 7
+
+	cborFalse   = 0xf4
+	cborTrue    = 0xf5
+	cborNull    = 0xf6
+	cborFloat64 = 0xfb
+)
+
+var (
+	// ErrInvalidBinary is returned when binary data cannot be decoded.
+	ErrInvalidBinary = errors.New("invalid binary encoding")
+)
+
+type cborEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *cborEncoder) writeHead(major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		e.buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(major | 24)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(major | 25)
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(n))
+		e.buf.Write(b[:])
+	case n <= math.MaxUint32:
+		e.buf.WriteByte(major | 26)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n))
+		e.buf.Write(b[:])
+	default:
+		e.buf.WriteByte(major | 27)
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		e.buf.Write(b[:])
+	}
+}
+
+func (e *cborEncoder) writeNull() {
+	e.buf.WriteByte(cborNull)
+}
+
+func (e *cborEncoder) writeString(s string) {
+	e.writeHead(cborMajorText, uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *cborEncoder) writeBytes(b []byte) {
+	e.writeHead(cborMajorBytes, uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *cborEncoder) writeInt(i int64) {
+	if i < 0 {
+		e.writeHead(cborMajorNegInt, uint64(-(i + 1)))
+		return
+	}
+	e.writeHead(cborMajorUint, uint64(i))
+}
+
+func (e *cborEncoder) writeFloat(f float64) {
+	// Integral values are encoded as integers which is more compact.
+	// Negative zero is kept as a float to preserve its sign.
+	if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 && !(f == 0 && math.Signbit(f)) {
+		e.writeInt(int64(f))
+		return
+	}
+	e.buf.WriteByte(cborFloat64)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(f))
+	e.buf.Write(b[:])
+}
+
+// writeValue encodes a JSON-like value.
+// Values of other types are converted through their JSON representation.
+func (e *cborEncoder) writeValue(v interface{}) error {
+	switch val := v.(type) {
+	case nil:
+		e.writeNull()
+	case bool:
+		if val {
+			e.buf.WriteByte(cborTrue)
+		} else {
+			e.buf.WriteByte(cborFalse)
+		}
+	case string:
+		e.writeString(val)
+	case []byte:
+		e.writeBytes(val)
+	case float64:
+		e.writeFloat(val)
+	case int:
+		e.writeInt(int64(val))
+	case int64:
+		e.writeInt(val)
+	case uint64:
+		e.writeHead(cborMajorUint, val)
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			e.writeInt(i)
+			return nil
+		}
+		f, err := val.Float64()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		e.writeFloat(f)
+	case []interface{}:
+		e.writeHead(cborMajorArray, uint64(len(val)))
+		for _, item := range val {
+			if err := e.writeValue(item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if val == nil {
+			e.writeNull()
+			return nil
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.writeHead(cborMajorMap, uint64(len(val)))
+		for _, k := range keys {
+			e.writeString(k)
+			if err := e.writeValue(val[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		generic, err := toGenericValue(v)
+		if err != nil {
+			return err
+		}
+		return e.writeValue(generic)
+	}
+	return nil
+}
+
+// toGenericValue converts a value to its generic JSON representation,
+// keeping numbers exact.
+func toGenericValue(v interface{}) (interface{}, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return rawToGenericValue(js)
+}
+
+// rawToGenericValue decodes JSON to a generic value, keeping numbers exact.
+func rawToGenericValue(js []byte) (interface{}, error) {
+	var generic interface{}
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return generic, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, ErrInvalidBinary
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *cborDecoder) readN(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, ErrInvalidBinary
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *cborDecoder) readHead() (major byte, info byte, n uint64, err error) {
+	b, err := d.readByte()
+	if err != nil {
+		return
+	}
+	major, info = b>>5, b&0x1f
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info == 24:
+		var buf []byte
+		if buf, err = d.readN(1); err == nil {
+			n = uint64(buf[0])
+		}
+	case info == 25:
+		var buf []byte
+		if buf, err = d.readN(2); err == nil {
+			n = uint64(binary.BigEndian.Uint16(buf))
+		}
+	case info == 26:
+		var buf []byte
+		if buf, err = d.readN(4); err == nil {
+			n = uint64(binary.BigEndian.Uint32(buf))
+		}
+	case info == 27:
+		var buf []byte
+		if buf, err = d.readN(8); err == nil {
+			n = binary.BigEndian.Uint64(buf)
+		}
+	default:
+		// Indefinite lengths are not part of the schema.
+		err = ErrInvalidBinary
+	}
+	return
+}
+
+// readValue decodes a value. Integers are returned as int64 (or uint64 if
+// they overflow an int64) and floats as float64.
+func (d *cborDecoder) readValue() (interface{}, error) {
+	major, info, n, err := d.readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborMajorUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cborMajorNegInt:
+		if n > math.MaxInt64 {
+			return nil, ErrInvalidBinary
+		}
+		return -int64(n) - 1, nil
+	case cborMajorBytes:
+		b, err := d.readN(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case cborMajorText:
+		b, err := d.readN(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case cborMajorArray:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, ErrInvalidBinary
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if arr[i], err = d.readValue(); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case cborMajorMap:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, ErrInvalidBinary
+		}
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.readValue()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, ErrInvalidBinary
+			}
+			if m[key], err = d.readValue(); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case cborMajorSimple:
+		switch info {
+		case cborFalse & 0x1f:
+			return false, nil
+		case cborTrue & 0x1f:
+			return true, nil
+		case cborNull & 0x1f:
+			return nil, nil
+		case cborFloat64 & 0x1f:
+			return math.Float64frombits(n), nil
+		}
+	}
+
+	return nil, ErrInvalidBinary
+}
+
+// decodeCBOR decodes a single value that must span the whole input.
+func decodeCBOR(data []byte) (interface{}, error) {
+	d := cborDecoder{data: data}
+	v, err := d.readValue()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, ErrInvalidBinary
+	}
+	return v, nil
+}
+
+// normalizeNumbers converts all integers to float64, which is what
+// encoding/json produces when decoding to an interface{}.
+func normalizeNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case int64:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case []interface{}:
+		for i, item := range val {
+			val[i] = normalizeNumbers(item)
+		}
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = normalizeNumbers(item)
+		}
+	}
+	return v
+}
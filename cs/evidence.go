@@ -17,12 +17,35 @@ package cs
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
+	"sync"
 )
 
-// DeserializeMethods maps a proof backend (like "TMPop") to a deserializer function returning a specific proof
-var DeserializeMethods = make(map[string]func(json.RawMessage) (Proof, error), 0)
+// ProofDeserializer is a function returning a specific proof from its JSON representation
+type ProofDeserializer func(json.RawMessage) (Proof, error)
+
+var (
+	// deserializeMethods maps a proof backend (like "TMPop") to a deserializer function returning a specific proof
+	deserializeMethods   = make(map[string]ProofDeserializer, 0)
+	deserializeMethodsMu sync.RWMutex
+)
+
+// RegisterProofType registers the deserializer for proofs of the given backend.
+// It is safe to call from multiple goroutines, typically in a package's init().
+// Registering the same backend twice replaces the previous deserializer.
+func RegisterProofType(backend string, deserializer ProofDeserializer) {
+	deserializeMethodsMu.Lock()
+	defer deserializeMethodsMu.Unlock()
+	deserializeMethods[backend] = deserializer
+}
+
+// getProofDeserializer returns the deserializer registered for a backend
+func getProofDeserializer(backend string) (ProofDeserializer, bool) {
+	deserializeMethodsMu.RLock()
+	defer deserializeMethodsMu.RUnlock()
+	deserializer, exists := deserializeMethods[backend]
+	return deserializer, exists
+}
 
 // Evidences encapsulates a list of evidences contained in Segment.Meta
 type Evidences []*Evidence
@@ -70,13 +93,11 @@ func (e *Evidence) UnmarshalJSON(data []byte) error {
 		Provider string          `json:"provider"`
 		Proof    json.RawMessage `json:"proof"`
 	}{}
-	json.Unmarshal(data, &serialized)
-	deserializer, exists := DeserializeMethods[serialized.Backend]
-	if !exists {
-		return errors.New("Evidence type does not exist")
+	if err := json.Unmarshal(data, &serialized); err != nil {
+		return err
 	}
 
-	proof, err := deserializer(serialized.Proof)
+	proof, err := deserializeProof(serialized.Backend, serialized.Proof)
 	if err != nil {
 		return err
 	}
@@ -89,6 +110,18 @@ func (e *Evidence) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// deserializeProof deserializes a raw proof using the deserializer of its backend
+func deserializeProof(backend string, rawProof json.RawMessage) (Proof, error) {
+	deserializer, exists := getProofDeserializer(backend)
+	if !exists {
+		// The backend is unknown to this client (for instance it was
+		// registered by a newer fossilizer), so we keep the raw proof
+		// to be able to serialize it back without losing data.
+		return NewUnknownProof(rawProof), nil
+	}
+	return deserializer(rawProof)
+}
+
 // UnmarshalRQL serializes an interface{} into an Evidence
 func (e *Evidence) UnmarshalRQL(data interface{}) error {
 	return e.UnmarshalJSON(data.([]byte))
@@ -133,13 +166,57 @@ func (p *GenericProof) Verify(_ interface{}) bool {
 	return true
 }
 
-// init needs to define a way to deserialize a DummyProof
+// UnknownProof implements the Proof interface for backends that have no
+// registered deserializer. It keeps the raw JSON so it round-trips losslessly.
+type UnknownProof struct {
+	Raw json.RawMessage
+}
+
+// NewUnknownProof creates an UnknownProof from a raw JSON proof
+func NewUnknownProof(raw json.RawMessage) *UnknownProof {
+	p := &UnknownProof{}
+	if raw != nil {
+		p.Raw = append(json.RawMessage{}, raw...)
+	}
+	return p
+}
+
+// Time returns 0 since the timestamp cannot be extracted from an unknown proof
+func (p *UnknownProof) Time() uint64 {
+	return 0
+}
+
+// FullProof returns the raw JSON proof
+func (p *UnknownProof) FullProof() []byte {
+	return p.Raw
+}
+
+// Verify always returns false since an unknown proof cannot be checked
+func (p *UnknownProof) Verify(_ interface{}) bool {
+	return false
+}
+
+// MarshalJSON returns the raw JSON proof as is
+func (p *UnknownProof) MarshalJSON() ([]byte, error) {
+	if len(p.Raw) == 0 {
+		return []byte("null"), nil
+	}
+	return p.Raw, nil
+}
+
+// UnmarshalJSON stores a copy of the raw JSON proof
+func (p *UnknownProof) UnmarshalJSON(data []byte) error {
+	p.Raw = append(p.Raw[0:0], data...)
+	return nil
+}
+
+// init needs to define a way to deserialize a GenericProof
 func init() {
-	DeserializeMethods["generic"] = func(rawProof json.RawMessage) (Proof, error) {
+	RegisterProofType("generic", func(rawProof json.RawMessage) (Proof, error) {
 		p := GenericProof{}
 		if err := json.Unmarshal(rawProof, &p); err != nil {
 			return nil, err
 		}
 		return &p, nil
-	}
+	})
 }
@@ -20,6 +20,11 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/btctesting"
+	"github.com/stratumn/sdk/blockchain/btc/btctimestamper"
 	"github.com/stratumn/sdk/cs"
 	"github.com/stratumn/sdk/cs/evidences"
 	"github.com/stratumn/sdk/merkle"
@@ -51,10 +56,17 @@ var (
 		},
 	}
 
-	JSONTestWrongEvidences = `
+	JSONTestUnknownEvidences = `
 		[{
 			"backend": "random",
 			"provider": "testChain",
+			"proof": {"a":1,"nested":{"b":[true,null,"c"]}}
+		}]`
+
+	JSONTestWrongEvidences = `
+		[{
+			"backend": "generic",
+			"provider": 42,
 			"proof": {}
 		}]`
 
@@ -146,9 +158,59 @@ func TestSerializeWrongEvidence(t *testing.T) {
 	evidences := cs.Evidences{}
 
 	if err := json.Unmarshal([]byte(JSONTestWrongEvidences), &evidences); err == nil {
-		t.Errorf("Should have failed because of unknown type of evidence")
+		t.Errorf("Should have failed because of invalid evidence")
+	}
+
+}
+
+func TestSerializeUnknownEvidence(t *testing.T) {
+	evidences := cs.Evidences{}
+
+	if err := json.Unmarshal([]byte(JSONTestUnknownEvidences), &evidences); err != nil {
+		t.Fatalf("json.Unmarshal(): err: %s", err)
+	}
+	if got, want := len(evidences), 1; got != want {
+		t.Fatalf("len(evidences) = %d, want %d", got, want)
+	}
+
+	e := evidences[0]
+	assert.Equal(t, "random", e.Backend)
+	assert.Equal(t, "testChain", e.Provider)
+	assert.IsType(t, &cs.UnknownProof{}, e.Proof)
+	assert.False(t, e.Proof.Verify(testutil.RandomHash()), "Unknown proof should not be verified")
+
+	marshalled, err := json.Marshal(evidences)
+	if err != nil {
+		t.Fatalf("json.Marshal(): err: %s", err)
 	}
 
+	var got, want interface{}
+	if err := json.Unmarshal(marshalled, &got); err != nil {
+		t.Fatalf("json.Unmarshal(): err: %s", err)
+	}
+	if err := json.Unmarshal([]byte(JSONTestUnknownEvidences), &want); err != nil {
+		t.Fatalf("json.Unmarshal(): err: %s", err)
+	}
+	assert.Equal(t, want, got, "Unknown evidence should round-trip")
+}
+
+func TestRegisterProofType(t *testing.T) {
+	backend := "registered"
+	cs.RegisterProofType(backend, func(rawProof json.RawMessage) (cs.Proof, error) {
+		p := cs.GenericProof{}
+		if err := json.Unmarshal(rawProof, &p); err != nil {
+			return nil, err
+		}
+		return &p, nil
+	})
+
+	e := cs.Evidence{}
+	data := []byte(`{"backend":"registered","provider":"testChain","proof":{"timestamp":42}}`)
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatalf("json.Unmarshal(): err: %s", err)
+	}
+	assert.IsType(t, &cs.GenericProof{}, e.Proof)
+	assert.Equal(t, uint64(42), e.Proof.Time())
 }
 
 func TestGenericProof(t *testing.T) {
@@ -254,3 +316,113 @@ func TestTendermintProof(t *testing.T) {
 		assert.False(t, e.Verify(linkHash), "Proof should not be correct if previous app hash changed")
 	})
 }
+
+func TestBatchProof(t *testing.T) {
+	linkHash := testutil.RandomHash()
+	tree, _ := merkle.NewStaticTree([]types.Bytes32{*testutil.RandomHash(), *linkHash, *testutil.RandomHash()})
+	p := &evidences.BatchProof{Timestamp: 42, Root: tree.Root(), Path: tree.Path(1)}
+
+	t.Run("Verify()", func(t *testing.T) {
+		assert.True(t, p.Verify(linkHash), "Proof should be verified")
+		assert.True(t, (&evidences.BcBatchProof{Batch: *p}).Verify(linkHash), "Blockchain proof should be verified")
+	})
+
+	t.Run("Verify() fails for another link hash", func(t *testing.T) {
+		assert.False(t, p.Verify(testutil.RandomHash()), "Proof should not be correct for another link hash")
+	})
+
+	t.Run("Verify() fails for another root", func(t *testing.T) {
+		e := &evidences.BatchProof{Root: testutil.RandomHash(), Path: p.Path}
+		assert.False(t, e.Verify(linkHash), "Proof should not be correct if merkle root changed")
+	})
+
+	t.Run("Verify() succeeds for single element merkle tree", func(t *testing.T) {
+		e := &evidences.BatchProof{Root: linkHash}
+		assert.True(t, e.Verify(linkHash), "Proof should be verified")
+	})
+
+	t.Run("Verify() fails for an empty path", func(t *testing.T) {
+		assert.False(t, (&evidences.BatchProof{}).Verify(linkHash), "Empty proof should not be verified")
+		e := &evidences.BatchProof{Root: testutil.RandomHash()}
+		assert.False(t, e.Verify(linkHash), "Proof without path should not be correct for another root")
+	})
+}
+
+func TestOpenTimestampsProof(t *testing.T) {
+	linkHash := testutil.RandomHash()
+	tree, _ := merkle.NewStaticTree([]types.Bytes32{*testutil.RandomHash(), *linkHash, *testutil.RandomHash()})
+
+	harness := btctesting.NewHarness(btc.NetworkRegtest)
+	privKey, _ := btcec.NewPrivateKey(btcec.S256())
+	wif, _ := btcutil.NewWIF(privKey, btc.NetworkRegtest.Params(), true)
+	ts, err := btctimestamper.New(&btctimestamper.Config{
+		UnspentFinder: harness,
+		Broadcaster:   harness,
+		WIF:           wif.String(),
+		Network:       btc.NetworkRegtest,
+		Fee:           1000,
+	})
+	if err != nil {
+		t.Fatalf("btctimestamper.New(): err: %s", err)
+	}
+	harness.Fund(ts.Address(), 100000)
+
+	txid, err := ts.TimestampHash(tree.Root())
+	if err != nil {
+		t.Fatalf("ts.TimestampHash(): err: %s", err)
+	}
+	bcProof := &evidences.BcBatchProof{
+		Batch:         evidences.BatchProof{Timestamp: 42, Root: tree.Root(), Path: tree.Path(1)},
+		TransactionID: txid,
+	}
+
+	_, err = bcProof.OpenTimestamps(linkHash, harness)
+	assert.Equal(t, btc.ErrTransactionNotMined, err, "Transaction should not be mined")
+
+	harness.Mine(1)
+	p, err := bcProof.OpenTimestamps(linkHash, harness)
+	if err != nil {
+		t.Fatalf("bcProof.OpenTimestamps(): err: %s", err)
+	}
+
+	t.Run("Verify()", func(t *testing.T) {
+		assert.False(t, p.Verify(linkHash), "Proof should not be verified without block headers")
+	})
+
+	t.Run("VerifyHeaders()", func(t *testing.T) {
+		assert.NoError(t, p.VerifyHeaders(linkHash, harness))
+		assert.Error(t, p.VerifyHeaders(testutil.RandomHash(), harness), "Proof should not be correct for another link hash")
+
+		// The attested root is not in another chain.
+		other := btctesting.NewHarness(btc.NetworkRegtest)
+		other.Mine(2)
+		assert.Error(t, p.VerifyHeaders(linkHash, other), "Proof should not be correct for another chain")
+	})
+
+	t.Run("BitcoinAttestations()", func(t *testing.T) {
+		roots, err := p.BitcoinAttestations()
+		assert.NoError(t, err)
+		txProof, _ := harness.TransactionProof(txid)
+		root := harness.MerkleRoot(txProof.BlockHeight)
+		assert.Equal(t, map[uint64][]byte{uint64(txProof.BlockHeight): root[:]}, roots)
+	})
+
+	t.Run("NewOpenTimestampsProof()", func(t *testing.T) {
+		imported, err := evidences.NewOpenTimestampsProof(p.OTS)
+		assert.NoError(t, err)
+		assert.NoError(t, imported.VerifyHeaders(linkHash, harness), "Imported proof should be verified")
+
+		_, err = evidences.NewOpenTimestampsProof([]byte("not ots"))
+		assert.Error(t, err)
+	})
+
+	t.Run("UnmarshalJSON()", func(t *testing.T) {
+		data, err := json.Marshal(&cs.Evidence{Backend: evidences.OpenTimestampsName, Provider: "bitcoin:regtest", Proof: p})
+		assert.NoError(t, err)
+
+		e := cs.Evidence{}
+		assert.NoError(t, json.Unmarshal(data, &e))
+		assert.Equal(t, p, e.Proof)
+		assert.Equal(t, uint64(p.Timestamp), e.Proof.Time())
+	})
+}
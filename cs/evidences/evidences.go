@@ -19,12 +19,19 @@ package evidences
 import (
 	"bytes"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
 
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/ots"
 	"github.com/stratumn/sdk/cs"
 	// This package imports every package defining its own implementation of the cs.Proof interface
 	// The init() function of each package gets called hence providing a way for cs.Evidence.UnmarshalJSON to deserialize any kind of proof
 	_ "github.com/stratumn/sdk/dummyfossilizer"
+	"github.com/stratumn/sdk/tsa"
 	"github.com/stratumn/sdk/types"
 
 	abci "github.com/tendermint/abci/types"
@@ -38,6 +45,10 @@ var (
 	BcBatchFossilizerName = "bcbatch"
 	// TMPopName is the name used as the Tendermint PoP backend
 	TMPopName = "TMPop"
+	// TSABatchFossilizerName is the name used as the TSABatchProof backend
+	TSABatchFossilizerName = "tsabatch"
+	// OpenTimestampsName is the name used as the OpenTimestampsProof backend
+	OpenTimestampsName = "ots"
 )
 
 // BatchProof implements the Proof interface
@@ -63,17 +74,34 @@ func (p *BatchProof) FullProof() []byte {
 
 // Verify returns true if the proof of a given linkHash is correct
 func (p *BatchProof) Verify(linkHash interface{}) bool {
-	err := p.Path.Validate()
-	if err != nil {
+	lh, ok := linkHash.(*types.Bytes32)
+	if !ok || lh == nil || p.Root == nil {
 		return false
 	}
-	return true
+
+	if len(p.Path) == 0 {
+		// If the tree contains a single element, it's valid if it's the root
+		return lh.Equals(p.Root)
+	}
+
+	if err := p.Path.Validate(); err != nil {
+		return false
+	}
+	if !p.Root.Equals(&p.Path[len(p.Path)-1].Parent) {
+		return false
+	}
+
+	return lh.Equals(&p.Path[0].Left) || lh.Equals(&p.Path[0].Right)
 }
 
 // BcBatchProof implements the Proof interface
 type BcBatchProof struct {
 	Batch         BatchProof          `json:"batch"`
 	TransactionID types.TransactionID `json:"txid"`
+	// Set once the transaction is mined
+	BlockHash     *types.Bytes32 `json:"blockHash,omitempty"`
+	BlockHeight   uint64         `json:"blockHeight,omitempty"`
+	Confirmations uint64         `json:"confirmations,omitempty"`
 }
 
 // Time returns the timestamp from the block header
@@ -92,11 +120,200 @@ func (p *BcBatchProof) FullProof() []byte {
 
 // Verify returns true if the proof of a given linkHash is correct
 func (p *BcBatchProof) Verify(linkHash interface{}) bool {
-	err := p.Batch.Path.Validate()
+	return p.Batch.Verify(linkHash)
+}
+
+// OpenTimestamps converts the proof to the OpenTimestamps format, which can be
+// verified with the standard OpenTimestamps tools.
+// The transaction must be mined, its inclusion proof is given by the prover.
+func (p *BcBatchProof) OpenTimestamps(linkHash *types.Bytes32, prover btc.TransactionProver) (*OpenTimestampsProof, error) {
+	txProof, err := prover.TransactionProof(p.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := ots.FromBatch(linkHash, p.Batch.Path, p.Batch.Root, txProof)
 	if err != nil {
+		return nil, err
+	}
+	data, err := timestamp.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenTimestampsProof{Timestamp: txProof.BlockTime, OTS: data}, nil
+}
+
+// OpenTimestampsProof implements the Proof interface
+type OpenTimestampsProof struct {
+	// Unix time of the attesting block, zero if unknown
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Content of the .ots file
+	OTS []byte `json:"ots"`
+}
+
+// NewOpenTimestampsProof creates a proof from the content of a .ots file
+func NewOpenTimestampsProof(data []byte) (*OpenTimestampsProof, error) {
+	if _, err := ots.Decode(data); err != nil {
+		return nil, err
+	}
+	return &OpenTimestampsProof{OTS: data}, nil
+}
+
+// Time returns the time of the attesting block, if known
+func (p *OpenTimestampsProof) Time() uint64 {
+	return uint64(p.Timestamp)
+}
+
+// FullProof returns a JSON formatted proof
+func (p *OpenTimestampsProof) FullProof() []byte {
+	bytes, err := json.MarshalIndent(p, "", "   ")
+	if err != nil {
+		return nil
+	}
+	return bytes
+}
+
+// Verify always returns false because the Merkle roots attested by the proof
+// can only be checked against Bitcoin block headers, which requires querying
+// a chain. Use VerifyHeaders instead.
+func (p *OpenTimestampsProof) Verify(linkHash interface{}) bool {
+	return false
+}
+
+// VerifyHeaders checks that the proof timestamps the given linkHash and that
+// each of its Bitcoin attestations matches the Merkle root of the header of
+// the attesting block.
+func (p *OpenTimestampsProof) VerifyHeaders(linkHash *types.Bytes32, headers btc.MerkleRootReader) error {
+	timestamp, err := ots.Decode(p.OTS)
+	if err != nil {
+		return err
+	}
+	if timestamp.FileHashOp.Tag != ots.OpSHA256 || !bytes.Equal(timestamp.Digest, linkHash[:]) {
+		return errors.New("proof does not timestamp the link hash")
+	}
+
+	attestations, err := p.BitcoinAttestations()
+	if err != nil {
+		return err
+	}
+	if len(attestations) == 0 {
+		return errors.New("proof has no Bitcoin attestation")
+	}
+
+	for height, message := range attestations {
+		root, err := headers.BlockMerkleRoot(int64(height))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(root[:], message) {
+			return fmt.Errorf("attested message does not match the Merkle root of block %d", height)
+		}
+	}
+
+	return nil
+}
+
+// BitcoinAttestations returns the Merkle roots attested by Bitcoin blocks,
+// indexed by block height
+func (p *OpenTimestampsProof) BitcoinAttestations() (map[uint64][]byte, error) {
+	timestamp, err := ots.Decode(p.OTS)
+	if err != nil {
+		return nil, err
+	}
+	attested, err := timestamp.Evaluate()
+	if err != nil {
+		return nil, err
+	}
+
+	roots := map[uint64][]byte{}
+	for _, a := range attested {
+		if height, ok := a.Attestation.BitcoinHeight(); ok {
+			roots[height] = a.Message
+		}
+	}
+	return roots, nil
+}
+
+var (
+	tsaRoots      *x509.CertPool
+	tsaRootsMutex sync.RWMutex
+)
+
+// RegisterTSARoots sets the root certificates of the timestamp authorities
+// trusted to sign the tokens of TSABatchProof. No TSABatchProof is verified
+// until roots are registered.
+func RegisterTSARoots(roots *x509.CertPool) {
+	tsaRootsMutex.Lock()
+	defer tsaRootsMutex.Unlock()
+	tsaRoots = roots
+}
+
+// getTSARoots returns the registered roots of trusted timestamp authorities.
+func getTSARoots() *x509.CertPool {
+	tsaRootsMutex.RLock()
+	defer tsaRootsMutex.RUnlock()
+	return tsaRoots
+}
+
+// TSABatchProof implements the Proof interface
+type TSABatchProof struct {
+	Batch BatchProof `json:"batch"`
+	// DER encoded RFC 3161 time-stamp token of the Merkle root
+	Token []byte `json:"timeStampToken"`
+}
+
+// Time returns the time of the time-stamp token
+func (p *TSABatchProof) Time() uint64 {
+	token, err := tsa.ParseToken(p.Token)
+	if err != nil {
+		return 0
+	}
+	return uint64(token.Info.GenTime.Unix())
+}
+
+// FullProof returns a JSON formatted proof
+func (p *TSABatchProof) FullProof() []byte {
+	bytes, err := json.MarshalIndent(p, "", "   ")
+	if err != nil {
+		return nil
+	}
+	return bytes
+}
+
+// Verify returns true if the proof of a given linkHash is correct.
+// It checks the signature of the time-stamp token, that it was issued for
+// the Merkle root by an authority trusted by the roots given to
+// RegisterTSARoots, and that the Merkle path starts at the given link hash.
+// It returns false when no roots are registered.
+func (p *TSABatchProof) Verify(linkHash interface{}) bool {
+	roots := getTSARoots()
+	if roots == nil || p.Batch.Root == nil {
 		return false
 	}
-	return true
+
+	token, err := tsa.ParseToken(p.Token)
+	if err != nil {
+		return false
+	}
+	if err := token.Verify(p.Batch.Root[:]); err != nil {
+		return false
+	}
+	if err := token.VerifyChain(roots); err != nil {
+		return false
+	}
+
+	return p.Batch.Verify(linkHash)
+}
+
+// VerifyChain checks that the time-stamp token was signed by a timestamp
+// authority whose certificate chains to one of the given roots
+func (p *TSABatchProof) VerifyChain(roots *x509.CertPool) error {
+	token, err := tsa.ParseToken(p.Token)
+	if err != nil {
+		return err
+	}
+	return token.VerifyChain(roots)
 }
 
 // TendermintSignature is a signature by one of the Tendermint nodes
@@ -113,6 +330,10 @@ type TendermintProof struct {
 	Path            types.Path     `json:"merklePath"`
 	ValidationsHash *types.Bytes32 `json:"validationsHash"`
 
+	// The hash of the evidences delivered in the block, nil if there are
+	// none
+	EvidencesHash *types.Bytes32 `json:"evidencesHash,omitempty"`
+
 	// The header and its signatures are needed to validate
 	// the previous app hash and metadata such as the height and time
 	Header     abci.Header            `json:"header"`
@@ -160,9 +381,17 @@ func (p *TendermintProof) Verify(linkHash interface{}) bool {
 	if _, err := hash.Write(validationsHash[:]); err != nil {
 		return false
 	}
+	if p.Root == nil {
+		return false
+	}
 	if _, err := hash.Write(p.Root[:]); err != nil {
 		return false
 	}
+	if p.EvidencesHash != nil {
+		if _, err := hash.Write(p.EvidencesHash[:]); err != nil {
+			return false
+		}
+	}
 
 	expectedAppHash := hash.Sum(nil)
 	if bytes.Compare(expectedAppHash, p.NextHeader.AppHash) != 0 {
@@ -194,25 +423,39 @@ func (p *TendermintProof) Verify(linkHash interface{}) bool {
 }
 
 func init() {
-	cs.DeserializeMethods[BatchFossilizerName] = func(rawProof json.RawMessage) (cs.Proof, error) {
+	cs.RegisterProofType(BatchFossilizerName, func(rawProof json.RawMessage) (cs.Proof, error) {
 		p := BatchProof{}
 		if err := json.Unmarshal(rawProof, &p); err != nil {
 			return nil, err
 		}
 		return &p, nil
-	}
-	cs.DeserializeMethods[BcBatchFossilizerName] = func(rawProof json.RawMessage) (cs.Proof, error) {
+	})
+	cs.RegisterProofType(BcBatchFossilizerName, func(rawProof json.RawMessage) (cs.Proof, error) {
 		p := BcBatchProof{}
 		if err := json.Unmarshal(rawProof, &p); err != nil {
 			return nil, err
 		}
 		return &p, nil
-	}
-	cs.DeserializeMethods[TMPopName] = func(rawProof json.RawMessage) (cs.Proof, error) {
+	})
+	cs.RegisterProofType(TSABatchFossilizerName, func(rawProof json.RawMessage) (cs.Proof, error) {
+		p := TSABatchProof{}
+		if err := json.Unmarshal(rawProof, &p); err != nil {
+			return nil, err
+		}
+		return &p, nil
+	})
+	cs.RegisterProofType(OpenTimestampsName, func(rawProof json.RawMessage) (cs.Proof, error) {
+		p := OpenTimestampsProof{}
+		if err := json.Unmarshal(rawProof, &p); err != nil {
+			return nil, err
+		}
+		return &p, nil
+	})
+	cs.RegisterProofType(TMPopName, func(rawProof json.RawMessage) (cs.Proof, error) {
 		p := TendermintProof{}
 		if err := json.Unmarshal(rawProof, &p); err != nil {
 			return nil, err
 		}
 		return &p, nil
-	}
+	})
 }
@@ -83,13 +83,13 @@ func (p *DummyProof) Verify(interface{}) bool {
 
 // init needs to define a way to deserialize a DummyProof
 func init() {
-	cs.DeserializeMethods[Name] = func(rawProof json.RawMessage) (cs.Proof, error) {
+	cs.RegisterProofType(Name, func(rawProof json.RawMessage) (cs.Proof, error) {
 		p := DummyProof{}
 		if err := json.Unmarshal(rawProof, &p); err != nil {
 			return nil, err
 		}
 		return &p, nil
-	}
+	})
 }
 
 // New creates an instance of a DummyFossilizer.
@@ -17,6 +17,7 @@ package fossilizer
 
 import (
 	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/types"
 )
 
 // Adapter must be implemented by a fossilier.
@@ -51,6 +52,10 @@ type EventType string
 const (
 	// DidFossilizeLink means that the link was fossilized
 	DidFossilizeLink EventType = "DidFossilizeLink"
+
+	// DidConfirmLink means that the fossil of the link reached the required
+	// number of confirmations
+	DidConfirmLink EventType = "DidConfirmLink"
 )
 
 // Event is the object fossilizers send to notify of important events.
@@ -58,3 +63,57 @@ type Event struct {
 	EventType EventType
 	Data      interface{}
 }
+
+// Status is the status of a fossil or of a batch of fossils.
+type Status string
+
+const (
+	// StatusPending means that the data was received but has not been
+	// fossilized yet.
+	StatusPending Status = "pending"
+
+	// StatusSent means that an evidence was created for the data.
+	StatusSent Status = "sent"
+
+	// StatusAnchored means that the evidence reached the required number of
+	// confirmations.
+	StatusAnchored Status = "anchored"
+)
+
+// FossilStatus describes the status of fossilized data.
+type FossilStatus struct {
+	// The status of the fossil.
+	Status Status `json:"status"`
+
+	// The Merkle root of the batch containing the fossil, if any.
+	Root *types.Bytes32 `json:"merkleRoot,omitempty"`
+
+	// The results that were produced for the fossil.
+	Results []*Result `json:"results"`
+}
+
+// BatchStatus describes the status of a batch of fossils.
+type BatchStatus struct {
+	// The Merkle root of the batch.
+	Root *types.Bytes32 `json:"merkleRoot"`
+
+	// The status of the batch.
+	Status Status `json:"status"`
+
+	// The time of the batch, if known.
+	Timestamp int64 `json:"timestamp,omitempty"`
+
+	// The results that were produced for the fossils of the batch.
+	Results []*Result `json:"results"`
+}
+
+// Querier can optionally be implemented by an adapter that is able to
+// look up the fossils it has processed.
+type Querier interface {
+	// Returns the status of the given data, or nil if it is unknown.
+	FossilStatus(data []byte) (*FossilStatus, error)
+
+	// Returns the status of the batch with the given Merkle root, or nil
+	// if it is unknown.
+	BatchStatus(root *types.Bytes32) (*BatchStatus, error)
+}
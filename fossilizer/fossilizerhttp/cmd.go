@@ -42,6 +42,7 @@ var (
 	keyFile                 string
 	minDataLen              int
 	maxDataLen              int
+	maxResults              int
 	callbackTimeout         time.Duration
 	readTimeout             time.Duration
 	writeTimeout            time.Duration
@@ -88,6 +89,7 @@ func RegisterFlags() {
 	flag.StringVar(&keyFile, "tls_key", "", "TLS private key file")
 	flag.IntVar(&minDataLen, "mindata", DefaultMinDataLen, "Minimum data length")
 	flag.IntVar(&maxDataLen, "maxdata", DefaultMaxDataLen, "Maximum data length")
+	flag.IntVar(&maxResults, "maxresults", DefaultMaxResults, "Maximum number of fossils whose results are kept in memory")
 	flag.DurationVar(&callbackTimeout, "callbacktimeout", DefaultCallbackTimeout, "Callback request timeout")
 	flag.DurationVar(&readTimeout, "read_timeout", jsonhttp.DefaultReadTimeout, "Read timeout")
 	flag.DurationVar(&writeTimeout, "write_timeout", jsonhttp.DefaultWriteTimeout, "Write timeout")
@@ -110,6 +112,7 @@ func RunWithFlags(ctx context.Context, a fossilizer.Adapter) {
 		MaxDataLen:              maxDataLen,
 		CallbackTimeout:         callbackTimeout,
 		FossilizerEventChanSize: fossilizerEventChanSize,
+		MaxResults:              maxResults,
 	}
 	httpConfig := &jsonhttp.Config{
 		Address:        addr,
@@ -38,3 +38,17 @@ func newErrProcess(msg string) jsonhttp.ErrHTTP {
 	}
 	return jsonhttp.NewErrBadRequest(msg)
 }
+
+func newErrHash(msg string) jsonhttp.ErrHTTP {
+	if msg == "" {
+		msg = "invalid hash"
+	}
+	return jsonhttp.NewErrBadRequest(msg)
+}
+
+func newErrRoot(msg string) jsonhttp.ErrHTTP {
+	if msg == "" {
+		msg = "invalid Merkle root"
+	}
+	return jsonhttp.NewErrBadRequest(msg)
+}
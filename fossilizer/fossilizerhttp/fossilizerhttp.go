@@ -24,6 +24,14 @@
 //		Form.data should be a hex encoded buffer.
 //		Form.callbackUrl should be a URL to be called when the evidence
 //		is ready.
+//
+//	GET /fossils/:hash
+//		Renders the status and the results of the fossilized data.
+//		The hash should be the hex encoded data.
+//
+//	GET /batches/:root
+//		Renders the status and the results of a batch.
+//		The root should be the hex encoded Merkle root of the batch.
 package fossilizerhttp
 
 import (
@@ -38,6 +46,7 @@ import (
 	"github.com/stratumn/sdk/fossilizer"
 	"github.com/stratumn/sdk/jsonhttp"
 	"github.com/stratumn/sdk/jsonws"
+	"github.com/stratumn/sdk/types"
 )
 
 const (
@@ -56,6 +65,10 @@ const (
 
 	// DefaultFossilizerEventChanSize is the default size of the fossilizer event channel.
 	DefaultFossilizerEventChanSize = 256
+
+	// DefaultMaxResults is the default maximum number of fossils whose
+	// results are kept in memory.
+	DefaultMaxResults = 10000
 )
 
 // Config contains configuration options for the server.
@@ -71,6 +84,11 @@ type Config struct {
 
 	// The size of the EventChan channel.
 	FossilizerEventChanSize int
+
+	// The maximum number of fossils whose results are kept in memory.
+	// If zero, results are only looked up using the adapter, if it
+	// implements github.com/stratumn/sdk/fossilizer.Querier.
+	MaxResults int
 }
 
 // Info is the info returned by the root route.
@@ -85,6 +103,7 @@ type Server struct {
 	config              *Config
 	ws                  *jsonws.Basic
 	fossilizerEventChan chan *fossilizer.Event
+	results             *resultStore
 }
 
 // New create an instance of a server.
@@ -101,10 +120,13 @@ func New(
 		config:              config,
 		ws:                  jsonws.NewBasic(basicConfig, bufConnConfig),
 		fossilizerEventChan: make(chan *fossilizer.Event, config.FossilizerEventChanSize),
+		results:             newResultStore(config.MaxResults),
 	}
 
 	s.Get("/", s.root)
 	s.Post("/fossils", s.fossilize)
+	s.Get("/fossils/:hash", s.getFossil)
+	s.Get("/batches/:root", s.getBatch)
 	s.GetRaw("/websocket", s.getWebSocket)
 
 	return &s
@@ -161,6 +183,15 @@ func (s *Server) Start() {
 // Forward events to websocket
 func (s *Server) handleEvents() {
 	for event := range s.fossilizerEventChan {
+		if r, ok := event.Data.(*fossilizer.Result); ok {
+			switch event.EventType {
+			case fossilizer.DidFossilizeLink:
+				s.results.addResult(fossilizer.StatusSent, r)
+			case fossilizer.DidConfirmLink:
+				s.results.addResult(fossilizer.StatusAnchored, r)
+			}
+		}
+
 		s.ws.Broadcast(&jsonws.Message{
 			Type: string(event.EventType),
 			Data: event.Data,
@@ -189,9 +220,65 @@ func (s *Server) fossilize(w http.ResponseWriter, r *http.Request, p httprouter.
 		return nil, err
 	}
 
+	s.results.addPending(data)
+
 	return "ok", nil
 }
 
+func (s *Server) getFossil(w http.ResponseWriter, r *http.Request, p httprouter.Params) (interface{}, error) {
+	data, err := hex.DecodeString(p.ByName("hash"))
+	if err != nil || len(data) == 0 {
+		return nil, newErrHash("")
+	}
+
+	status, err := s.results.FossilStatus(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The adapter may know more about fossils that are not in memory
+	// anymore or that are still pending.
+	if q, ok := s.adapter.(fossilizer.Querier); ok && (status == nil || status.Status == fossilizer.StatusPending) {
+		found, err := q.FossilStatus(data)
+		if err != nil {
+			return nil, err
+		}
+		if found != nil {
+			status = found
+		}
+	}
+
+	if status == nil {
+		return nil, jsonhttp.NewErrNotFound("")
+	}
+
+	return status, nil
+}
+
+func (s *Server) getBatch(w http.ResponseWriter, r *http.Request, p httprouter.Params) (interface{}, error) {
+	var root types.Bytes32
+	if err := root.Unstring(p.ByName("root")); err != nil {
+		return nil, newErrRoot("")
+	}
+
+	status, err := s.results.BatchStatus(&root)
+	if err != nil {
+		return nil, err
+	}
+
+	if q, ok := s.adapter.(fossilizer.Querier); ok && status == nil {
+		if status, err = q.BatchStatus(&root); err != nil {
+			return nil, err
+		}
+	}
+
+	if status == nil {
+		return nil, jsonhttp.NewErrNotFound("")
+	}
+
+	return status, nil
+}
+
 func (s *Server) parseFossilizeValues(r *http.Request) ([]byte, string, error) {
 	if err := r.ParseForm(); err != nil {
 		return nil, "", err
@@ -25,12 +25,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/evidences"
 	"github.com/stratumn/sdk/fossilizer"
 	"github.com/stratumn/sdk/fossilizer/fossilizertesting"
 	"github.com/stratumn/sdk/jsonhttp"
 	"github.com/stratumn/sdk/jsonws"
 	"github.com/stratumn/sdk/jsonws/jsonwstesting"
 	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/types"
 )
 
 func TestRoot(t *testing.T) {
@@ -186,6 +189,173 @@ func TestFossilize_noBody(t *testing.T) {
 	}
 }
 
+func TestGetFossil(t *testing.T) {
+	s, _ := createServer()
+
+	req := httptest.NewRequest("POST", "/fossils", nil)
+	req.Form = url.Values{}
+	req.Form.Set("data", "42")
+	req.Form.Set("process", "zou")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	var body map[string]interface{}
+	w, err := testutil.RequestJSON(s.ServeHTTP, "GET", "/fossils/42", nil, &body)
+	if err != nil {
+		t.Fatalf("testutil.RequestJSON(): err: %s", err)
+	}
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("w.StatusCode = %d want %d", got, want)
+	}
+	if got, want := body["status"], string(fossilizer.StatusPending); got != want {
+		t.Errorf(`body["status"] = %v want %q`, got, want)
+	}
+
+	root := testutil.RandomHash()
+	result := &fossilizer.Result{
+		Evidence: cs.Evidence{
+			Backend:  "batch",
+			Provider: "batch",
+			Proof:    &evidences.BatchProof{Timestamp: 42, Root: root},
+		},
+		Data: []byte{0x42},
+		Meta: []byte("zou"),
+	}
+	s.results.addResult(fossilizer.StatusSent, result)
+
+	if _, err := testutil.RequestJSON(s.ServeHTTP, "GET", "/fossils/42", nil, &body); err != nil {
+		t.Fatalf("testutil.RequestJSON(): err: %s", err)
+	}
+	if got, want := body["status"], string(fossilizer.StatusSent); got != want {
+		t.Errorf(`body["status"] = %v want %q`, got, want)
+	}
+	if got, want := body["merkleRoot"], root.String(); got != want {
+		t.Errorf(`body["merkleRoot"] = %v want %q`, got, want)
+	}
+
+	s.results.addResult(fossilizer.StatusAnchored, result)
+
+	body = nil
+	w, err = testutil.RequestJSON(s.ServeHTTP, "GET", "/batches/"+root.String(), nil, &body)
+	if err != nil {
+		t.Fatalf("testutil.RequestJSON(): err: %s", err)
+	}
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("w.StatusCode = %d want %d", got, want)
+	}
+	if got, want := body["status"], string(fossilizer.StatusAnchored); got != want {
+		t.Errorf(`body["status"] = %v want %q`, got, want)
+	}
+	if got, want := body["timestamp"], float64(42); got != want {
+		t.Errorf(`body["timestamp"] = %v want %v`, got, want)
+	}
+	if got, want := len(body["results"].([]interface{})), 1; got != want {
+		t.Errorf(`len(body["results"]) = %d want %d`, got, want)
+	}
+}
+
+type queryAdapter struct {
+	*fossilizertesting.MockAdapter
+	status *fossilizer.FossilStatus
+}
+
+func (a *queryAdapter) FossilStatus(data []byte) (*fossilizer.FossilStatus, error) {
+	return a.status, nil
+}
+
+func (a *queryAdapter) BatchStatus(root *types.Bytes32) (*fossilizer.BatchStatus, error) {
+	return nil, errors.New("error")
+}
+
+func TestGetFossil_querier(t *testing.T) {
+	a := &queryAdapter{
+		MockAdapter: &fossilizertesting.MockAdapter{},
+		status:      &fossilizer.FossilStatus{Status: fossilizer.StatusSent},
+	}
+	s := New(a, &Config{}, &jsonhttp.Config{}, &jsonws.BasicConfig{}, &jsonws.BufferedConnConfig{})
+
+	var body map[string]interface{}
+	w, err := testutil.RequestJSON(s.ServeHTTP, "GET", "/fossils/42", nil, &body)
+	if err != nil {
+		t.Fatalf("testutil.RequestJSON(): err: %s", err)
+	}
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("w.StatusCode = %d want %d", got, want)
+	}
+	if got, want := body["status"], string(fossilizer.StatusSent); got != want {
+		t.Errorf(`body["status"] = %v want %q`, got, want)
+	}
+
+	w, err = testutil.RequestJSON(s.ServeHTTP, "GET", "/batches/"+testutil.RandomHash().String(), nil, &body)
+	if err != nil {
+		t.Fatalf("testutil.RequestJSON(): err: %s", err)
+	}
+	if got, want := w.Code, jsonhttp.NewErrInternalServer("").Status(); got != want {
+		t.Errorf("w.Code = %d want %d", got, want)
+	}
+}
+
+func TestGetFossil_notFound(t *testing.T) {
+	s, _ := createServer()
+
+	var body map[string]interface{}
+	w, err := testutil.RequestJSON(s.ServeHTTP, "GET", "/fossils/42", nil, &body)
+	if err != nil {
+		t.Fatalf("testutil.RequestJSON(): err: %s", err)
+	}
+
+	if got, want := w.Code, jsonhttp.NewErrNotFound("").Status(); got != want {
+		t.Errorf("w.Code = %d want %d", got, want)
+	}
+}
+
+func TestGetFossil_invalidHash(t *testing.T) {
+	s, _ := createServer()
+
+	var body map[string]interface{}
+	w, err := testutil.RequestJSON(s.ServeHTTP, "GET", "/fossils/azerty", nil, &body)
+	if err != nil {
+		t.Fatalf("testutil.RequestJSON(): err: %s", err)
+	}
+
+	if got, want := w.Code, newErrHash("").Status(); got != want {
+		t.Errorf("w.Code = %d want %d", got, want)
+	}
+	if got, want := body["error"].(string), newErrHash("").Error(); got != want {
+		t.Errorf(`body["error"] = %q want %q`, got, want)
+	}
+}
+
+func TestGetBatch_invalidRoot(t *testing.T) {
+	s, _ := createServer()
+
+	var body map[string]interface{}
+	w, err := testutil.RequestJSON(s.ServeHTTP, "GET", "/batches/42", nil, &body)
+	if err != nil {
+		t.Fatalf("testutil.RequestJSON(): err: %s", err)
+	}
+
+	if got, want := w.Code, newErrRoot("").Status(); got != want {
+		t.Errorf("w.Code = %d want %d", got, want)
+	}
+	if got, want := body["error"].(string), newErrRoot("").Error(); got != want {
+		t.Errorf(`body["error"] = %q want %q`, got, want)
+	}
+}
+
+func TestGetBatch_notFound(t *testing.T) {
+	s, _ := createServer()
+
+	var body map[string]interface{}
+	w, err := testutil.RequestJSON(s.ServeHTTP, "GET", "/batches/"+testutil.RandomHash().String(), nil, &body)
+	if err != nil {
+		t.Fatalf("testutil.RequestJSON(): err: %s", err)
+	}
+
+	if got, want := w.Code, jsonhttp.NewErrNotFound("").Status(); got != want {
+		t.Errorf("w.Code = %d want %d", got, want)
+	}
+}
+
 func TestNotFound(t *testing.T) {
 	s, _ := createServer()
 
@@ -0,0 +1,202 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fossilizerhttp
+
+import (
+	"encoding/hex"
+	"sync"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/types"
+)
+
+// resultStore keeps the results of the most recent fossils in memory.
+//
+// It implements github.com/stratumn/sdk/fossilizer.Querier. When the maximum
+// number of fossils is reached, the oldest ones are forgotten.
+type resultStore struct {
+	maxFossils int
+	mutex      sync.RWMutex
+	fossils    map[string]*fossilizer.FossilStatus
+	batches    map[types.Bytes32][]string
+	order      []string
+}
+
+func newResultStore(maxFossils int) *resultStore {
+	return &resultStore{
+		maxFossils: maxFossils,
+		fossils:    map[string]*fossilizer.FossilStatus{},
+		batches:    map[types.Bytes32][]string{},
+	}
+}
+
+// addPending records data that was sent to the fossilizer.
+func (s *resultStore) addPending(data []byte) {
+	if s.maxFossils <= 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := hex.EncodeToString(data)
+	if _, ok := s.fossils[key]; ok {
+		return
+	}
+	s.add(key, &fossilizer.FossilStatus{Status: fossilizer.StatusPending})
+}
+
+// addResult records a result sent by the fossilizer.
+//
+// A result replaces the previous result of the same provider for the data.
+func (s *resultStore) addResult(status fossilizer.Status, r *fossilizer.Result) {
+	if s.maxFossils <= 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := hex.EncodeToString(r.Data)
+	f, ok := s.fossils[key]
+	if !ok {
+		f = &fossilizer.FossilStatus{}
+		s.add(key, f)
+	}
+
+	if f.Status != fossilizer.StatusAnchored {
+		f.Status = status
+	}
+
+	replaced := false
+	for i, result := range f.Results {
+		if result.Evidence.Provider == r.Evidence.Provider {
+			f.Results[i] = r
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		f.Results = append(f.Results, r)
+	}
+
+	if proof := batchProof(&r.Evidence); proof != nil && (f.Root == nil || *f.Root != *proof.Root) {
+		if f.Root != nil {
+			s.removeFromBatch(*f.Root, key)
+		}
+		f.Root = proof.Root
+		s.batches[*proof.Root] = append(s.batches[*proof.Root], key)
+	}
+}
+
+// FossilStatus implements
+// github.com/stratumn/sdk/fossilizer.Querier.FossilStatus.
+func (s *resultStore) FossilStatus(data []byte) (*fossilizer.FossilStatus, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	f, ok := s.fossils[hex.EncodeToString(data)]
+	if !ok {
+		return nil, nil
+	}
+
+	status := *f
+	status.Results = append([]*fossilizer.Result(nil), f.Results...)
+	return &status, nil
+}
+
+// BatchStatus implements
+// github.com/stratumn/sdk/fossilizer.Querier.BatchStatus.
+//
+// A batch is anchored once all its known fossils are anchored.
+func (s *resultStore) BatchStatus(root *types.Bytes32) (*fossilizer.BatchStatus, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keys, ok := s.batches[*root]
+	if !ok {
+		return nil, nil
+	}
+
+	status := fossilizer.BatchStatus{
+		Root:   root,
+		Status: fossilizer.StatusAnchored,
+	}
+	for _, key := range keys {
+		f := s.fossils[key]
+		if f.Status != fossilizer.StatusAnchored {
+			status.Status = fossilizer.StatusSent
+		}
+		status.Results = append(status.Results, f.Results...)
+	}
+
+	for _, r := range status.Results {
+		if proof := batchProof(&r.Evidence); proof != nil {
+			status.Timestamp = proof.Timestamp
+			break
+		}
+	}
+
+	return &status, nil
+}
+
+func (s *resultStore) add(key string, f *fossilizer.FossilStatus) {
+	for len(s.order) >= s.maxFossils {
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		if f := s.fossils[oldest]; f.Root != nil {
+			s.removeFromBatch(*f.Root, oldest)
+		}
+		delete(s.fossils, oldest)
+	}
+
+	s.fossils[key] = f
+	s.order = append(s.order, key)
+}
+
+func (s *resultStore) removeFromBatch(root types.Bytes32, key string) {
+	keys := s.batches[root]
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(s.batches, root)
+	} else {
+		s.batches[root] = keys
+	}
+}
+
+// batchProof returns the batch proof of an evidence, or nil if the evidence
+// was not created by a batch fossilizer.
+func batchProof(e *cs.Evidence) *evidences.BatchProof {
+	var proof *evidences.BatchProof
+	switch p := e.Proof.(type) {
+	case *evidences.BatchProof:
+		proof = p
+	case *evidences.BcBatchProof:
+		proof = &p.Batch
+	case *evidences.TSABatchProof:
+		proof = &p.Batch
+	}
+	if proof == nil || proof.Root == nil {
+		return nil
+	}
+	return proof
+}
@@ -31,6 +31,7 @@ func createServer() (*Server, *fossilizertesting.MockAdapter) {
 	s := New(a, &Config{
 		MinDataLen: 2,
 		MaxDataLen: 16,
+		MaxResults: 16,
 	}, &jsonhttp.Config{}, &jsonws.BasicConfig{}, &jsonws.BufferedConnConfig{
 		Size:         256,
 		WriteTimeout: 10 * time.Second,
@@ -16,12 +16,21 @@
 //
 // Routes can be added by passing a handle that should return JSON serializable
 // data or an error.
+//
+// If the data implements encoding.BinaryMarshaler and the client accepts
+// BinaryContentType, the binary encoding is rendered instead of JSON.
 package jsonhttp
 
 import (
 	"context"
+	"encoding"
 	"encoding/json"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -37,6 +46,12 @@ const (
 
 	// DefaultMaxHeaderBytes is the default max header bytes.
 	DefaultMaxHeaderBytes = 1 << 8
+
+	// JSONContentType is the content type of JSON data.
+	JSONContentType = "application/json"
+
+	// BinaryContentType is the content type of binary (CBOR) data.
+	BinaryContentType = "application/cbor"
 )
 
 // Config contains configuration options for the server.
@@ -160,16 +175,87 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request, p httprouter.
 		return
 	}
 
+	if m, ok := data.(encoding.BinaryMarshaler); ok && !isNil(data) && AcceptsBinary(r) {
+		bin, err := m.MarshalBinary()
+		if err != nil {
+			renderErr(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", BinaryContentType)
+		w.Write(bin)
+		return
+	}
+
 	js, err := json.Marshal(data)
 	if err != nil {
 		renderErr(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", JSONContentType)
 	w.Write(js)
 }
 
+// Decode decodes the body of a request into v.
+// If the request content type is BinaryContentType and v implements
+// encoding.BinaryUnmarshaler, the binary encoding is used, otherwise the body
+// is decoded as JSON.
+func Decode(r *http.Request, v interface{}) error {
+	if u, ok := v.(encoding.BinaryUnmarshaler); ok {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == BinaryContentType {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return err
+			}
+			return u.UnmarshalBinary(body)
+		}
+	}
+
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// AcceptsBinary returns whether the Accept header of a request prefers
+// BinaryContentType over JSONContentType.
+func AcceptsBinary(r *http.Request) bool {
+	binaryQ, jsonQ := -1.0, -1.0
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case BinaryContentType:
+			binaryQ = q
+		case JSONContentType, "application/*", "*/*":
+			if q > jsonQ {
+				jsonQ = q
+			}
+		}
+	}
+
+	return binaryQ > 0 && binaryQ >= jsonQ
+}
+
+func isNil(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
 type rawHandler struct {
 	config *Config
 	serve  RawHandle
@@ -200,7 +286,7 @@ func renderErr(w http.ResponseWriter, r *http.Request, err error) {
 		e = NewErrInternalServer("")
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", JSONContentType)
 	http.Error(w, string(e.JSONMarshal()), e.Status())
 }
 
@@ -15,8 +15,10 @@
 package jsonhttp
 
 import (
+	"bytes"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/julienschmidt/httprouter"
@@ -186,3 +188,80 @@ func TestError(t *testing.T) {
 		t.Errorf(`body["status"] = %d want %d`, got, want)
 	}
 }
+
+type binaryData struct {
+	Test bool `json:"test"`
+}
+
+func (b *binaryData) MarshalBinary() ([]byte, error) {
+	if b.Test {
+		return []byte{1}, nil
+	}
+	return []byte{0}, nil
+}
+
+func (b *binaryData) UnmarshalBinary(data []byte) error {
+	b.Test = len(data) == 1 && data[0] == 1
+	return nil
+}
+
+func TestGet_binary(t *testing.T) {
+	s := New(&Config{})
+	s.Get("/test", func(r http.ResponseWriter, _ *http.Request, p httprouter.Params) (interface{}, error) {
+		return &binaryData{true}, nil
+	})
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", JSONContentType, `{"test":true}`},
+		{"application/json", JSONContentType, `{"test":true}`},
+		{"*/*", JSONContentType, `{"test":true}`},
+		{"application/cbor", BinaryContentType, "\x01"},
+		{"application/cbor, */*;q=0.1", BinaryContentType, "\x01"},
+		{"application/cbor;q=0.5, application/json", JSONContentType, `{"test":true}`},
+		{"application/cbor;q=0", JSONContentType, `{"test":true}`},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/test", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if got, want := w.Header().Get("Content-Type"), tt.contentType; got != want {
+			t.Errorf("Accept %q: Content-Type = %s want %s", tt.accept, got, want)
+		}
+		if got, want := w.Body.String(), tt.body; got != want {
+			t.Errorf("Accept %q: w.Body = %q want %q", tt.accept, got, want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	req := httptest.NewRequest("POST", "/test", bytes.NewReader([]byte{1}))
+	req.Header.Set("Content-Type", BinaryContentType)
+
+	var b binaryData
+	if err := Decode(req, &b); err != nil {
+		t.Fatalf("Decode(): err: %s", err)
+	}
+	if !b.Test {
+		t.Errorf("b.Test = false want true")
+	}
+
+	req = httptest.NewRequest("POST", "/test", bytes.NewReader([]byte(`{"test":true}`)))
+	req.Header.Set("Content-Type", JSONContentType)
+
+	b = binaryData{}
+	if err := Decode(req, &b); err != nil {
+		t.Fatalf("Decode(): err: %s", err)
+	}
+	if !b.Test {
+		t.Errorf("b.Test = false want true")
+	}
+}
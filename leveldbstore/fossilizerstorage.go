@@ -0,0 +1,213 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leveldbstore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/types"
+)
+
+// Prefixes of the keys of the fossilizer storage.
+var (
+	// Pending fossils, followed by the batch ID, a colon and a sequence
+	// number.
+	pendingPrefix = []byte("pending:")
+
+	// Completed batches, followed by the Merkle root.
+	batchPrefix = []byte("batch:")
+
+	// Merkle root of the last batch containing a hash, followed by the
+	// hash.
+	fossilPrefix = []byte("fossil:")
+)
+
+// FossilizerStorage implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.
+//
+// Fossils and batches are saved as JSON so they can be inspected. The mutex
+// serializes the updates of batches.
+type FossilizerStorage struct {
+	db    *leveldb.DB
+	seq   uint64
+	mutex sync.Mutex
+}
+
+// NewFossilizerStorage creates an instance of a FossilizerStorage.
+func NewFossilizerStorage(config *Config) (*FossilizerStorage, error) {
+	db, err := leveldb.OpenFile(config.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &FossilizerStorage{db: db}, nil
+}
+
+// AddFossil implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.AddFossil.
+func (s *FossilizerStorage) AddFossil(batchID string, f *batchfossilizer.Fossil) error {
+	value, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	seq := make([]byte, 8)
+	binary.BigEndian.PutUint64(seq, atomic.AddUint64(&s.seq, 1))
+
+	return s.db.Put(makeKey(pendingBatchPrefix(batchID), seq), value, nil)
+}
+
+// Pending implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.Pending.
+func (s *FossilizerStorage) Pending() (map[string][]*batchfossilizer.Fossil, error) {
+	iter := s.db.NewIterator(util.BytesPrefix(pendingPrefix), nil)
+	defer iter.Release()
+
+	pending := map[string][]*batchfossilizer.Fossil{}
+	for iter.Next() {
+		key := iter.Key()
+		// Remove the colon and the sequence number.
+		batchID := string(key[len(pendingPrefix) : len(key)-9])
+
+		var f batchfossilizer.Fossil
+		if err := json.Unmarshal(iter.Value(), &f); err != nil {
+			return nil, err
+		}
+		pending[batchID] = append(pending[batchID], &f)
+	}
+
+	return pending, iter.Error()
+}
+
+// DeletePending implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.DeletePending.
+func (s *FossilizerStorage) DeletePending(batchID string) error {
+	var batch leveldb.Batch
+	if err := s.deletePending(&batch, batchID); err != nil {
+		return err
+	}
+	return s.db.Write(&batch, nil)
+}
+
+// SaveBatch implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.SaveBatch.
+func (s *FossilizerStorage) SaveBatch(batchID string, b *batchfossilizer.Batch) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	var batch leveldb.Batch
+	batch.Put(makeKey(batchPrefix, b.Root[:]), value)
+	for _, f := range b.Fossils {
+		batch.Put(makeKey(fossilPrefix, f.Data[:]), b.Root[:])
+	}
+	if err := s.deletePending(&batch, batchID); err != nil {
+		return err
+	}
+
+	return s.db.Write(&batch, nil)
+}
+
+// SaveResults implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.SaveResults.
+func (s *FossilizerStorage) SaveResults(root *types.Bytes32, status fossilizer.Status, results []*fossilizer.Result) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, err := s.GetBatch(root)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return batchfossilizer.ErrBatchNotFound
+	}
+	b.Status, b.Results = status, results
+
+	value, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(makeKey(batchPrefix, root[:]), value, nil)
+}
+
+// GetBatch implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.GetBatch.
+func (s *FossilizerStorage) GetBatch(root *types.Bytes32) (*batchfossilizer.Batch, error) {
+	value, err := s.db.Get(makeKey(batchPrefix, root[:]), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var b batchfossilizer.Batch
+	if err := json.Unmarshal(value, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// FindBatch implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.FindBatch.
+func (s *FossilizerStorage) FindBatch(data *types.Bytes32) (*batchfossilizer.Batch, error) {
+	value, err := s.db.Get(makeKey(fossilPrefix, data[:]), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var root types.Bytes32
+	copy(root[:], value)
+	return s.GetBatch(&root)
+}
+
+// Close closes the database.
+func (s *FossilizerStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *FossilizerStorage) deletePending(batch *leveldb.Batch, batchID string) error {
+	iter := s.db.NewIterator(util.BytesPrefix(pendingBatchPrefix(batchID)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	return iter.Error()
+}
+
+func pendingBatchPrefix(batchID string) []byte {
+	return makeKey(pendingPrefix, []byte(batchID+":"))
+}
+
+func makeKey(prefix, suffix []byte) []byte {
+	key := make([]byte, 0, len(prefix)+len(suffix))
+	key = append(key, prefix...)
+	return append(key, suffix...)
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leveldbstore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/batchfossilizer/storagetestcases"
+)
+
+func TestFossilizerStorage(t *testing.T) {
+	paths := map[batchfossilizer.Storage]string{}
+
+	factory := storagetestcases.Factory{
+		New: func() (batchfossilizer.Storage, error) {
+			path, err := ioutil.TempDir("", "leveldbstore")
+			if err != nil {
+				return nil, err
+			}
+			s, err := NewFossilizerStorage(&Config{Path: path})
+			if err != nil {
+				return nil, err
+			}
+			paths[s] = path
+			return s, nil
+		},
+		Free: func(s batchfossilizer.Storage) {
+			s.(*FossilizerStorage).Close()
+			os.RemoveAll(paths[s])
+		},
+	}
+
+	factory.RunTests(t)
+}
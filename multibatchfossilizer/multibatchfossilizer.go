@@ -0,0 +1,402 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package multibatchfossilizer implements a fossilizer that fossilize batches
+// of hashes on several blockchains and timestamp authorities at once.
+//
+// Each segment receives one evidence per anchor, sent as soon as the Merkle
+// root of its batch is anchored. Failed anchors are retried independently.
+package multibatchfossilizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/types"
+
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/tsa"
+)
+
+const (
+	// Name is the name set in the fossilizer's information.
+	Name = "multibatch"
+
+	// Description is the description set in the fossilizer's information.
+	Description = "Indigo's Multi-Anchor Batch Fossilizer"
+
+	// DefaultMaxRetries is the default number of times a failed anchor is
+	// retried.
+	DefaultMaxRetries = 5
+
+	// DefaultRetryInterval is the default interval before the first retry
+	// of a failed anchor.
+	DefaultRetryInterval = 10 * time.Second
+)
+
+var (
+	// ErrNoAnchor is returned when the configuration contains no
+	// timestamper.
+	ErrNoAnchor = errors.New("at least one timestamper is required")
+)
+
+// Config contains configuration options for the fossilizer.
+type Config struct {
+	// Blockchain timestampers anchoring the Merkle roots.
+	HashTimestampers []blockchain.HashTimestamper
+
+	// Timestamp authorities anchoring the Merkle roots.
+	TSAs []tsa.HashTimestamper
+
+	// Number of times a failed anchor is retried before giving up.
+	MaxRetries int
+
+	// Interval before the first retry of a failed anchor. It doubles after
+	// each retry.
+	RetryInterval time.Duration
+}
+
+// GetMaxRetries returns the configuration's maximum number of retries or the
+// default value.
+func (c *Config) GetMaxRetries() int {
+	if c.MaxRetries > 0 {
+		return c.MaxRetries
+	}
+	return DefaultMaxRetries
+}
+
+// GetRetryInterval returns the configuration's retry interval or the default
+// value.
+func (c *Config) GetRetryInterval() time.Duration {
+	if c.RetryInterval > 0 {
+		return c.RetryInterval
+	}
+	return DefaultRetryInterval
+}
+
+// Info is the info returned by GetInfo.
+type Info struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Version     string   `json:"version"`
+	Commit      string   `json:"commit"`
+	Anchors     []string `json:"anchors"`
+}
+
+// Fossilizer is the type that
+// implements github.com/stratumn/sdk/fossilizer.Adapter.
+type Fossilizer struct {
+	*batchfossilizer.Fossilizer
+	config     *Config
+	anchors    []anchor
+	eventChans []chan *fossilizer.Event
+	doneChan   chan struct{}
+	waitGroup  sync.WaitGroup
+	mutex      sync.Mutex
+	current    *batch
+}
+
+// New creates an instance of a Fossilizer.
+func New(config *Config, batchConfig *batchfossilizer.Config) (*Fossilizer, error) {
+	if batchConfig.MaxSimBatches > 1 {
+		return nil, fmt.Errorf("MaxSimBatches is %d want less than 2", batchConfig.MaxSimBatches)
+	}
+
+	var anchors []anchor
+	for _, ts := range config.HashTimestampers {
+		anchors = append(anchors, &blockchainAnchor{ts})
+	}
+	for _, ts := range config.TSAs {
+		anchors = append(anchors, &tsaAnchor{ts})
+	}
+	if len(anchors) == 0 {
+		return nil, ErrNoAnchor
+	}
+
+	// Segments can only have one evidence per provider.
+	providers := map[string]struct{}{}
+	for _, anc := range anchors {
+		provider := anc.provider()
+		if _, ok := providers[provider]; ok {
+			return nil, fmt.Errorf("provider %s is used by several timestampers", provider)
+		}
+		providers[provider] = struct{}{}
+	}
+
+	b, err := batchfossilizer.New(batchConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	f := Fossilizer{
+		Fossilizer: b,
+		config:     config,
+		anchors:    anchors,
+		doneChan:   make(chan struct{}),
+	}
+
+	f.SetTransformer(f.transform)
+
+	return &f, nil
+}
+
+// AddFossilizerEventChan implements
+// github.com/stratumn/sdk/fossilizer.Adapter.AddFossilizerEventChan.
+func (a *Fossilizer) AddFossilizerEventChan(fossilizerEventChan chan *fossilizer.Event) {
+	a.eventChans = append(a.eventChans, fossilizerEventChan)
+}
+
+// Start starts the fossilizer. Once stopped, anchors of the last batches are
+// not retried anymore and it waits for the ones in progress.
+func (a *Fossilizer) Start(ctx context.Context) error {
+	err := a.Fossilizer.Start(ctx)
+	close(a.doneChan)
+	a.waitGroup.Wait()
+	return err
+}
+
+// GetInfo implements github.com/stratumn/sdk/fossilizer.Adapter.GetInfo.
+func (a *Fossilizer) GetInfo() (interface{}, error) {
+	batchInfo, err := a.Fossilizer.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := batchInfo.(*batchfossilizer.Info)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected batchfossilizer info %#v", batchInfo)
+	}
+
+	multiInfo := &Info{
+		Name:        Name,
+		Description: Description,
+		Version:     info.Version,
+		Commit:      info.Commit,
+	}
+	for _, anc := range a.anchors {
+		multiInfo.Anchors = append(multiInfo.Anchors, anc.provider())
+	}
+
+	return multiInfo, nil
+}
+
+// transform collects the leaves of the current batch and starts anchoring
+// its root when the first leaf is received. Events are sent by the anchors.
+func (a *Fossilizer) transform(evidence *cs.Evidence, data, meta []byte) (*fossilizer.Result, error) {
+	proof := evidence.Proof.(*evidences.BatchProof)
+	l := &leaf{batch: *proof, data: data, meta: meta}
+
+	a.mutex.Lock()
+	if a.current == nil || *a.current.root != *proof.Root {
+		a.current = &batch{
+			root:      proof.Root,
+			evidences: make([]evidenceFunc, len(a.anchors)),
+		}
+		for i := range a.anchors {
+			a.waitGroup.Add(1)
+			go a.anchor(a.current, i)
+		}
+	}
+	b := a.current
+	b.leaves = append(b.leaves, l)
+
+	var results []*fossilizer.Result
+	for _, create := range b.evidences {
+		if create != nil {
+			results = append(results, l.result(create))
+		}
+	}
+	a.mutex.Unlock()
+
+	a.send(results)
+
+	return nil, nil
+}
+
+// anchor anchors the root of a batch with the anchor at the given index,
+// retrying on failure, and sends the evidences of the leaves of the batch.
+func (a *Fossilizer) anchor(b *batch, i int) {
+	defer a.waitGroup.Done()
+
+	var (
+		anc        = a.anchors[i]
+		interval   = a.config.GetRetryInterval()
+		maxRetries = a.config.GetMaxRetries()
+	)
+
+	for retry := 0; ; retry++ {
+		create, err := anc.anchor(b.root)
+		if err == nil {
+			log.WithFields(log.Fields{
+				"root":     b.root,
+				"provider": anc.provider(),
+			}).Info("Anchored Merkle root")
+
+			a.mutex.Lock()
+			b.evidences[i] = create
+			leaves := b.leaves
+			a.mutex.Unlock()
+
+			results := make([]*fossilizer.Result, len(leaves))
+			for j, l := range leaves {
+				results[j] = l.result(create)
+			}
+			a.send(results)
+			return
+		}
+
+		if retry >= maxRetries {
+			log.WithFields(log.Fields{
+				"root":     b.root,
+				"provider": anc.provider(),
+				"error":    err,
+			}).Error("Failed to anchor Merkle root")
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"root":     b.root,
+			"provider": anc.provider(),
+			"error":    err,
+			"retry":    interval,
+		}).Warn("Failed to anchor Merkle root, retrying")
+
+		select {
+		case <-time.After(interval):
+			interval *= 2
+		case <-a.doneChan:
+			log.WithFields(log.Fields{
+				"root":     b.root,
+				"provider": anc.provider(),
+			}).Warn("Gave up anchoring Merkle root because the fossilizer stopped")
+			return
+		}
+	}
+}
+
+func (a *Fossilizer) send(results []*fossilizer.Result) {
+	for _, r := range results {
+		event := &fossilizer.Event{
+			EventType: fossilizer.DidFossilizeLink,
+			Data:      r,
+		}
+		for _, c := range a.eventChans {
+			c <- event
+		}
+	}
+}
+
+// evidenceFunc creates the evidence of a leaf from its batch proof once the
+// root of the batch is anchored.
+type evidenceFunc func(batch evidences.BatchProof) cs.Evidence
+
+// anchor anchors the Merkle roots of batches.
+type anchor interface {
+	// provider returns the provider of the evidences.
+	provider() string
+
+	// anchor anchors a Merkle root.
+	anchor(root *types.Bytes32) (evidenceFunc, error)
+}
+
+type blockchainAnchor struct {
+	timestamper blockchain.HashTimestamper
+}
+
+func (a *blockchainAnchor) provider() string {
+	return a.timestamper.GetInfo().Network.String()
+}
+
+func (a *blockchainAnchor) anchor(root *types.Bytes32) (evidenceFunc, error) {
+	txid, err := a.timestamper.TimestampHash(root)
+	if err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"txid": txid,
+		"root": root,
+	}).Info("Broadcasted transaction")
+
+	provider := a.provider()
+	return func(batch evidences.BatchProof) cs.Evidence {
+		return cs.Evidence{
+			Backend:  evidences.BcBatchFossilizerName,
+			Provider: provider,
+			Proof: &evidences.BcBatchProof{
+				Batch:         batch,
+				TransactionID: txid,
+			},
+		}
+	}, nil
+}
+
+type tsaAnchor struct {
+	timestamper tsa.HashTimestamper
+}
+
+func (a *tsaAnchor) provider() string {
+	return a.timestamper.GetInfo().URL
+}
+
+func (a *tsaAnchor) anchor(root *types.Bytes32) (evidenceFunc, error) {
+	token, err := a.timestamper.TimestampHash(root)
+	if err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"root": root,
+		"tsa":  a.provider(),
+	}).Info("Obtained time-stamp token")
+
+	provider := a.provider()
+	return func(batch evidences.BatchProof) cs.Evidence {
+		return cs.Evidence{
+			Backend:  evidences.TSABatchFossilizerName,
+			Provider: provider,
+			Proof: &evidences.TSABatchProof{
+				Batch: batch,
+				Token: token,
+			},
+		}
+	}, nil
+}
+
+type batch struct {
+	root      *types.Bytes32
+	leaves    []*leaf
+	evidences []evidenceFunc
+}
+
+type leaf struct {
+	batch evidences.BatchProof
+	data  []byte
+	meta  []byte
+}
+
+func (l *leaf) result(create evidenceFunc) *fossilizer.Result {
+	return &fossilizer.Result{
+		Evidence: create(l.batch),
+		Data:     l.data,
+		Meta:     l.meta,
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multibatchfossilizer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/blockchain"
+	"github.com/stratumn/sdk/blockchain/dummytimestamper"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/tsa"
+	"github.com/stratumn/sdk/types"
+)
+
+const testInterval = 100 * time.Millisecond
+
+type testNetwork string
+
+func (n testNetwork) String() string {
+	return string(n)
+}
+
+// failingTimestamper fails a number of times before timestamping hashes.
+type failingTimestamper struct {
+	dummytimestamper.Timestamper
+	network  string
+	mutex    sync.Mutex
+	failures int
+}
+
+func (t *failingTimestamper) GetInfo() *blockchain.Info {
+	return &blockchain.Info{Network: testNetwork(t.network)}
+}
+
+func (t *failingTimestamper) TimestampHash(hash *types.Bytes32) (types.TransactionID, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.failures != 0 {
+		t.failures--
+		return nil, errors.New("unavailable")
+	}
+	return t.Timestamper.TimestampHash(hash)
+}
+
+type testTSA struct {
+	url string
+}
+
+func (t *testTSA) GetInfo() *tsa.Info {
+	return &tsa.Info{URL: t.url}
+}
+
+func (t *testTSA) TimestampHash(hash *types.Bytes32) ([]byte, error) {
+	return append([]byte("token"), hash[:]...), nil
+}
+
+func TestNew_invalid(t *testing.T) {
+	ts := &failingTimestamper{network: "chain"}
+	tests := []struct {
+		name        string
+		config      *Config
+		batchConfig *batchfossilizer.Config
+	}{
+		{"no anchor", &Config{}, &batchfossilizer.Config{}},
+		{"same provider", &Config{HashTimestampers: []blockchain.HashTimestamper{ts, ts}}, &batchfossilizer.Config{}},
+		{"simultaneous batches", &Config{HashTimestampers: []blockchain.HashTimestamper{ts}}, &batchfossilizer.Config{MaxSimBatches: 2}},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.config, tt.batchConfig); err == nil {
+			t.Errorf("%s: New(): err = nil want Error", tt.name)
+		}
+	}
+}
+
+func TestGetInfo(t *testing.T) {
+	a, err := New(&Config{
+		HashTimestampers: []blockchain.HashTimestamper{&failingTimestamper{network: "chain"}},
+		TSAs:             []tsa.HashTimestamper{&testTSA{url: "http://tsa"}},
+	}, &batchfossilizer.Config{Version: "1.0.0"})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	got, err := a.GetInfo()
+	if err != nil {
+		t.Fatalf("a.GetInfo(): err: %s", err)
+	}
+	want := &Info{
+		Name:        Name,
+		Description: Description,
+		Version:     "1.0.0",
+		Anchors:     []string{"chain", "http://tsa"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("a.GetInfo() = %#v want %#v", got, want)
+	}
+}
+
+func TestFossilize(t *testing.T) {
+	a, err := New(&Config{
+		HashTimestampers: []blockchain.HashTimestamper{
+			&failingTimestamper{network: "chain1"},
+			&failingTimestamper{network: "chain2", failures: 2},
+		},
+		TSAs:          []tsa.HashTimestamper{&testTSA{url: "http://tsa"}},
+		RetryInterval: 10 * time.Millisecond,
+	}, &batchfossilizer.Config{
+		Interval: testInterval,
+	})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	ec := make(chan *fossilizer.Event, 1)
+	a.AddFossilizerEventChan(ec)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Start(ctx)
+	<-a.Started()
+
+	leaves := map[string]*types.Bytes32{}
+	for _, meta := range []string{"a", "b", "c"} {
+		hash := testutil.RandomHash()
+		leaves[meta] = hash
+		if err := a.Fossilize(hash[:], []byte(meta)); err != nil {
+			t.Fatalf("a.Fossilize(): err: %s", err)
+		}
+	}
+
+	providers := map[string][]string{}
+	for i := 0; i < len(leaves)*3; i++ {
+		r := (<-ec).Data.(*fossilizer.Result)
+		meta := string(r.Meta)
+		if hash := leaves[meta]; string(r.Data) != string(hash[:]) {
+			t.Errorf("%s: Data = %x want %x", meta, r.Data, hash)
+		}
+		switch proof := r.Evidence.Proof.(type) {
+		case *evidences.BcBatchProof:
+			if r.Evidence.Backend != evidences.BcBatchFossilizerName || len(proof.TransactionID) == 0 {
+				t.Errorf("%s: unexpected evidence %#v", meta, r.Evidence)
+			}
+		case *evidences.TSABatchProof:
+			if r.Evidence.Backend != evidences.TSABatchFossilizerName || len(proof.Token) == 0 {
+				t.Errorf("%s: unexpected evidence %#v", meta, r.Evidence)
+			}
+		default:
+			t.Errorf("%s: unexpected proof %#v", meta, proof)
+		}
+		providers[meta] = append(providers[meta], r.Evidence.Provider)
+	}
+
+	want := []string{"chain1", "chain2", "http://tsa"}
+	for meta, got := range providers {
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: providers = %v want %v", meta, got, want)
+		}
+	}
+}
+
+func TestFossilize_failure(t *testing.T) {
+	a, err := New(&Config{
+		HashTimestampers: []blockchain.HashTimestamper{
+			&failingTimestamper{network: "chain1"},
+			&failingTimestamper{network: "chain2", failures: -1},
+		},
+		MaxRetries:    2,
+		RetryInterval: 10 * time.Millisecond,
+	}, &batchfossilizer.Config{
+		Interval: testInterval,
+	})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	ec := make(chan *fossilizer.Event, 1)
+	a.AddFossilizerEventChan(ec)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Start(ctx)
+	<-a.Started()
+
+	if err := a.Fossilize(testutil.RandomHash()[:], []byte("a")); err != nil {
+		t.Fatalf("a.Fossilize(): err: %s", err)
+	}
+
+	r := (<-ec).Data.(*fossilizer.Result)
+	if got, want := r.Evidence.Provider, "chain1"; got != want {
+		t.Errorf("Provider = %q want %q", got, want)
+	}
+
+	select {
+	case e := <-ec:
+		t.Errorf("unexpected event %#v", e.Data)
+	case <-time.After(testInterval + 100*time.Millisecond):
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresstore
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/fossilizer"
+	"github.com/stratumn/sdk/types"
+)
+
+const (
+	sqlAddPendingFossil = `
+		INSERT INTO fossilizer_pending (
+			fossilizer_id,
+			batch_id,
+			data,
+			meta
+		)
+		VALUES ($1, $2, $3, $4)
+	`
+	sqlGetPendingFossils = `
+		SELECT batch_id, data, meta FROM fossilizer_pending
+		WHERE fossilizer_id = $1
+		ORDER BY id
+	`
+	sqlDeletePendingFossils = `
+		DELETE FROM fossilizer_pending
+		WHERE fossilizer_id = $1 AND batch_id = $2
+	`
+	sqlSaveFossilizerBatch = `
+		INSERT INTO fossilizer_batches (
+			root,
+			timestamp,
+			fossils,
+			status,
+			results
+		)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (root)
+		DO UPDATE SET
+			timestamp = $2,
+			fossils = $3,
+			status = $4,
+			results = $5
+	`
+	sqlSaveFossilizerResults = `
+		UPDATE fossilizer_batches
+		SET status = $2, results = $3
+		WHERE root = $1
+	`
+	sqlAddBatchFossil = `
+		INSERT INTO fossilizer_fossils (
+			data,
+			root
+		)
+		VALUES ($1, $2)
+	`
+	sqlGetFossilizerBatch = `
+		SELECT timestamp, fossils, status, results FROM fossilizer_batches
+		WHERE root = $1
+	`
+	sqlFindFossilizerBatch = `
+		SELECT root FROM fossilizer_fossils
+		WHERE data = $1
+		ORDER BY id DESC
+		LIMIT 1
+	`
+)
+
+var sqlFossilizerCreate = []string{
+	`
+		CREATE TABLE IF NOT EXISTS fossilizer_pending (
+			id BIGSERIAL PRIMARY KEY,
+			fossilizer_id text NOT NULL,
+			batch_id text NOT NULL,
+			data bytea NOT NULL,
+			meta bytea NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`,
+	`
+		CREATE INDEX IF NOT EXISTS fossilizer_pending_batch_id_idx
+		ON fossilizer_pending (fossilizer_id, batch_id)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS fossilizer_batches (
+			id BIGSERIAL PRIMARY KEY,
+			root bytea NOT NULL,
+			timestamp bigint NOT NULL,
+			fossils jsonb NOT NULL,
+			status text NOT NULL,
+			results jsonb,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`,
+	`
+		CREATE UNIQUE INDEX IF NOT EXISTS fossilizer_batches_root_idx
+		ON fossilizer_batches (root)
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS fossilizer_fossils (
+			id BIGSERIAL PRIMARY KEY,
+			data bytea NOT NULL,
+			root bytea NOT NULL
+		)
+	`,
+	`
+		CREATE INDEX IF NOT EXISTS fossilizer_fossils_data_idx
+		ON fossilizer_fossils (data)
+	`,
+}
+
+var sqlFossilizerDrop = []string{
+	"DROP TABLE fossilizer_pending, fossilizer_batches, fossilizer_fossils",
+}
+
+type fossilizerStmts struct {
+	AddPendingFossil     *sql.Stmt
+	GetPendingFossils    *sql.Stmt
+	DeletePendingFossils *sql.Stmt
+	SaveResults          *sql.Stmt
+	GetBatch             *sql.Stmt
+	FindBatch            *sql.Stmt
+}
+
+// FossilizerStorage implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.
+//
+// Several fossilizers can share a database, provided they use different
+// fossilizer IDs. Pending fossils are only visible to the fossilizer that
+// added them, so a restarting replica doesn't recover the batches of the
+// others. Completed batches are shared.
+type FossilizerStorage struct {
+	db           *sql.DB
+	stmts        *fossilizerStmts
+	fossilizerID string
+}
+
+// NewFossilizerStorage creates an instance of a FossilizerStorage for the
+// fossilizer with the given ID. The ID must not change when the fossilizer
+// restarts.
+func NewFossilizerStorage(config *Config, fossilizerID string) (*FossilizerStorage, error) {
+	db, err := sql.Open("postgres", config.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &FossilizerStorage{db: db, fossilizerID: fossilizerID}, nil
+}
+
+// Create creates the database tables and indexes if they do not exist.
+func (s *FossilizerStorage) Create() error {
+	for _, query := range sqlFossilizerCreate {
+		if _, err := s.db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prepare prepares the database stmts.
+// It should be called once before interacting with the storage.
+// It assumes the tables have been created using Create().
+func (s *FossilizerStorage) Prepare() error {
+	var (
+		stmts fossilizerStmts
+		err   error
+	)
+
+	prepare := func(str string) (stmt *sql.Stmt) {
+		if err == nil {
+			stmt, err = s.db.Prepare(str)
+		}
+		return
+	}
+
+	stmts.AddPendingFossil = prepare(sqlAddPendingFossil)
+	stmts.GetPendingFossils = prepare(sqlGetPendingFossils)
+	stmts.DeletePendingFossils = prepare(sqlDeletePendingFossils)
+	stmts.SaveResults = prepare(sqlSaveFossilizerResults)
+	stmts.GetBatch = prepare(sqlGetFossilizerBatch)
+	stmts.FindBatch = prepare(sqlFindFossilizerBatch)
+
+	if err != nil {
+		return err
+	}
+
+	s.stmts = &stmts
+	return nil
+}
+
+// Drop drops the database tables and indexes.
+func (s *FossilizerStorage) Drop() error {
+	for _, query := range sqlFossilizerDrop {
+		if _, err := s.db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database connection.
+func (s *FossilizerStorage) Close() error {
+	return s.db.Close()
+}
+
+// AddFossil implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.AddFossil.
+func (s *FossilizerStorage) AddFossil(batchID string, f *batchfossilizer.Fossil) error {
+	meta := f.Meta
+	if meta == nil {
+		meta = []byte{}
+	}
+	_, err := s.stmts.AddPendingFossil.Exec(s.fossilizerID, batchID, f.Data[:], meta)
+	return err
+}
+
+// Pending implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.Pending.
+func (s *FossilizerStorage) Pending() (map[string][]*batchfossilizer.Fossil, error) {
+	rows, err := s.stmts.GetPendingFossils.Query(s.fossilizerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := map[string][]*batchfossilizer.Fossil{}
+	for rows.Next() {
+		var (
+			batchID string
+			data    []byte
+			f       batchfossilizer.Fossil
+		)
+		if err := rows.Scan(&batchID, &data, &f.Meta); err != nil {
+			return nil, err
+		}
+		copy(f.Data[:], data)
+		pending[batchID] = append(pending[batchID], &f)
+	}
+
+	return pending, rows.Err()
+}
+
+// DeletePending implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.DeletePending.
+func (s *FossilizerStorage) DeletePending(batchID string) error {
+	_, err := s.stmts.DeletePendingFossils.Exec(s.fossilizerID, batchID)
+	return err
+}
+
+// SaveBatch implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.SaveBatch.
+func (s *FossilizerStorage) SaveBatch(batchID string, b *batchfossilizer.Batch) (err error) {
+	fossils, err := json.Marshal(b.Fossils)
+	if err != nil {
+		return err
+	}
+
+	results, err := marshalResults(b.Results)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if _, err = tx.Exec(sqlSaveFossilizerBatch, b.Root[:], b.Timestamp, string(fossils), string(b.Status), results); err != nil {
+		return
+	}
+
+	addFossil, err := tx.Prepare(sqlAddBatchFossil)
+	if err != nil {
+		return
+	}
+	defer addFossil.Close()
+
+	for _, f := range b.Fossils {
+		if _, err = addFossil.Exec(f.Data[:], b.Root[:]); err != nil {
+			return
+		}
+	}
+
+	_, err = tx.Stmt(s.stmts.DeletePendingFossils).Exec(s.fossilizerID, batchID)
+	return
+}
+
+// SaveResults implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.SaveResults.
+func (s *FossilizerStorage) SaveResults(root *types.Bytes32, status fossilizer.Status, results []*fossilizer.Result) error {
+	value, err := marshalResults(results)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.stmts.SaveResults.Exec(root[:], string(status), value)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return batchfossilizer.ErrBatchNotFound
+	}
+	return nil
+}
+
+// GetBatch implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.GetBatch.
+func (s *FossilizerStorage) GetBatch(root *types.Bytes32) (*batchfossilizer.Batch, error) {
+	var (
+		b       = batchfossilizer.Batch{Root: root}
+		fossils []byte
+		status  string
+		results []byte
+	)
+
+	if err := s.stmts.GetBatch.QueryRow(root[:]).Scan(&b.Timestamp, &fossils, &status, &results); err != nil {
+		if err.Error() == notFoundError {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(fossils, &b.Fossils); err != nil {
+		return nil, err
+	}
+	b.Status = fossilizer.Status(status)
+	if results != nil {
+		if err := json.Unmarshal(results, &b.Results); err != nil {
+			return nil, err
+		}
+	}
+
+	return &b, nil
+}
+
+// FindBatch implements
+// github.com/stratumn/sdk/batchfossilizer.Storage.FindBatch.
+func (s *FossilizerStorage) FindBatch(data *types.Bytes32) (*batchfossilizer.Batch, error) {
+	var rootBytes []byte
+
+	if err := s.stmts.FindBatch.QueryRow(data[:]).Scan(&rootBytes); err != nil {
+		if err.Error() == notFoundError {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var root types.Bytes32
+	copy(root[:], rootBytes)
+
+	return s.GetBatch(&root)
+}
+
+// marshalResults encodes the results of a batch, or returns nil if there are
+// none.
+func marshalResults(results []*fossilizer.Result) (interface{}, error) {
+	if len(results) == 0 {
+		return nil, nil
+	}
+	value, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	return string(value), nil
+}
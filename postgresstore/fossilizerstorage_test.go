@@ -0,0 +1,99 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgresstore
+
+import (
+	"testing"
+
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/batchfossilizer/storagetestcases"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const fossilizerStorageURL = "postgres://postgres@localhost/sdk_test?sslmode=disable"
+
+func newFossilizerStorage(id string) (*FossilizerStorage, error) {
+	s, err := NewFossilizerStorage(&Config{URL: fossilizerStorageURL}, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Create(); err != nil {
+		return nil, err
+	}
+	if err := s.Prepare(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func TestFossilizerStorage(t *testing.T) {
+	factory := storagetestcases.Factory{
+		New: func() (batchfossilizer.Storage, error) {
+			return newFossilizerStorage("test")
+		},
+		Free: func(s batchfossilizer.Storage) {
+			a := s.(*FossilizerStorage)
+			if err := a.Drop(); err != nil {
+				panic(err)
+			}
+			if err := a.Close(); err != nil {
+				panic(err)
+			}
+		},
+	}
+
+	factory.RunTests(t)
+}
+
+func TestFossilizerStorage_sharedDatabase(t *testing.T) {
+	s1, err := newFossilizerStorage("replica1")
+	if err != nil {
+		t.Fatalf("newFossilizerStorage(): err: %s", err)
+	}
+	defer func() {
+		s1.Drop()
+		s1.Close()
+	}()
+	s2, err := newFossilizerStorage("replica2")
+	if err != nil {
+		t.Fatalf("newFossilizerStorage(): err: %s", err)
+	}
+	defer s2.Close()
+
+	f1 := &batchfossilizer.Fossil{Data: *testutil.RandomHash(), Meta: []byte("one")}
+	f2 := &batchfossilizer.Fossil{Data: *testutil.RandomHash(), Meta: []byte("two")}
+	if err := s1.AddFossil("batch", f1); err != nil {
+		t.Fatalf("s1.AddFossil(): err: %s", err)
+	}
+	if err := s2.AddFossil("batch", f2); err != nil {
+		t.Fatalf("s2.AddFossil(): err: %s", err)
+	}
+
+	pending, err := s1.Pending()
+	if err != nil {
+		t.Fatalf("s1.Pending(): err: %s", err)
+	}
+	assert.Equal(t, map[string][]*batchfossilizer.Fossil{"batch": {f1}}, pending)
+
+	if err := s1.DeletePending("batch"); err != nil {
+		t.Fatalf("s1.DeletePending(): err: %s", err)
+	}
+	pending, err = s2.Pending()
+	if err != nil {
+		t.Fatalf("s2.Pending(): err: %s", err)
+	}
+	assert.Equal(t, map[string][]*batchfossilizer.Fossil{"batch": {f2}}, pending, "Other replicas should keep their pending fossils")
+}
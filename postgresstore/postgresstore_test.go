@@ -19,6 +19,7 @@ import (
 
 	"github.com/stratumn/sdk/store"
 	"github.com/stratumn/sdk/store/storetestcases"
+	"github.com/stratumn/sdk/tmpop/tmpoptestcases"
 )
 
 func TestStore(t *testing.T) {
@@ -33,6 +34,13 @@ func TestStore(t *testing.T) {
 	factory.RunKeyValueStoreTests(t)
 }
 
+func TestPostgresTMPop(t *testing.T) {
+	tmpoptestcases.Factory{
+		New:  createAdapterTMPop,
+		Free: freeAdapterTMPop,
+	}.RunTests(t)
+}
+
 func createStore() (*Store, error) {
 	a, err := New(&Config{URL: "postgres://postgres@localhost/sdk_test?sslmode=disable"})
 	if err := a.Create(); err != nil {
@@ -52,6 +60,11 @@ func createKeyValueStore() (store.KeyValueStore, error) {
 	return createStore()
 }
 
+func createAdapterTMPop() (store.Adapter, store.KeyValueStore, error) {
+	a, err := createStore()
+	return a, a, err
+}
+
 func freeStore(s *Store) {
 	if err := s.Drop(); err != nil {
 		panic(err)
@@ -68,3 +81,7 @@ func freeAdapter(s store.Adapter) {
 func freeKeyValueStore(s store.KeyValueStore) {
 	freeStore(s.(*Store))
 }
+
+func freeAdapterTMPop(a store.Adapter, _ store.KeyValueStore) {
+	freeAdapter(a)
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/stratumn/sdk/store"
 	"github.com/stratumn/sdk/store/storetestcases"
+	"github.com/stratumn/sdk/tmpop/tmpoptestcases"
 )
 
 func TestExists(t *testing.T) {
@@ -59,6 +60,13 @@ func TestStore(t *testing.T) {
 	factory.RunKeyValueStoreTests(t)
 }
 
+func TestRethinkTMPop(t *testing.T) {
+	tmpoptestcases.Factory{
+		New:  createAdapterTMPop,
+		Free: freeAdapterTMPop,
+	}.RunTests(t)
+}
+
 func createStore() (*Store, error) {
 	a, err := New(&Config{URL: fmt.Sprintf("%s:%s", domain, port), DB: dbName})
 	if err != nil {
@@ -78,6 +86,11 @@ func createKeyValueStore() (store.KeyValueStore, error) {
 	return createStore()
 }
 
+func createAdapterTMPop() (store.Adapter, store.KeyValueStore, error) {
+	a, err := createStore()
+	return a, a, err
+}
+
 func freeStore(a *Store) {
 	if err := a.Clean(); err != nil {
 		panic(err)
@@ -91,3 +104,7 @@ func freeAdapter(a store.Adapter) {
 func freeKeyValueStore(a store.KeyValueStore) {
 	freeStore(a.(*Store))
 }
+
+func freeAdapterTMPop(a store.Adapter, _ store.KeyValueStore) {
+	freeAdapter(a)
+}
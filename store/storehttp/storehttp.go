@@ -20,11 +20,13 @@
 //
 //	POST /links
 //		Saves then renders a link.
-//		Body should be a JSON encoded link.
+//		Body should be a JSON (or binary if the content type is
+//		application/cbor) encoded link.
 //
 //	POST /evidences/:linkHash
 //		Adds evidence to a link.
-//		Body should be a JSON encoded evidence.
+//		Body should be a JSON (or binary if the content type is
+//		application/cbor) encoded evidence.
 //
 //	GET /segments/:linkHash
 //		Renders a segment.
@@ -35,6 +37,8 @@
 //	GET /maps?[offset=offset]&[limit=limit]
 //		Finds and renders map IDs.
 //
+//	Segments are rendered in binary if the request accepts application/cbor.
+//
 //	GET /websocket
 //		A web socket that broadcasts messages from the store:
 //			{ "type": "SavedLink", "data": [link] }
@@ -43,7 +47,6 @@ package storehttp
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 	"sync"
 
@@ -179,10 +182,8 @@ func (s *Server) root(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 }
 
 func (s *Server) createLink(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (interface{}, error) {
-	decoder := json.NewDecoder(r.Body)
-
 	var link cs.Link
-	if err := decoder.Decode(&link); err != nil {
+	if err := jsonhttp.Decode(r, &link); err != nil {
 		return nil, jsonhttp.NewErrBadRequest(err.Error())
 	}
 
@@ -202,10 +203,8 @@ func (s *Server) addEvidence(w http.ResponseWriter, r *http.Request, p httproute
 		return nil, err
 	}
 
-	decoder := json.NewDecoder(r.Body)
-
 	var evidence cs.Evidence
-	if err := decoder.Decode(&evidence); err != nil {
+	if err := jsonhttp.Decode(r, &evidence); err != nil {
 		return nil, jsonhttp.NewErrBadRequest(err.Error())
 	}
 
@@ -0,0 +1,111 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/hdwallet"
+)
+
+var (
+	keystoreWIF         string
+	keystoreExtendedKey string
+	keystoreNetwork     string
+	keystorePath        string
+	keystoreIndex       uint32
+)
+
+// btcKeystoreCmd represents the btc-keystore command
+var btcKeystoreCmd = &cobra.Command{
+	Use:   "btc-keystore <file>",
+	Short: "Create an encrypted Bitcoin keystore file",
+	Long: `Create an encrypted keystore file containing the key of a Bitcoin timestamper.
+
+The key is either a WIF encoded key, an extended private key, or a BIP39 mnemonic read from the BTC_MNEMONIC environment variable, with an optional passphrase read from BTC_MNEMONIC_PASSPHRASE.
+
+The keystore is encrypted with the password read from the BTC_KEYSTORE_PASSWORD environment variable. It can be used with the -btc-keystore flag of btcfossilizer.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("expected a keystore file")
+		}
+		filename := args[0]
+
+		if _, err := os.Stat(filename); err == nil {
+			return fmt.Errorf("%s already exists", filename)
+		}
+
+		keystore := &hdwallet.Keystore{
+			WIF:         keystoreWIF,
+			ExtendedKey: keystoreExtendedKey,
+			Mnemonic:    os.Getenv("BTC_MNEMONIC"),
+			Passphrase:  os.Getenv("BTC_MNEMONIC_PASSPHRASE"),
+			Network:     btc.Network(keystoreNetwork),
+			Path:        keystorePath,
+			Index:       keystoreIndex,
+		}
+
+		if err := hdwallet.WriteFile(filename, keystore, os.Getenv("BTC_KEYSTORE_PASSWORD")); err != nil {
+			return err
+		}
+
+		fmt.Printf("Created keystore %s.\n", filename)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(btcKeystoreCmd)
+
+	btcKeystoreCmd.PersistentFlags().StringVar(
+		&keystoreWIF,
+		"wif",
+		"",
+		"WIF encoded private key",
+	)
+
+	btcKeystoreCmd.PersistentFlags().StringVar(
+		&keystoreExtendedKey,
+		"xprv",
+		"",
+		"Extended private key",
+	)
+
+	btcKeystoreCmd.PersistentFlags().StringVar(
+		&keystoreNetwork,
+		"network",
+		"",
+		"Bitcoin network of the mnemonic (bitcoin:main, bitcoin:test3, bitcoin:regtest or bitcoin:simnet)",
+	)
+
+	btcKeystoreCmd.PersistentFlags().StringVar(
+		&keystorePath,
+		"path",
+		"",
+		"Derivation path of the keys, defaults to the BIP44, BIP49 or BIP84 path of the address type",
+	)
+
+	btcKeystoreCmd.PersistentFlags().Uint32Var(
+		&keystoreIndex,
+		"index",
+		0,
+		"Index of the current key",
+	)
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stratumn/sdk/blockchain/btc"
+	"github.com/stratumn/sdk/blockchain/btc/bitcoind"
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/evidences"
+)
+
+var (
+	otsNetwork    string
+	otsRPCURL     string
+	otsCookieFile string
+)
+
+// otsCmd represents the ots command
+var otsCmd = &cobra.Command{
+	Use:   "ots <segment.json> <file.ots>",
+	Short: "Export the Bitcoin proof of a segment to the OpenTimestamps format",
+	Long: `Export the Bitcoin evidence of a segment to an OpenTimestamps proof.
+
+The segment is read from a JSON file and must contain a bcbatch evidence whose transaction is mined. The inclusion proof of the transaction is queried from a Bitcoin Core node. Its credentials are read from the BTC_RPC_USER and BTC_RPC_PASSWORD environment variables, unless a cookie file is given.
+
+The created file can be verified with the standard OpenTimestamps tools, the timestamped file being the link hash of the segment.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("expected a segment file and an output file")
+		}
+		filename := args[1]
+
+		if _, err := os.Stat(filename); err == nil {
+			return fmt.Errorf("%s already exists", filename)
+		}
+
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		var segment cs.Segment
+		if err := json.Unmarshal(data, &segment); err != nil {
+			return err
+		}
+
+		evidence := segment.Meta.FindEvidences(evidences.BcBatchFossilizerName)
+		if len(evidence) == 0 {
+			return fmt.Errorf("segment has no %s evidence", evidences.BcBatchFossilizerName)
+		}
+		proof, ok := evidence[0].Proof.(*evidences.BcBatchProof)
+		if !ok {
+			return fmt.Errorf("unexpected %s proof", evidences.BcBatchFossilizerName)
+		}
+
+		linkHash, err := segment.Link.Hash()
+		if err != nil {
+			return err
+		}
+
+		client := bitcoind.New(&bitcoind.Config{
+			Network:    btc.Network(otsNetwork),
+			URL:        otsRPCURL,
+			Username:   os.Getenv("BTC_RPC_USER"),
+			Password:   os.Getenv("BTC_RPC_PASSWORD"),
+			CookieFile: otsCookieFile,
+		})
+
+		p, err := proof.OpenTimestamps(linkHash, client)
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(filename, p.OTS, 0644); err != nil {
+			return err
+		}
+
+		fmt.Printf("Exported OpenTimestamps proof to %s.\n", filename)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(otsCmd)
+
+	otsCmd.PersistentFlags().StringVar(
+		&otsNetwork,
+		"network",
+		string(btc.NetworkMain),
+		"Bitcoin network of the evidence (bitcoin:main, bitcoin:test3, bitcoin:regtest or bitcoin:simnet)",
+	)
+
+	otsCmd.PersistentFlags().StringVar(
+		&otsRPCURL,
+		"btc-rpc-url",
+		"",
+		"URL of the JSON-RPC endpoint of a Bitcoin Core node (defaults to the RPC port of the network on localhost)",
+	)
+
+	otsCmd.PersistentFlags().StringVar(
+		&otsCookieFile,
+		"btc-rpc-cookie",
+		"",
+		"Path of the cookie file of the Bitcoin Core node",
+	)
+}
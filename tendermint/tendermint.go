@@ -15,11 +15,14 @@
 package tendermint
 
 import (
+	"errors"
+
 	log "github.com/sirupsen/logrus"
 	abci "github.com/tendermint/abci/types"
 	cfg "github.com/tendermint/tendermint/config"
 	"github.com/tendermint/tendermint/node"
 	"github.com/tendermint/tendermint/proxy"
+	sm "github.com/tendermint/tendermint/state"
 	"github.com/tendermint/tendermint/types"
 	"github.com/tendermint/tmlibs/cli/flags"
 	tmlog "github.com/tendermint/tmlibs/log"
@@ -49,3 +52,21 @@ func NewNode(config *cfg.Config, app abci.Application) *node.Node {
 	}
 	return ret
 }
+
+// LoadLastBlock returns the height and the app hash of the last block
+// committed by a node, read from its state db.
+// The node must not be running since it holds a lock on the db.
+func LoadLastBlock(config *cfg.Config) (int64, []byte, error) {
+	db, err := node.DefaultDBProvider(&node.DBContext{ID: "state", Config: config})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer db.Close()
+
+	state := sm.LoadState(db)
+	if state == nil {
+		return 0, nil, errors.New("tendermint state not found")
+	}
+
+	return state.LastBlockHeight, state.AppHash, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpop
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/stratumn/sdk/store"
+	"github.com/tendermint/go-crypto"
+)
+
+// Signature is the signature of an administrator.
+type Signature struct {
+	PubKey    crypto.PubKey    `json:"pubKey"`
+	Signature crypto.Signature `json:"signature"`
+}
+
+// AdminUpdate contains what is common to the updates signed by
+// administrators: rules, validators and permissions updates.
+type AdminUpdate struct {
+	// The height from which the latest value of the same kind applies,
+	// such as the genesis validators or the latest approved rules, or zero
+	// if there is none. Every approved update raises it, so an approved
+	// update can't be replayed, even once the value it replaced is back.
+	PreviousHeight int64 `json:"previousHeight"`
+
+	// The signatures of the administrators, which also cover the ID of the
+	// chain. Updates are therefore only accepted once a block began.
+	Signatures []*Signature `json:"signatures"`
+}
+
+// message returns the bytes signed by the administrators for an update of
+// the given kind changing to the given content on the given chain, so that
+// it can't be replayed on another chain with the same administrators.
+func (u *AdminUpdate) message(chainID string, kind string, content []byte) []byte {
+	var previousHeight [8]byte
+	binary.BigEndian.PutUint64(previousHeight[:], uint64(u.PreviousHeight))
+	chainIDHash := sha256.Sum256([]byte(chainID))
+	kindHash := sha256.Sum256([]byte(kind))
+	contentHash := sha256.Sum256(content)
+
+	hash := sha256.New()
+	hash.Write(chainIDHash[:])
+	hash.Write(kindHash[:])
+	hash.Write(previousHeight[:])
+	hash.Write(contentHash[:])
+	return hash.Sum(nil)
+}
+
+// sign adds the signature of an administrator of a message.
+func (u *AdminUpdate) sign(msg []byte, privKey crypto.PrivKey) {
+	u.Signatures = append(u.Signatures, &Signature{
+		PubKey:    privKey.PubKey(),
+		Signature: privKey.Sign(msg),
+	})
+}
+
+// adminUpdates handles the updates of one kind approved by administrators.
+// The values they adopt are saved by height under a prefix of the
+// key-value store.
+type adminUpdates struct {
+	// The name of the updated values, such as "Rules".
+	name string
+
+	// The prefix of the database keys where the values are saved.
+	prefix string
+
+	admins    []crypto.PubKey
+	approvals int
+
+	// The value approved in the current block, which applies from the
+	// next block.
+	pending interface{}
+}
+
+// check checks that an update applies to the latest adopted value and is
+// signed by enough administrators.
+func (a *adminUpdates) check(kv store.KeyValueReader, u *AdminUpdate, msg []byte) *ABCIError {
+	heights, err := getHeights(kv, a.prefix)
+	if err != nil {
+		return &ABCIError{CodeTypeInternalError, err.Error()}
+	}
+	var latest int64
+	if len(heights) > 0 {
+		latest = heights[len(heights)-1]
+	}
+	if u.PreviousHeight != latest {
+		return &ABCIError{
+			CodeTypeValidation,
+			fmt.Sprintf("%s update doesn't apply to the latest %s", a.name, strings.ToLower(a.name)),
+		}
+	}
+
+	return checkApprovals(a.admins, a.approvals, msg, u.Signatures)
+}
+
+// approve checks an update and keeps the value it adopts until the end of
+// the block. Only one update is allowed per block.
+func (a *adminUpdates) approve(kv store.KeyValueReader, u *AdminUpdate, msg []byte, value interface{}) *ABCIError {
+	if a.pending != nil {
+		return &ABCIError{
+			CodeTypeValidation,
+			fmt.Sprintf("%s were already updated in this block", a.name),
+		}
+	}
+	if err := a.check(kv, u, msg); !err.IsOK() {
+		return err
+	}
+
+	a.pending = value
+	return nil
+}
+
+// save saves the value approved in the current block, which applies from
+// the given height. It returns the saved value, or nil if there is none.
+func (a *adminUpdates) save(kv store.KeyValueStore, height int64) (interface{}, error) {
+	if a.pending == nil {
+		return nil, nil
+	}
+
+	if err := saveAtHeight(kv, a.prefix, height, a.pending); err != nil {
+		return nil, err
+	}
+
+	saved := a.pending
+	a.pending = nil
+	return saved, nil
+}
+
+// checkApprovals checks that enough administrators signed an update
+// message. Zero required approvals requires all the administrators.
+func checkApprovals(admins []crypto.PubKey, required int, msg []byte, signatures []*Signature) *ABCIError {
+	if len(admins) == 0 {
+		return &ABCIError{
+			CodeTypeValidation,
+			"Updates are disabled because there are no administrators",
+		}
+	}
+	if required <= 0 {
+		required = len(admins)
+	}
+
+	signers := make(map[int]bool)
+	for _, sig := range signatures {
+		if sig == nil || sig.PubKey.Empty() || sig.Signature.Empty() {
+			continue
+		}
+		for i, admin := range admins {
+			if bytes.Equal(admin.Bytes(), sig.PubKey.Bytes()) && admin.VerifyBytes(msg, sig.Signature) {
+				signers[i] = true
+			}
+		}
+	}
+
+	if len(signers) < required {
+		return &ABCIError{
+			CodeTypeValidation,
+			fmt.Sprintf("Update has %d valid signatures, %d required", len(signers), required),
+		}
+	}
+
+	return nil
+}
@@ -15,6 +15,10 @@
 package tmpop
 
 import (
+	"crypto/x509"
+	"flag"
+	"io/ioutil"
+	"os"
 	"runtime"
 
 	log "github.com/sirupsen/logrus"
@@ -22,8 +26,86 @@ import (
 
 	"github.com/stratumn/sdk/store"
 	"github.com/stratumn/sdk/tendermint"
+	"github.com/stratumn/sdk/types"
+	"github.com/stratumn/sdk/validator"
 )
 
+var (
+	snapshotIn  string
+	snapshotOut string
+
+	validatorFilename    string
+	rulesAdmins          string
+	rulesApprovals       int
+	validatorsAdmins     string
+	validatorsApprovals  int
+	permissionsAdmins    string
+	permissionsApprovals int
+	evidenceProviders    string
+	tsaRoots             string
+)
+
+// RegisterFlags registers the TMPop flags.
+func RegisterFlags() {
+	flag.StringVar(&validatorFilename, "rules_filename", validator.DefaultFilename, "Path to filename containing validation rules")
+	flag.StringVar(&rulesAdmins, "rules_admins", "", "Comma-separated hex-encoded Ed25519 public keys of the administrators allowed to update validation rules")
+	flag.IntVar(&rulesApprovals, "rules_approvals", 0, "Number of administrator signatures required to update validation rules, zero requiring all of them")
+	flag.StringVar(&validatorsAdmins, "validators_admins", "", "Comma-separated hex-encoded Ed25519 public keys of the administrators allowed to update Tendermint validators")
+	flag.IntVar(&validatorsApprovals, "validators_approvals", 0, "Number of administrator signatures required to update Tendermint validators, zero requiring all of them")
+	flag.StringVar(&permissionsAdmins, "permissions_admins", "", "Comma-separated hex-encoded Ed25519 public keys of the administrators allowed to update process permissions")
+	flag.IntVar(&permissionsApprovals, "permissions_approvals", 0, "Number of administrator signatures required to update process permissions, zero requiring all of them")
+	flag.StringVar(&evidenceProviders, "evidence_providers", "", "Comma-separated evidence providers and hex-encoded Ed25519 public keys allowed to add their evidences, as provider=key")
+	flag.StringVar(&tsaRoots, "tsa_roots", "", "Path to a PEM file containing the root certificates of the timestamp authorities trusted to sign TSA batch evidences")
+	flag.StringVar(&snapshotIn, "snapshot_in", "", "Path to a snapshot restored in the empty store before starting (the Tendermint data directory must be copied from the same node)")
+	flag.StringVar(&snapshotOut, "snapshot_out", "", "Path where a snapshot of the store is written, instead of starting")
+}
+
+// ConfigFromFlags creates a TMPop configuration from the command-line flags.
+func ConfigFromFlags(version string, commit string) *Config {
+	rulesAdminKeys, err := ParseAdmins(rulesAdmins)
+	if err != nil {
+		log.Fatal(err)
+	}
+	validatorsAdminKeys, err := ParseAdmins(validatorsAdmins)
+	if err != nil {
+		log.Fatal(err)
+	}
+	permissionsAdminKeys, err := ParseAdmins(permissionsAdmins)
+	if err != nil {
+		log.Fatal(err)
+	}
+	evidenceProviderKeys, err := ParseEvidenceProviders(evidenceProviders)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var tsaRootCerts *x509.CertPool
+	if tsaRoots != "" {
+		pem, err := ioutil.ReadFile(tsaRoots)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tsaRootCerts = x509.NewCertPool()
+		if !tsaRootCerts.AppendCertsFromPEM(pem) {
+			log.Fatalf("no certificate found in %s", tsaRoots)
+		}
+	}
+
+	return &Config{
+		Commit:               commit,
+		Version:              version,
+		ValidatorFilename:    validatorFilename,
+		RulesAdmins:          rulesAdminKeys,
+		RulesApprovals:       rulesApprovals,
+		ValidatorsAdmins:     validatorsAdminKeys,
+		ValidatorsApprovals:  validatorsApprovals,
+		PermissionsAdmins:    permissionsAdminKeys,
+		PermissionsApprovals: permissionsApprovals,
+		EvidenceProviders:    evidenceProviderKeys,
+		TSARoots:             tsaRootCerts,
+	}
+}
+
 // Run launches a TMPop Tendermint App
 func Run(a store.Adapter, kv store.KeyValueStore, config *Config) {
 	adapterInfo, err := a.GetInfo()
@@ -31,11 +113,31 @@ func Run(a store.Adapter, kv store.KeyValueStore, config *Config) {
 		log.Fatal(err)
 	}
 
+	if snapshotIn != "" {
+		height, appHash, err := tendermint.LoadLastBlock(tendermint.GetConfig())
+		if err != nil {
+			log.Fatal(err)
+		}
+		trusted := &LastBlock{Height: height, AppHash: types.NewBytes32FromBytes(appHash)}
+		if err := restoreSnapshotFile(a, kv, snapshotIn, config, trusted); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Restored snapshot %s", snapshotIn)
+	}
+
 	tmpop, err := New(a, kv, config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if snapshotOut != "" {
+		if err := writeSnapshotFile(tmpop, snapshotOut); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Wrote snapshot %s at height %d", snapshotOut, tmpop.lastBlock.Height)
+		return
+	}
+
 	log.Infof("TMPop v%s@%s", config.Version, config.Commit[:7])
 	log.Infof("Adapter %v", adapterInfo)
 	log.Info("Copyright (c) 2017 Stratumn SAS")
@@ -48,3 +150,27 @@ func Run(a store.Adapter, kv store.KeyValueStore, config *Config) {
 	tendermintNode.Start()
 	tendermintNode.RunForever()
 }
+
+func restoreSnapshotFile(a store.Adapter, kv store.KeyValueStore, filename string, config *Config, trusted *LastBlock) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return RestoreSnapshot(a, kv, f, config, trusted)
+}
+
+func writeSnapshotFile(t *TMPop, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := t.WriteSnapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
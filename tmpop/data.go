@@ -59,11 +59,12 @@ func getValidatorHashKey(height int64) []byte {
 	return []byte(key)
 }
 
-// saveValidatorHash saves the hash of the validator used for the current block
+// saveValidatorHash saves the hash of the validator and permissions used for
+// the current block
 func (t *TMPop) saveValidatorHash() error {
-	if t.state.validator != nil {
+	if validationsHash := t.state.validationsHash(); validationsHash != nil {
 		key := getValidatorHashKey(t.currentHeader.Height)
-		value := t.state.validator.Hash()[:]
+		value := validationsHash[:]
 		if err := t.kvDB.SetValue(key, value); err != nil {
 			return err
 		}
@@ -24,6 +24,14 @@ const (
 	// CodeTypeValidation is the ABCI error code for a validation error.
 	CodeTypeValidation uint32 = 400
 
+	// CodeTypeForbidden is the ABCI error code for a link or an evidence
+	// that isn't signed by keys allowed to add it.
+	CodeTypeForbidden uint32 = 403
+
+	// CodeTypeDuplicate is the ABCI error code for a link that already
+	// exists, either committed or delivered in the current block.
+	CodeTypeDuplicate uint32 = 409
+
 	// CodeTypeInternalError is the ABCI error code for an internal error.
 	CodeTypeInternalError uint32 = 500
 
@@ -15,6 +15,8 @@
 package tmpop
 
 import (
+	"encoding/json"
+	"fmt"
 	"sync"
 
 	"github.com/stratumn/sdk/cs"
@@ -22,12 +24,37 @@ import (
 	"github.com/stratumn/sdk/types"
 )
 
+// MaxEventsBlocks is the maximum number of blocks whose events are returned
+// by a GetEvents query.
+const MaxEventsBlocks = 1000
+
+// EventsFilter selects the events returned by a GetEvents query.
+type EventsFilter struct {
+	// The height of the first block whose events are returned.
+	FromHeight int64 `json:"fromHeight"`
+}
+
+// Events are the events saved by a range of blocks.
+type Events struct {
+	// The height of the last block whose events are included.
+	// The next events should be queried from the following height.
+	LastHeight int64 `json:"lastHeight"`
+
+	Events []*store.Event `json:"events"`
+}
+
 // Tendermint doesn't allow us to fire arbitrary events to notify TMStore.
-// So instead we store pending events here, and TMStore will query them
-// when a new block is produced.
+// So instead we save the events of each block in the key-value store, and
+// each TMStore queries the events it hasn't seen when a new block is
+// produced.
 type eventsManager struct {
-	pendingEvents []*store.Event
-	lock          sync.Mutex
+	blockEvents []*store.Event
+	lock        sync.Mutex
+}
+
+func getEventsKey(height int64) []byte {
+	key := fmt.Sprintf("tmpop:events:%d", height)
+	return []byte(key)
 }
 
 func (e *eventsManager) AddSavedLinks(links []*cs.Link) {
@@ -36,7 +63,7 @@ func (e *eventsManager) AddSavedLinks(links []*cs.Link) {
 
 		e.lock.Lock()
 		defer e.lock.Unlock()
-		e.pendingEvents = append(e.pendingEvents, savedEvent)
+		e.blockEvents = append(e.blockEvents, savedEvent)
 	}
 }
 
@@ -49,17 +76,63 @@ func (e *eventsManager) AddSavedEvidences(evidences map[*types.Bytes32]*cs.Evide
 
 		e.lock.Lock()
 		defer e.lock.Unlock()
-		e.pendingEvents = append(e.pendingEvents, evidenceEvent)
+		e.blockEvents = append(e.blockEvents, evidenceEvent)
 	}
 }
 
-func (e *eventsManager) GetPendingEvents() []*store.Event {
+// Commit saves the events of the block at the given height.
+func (e *eventsManager) Commit(kv store.KeyValueStore, height int64) error {
 	e.lock.Lock()
 	defer e.lock.Unlock()
 
-	eventsToDeliver := make([]*store.Event, len(e.pendingEvents))
-	copy(eventsToDeliver, e.pendingEvents)
-	e.pendingEvents = nil
+	if len(e.blockEvents) == 0 {
+		return nil
+	}
+
+	value, err := json.Marshal(e.blockEvents)
+	if err != nil {
+		return err
+	}
+	if err := kv.SetValue(getEventsKey(height), value); err != nil {
+		return err
+	}
+
+	e.blockEvents = nil
+
+	return nil
+}
+
+// GetEvents returns the events saved by the blocks from the filter's height
+// up to the given last height.
+func (e *eventsManager) GetEvents(kv store.KeyValueStore, filter *EventsFilter, lastHeight int64) (*Events, error) {
+	fromHeight := filter.FromHeight
+	if fromHeight < 1 {
+		fromHeight = 1
+	}
+	if lastHeight-fromHeight >= MaxEventsBlocks {
+		lastHeight = fromHeight + MaxEventsBlocks - 1
+	}
+
+	events := &Events{
+		LastHeight: lastHeight,
+		Events:     []*store.Event{},
+	}
+
+	for height := fromHeight; height <= lastHeight; height++ {
+		value, err := kv.GetValue(getEventsKey(height))
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+
+		var blockEvents []*store.Event
+		if err := json.Unmarshal(value, &blockEvents); err != nil {
+			return nil, err
+		}
+		events.Events = append(events.Events, blockEvents...)
+	}
 
-	return eventsToDeliver
+	return events, nil
 }
@@ -0,0 +1,191 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpop
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/types"
+	"github.com/tendermint/go-crypto"
+)
+
+// verifiedBackends are the backends of the evidences whose proofs every node
+// verifies from the evidence alone when evidences are added by transactions.
+// The Merkle path of batch and bcbatch proofs must lead from the link to the
+// root, but the anchoring transaction of bcbatch proofs is not checked. The
+// token of TSA batch proofs must also be signed by a trusted authority.
+// Other proofs can't be verified by TMPop: OpenTimestamps proofs require
+// Bitcoin block headers, and TMPop evidences are only produced by TMPop.
+// Their evidences are refused unless evidence verification is skipped.
+var verifiedBackends = map[string]bool{
+	evidences.BatchFossilizerName:    true,
+	evidences.BcBatchFossilizerName:  true,
+	evidences.TSABatchFossilizerName: true,
+}
+
+// verifyEvidence checks that the backend of an evidence can be verified and
+// that its proof is valid for the link.
+func verifyEvidence(linkHash *types.Bytes32, evidence *cs.Evidence) error {
+	if !verifiedBackends[evidence.Backend] {
+		return fmt.Errorf("proofs of backend %s can't be verified", evidence.Backend)
+	}
+	if evidence.Proof == nil || !evidence.Proof.Verify(linkHash) {
+		return errors.New("proof verification failed")
+	}
+
+	return nil
+}
+
+// EvidenceMessage returns the bytes signed by a provider to add an evidence
+// to a link: the hash of the link hash followed by the hash of the binary
+// evidence.
+func EvidenceMessage(linkHash *types.Bytes32, evidence *cs.Evidence) ([]byte, error) {
+	if linkHash == nil || evidence == nil {
+		return nil, errors.New("an evidence message requires a link hash and an evidence")
+	}
+
+	evidenceHash, err := hashEvidence(evidence)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	hash.Write(linkHash[:])
+	hash.Write(evidenceHash[:])
+	return hash.Sum(nil), nil
+}
+
+// SignEvidence signs the evidence of an AddEvidenceTx transaction with a key
+// registered for its provider.
+func (tx *Tx) SignEvidence(privKey crypto.PrivKey) error {
+	msg, err := EvidenceMessage(tx.LinkHash, tx.Evidence)
+	if err != nil {
+		return err
+	}
+
+	tx.Signature = &Signature{
+		PubKey:    privKey.PubKey(),
+		Signature: privKey.Sign(msg),
+	}
+	return nil
+}
+
+// ParseEvidenceProviders parses a comma-separated list of providers and the
+// hex-encoded Ed25519 public keys allowed to add their evidences, such as
+// "bitcoin:main=<key1>,bitcoin:main=<key2>,tsa=<key3>".
+func ParseEvidenceProviders(s string) (map[string][]crypto.PubKey, error) {
+	providers := make(map[string][]crypto.PubKey)
+
+	for _, str := range strings.Split(s, ",") {
+		if str = strings.TrimSpace(str); str == "" {
+			continue
+		}
+
+		i := strings.LastIndex(str, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid evidence provider %q, want provider=key", str)
+		}
+		provider := strings.TrimSpace(str[:i])
+
+		pubKey, err := parsePubKey(strings.TrimSpace(str[i+1:]))
+		if err != nil {
+			return nil, err
+		}
+		providers[provider] = append(providers[provider], pubKey.Wrap())
+	}
+
+	return providers, nil
+}
+
+// ParseEvidenceKey parses a hex-encoded Ed25519 private key signing
+// evidences.
+func ParseEvidenceKey(s string) (crypto.PrivKey, error) {
+	var privKey crypto.PrivKeyEd25519
+
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return crypto.PrivKey{}, err
+	}
+	if len(b) != len(privKey) {
+		return crypto.PrivKey{}, fmt.Errorf("invalid private key length %d", len(b))
+	}
+	copy(privKey[:], b)
+
+	return privKey.Wrap(), nil
+}
+
+// authorizeEvidence checks that an evidence is signed by one of the keys
+// registered for its provider. Evidences of providers that aren't
+// registered are refused so that nobody can take the place of a provider.
+func authorizeEvidence(providers map[string][]crypto.PubKey, linkHash *types.Bytes32, evidence *cs.Evidence, sig *Signature) error {
+	keys, ok := providers[evidence.Provider]
+	if !ok || len(keys) == 0 {
+		return fmt.Errorf("provider %s isn't registered", evidence.Provider)
+	}
+	if sig == nil || sig.PubKey.Empty() || sig.Signature.Empty() {
+		return errors.New("evidence isn't signed")
+	}
+
+	msg, err := EvidenceMessage(linkHash, evidence)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if bytes.Equal(key.Bytes(), sig.PubKey.Bytes()) && key.VerifyBytes(msg, sig.Signature) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("evidence isn't signed by a key of provider %s", evidence.Provider)
+}
+
+// hashEvidence returns the hash of the binary encoding of an evidence.
+func hashEvidence(evidence *cs.Evidence) (*types.Bytes32, error) {
+	evidenceBytes, err := evidence.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := types.Bytes32(sha256.Sum256(evidenceBytes))
+	return &hash, nil
+}
+
+// hashEvidences returns the hash of the evidences delivered in a block, in
+// the order they were delivered, or nil if there are none.
+func hashEvidences(evidences []*linkEvidence) (*types.Bytes32, error) {
+	if len(evidences) == 0 {
+		return nil, nil
+	}
+
+	hash := sha256.New()
+	for _, e := range evidences {
+		evidenceHash, err := hashEvidence(e.evidence)
+		if err != nil {
+			return nil, err
+		}
+		hash.Write(e.linkHash[:])
+		hash.Write(evidenceHash[:])
+	}
+
+	return types.NewBytes32FromBytes(hash.Sum(nil)), nil
+}
@@ -0,0 +1,291 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpop
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/store"
+	"github.com/stratumn/sdk/types"
+)
+
+func getLinkHeightKey(linkHash *types.Bytes32) []byte {
+	key := fmt.Sprintf("tmpop:linkheight:%s", linkHash.String())
+	return []byte(key)
+}
+
+// saveLinkHeights saves the height of the current block for each link
+// created in it, so that queries can be made at a past height.
+func (t *TMPop) saveLinkHeights(links []*cs.Link) error {
+	value := []byte(strconv.FormatInt(t.currentHeader.Height, 10))
+	for _, link := range links {
+		linkHash, err := link.Hash()
+		if err != nil {
+			return err
+		}
+		if err := t.kvDB.SetValue(getLinkHeightKey(linkHash), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getLinkHeight gets the height of the block that created a link.
+// It returns zero if the height is unknown.
+func (t *TMPop) getLinkHeight(linkHash *types.Bytes32) (int64, error) {
+	value, err := t.kvDB.GetValue(getLinkHeightKey(linkHash))
+	if err != nil || value == nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(string(value), 10, 64)
+}
+
+// existsAt tells whether a link was committed at the given height.
+// Links committed before heights were recorded are considered part of
+// every height.
+func (t *TMPop) existsAt(linkHash *types.Bytes32, height int64) (bool, error) {
+	linkHeight, err := t.getLinkHeight(linkHash)
+	if err != nil {
+		return false, err
+	}
+
+	return linkHeight <= height, nil
+}
+
+// getSegmentAt returns a segment if its link was committed at the given
+// height. The segment contains the evidences and the meta data added after
+// that height.
+func (t *TMPop) getSegmentAt(linkHash *types.Bytes32, height int64) (*cs.Segment, error) {
+	segment, err := t.adapter.GetSegment(linkHash)
+	if err != nil || segment == nil {
+		return nil, err
+	}
+
+	exists, err := t.existsAt(linkHash, height)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	return segment, nil
+}
+
+// getLinkHashesAfter returns the hashes of the links committed in the blocks
+// following the given height. The link hashes saved for every block index
+// the links by height, so it reads one value per block.
+func (t *TMPop) getLinkHashesAfter(height int64) (map[types.Bytes32]struct{}, error) {
+	after := map[types.Bytes32]struct{}{}
+	for h := height + 1; h <= t.lastBlock.Height; h++ {
+		linkHashes, err := t.getCommitLinkHashes(h)
+		if err != nil {
+			return nil, err
+		}
+		for _, linkHash := range linkHashes {
+			after[linkHash] = struct{}{}
+		}
+	}
+
+	return after, nil
+}
+
+// findSegmentsAt finds the segments matching the filter whose links were
+// committed at the given height. A zero limit returns store.DefaultLimit
+// segments.
+//
+// The segments are returned as they are now: they contain the evidences and
+// the meta data added after the given height.
+//
+// Since the adapter doesn't know about heights, it fetches the page with
+// room for the links committed after the given height and removes them.
+// The cost grows with the offset, the limit and the number of links
+// committed since that height, not with the size of the store.
+func (t *TMPop) findSegmentsAt(filter *store.SegmentFilter, height int64) (cs.SegmentSlice, error) {
+	after, err := t.getLinkHashesAfter(height)
+	if err != nil {
+		return nil, err
+	}
+
+	pagination := filter.Pagination
+	if pagination.Limit <= 0 {
+		pagination.Limit = store.DefaultLimit
+	}
+
+	pageFilter := *filter
+	pageFilter.Pagination = store.Pagination{Limit: pagination.Offset + pagination.Limit + len(after)}
+	page, err := t.adapter.FindSegments(&pageFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := cs.SegmentSlice{}
+	for _, segment := range page {
+		if _, ok := after[*segment.GetLinkHash()]; !ok {
+			segments = append(segments, segment)
+		}
+	}
+
+	return pagination.PaginateSegments(segments), nil
+}
+
+// getMapIDsAt returns the IDs of the maps that had at least one segment at
+// the given height, sorted.
+//
+// Only the maps of the links committed after the given height can be
+// missing at that height, so only their segments are read. The cost grows
+// with the offset, the limit and the segments of these maps, not with the
+// size of the store.
+func (t *TMPop) getMapIDsAt(filter *store.MapFilter, height int64) ([]string, error) {
+	after, err := t.getLinkHashesAfter(height)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded, err := t.getMapIDsAfter(filter, after)
+	if err != nil {
+		return nil, err
+	}
+
+	pagination := filter.Pagination
+	if pagination.Limit <= 0 {
+		pagination.Limit = store.DefaultLimit
+	}
+
+	pageFilter := *filter
+	pageFilter.Pagination = store.Pagination{Limit: pagination.Offset + pagination.Limit + len(excluded)}
+	page, err := t.adapter.GetMapIDs(&pageFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	mapIDs := []string{}
+	for _, mapID := range page {
+		if _, ok := excluded[mapID]; !ok {
+			mapIDs = append(mapIDs, mapID)
+		}
+	}
+
+	return pagination.PaginateStrings(mapIDs), nil
+}
+
+// getMapIDsAfter returns the IDs of the maps matching the filter whose
+// segments were all committed with the given links.
+func (t *TMPop) getMapIDsAfter(filter *store.MapFilter, after map[types.Bytes32]struct{}) (map[string]struct{}, error) {
+	mapIDs := map[string]struct{}{}
+	for linkHash := range after {
+		linkHash := linkHash
+		segment, err := t.adapter.GetSegment(&linkHash)
+		if err != nil {
+			return nil, err
+		}
+		if segment == nil || !filter.MatchLink(&segment.Link) {
+			continue
+		}
+		mapIDs[segment.Link.GetMapID()] = struct{}{}
+	}
+
+	for mapID := range mapIDs {
+		segments, err := t.adapter.FindSegments(&store.SegmentFilter{
+			Pagination: store.Pagination{Limit: len(after) + 1},
+			MapIDs:     []string{mapID},
+			Process:    filter.Process,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, segment := range segments {
+			if _, ok := after[*segment.GetLinkHash()]; !ok {
+				delete(mapIDs, mapID)
+				break
+			}
+		}
+	}
+
+	return mapIDs, nil
+}
+
+func getAtHeightKey(prefix string, height int64) []byte {
+	key := fmt.Sprintf("%s:%d", prefix, height)
+	return []byte(key)
+}
+
+// saveAtHeight saves a value that applies from the given height, and indexes
+// the height so that getAtHeight finds the value that applies at any height.
+// Heights must be saved in increasing order.
+func saveAtHeight(kv store.KeyValueStore, prefix string, height int64, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := kv.SetValue(getAtHeightKey(prefix, height), value); err != nil {
+		return err
+	}
+
+	heights, err := getHeights(kv, prefix)
+	if err != nil {
+		return err
+	}
+	if value, err = json.Marshal(append(heights, height)); err != nil {
+		return err
+	}
+
+	return kv.SetValue([]byte(prefix+":heights"), value)
+}
+
+// getHeights returns the heights of the values saved with a prefix, in
+// increasing order.
+func getHeights(kv store.KeyValueReader, prefix string) ([]int64, error) {
+	value, err := kv.GetValue([]byte(prefix + ":heights"))
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	var heights []int64
+	if err := json.Unmarshal(value, &heights); err != nil {
+		return nil, err
+	}
+
+	return heights, nil
+}
+
+// getAtHeight gets the value saved with a prefix that applies at the given
+// height. A negative height gets the latest value. It returns false if no
+// value applies.
+func getAtHeight(kv store.KeyValueReader, prefix string, height int64, v interface{}) (bool, error) {
+	heights, err := getHeights(kv, prefix)
+	if err != nil {
+		return false, err
+	}
+
+	// Index of the first height greater than the given height.
+	i := sort.Search(len(heights), func(i int) bool { return heights[i] > height })
+	if height < 0 {
+		i = len(heights)
+	}
+	if i == 0 {
+		return false, nil
+	}
+
+	value, err := kv.GetValue(getAtHeightKey(prefix, heights[i-1]))
+	if err != nil || value == nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(value, v)
+}
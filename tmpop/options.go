@@ -0,0 +1,106 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpop
+
+import (
+	"fmt"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stratumn/sdk/store"
+)
+
+// Keys of the options that can be changed with SetOption.
+const (
+	// OptionLogLevel sets the logrus level (debug, info, warning, error...).
+	OptionLogLevel = "log_level"
+
+	// OptionGenerateEvidence turns the generation of Tendermint evidences
+	// on or off ("true" or "false").
+	OptionGenerateEvidence = "generate_evidence"
+
+	// OptionQueryLimit sets the maximum number of results returned by
+	// FindSegments and GetMapIDs queries. Zero only applies the limits of
+	// the adapter.
+	OptionQueryLimit = "query_limit"
+)
+
+// Options are the runtime options of a node. They don't affect consensus,
+// so each node can change them with SetOption without restarting.
+type Options struct {
+	LogLevel         string `json:"logLevel"`
+	GenerateEvidence bool   `json:"generateEvidence"`
+	QueryLimit       int    `json:"queryLimit"`
+}
+
+// newOptions returns the options a node starts with.
+func newOptions() *Options {
+	return &Options{
+		LogLevel:         log.GetLevel().String(),
+		GenerateEvidence: true,
+	}
+}
+
+// set changes the value of an option.
+func (o *Options) set(key, value string) *ABCIError {
+	switch key {
+	case OptionLogLevel:
+		level, err := log.ParseLevel(value)
+		if err != nil {
+			return &ABCIError{CodeTypeValidation, err.Error()}
+		}
+		log.SetLevel(level)
+		o.LogLevel = level.String()
+
+	case OptionGenerateEvidence:
+		generate, err := strconv.ParseBool(value)
+		if err != nil {
+			return &ABCIError{
+				CodeTypeValidation,
+				fmt.Sprintf("Invalid value %q for option %s", value, key),
+			}
+		}
+		o.GenerateEvidence = generate
+
+	case OptionQueryLimit:
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return &ABCIError{
+				CodeTypeValidation,
+				fmt.Sprintf("Invalid value %q for option %s", value, key),
+			}
+		}
+		o.QueryLimit = limit
+
+	default:
+		return &ABCIError{
+			CodeTypeNotImplemented,
+			fmt.Sprintf("Unknown option %s", key),
+		}
+	}
+
+	return nil
+}
+
+// limit applies the query limit to a pagination. A zero limit is replaced by
+// the default limit first.
+func (o *Options) limit(p *store.Pagination) {
+	if p.Limit <= 0 {
+		p.Limit = store.DefaultLimit
+	}
+	if o.QueryLimit > 0 && p.Limit > o.QueryLimit {
+		p.Limit = o.QueryLimit
+	}
+}
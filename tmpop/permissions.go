@@ -0,0 +1,313 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpop
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/types"
+	"github.com/tendermint/go-crypto"
+)
+
+// permissionsPrefix is the prefix of the database keys where permissions
+// are saved by height.
+const permissionsPrefix = "tmpop:permissions"
+
+// LinkSignaturesKey is the key of the link meta data containing the
+// signatures of a link.
+//
+// The signatures are a list of objects with the hex-encoded Ed25519 public
+// key and signature of a signer. They sign the hash of the link without its
+// signatures.
+const LinkSignaturesKey = "signatures"
+
+// ProcessPermissions list the hex-encoded Ed25519 public keys allowed to
+// create links in a process.
+//
+// A link must be signed by one of the signers of the process, if any, by one
+// of the keys allowed to append to its map, if any, and by one of the keys
+// allowed to use its action, if any.
+type ProcessPermissions struct {
+	// The keys allowed to create links in the process.
+	Signers []string `json:"signers"`
+
+	// The keys allowed to append to a map, by map ID.
+	MapIDs map[string][]string `json:"mapIds"`
+
+	// The keys allowed to use an action, by action.
+	Actions map[string][]string `json:"actions"`
+}
+
+// validate checks that all the keys are valid.
+func (p *ProcessPermissions) validate() error {
+	if p == nil {
+		return errors.New("permissions are missing")
+	}
+
+	keys := [][]string{p.Signers}
+	for _, k := range p.MapIDs {
+		keys = append(keys, k)
+	}
+	for _, k := range p.Actions {
+		keys = append(keys, k)
+	}
+
+	for _, list := range keys {
+		for _, key := range list {
+			if _, err := parsePubKey(key); err != nil {
+				return fmt.Errorf("invalid key %q: %v", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PermissionsUpdate proposes new permissions. It must be signed by enough
+// administrators to be accepted.
+type PermissionsUpdate struct {
+	AdminUpdate
+
+	// The permissions of the restricted processes, by process name.
+	// Processes that are not listed are open to everyone.
+	Processes map[string]*ProcessPermissions `json:"processes"`
+}
+
+// Message returns the bytes signed by the administrators of the chain with
+// the given ID.
+func (u *PermissionsUpdate) Message(chainID string) []byte {
+	processes, _ := json.Marshal(u.Processes)
+	return u.message(chainID, permissionsPrefix, processes)
+}
+
+// Sign adds the signature of an administrator of the chain with the given
+// ID to the update.
+func (u *PermissionsUpdate) Sign(chainID string, privKey crypto.PrivKey) {
+	u.sign(u.Message(chainID), privKey)
+}
+
+// Permissions are process permissions adopted on chain.
+type Permissions struct {
+	// The height of the first block validated by the permissions.
+	Height int64 `json:"height"`
+
+	// The permissions of the restricted processes, by process name.
+	Processes map[string]*ProcessPermissions `json:"processes"`
+}
+
+// Hash returns the hash of the permissions of the processes.
+func (p *Permissions) Hash() *types.Bytes32 {
+	processes, _ := json.Marshal(p.Processes)
+	hash := types.Bytes32(sha256.Sum256(processes))
+	return &hash
+}
+
+// authorize checks that a valid link is signed by keys allowed to create it.
+func (p *Permissions) authorize(link *cs.Link) error {
+	if p == nil {
+		return nil
+	}
+	process, ok := p.Processes[link.GetProcess()]
+	if !ok {
+		return nil
+	}
+
+	signers, err := GetLinkSigners(link)
+	if err != nil {
+		return err
+	}
+	if len(signers) == 0 {
+		return fmt.Errorf("links of process %s must be signed", link.GetProcess())
+	}
+
+	if len(process.Signers) > 0 && !signedByOneOf(signers, process.Signers) {
+		return fmt.Errorf("link isn't signed by a signer of process %s", link.GetProcess())
+	}
+	if keys, ok := process.MapIDs[link.GetMapID()]; ok && !signedByOneOf(signers, keys) {
+		return fmt.Errorf("link isn't signed by a key allowed to append to map %s", link.GetMapID())
+	}
+	if action, ok := link.Meta["action"].(string); ok {
+		if keys, ok := process.Actions[action]; ok && !signedByOneOf(signers, keys) {
+			return fmt.Errorf("link isn't signed by a key allowed to use action %s", action)
+		}
+	}
+
+	return nil
+}
+
+func signedByOneOf(signers map[string]bool, keys []string) bool {
+	for _, key := range keys {
+		if pubKey, err := parsePubKey(key); err == nil && signers[hex.EncodeToString(pubKey[:])] {
+			return true
+		}
+	}
+	return false
+}
+
+// linkSignedHash returns the hash signed by the signers of a link, which is
+// the hash of the link without its signatures.
+func linkSignedHash(link *cs.Link) (*types.Bytes32, error) {
+	meta := make(map[string]interface{}, len(link.Meta))
+	for k, v := range link.Meta {
+		if k != LinkSignaturesKey {
+			meta[k] = v
+		}
+	}
+
+	return (&cs.Link{State: link.State, Meta: meta}).Hash()
+}
+
+// SignLink adds the signature of an Ed25519 private key to a link.
+func SignLink(link *cs.Link, privKey crypto.PrivKey) error {
+	pubKey, ok := privKey.PubKey().Unwrap().(crypto.PubKeyEd25519)
+	if !ok {
+		return errors.New("links can only be signed with Ed25519 keys")
+	}
+
+	hash, err := linkSignedHash(link)
+	if err != nil {
+		return err
+	}
+	signature, ok := privKey.Sign(hash[:]).Unwrap().(crypto.SignatureEd25519)
+	if !ok {
+		return errors.New("links can only be signed with Ed25519 keys")
+	}
+
+	signatures, _ := link.Meta[LinkSignaturesKey].([]interface{})
+	link.Meta[LinkSignaturesKey] = append(signatures, map[string]interface{}{
+		"pubKey":    hex.EncodeToString(pubKey[:]),
+		"signature": hex.EncodeToString(signature[:]),
+	})
+
+	return nil
+}
+
+// GetLinkSigners verifies the signatures of a link and returns the set of
+// the hex-encoded public keys that signed it.
+func GetLinkSigners(link *cs.Link) (map[string]bool, error) {
+	v, ok := link.Meta[LinkSignaturesKey]
+	if !ok {
+		return nil, nil
+	}
+	signatures, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("link.meta.signatures should be an array")
+	}
+
+	hash, err := linkSignedHash(link)
+	if err != nil {
+		return nil, err
+	}
+
+	signers := make(map[string]bool, len(signatures))
+	for i, s := range signatures {
+		sig, ok := s.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("link.meta.signatures[%d] should be a map", i)
+		}
+		keyStr, _ := sig["pubKey"].(string)
+		pubKey, err := parsePubKey(keyStr)
+		if err != nil {
+			return nil, fmt.Errorf("link.meta.signatures[%d].pubKey is invalid: %v", i, err)
+		}
+		sigStr, _ := sig["signature"].(string)
+		sigBytes, err := hex.DecodeString(sigStr)
+		var signature crypto.SignatureEd25519
+		if err != nil || len(sigBytes) != len(signature) {
+			return nil, fmt.Errorf("link.meta.signatures[%d].signature is invalid", i)
+		}
+		copy(signature[:], sigBytes)
+
+		if !pubKey.VerifyBytes(hash[:], signature.Wrap()) {
+			return nil, fmt.Errorf("link.meta.signatures[%d] verification failed", i)
+		}
+		signers[hex.EncodeToString(pubKey[:])] = true
+	}
+
+	return signers, nil
+}
+
+// checkPermissionsUpdate checks that a permissions update is valid and
+// returns the permissions it adopts.
+func (t *TMPop) checkPermissionsUpdate(u *PermissionsUpdate) (*Permissions, *ABCIError) {
+	if u == nil {
+		return nil, &ABCIError{
+			CodeTypeValidation,
+			"A permissions update requires permissions",
+		}
+	}
+
+	for process, p := range u.Processes {
+		if err := p.validate(); err != nil {
+			return nil, &ABCIError{
+				CodeTypeValidation,
+				fmt.Sprintf("Invalid permissions of process %s: %v", process, err),
+			}
+		}
+	}
+
+	return &Permissions{
+		Height:    t.currentHeader.GetHeight() + 1,
+		Processes: u.Processes,
+	}, nil
+}
+
+// checkPermissions checks a permissions update.
+func (t *TMPop) checkPermissions(u *PermissionsUpdate) *ABCIError {
+	if _, err := t.checkPermissionsUpdate(u); !err.IsOK() {
+		return err
+	}
+	return t.permissionsUpdates.check(t.kvDB, &u.AdminUpdate, u.Message(t.currentHeader.GetChainId()))
+}
+
+// deliverPermissions approves a permissions update. The permissions apply
+// from the next block.
+func (t *TMPop) deliverPermissions(u *PermissionsUpdate) *ABCIError {
+	permissions, err := t.checkPermissionsUpdate(u)
+	if !err.IsOK() {
+		return err
+	}
+	return t.permissionsUpdates.approve(t.kvDB, &u.AdminUpdate, u.Message(t.currentHeader.GetChainId()), permissions)
+}
+
+// savePermissions saves the permissions approved in the current block, which
+// apply from the next block.
+func (t *TMPop) savePermissions() error {
+	saved, err := t.permissionsUpdates.save(t.kvDB, t.currentHeader.Height+1)
+	if err != nil || saved == nil {
+		return err
+	}
+
+	t.nextPermissions = saved.(*Permissions)
+	return nil
+}
+
+// getPermissionsAt returns the permissions adopted on chain that apply to
+// the block at the given height, or nil if there are none. A negative height
+// returns the latest permissions.
+func (t *TMPop) getPermissionsAt(height int64) (*Permissions, error) {
+	permissions := &Permissions{}
+	found, err := getAtHeight(t.kvDB, permissionsPrefix, height, permissions)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return permissions, nil
+}
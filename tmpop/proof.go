@@ -0,0 +1,196 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/merkle"
+	"github.com/stratumn/sdk/types"
+)
+
+// LinkProof proves that a link was committed in a block.
+// The app hash it leads to is included in the header of the next block,
+// which is signed by the validators.
+type LinkProof struct {
+	BlockHeight int64 `json:"blockHeight"`
+
+	Root            *types.Bytes32 `json:"merkleRoot"`
+	Path            types.Path     `json:"merklePath"`
+	ValidationsHash *types.Bytes32 `json:"validationsHash"`
+	EvidencesHash   *types.Bytes32 `json:"evidencesHash,omitempty"`
+
+	PreviousAppHash *types.Bytes32 `json:"previousAppHash"`
+	AppHash         *types.Bytes32 `json:"appHash"`
+}
+
+// Verify checks that the proof leads from a link hash to its app hash.
+func (p *LinkProof) Verify(linkHash *types.Bytes32) error {
+	if linkHash == nil || p.Root == nil || p.AppHash == nil {
+		return errors.New("incomplete link proof")
+	}
+
+	appHash, err := ComputeAppHash(p.PreviousAppHash, p.ValidationsHash, p.Root, p.EvidencesHash)
+	if err != nil {
+		return err
+	}
+	if *appHash != *p.AppHash {
+		return errors.New("link proof doesn't lead to its app hash")
+	}
+
+	if len(p.Path) == 0 {
+		if *linkHash != *p.Root {
+			return errors.New("link hash isn't the Merkle root")
+		}
+		return nil
+	}
+
+	if err := p.Path.Validate(); err != nil {
+		return err
+	}
+	if *linkHash != p.Path[0].Left && *linkHash != p.Path[0].Right {
+		return errors.New("Merkle path doesn't start at the link hash")
+	}
+	if *p.Root != p.Path[len(p.Path)-1].Parent {
+		return errors.New("Merkle path doesn't end at the Merkle root")
+	}
+
+	return nil
+}
+
+// blockAppHashes are the app hashes before and after a block, and the hash
+// of the evidences it delivered.
+type blockAppHashes struct {
+	PreviousAppHash *types.Bytes32 `json:"previousAppHash"`
+	AppHash         *types.Bytes32 `json:"appHash"`
+	EvidencesHash   *types.Bytes32 `json:"evidencesHash,omitempty"`
+}
+
+func getAppHashesKey(height int64) []byte {
+	key := fmt.Sprintf("tmpop:apphashes:%d", height)
+	return []byte(key)
+}
+
+// saveAppHashes saves the app hashes before and after the current block.
+func (t *TMPop) saveAppHashes(appHash *types.Bytes32) error {
+	value, err := json.Marshal(blockAppHashes{
+		PreviousAppHash: t.state.previousAppHash,
+		AppHash:         appHash,
+		EvidencesHash:   t.state.evidencesHash,
+	})
+	if err != nil {
+		return err
+	}
+
+	return t.kvDB.SetValue(getAppHashesKey(t.currentHeader.Height), value)
+}
+
+// getAppHashes gets the app hashes before and after a block.
+func (t *TMPop) getAppHashes(height int64) (*blockAppHashes, error) {
+	value, err := t.kvDB.GetValue(getAppHashesKey(height))
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	var hashes blockAppHashes
+	if err := json.Unmarshal(value, &hashes); err != nil {
+		return nil, err
+	}
+
+	return &hashes, nil
+}
+
+// getLinkProof builds the proof that a link was committed.
+// It returns nil if the link was committed before proofs were available.
+func (t *TMPop) getLinkProof(linkHash *types.Bytes32) (*LinkProof, error) {
+	height, err := t.getLinkHeight(linkHash)
+	if err != nil || height == 0 {
+		return nil, err
+	}
+
+	hashes, err := t.getAppHashes(height)
+	if err != nil || hashes == nil {
+		return nil, err
+	}
+
+	linkHashes, err := t.getCommitLinkHashes(height)
+	if err != nil {
+		return nil, err
+	}
+	position := -1
+	for i, lh := range linkHashes {
+		if lh == *linkHash {
+			position = i
+			break
+		}
+	}
+	if position < 0 {
+		return nil, fmt.Errorf("link %s missing from block %d", linkHash, height)
+	}
+
+	tree, err := merkle.NewStaticTree(linkHashes)
+	if err != nil {
+		return nil, err
+	}
+
+	validationsHash, err := t.getValidatorHash(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LinkProof{
+		BlockHeight:     height,
+		Root:            tree.Root(),
+		Path:            tree.Path(position),
+		ValidationsHash: validationsHash,
+		EvidencesHash:   hashes.EvidencesHash,
+		PreviousAppHash: hashes.PreviousAppHash,
+		AppHash:         hashes.AppHash,
+	}, nil
+}
+
+// proveResult returns the JSON encoded proofs of the segments of a query
+// result: a proof for a segment, or a list of proofs in the same order for
+// a list of segments.
+func (t *TMPop) proveResult(result interface{}) ([]byte, error) {
+	switch r := result.(type) {
+	case *cs.Segment:
+		if r == nil {
+			return nil, nil
+		}
+		proof, err := t.getLinkProof(r.GetLinkHash())
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(proof)
+
+	case cs.SegmentSlice:
+		proofs := make([]*LinkProof, len(r))
+		for i, segment := range r {
+			proof, err := t.getLinkProof(segment.GetLinkHash())
+			if err != nil {
+				return nil, err
+			}
+			proofs[i] = proof
+		}
+		return json.Marshal(proofs)
+
+	default:
+		return nil, nil
+	}
+}
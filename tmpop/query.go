@@ -18,13 +18,23 @@ import "encoding/json"
 
 // Query types.
 const (
-	AddEvidence   = "AddEvidence"
-	FindSegments  = "FindSegments"
-	GetEvidences  = "GetEvidences"
-	GetInfo       = "GetInfo"
-	GetMapIDs     = "GetMapIDs"
-	GetSegment    = "GetSegment"
-	PendingEvents = "PendingEvents"
+	// AddEvidence adds an evidence directly to the local store, outside of
+	// consensus.
+	//
+	// Deprecated: use a transaction of type AddEvidenceTx so that the
+	// evidence is replicated on all the nodes.
+	AddEvidence = "AddEvidence"
+
+	FindSegments   = "FindSegments"
+	GetEvents      = "GetEvents"
+	GetEvidences   = "GetEvidences"
+	GetInfo        = "GetInfo"
+	GetMapIDs      = "GetMapIDs"
+	GetOptions     = "GetOptions"
+	GetPermissions = "GetPermissions"
+	GetRules       = "GetRules"
+	GetSegment     = "GetSegment"
+	GetValidators  = "GetValidators"
 )
 
 // BuildQueryBinary outputs the marshalled Query.
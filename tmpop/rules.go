@@ -0,0 +1,165 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpop
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/stratumn/sdk/types"
+	"github.com/stratumn/sdk/validator"
+	"github.com/tendermint/go-crypto"
+)
+
+// rulesPrefix is the prefix of the database keys where rules are saved by
+// height.
+const rulesPrefix = "tmpop:rules"
+
+// RulesUpdate proposes new validation rules. It must be signed by enough
+// administrators to be accepted.
+type RulesUpdate struct {
+	AdminUpdate
+
+	// The content of the new rules file.
+	Rules []byte `json:"rules"`
+}
+
+// Message returns the bytes signed by the administrators of the chain with
+// the given ID.
+func (u *RulesUpdate) Message(chainID string) []byte {
+	return u.message(chainID, rulesPrefix, u.Rules)
+}
+
+// Sign adds the signature of an administrator of the chain with the given
+// ID to the update.
+func (u *RulesUpdate) Sign(chainID string, privKey crypto.PrivKey) {
+	u.sign(u.Message(chainID), privKey)
+}
+
+// Rules are validation rules adopted on chain.
+type Rules struct {
+	// The height of the first block validated by the rules.
+	Height int64 `json:"height"`
+
+	// The hash of the rules, used to compute app hashes.
+	Hash *types.Bytes32 `json:"hash"`
+
+	// The content of the rules file.
+	Rules []byte `json:"rules"`
+}
+
+// ParseAdmins parses a comma-separated list of hex-encoded Ed25519
+// public keys of administrators.
+func ParseAdmins(s string) ([]crypto.PubKey, error) {
+	var admins []crypto.PubKey
+
+	for _, str := range strings.Split(s, ",") {
+		if str = strings.TrimSpace(str); str == "" {
+			continue
+		}
+
+		pubKey, err := parsePubKey(str)
+		if err != nil {
+			return nil, err
+		}
+		admins = append(admins, pubKey.Wrap())
+	}
+
+	return admins, nil
+}
+
+// parsePubKey parses a hex-encoded Ed25519 public key.
+func parsePubKey(s string) (crypto.PubKeyEd25519, error) {
+	var pubKey crypto.PubKeyEd25519
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return pubKey, err
+	}
+	if len(b) != len(pubKey) {
+		return pubKey, fmt.Errorf("invalid public key length %d", len(b))
+	}
+	copy(pubKey[:], b)
+
+	return pubKey, nil
+}
+
+// checkRulesUpdate checks that a rules update is valid and returns the
+// rules it adopts.
+func (t *TMPop) checkRulesUpdate(u *RulesUpdate) (*Rules, *ABCIError) {
+	if u == nil || len(u.Rules) == 0 {
+		return nil, &ABCIError{
+			CodeTypeValidation,
+			"A rules update requires rules",
+		}
+	}
+
+	v, err := validator.NewRootValidatorFromJSON(u.Rules, true)
+	if err != nil {
+		return nil, &ABCIError{
+			CodeTypeValidation,
+			fmt.Sprintf("Invalid rules: %v", err),
+		}
+	}
+
+	return &Rules{
+		Height: t.currentHeader.GetHeight() + 1,
+		Hash:   v.Hash(),
+		Rules:  u.Rules,
+	}, nil
+}
+
+// checkRules checks a rules update.
+func (t *TMPop) checkRules(u *RulesUpdate) *ABCIError {
+	if _, err := t.checkRulesUpdate(u); !err.IsOK() {
+		return err
+	}
+	return t.rulesUpdates.check(t.kvDB, &u.AdminUpdate, u.Message(t.currentHeader.GetChainId()))
+}
+
+// deliverRules approves a rules update. The rules apply from the next block.
+func (t *TMPop) deliverRules(u *RulesUpdate) *ABCIError {
+	rules, err := t.checkRulesUpdate(u)
+	if !err.IsOK() {
+		return err
+	}
+	return t.rulesUpdates.approve(t.kvDB, &u.AdminUpdate, u.Message(t.currentHeader.GetChainId()), rules)
+}
+
+// saveRules saves the rules approved in the current block, which apply from
+// the next block.
+func (t *TMPop) saveRules() error {
+	saved, err := t.rulesUpdates.save(t.kvDB, t.currentHeader.Height+1)
+	if err != nil || saved == nil {
+		return err
+	}
+
+	t.nextValidator, err = validator.NewRootValidatorFromJSON(saved.(*Rules).Rules, true)
+	return err
+}
+
+// getRulesAt returns the rules adopted on chain that validate the block at
+// the given height, or nil if there are none. A negative height returns the
+// latest rules.
+func (t *TMPop) getRulesAt(height int64) (*Rules, error) {
+	rules := &Rules{}
+	found, err := getAtHeight(t.kvDB, rulesPrefix, height, rules)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return rules, nil
+}
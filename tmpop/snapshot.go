@@ -0,0 +1,444 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpop
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/merkle"
+	"github.com/stratumn/sdk/store"
+	"github.com/stratumn/sdk/types"
+	"github.com/stratumn/sdk/validator"
+)
+
+// SnapshotHeader describes the state of a TMPop node at a height.
+//
+// A snapshot is written as a JSON header followed by the segments of every
+// link committed, one JSON segment per line, in the order they were
+// committed.
+type SnapshotHeader struct {
+	LastBlock   *LastBlock       `json:"lastBlock"`
+	Blocks      []*SnapshotBlock `json:"blocks"`
+	Rules       []*Rules         `json:"rules"`
+	Validators  []*Validators    `json:"validators"`
+	Permissions []*Permissions   `json:"permissions"`
+}
+
+// SnapshotBlock contains what is needed to verify the app hash of a block.
+type SnapshotBlock struct {
+	Height          int64           `json:"height"`
+	PreviousAppHash *types.Bytes32  `json:"previousAppHash"`
+	AppHash         *types.Bytes32  `json:"appHash"`
+	ValidatorHash   *types.Bytes32  `json:"validatorHash"`
+	EvidencesHash   *types.Bytes32  `json:"evidencesHash,omitempty"`
+	LinkHashes      []types.Bytes32 `json:"linkHashes"`
+}
+
+// WriteSnapshot writes a snapshot of the state of the node at its last
+// block. It must not run while blocks are committed.
+//
+// The app hashes of the blocks committed before they were saved by height
+// are computed again from the saved validations hashes and link hashes.
+// A snapshot can't be written right after rules or permissions are adopted,
+// until the next block commits to them.
+func (t *TMPop) WriteSnapshot(w io.Writer) error {
+	header := &SnapshotHeader{LastBlock: t.lastBlock}
+
+	previousAppHash := types.NewBytes32FromBytes(nil)
+	for height := int64(1); height <= t.lastBlock.Height; height++ {
+		validatorHash, err := t.getValidatorHash(height)
+		if err != nil {
+			return err
+		}
+
+		linkHashes, err := t.getCommitLinkHashes(height)
+		if err != nil {
+			return err
+		}
+
+		hashes, err := t.getAppHashes(height)
+		if err != nil {
+			return err
+		}
+		if hashes == nil {
+			// Evidences were not part of the app hash then.
+			root, err := linksRoot(linkHashes)
+			if err != nil {
+				return err
+			}
+			appHash, err := ComputeAppHash(previousAppHash, validatorHash, root, nil)
+			if err != nil {
+				return err
+			}
+			hashes = &blockAppHashes{PreviousAppHash: previousAppHash, AppHash: appHash}
+		}
+		previousAppHash = hashes.AppHash
+
+		header.Blocks = append(header.Blocks, &SnapshotBlock{
+			Height:          height,
+			PreviousAppHash: hashes.PreviousAppHash,
+			AppHash:         hashes.AppHash,
+			ValidatorHash:   validatorHash,
+			EvidencesHash:   hashes.EvidencesHash,
+			LinkHashes:      linkHashes,
+		})
+	}
+
+	heights, err := getHeights(t.kvDB, rulesPrefix)
+	if err != nil {
+		return err
+	}
+	for _, height := range heights {
+		rules, err := t.getRulesAt(height)
+		if err != nil {
+			return err
+		}
+		header.Rules = append(header.Rules, rules)
+	}
+
+	if heights, err = getHeights(t.kvDB, validatorsPrefix); err != nil {
+		return err
+	}
+	for _, height := range heights {
+		validators, err := t.getValidatorsAt(height)
+		if err != nil {
+			return err
+		}
+		header.Validators = append(header.Validators, validators)
+	}
+
+	if heights, err = getHeights(t.kvDB, permissionsPrefix); err != nil {
+		return err
+	}
+	for _, height := range heights {
+		permissions, err := t.getPermissionsAt(height)
+		if err != nil {
+			return err
+		}
+		header.Permissions = append(header.Permissions, permissions)
+	}
+
+	if err := header.verify(fileValidatorHash(t.config)); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+
+	for _, block := range header.Blocks {
+		for i := range block.LinkHashes {
+			segment, err := t.adapter.GetSegment(&block.LinkHashes[i])
+			if err != nil {
+				return err
+			}
+			if segment == nil {
+				return fmt.Errorf("segment %s is missing", block.LinkHashes[i].String())
+			}
+			if err := enc.Encode(segment); err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// RestoreSnapshot restores the state of a node from a snapshot.
+// The adapter and key-value store must be empty.
+//
+// The app hashes of the blocks are verified up to the app hash of the last
+// block, as well as the hash of every link and the rules and permissions
+// validating every block. The blocks validated before rules were adopted on
+// chain are verified with the validator file of the configuration, which
+// must be the one the chain started with.
+//
+// The evidences of the segments and the Tendermint validator sets are
+// restored without verification: the snapshot doesn't say which block
+// delivered each evidence, and validator sets are not part of the app hash.
+// The Tendermint data directory, copied from the same node, holds the
+// validators in use.
+//
+// Since the last block comes from the snapshot itself, a snapshot rebuilt
+// with consistent hashes would pass these checks. The last block must
+// therefore match the trusted one, usually read from the state of the
+// Tendermint node, before anything is written.
+func RestoreSnapshot(a store.Adapter, kv store.KeyValueStore, r io.Reader, config *Config, trusted *LastBlock) error {
+	if trusted == nil || trusted.AppHash == nil {
+		return errors.New("cannot restore a snapshot without a trusted app hash")
+	}
+
+	initialized, err := kv.GetValue(tmpopLastBlockKey)
+	if err != nil {
+		return err
+	}
+	if initialized != nil {
+		return errors.New("cannot restore a snapshot in an existing db")
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	header := &SnapshotHeader{}
+	if err := dec.Decode(header); err != nil {
+		return err
+	}
+	if err := header.verify(fileValidatorHash(config)); err != nil {
+		return err
+	}
+	if header.LastBlock.Height != trusted.Height || *header.LastBlock.AppHash != *trusted.AppHash {
+		return fmt.Errorf("snapshot last block %d doesn't match the trusted block %d", header.LastBlock.Height, trusted.Height)
+	}
+
+	for _, block := range header.Blocks {
+		if err := restoreBlock(a, kv, dec, block); err != nil {
+			return err
+		}
+	}
+
+	for _, rules := range header.Rules {
+		if err := saveAtHeight(kv, rulesPrefix, rules.Height, rules); err != nil {
+			return err
+		}
+	}
+
+	for _, validators := range header.Validators {
+		if err := saveAtHeight(kv, validatorsPrefix, validators.Height, validators); err != nil {
+			return err
+		}
+	}
+
+	for _, permissions := range header.Permissions {
+		if err := saveAtHeight(kv, permissionsPrefix, permissions.Height, permissions); err != nil {
+			return err
+		}
+	}
+
+	// The last block is saved at the end so that a failed restore doesn't
+	// look like a valid db.
+	saveLastBlock(kv, *header.LastBlock)
+
+	return nil
+}
+
+// verify checks that the app hashes of the blocks are chained up to the app
+// hash of the last block, and that the rules and permissions lead to the
+// validations hash of every block. The given validator hash is the one of
+// the blocks validated before rules were adopted on chain.
+func (h *SnapshotHeader) verify(fileValidatorHash *types.Bytes32) error {
+	if h.LastBlock == nil || h.LastBlock.AppHash == nil {
+		return errors.New("snapshot has no last block")
+	}
+	if int64(len(h.Blocks)) != h.LastBlock.Height {
+		return fmt.Errorf("snapshot has %d blocks, want %d", len(h.Blocks), h.LastBlock.Height)
+	}
+	if err := h.verifyRules(); err != nil {
+		return err
+	}
+	if err := h.verifyPermissions(); err != nil {
+		return err
+	}
+
+	var rules *Rules
+	var permissions *Permissions
+	nextRules, nextPermissions := 0, 0
+
+	previousAppHash := types.NewBytes32FromBytes(nil)
+	for i, block := range h.Blocks {
+		if block.Height != int64(i+1) {
+			return fmt.Errorf("snapshot block %d has height %d", i+1, block.Height)
+		}
+		if block.PreviousAppHash == nil || block.AppHash == nil {
+			return fmt.Errorf("app hashes of block %d are missing", block.Height)
+		}
+		if i > 0 && *block.PreviousAppHash != *previousAppHash {
+			return fmt.Errorf("block %d doesn't follow the app hash of the previous block", block.Height)
+		}
+
+		for ; nextRules < len(h.Rules) && h.Rules[nextRules].Height <= block.Height; nextRules++ {
+			rules = h.Rules[nextRules]
+		}
+		for ; nextPermissions < len(h.Permissions) && h.Permissions[nextPermissions].Height <= block.Height; nextPermissions++ {
+			permissions = h.Permissions[nextPermissions]
+		}
+		validatorHash := fileValidatorHash
+		if rules != nil {
+			validatorHash = rules.Hash
+		}
+		if !equalHashes(validationsHash(validatorHash, permissions), block.ValidatorHash) {
+			return fmt.Errorf("rules and permissions don't match the validations of block %d", block.Height)
+		}
+
+		root, err := linksRoot(block.LinkHashes)
+		if err != nil {
+			return err
+		}
+		appHash, err := ComputeAppHash(block.PreviousAppHash, block.ValidatorHash, root, block.EvidencesHash)
+		if err != nil {
+			return err
+		}
+		if *appHash != *block.AppHash {
+			return fmt.Errorf("invalid app hash for block %d", block.Height)
+		}
+
+		previousAppHash = appHash
+	}
+
+	if len(h.Blocks) > 0 && *previousAppHash != *h.LastBlock.AppHash {
+		return errors.New("blocks don't lead to the app hash of the last block")
+	}
+
+	return nil
+}
+
+// verifyRules checks that the rules are sorted by height, validate committed
+// blocks and match their hash.
+func (h *SnapshotHeader) verifyRules() error {
+	var previousHeight int64
+	for _, rules := range h.Rules {
+		if rules == nil || rules.Height <= previousHeight {
+			return errors.New("snapshot rules are not sorted by height")
+		}
+		if rules.Height > h.LastBlock.Height {
+			return fmt.Errorf("rules of height %d are not committed yet", rules.Height)
+		}
+		previousHeight = rules.Height
+
+		v, err := validator.NewRootValidatorFromJSON(rules.Rules, true)
+		if err != nil {
+			return err
+		}
+		if !equalHashes(v.Hash(), rules.Hash) {
+			return fmt.Errorf("rules of height %d don't match their hash", rules.Height)
+		}
+	}
+
+	return nil
+}
+
+// verifyPermissions checks that the permissions are sorted by height and
+// validate committed blocks.
+func (h *SnapshotHeader) verifyPermissions() error {
+	var previousHeight int64
+	for _, permissions := range h.Permissions {
+		if permissions == nil || permissions.Height <= previousHeight {
+			return errors.New("snapshot permissions are not sorted by height")
+		}
+		if permissions.Height > h.LastBlock.Height {
+			return fmt.Errorf("permissions of height %d are not committed yet", permissions.Height)
+		}
+		previousHeight = permissions.Height
+	}
+
+	return nil
+}
+
+// fileValidatorHash returns the hash of the validator file of a
+// configuration, which validates blocks until rules are adopted on chain.
+func fileValidatorHash(config *Config) *types.Bytes32 {
+	if config == nil || config.ValidatorFilename == "" {
+		return nil
+	}
+	return validator.NewRootValidator(config.ValidatorFilename, true).Hash()
+}
+
+// linksRoot returns the root of the Merkle tree of the links of a block, or
+// nil if there are none.
+func linksRoot(linkHashes []types.Bytes32) (*types.Bytes32, error) {
+	if len(linkHashes) == 0 {
+		return nil, nil
+	}
+
+	tree, err := merkle.NewStaticTree(linkHashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree.Root(), nil
+}
+
+// equalHashes tells whether two hashes are both missing or equal.
+func equalHashes(a, b *types.Bytes32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// restoreBlock saves the segments and the key-value entries of a block.
+func restoreBlock(a store.Adapter, kv store.KeyValueStore, dec *json.Decoder, block *SnapshotBlock) error {
+	heightValue := []byte(strconv.FormatInt(block.Height, 10))
+
+	for i := range block.LinkHashes {
+		linkHash := &block.LinkHashes[i]
+
+		segment := &cs.Segment{}
+		if err := dec.Decode(segment); err != nil {
+			return err
+		}
+		segmentLinkHash, err := segment.Link.Hash()
+		if err != nil {
+			return err
+		}
+		if *segmentLinkHash != *linkHash {
+			return fmt.Errorf("snapshot segment %s is not link %s of block %d", segmentLinkHash.String(), linkHash.String(), block.Height)
+		}
+
+		if _, err := a.CreateLink(&segment.Link); err != nil {
+			return err
+		}
+		for _, evidence := range segment.Meta.Evidences {
+			if err := a.AddEvidence(linkHash, evidence); err != nil {
+				return err
+			}
+		}
+		if err := kv.SetValue(getLinkHeightKey(linkHash), heightValue); err != nil {
+			return err
+		}
+	}
+
+	if len(block.LinkHashes) > 0 {
+		value, err := json.Marshal(block.LinkHashes)
+		if err != nil {
+			return err
+		}
+		if err := kv.SetValue(getCommitLinkHashesKey(block.Height), value); err != nil {
+			return err
+		}
+	}
+
+	if block.ValidatorHash != nil {
+		if err := kv.SetValue(getValidatorHashKey(block.Height), block.ValidatorHash[:]); err != nil {
+			return err
+		}
+	}
+
+	value, err := json.Marshal(blockAppHashes{
+		PreviousAppHash: block.PreviousAppHash,
+		AppHash:         block.AppHash,
+		EvidencesHash:   block.EvidencesHash,
+	})
+	if err != nil {
+		return err
+	}
+
+	return kv.SetValue(getAppHashesKey(block.Height), value)
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/stratumn/sdk/store"
 	"github.com/stratumn/sdk/types"
 	"github.com/stratumn/sdk/validator"
+	"github.com/tendermint/go-crypto"
 )
 
 // State represents the app states, separating the committed state (for queries)
@@ -35,10 +36,34 @@ type State struct {
 	// be updated.
 	validator validator.Validator
 
+	// The permissions restricting who can create links, updated like the
+	// validator.
+	permissions *Permissions
+
+	// Whether to skip the verification of the proofs of external
+	// evidences.
+	skipEvidenceVerification bool
+
+	// The keys allowed to add evidences, by provider.
+	evidenceProviders map[string][]crypto.PubKey
+
+	// The hash of the evidences of the last committed block, nil if there
+	// were none.
+	evidencesHash *types.Bytes32
+
 	adapter            store.Adapter
 	deliveredLinks     store.Batch
 	deliveredLinksList []*cs.Link
 	checkedLinks       store.Batch
+
+	deliveredEvidences []*linkEvidence
+	checkedEvidences   []*linkEvidence
+}
+
+// linkEvidence is an external evidence of a link.
+type linkEvidence struct {
+	linkHash *types.Bytes32
+	evidence *cs.Evidence
 }
 
 // NewState creates a new State.
@@ -73,8 +98,119 @@ func (s *State) Deliver(link *cs.Link) *ABCIError {
 	return res
 }
 
+// CheckEvidence checks if adding this evidence is a valid operation
+func (s *State) CheckEvidence(linkHash *types.Bytes32, evidence *cs.Evidence, sig *Signature) *ABCIError {
+	res := s.checkEvidence(linkHash, evidence, sig, s.checkedLinks, s.checkedEvidences)
+	if res.IsOK() {
+		s.checkedEvidences = append(s.checkedEvidences, &linkEvidence{linkHash, evidence})
+	}
+	return res
+}
+
+// DeliverEvidence adds an evidence to the list of evidences to be committed
+func (s *State) DeliverEvidence(linkHash *types.Bytes32, evidence *cs.Evidence, sig *Signature) *ABCIError {
+	res := s.checkEvidence(linkHash, evidence, sig, s.deliveredLinks, s.deliveredEvidences)
+	if res.IsOK() {
+		s.deliveredEvidences = append(s.deliveredEvidences, &linkEvidence{linkHash, evidence})
+	}
+	return res
+}
+
+// checkEvidence checks that an evidence is signed by its provider, that it
+// references an existing link, that its provider didn't already produce an
+// evidence for the link and that its proof is valid.
+func (s *State) checkEvidence(linkHash *types.Bytes32, evidence *cs.Evidence, sig *Signature, batch store.Batch, pending []*linkEvidence) *ABCIError {
+	if linkHash == nil || evidence == nil {
+		return &ABCIError{
+			CodeTypeValidation,
+			"An evidence transaction requires a link hash and an evidence",
+		}
+	}
+	if evidence.Provider == "" {
+		return &ABCIError{
+			CodeTypeValidation,
+			"Evidence provider cannot be empty",
+		}
+	}
+	if err := authorizeEvidence(s.evidenceProviders, linkHash, evidence, sig); err != nil {
+		return &ABCIError{
+			CodeTypeForbidden,
+			fmt.Sprintf("Evidence not authorized for link %x: %v", *linkHash, err),
+		}
+	}
+
+	segment, err := batch.GetSegment(linkHash)
+	if err != nil {
+		return &ABCIError{
+			CodeTypeInternalError,
+			err.Error(),
+		}
+	}
+	if segment == nil {
+		return &ABCIError{
+			CodeTypeValidation,
+			fmt.Sprintf("Evidence references unknown link %x", *linkHash),
+		}
+	}
+
+	evidences, err := s.adapter.GetEvidences(linkHash)
+	if err != nil {
+		return &ABCIError{
+			CodeTypeInternalError,
+			err.Error(),
+		}
+	}
+	duplicate := evidences != nil && evidences.GetEvidence(evidence.Provider) != nil
+	for _, e := range pending {
+		if *e.linkHash == *linkHash && e.evidence.Provider == evidence.Provider {
+			duplicate = true
+		}
+	}
+	if duplicate {
+		return &ABCIError{
+			CodeTypeValidation,
+			fmt.Sprintf("Link %x already has an evidence from provider %s", *linkHash, evidence.Provider),
+		}
+	}
+
+	if !s.skipEvidenceVerification {
+		if err := verifyEvidence(linkHash, evidence); err != nil {
+			return &ABCIError{
+				CodeTypeValidation,
+				fmt.Sprintf("Evidence of link %x and provider %s refused: %v", *linkHash, evidence.Provider, err),
+			}
+		}
+	}
+
+	return nil
+}
+
 func (s *State) checkLinkAndAddToBatch(link *cs.Link, batch store.Batch) *ABCIError {
-	err := link.Validate(batch.GetSegment)
+	linkHash, err := link.Hash()
+	if err != nil {
+		return &ABCIError{
+			CodeTypeValidation,
+			fmt.Sprintf("Link hash failed %v: %v", link, err),
+		}
+	}
+
+	// The batch contains both the committed links and the links of the
+	// current block.
+	existing, err := batch.GetSegment(linkHash)
+	if err != nil {
+		return &ABCIError{
+			CodeTypeInternalError,
+			err.Error(),
+		}
+	}
+	if existing != nil {
+		return &ABCIError{
+			CodeTypeDuplicate,
+			fmt.Sprintf("Link %s already exists", linkHash.String()),
+		}
+	}
+
+	err = link.Validate(batch.GetSegment)
 	if err != nil {
 		return &ABCIError{
 			CodeTypeValidation,
@@ -82,6 +218,13 @@ func (s *State) checkLinkAndAddToBatch(link *cs.Link, batch store.Batch) *ABCIEr
 		}
 	}
 
+	if err := s.permissions.authorize(link); err != nil {
+		return &ABCIError{
+			CodeTypeForbidden,
+			fmt.Sprintf("Link not authorized %v: %v", link, err),
+		}
+	}
+
 	if s.validator != nil {
 		err = s.validator.Validate(batch, link)
 		if err != nil {
@@ -102,22 +245,39 @@ func (s *State) checkLinkAndAddToBatch(link *cs.Link, batch store.Batch) *ABCIEr
 	return nil
 }
 
-// Commit commits the delivered links,
+// Commit commits the delivered links and evidences,
 // resets delivered and checked state,
-// and returns the hash for the commit
-// and the list of committed links.
-func (s *State) Commit() (*types.Bytes32, []*cs.Link, error) {
-	appHash, err := s.computeAppHash()
+// and returns the hash for the commit,
+// the list of committed links and the committed evidences.
+func (s *State) Commit() (*types.Bytes32, []*cs.Link, map[*types.Bytes32]*cs.Evidence, error) {
+	evidencesHash, err := hashEvidences(s.deliveredEvidences)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+	appHash, err := s.computeAppHash(evidencesHash)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	if err := s.deliveredLinks.Write(); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+
+	// Evidences are added once the links are written since they can
+	// reference links delivered in the same block.
+	committedEvidences := make(map[*types.Bytes32]*cs.Evidence, len(s.deliveredEvidences))
+	for _, e := range s.deliveredEvidences {
+		if err := s.adapter.AddEvidence(e.linkHash, e.evidence); err != nil {
+			return nil, nil, nil, err
+		}
+		committedEvidences[e.linkHash] = e.evidence
 	}
+	s.deliveredEvidences = nil
+	s.checkedEvidences = nil
+	s.evidencesHash = evidencesHash
 
 	if s.deliveredLinks, err = s.adapter.NewBatch(); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	s.checkedLinks = bufferedbatch.NewBatch(s.adapter)
 
@@ -125,14 +285,38 @@ func (s *State) Commit() (*types.Bytes32, []*cs.Link, error) {
 	copy(committedLinks, s.deliveredLinksList)
 	s.deliveredLinksList = nil
 
-	return appHash, committedLinks, nil
+	return appHash, committedLinks, committedEvidences, nil
 }
 
-func (s *State) computeAppHash() (*types.Bytes32, error) {
+// validationsHash returns the hash of the validator, combined with the hash
+// of the permissions when there are some.
+func (s *State) validationsHash() *types.Bytes32 {
 	var validatorHash *types.Bytes32
 	if s.validator != nil {
 		validatorHash = s.validator.Hash()
 	}
+	return validationsHash(validatorHash, s.permissions)
+}
+
+// validationsHash combines the hash of a validator with the hash of
+// permissions, or returns the hash of the validator when there are none.
+func validationsHash(validatorHash *types.Bytes32, permissions *Permissions) *types.Bytes32 {
+	if permissions == nil {
+		return validatorHash
+	}
+
+	if validatorHash == nil {
+		validatorHash = &types.Bytes32{}
+	}
+	hash := sha256.New()
+	hash.Write(validatorHash[:])
+	hash.Write(permissions.Hash()[:])
+
+	return types.NewBytes32FromBytes(hash.Sum(nil))
+}
+
+func (s *State) computeAppHash(evidencesHash *types.Bytes32) (*types.Bytes32, error) {
+	validatorHash := s.validationsHash()
 
 	var merkleRoot *types.Bytes32
 	if len(s.deliveredLinksList) > 0 {
@@ -150,13 +334,15 @@ func (s *State) computeAppHash() (*types.Bytes32, error) {
 		merkleRoot = merkle.Root()
 	}
 
-	return ComputeAppHash(s.previousAppHash, validatorHash, merkleRoot)
+	return ComputeAppHash(s.previousAppHash, validatorHash, merkleRoot, evidencesHash)
 }
 
 // ComputeAppHash computes the app hash from its required parts
 // If one of the parts is nil or empty, we'll pad with 0s so that
-// we always hash a 96-bytes array
-func ComputeAppHash(previous *types.Bytes32, validator *types.Bytes32, root *types.Bytes32) (*types.Bytes32, error) {
+// we always hash a 96-bytes array.
+// The hash of the evidences is only appended when the block delivered
+// evidences, so blocks without evidences keep the same app hash.
+func ComputeAppHash(previous *types.Bytes32, validator *types.Bytes32, root *types.Bytes32, evidences *types.Bytes32) (*types.Bytes32, error) {
 	hash := sha256.New()
 
 	if previous == nil {
@@ -180,6 +366,12 @@ func ComputeAppHash(previous *types.Bytes32, validator *types.Bytes32, root *typ
 		return nil, err
 	}
 
+	if evidences != nil {
+		if _, err := hash.Write(evidences[:]); err != nil {
+			return nil, err
+		}
+	}
+
 	appHash := hash.Sum(nil)
 	var appHash32 types.Bytes32
 	copy(appHash32[:], appHash)
@@ -65,10 +65,13 @@ func (c *TendermintClientWrapper) Block(height int) *Block {
 
 	for _, tx := range previousBlock.Block.Txs {
 		tmTx, err := unmarshallTx(tx)
-		if !err.IsOK() || tmTx.TxType != CreateLink {
+		if !err.IsOK() {
 			log.Warn("Could not unmarshall previous block Tx. Evidence will not be created.")
 			continue
 		}
+		if tmTx.TxType != CreateLink {
+			continue
+		}
 
 		block.Txs = append(block.Txs, tmTx)
 	}
@@ -15,6 +15,7 @@
 package tmpop
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 
@@ -26,6 +27,7 @@ import (
 	"github.com/stratumn/sdk/types"
 	"github.com/stratumn/sdk/validator"
 	abci "github.com/tendermint/abci/types"
+	"github.com/tendermint/go-crypto"
 )
 
 // tmpopLastBlockKey is the database key where last block information are saved.
@@ -55,8 +57,49 @@ type Config struct {
 	// A git commit hash that will be set in the store's information.
 	Commit string
 
-	// JSON schema rules definition
+	// JSON schema rules definition, used until rules are adopted on chain.
 	ValidatorFilename string
+
+	// The public keys of the administrators allowed to update the
+	// validation rules. Rules can't be updated when empty.
+	RulesAdmins []crypto.PubKey
+
+	// The number of administrator signatures required to update the
+	// validation rules. Zero requires all the administrators.
+	RulesApprovals int
+
+	// The public keys of the administrators allowed to update the
+	// Tendermint validators. Validators can't be updated when empty.
+	ValidatorsAdmins []crypto.PubKey
+
+	// The number of administrator signatures required to update the
+	// Tendermint validators. Zero requires all the administrators.
+	ValidatorsApprovals int
+
+	// The public keys of the administrators allowed to update the
+	// permissions of processes. Permissions can't be updated when empty.
+	PermissionsAdmins []crypto.PubKey
+
+	// The number of administrator signatures required to update the
+	// permissions of processes. Zero requires all the administrators.
+	PermissionsApprovals int
+
+	// Whether to skip the verification of the proofs of the evidences
+	// added by transactions. Evidences must still reference an existing
+	// link. Evidences of backends whose proofs can't be verified by TMPop,
+	// such as OpenTimestamps proofs, are only accepted when it is set.
+	SkipEvidenceVerification bool
+
+	// The root certificates of the timestamp authorities trusted to sign
+	// the proofs of TSA batch evidences, registered with
+	// evidences.RegisterTSARoots. TSA batch evidences are refused when
+	// there are none, unless evidence verification is skipped.
+	TSARoots *x509.CertPool
+
+	// The public keys allowed to add evidences by transactions, by
+	// provider. An evidence must be signed by one of the keys of its
+	// provider, evidences of other providers are refused.
+	EvidenceProviders map[string][]crypto.PubKey
 }
 
 // TMPop is the type of the application that implements github.com/tendermint/abci/types.Application,
@@ -71,7 +114,18 @@ type TMPop struct {
 	config        *Config
 	currentHeader *abci.Header
 	tmClient      TendermintClient
+	options       *Options
 	eventsManager eventsManager
+	nextValidator validator.Validator
+
+	rulesUpdates       *adminUpdates
+	validatorsUpdates  *adminUpdates
+	permissionsUpdates *adminUpdates
+
+	// The validator changes approved in the current block.
+	validatorChanges []*abci.Validator
+
+	nextPermissions *Permissions
 }
 
 const (
@@ -107,15 +161,57 @@ func New(a store.Adapter, kv store.KeyValueStore, config *Config) (*TMPop, error
 	if err != nil {
 		return nil, err
 	}
+	s.skipEvidenceVerification = config.SkipEvidenceVerification
+	if config.TSARoots != nil {
+		evidences.RegisterTSARoots(config.TSARoots)
+	}
+	s.evidenceProviders = config.EvidenceProviders
 
-	return &TMPop{
+	t := &TMPop{
 		state:         s,
 		adapter:       a,
 		kvDB:          kv,
 		lastBlock:     lastBlock,
 		config:        config,
 		currentHeader: lastBlock.LastHeader,
-	}, nil
+		options:       newOptions(),
+		rulesUpdates: &adminUpdates{
+			name:      "Rules",
+			prefix:    rulesPrefix,
+			admins:    config.RulesAdmins,
+			approvals: config.RulesApprovals,
+		},
+		validatorsUpdates: &adminUpdates{
+			name:      "Validators",
+			prefix:    validatorsPrefix,
+			admins:    config.ValidatorsAdmins,
+			approvals: config.ValidatorsApprovals,
+		},
+		permissionsUpdates: &adminUpdates{
+			name:      "Permissions",
+			prefix:    permissionsPrefix,
+			admins:    config.PermissionsAdmins,
+			approvals: config.PermissionsApprovals,
+		},
+	}
+
+	rules, err := t.getRulesAt(-1)
+	if err != nil {
+		return nil, err
+	}
+	if rules != nil {
+		if s.validator, err = validator.NewRootValidatorFromJSON(rules.Rules, true); err != nil {
+			return nil, err
+		}
+	} else if config.ValidatorFilename != "" {
+		s.validator = validator.NewRootValidator(config.ValidatorFilename, true)
+	}
+
+	if s.permissions, err = t.getPermissionsAt(-1); err != nil {
+		return nil, err
+	}
+
+	return t, nil
 }
 
 // ConnectTendermint connects TMPoP to a Tendermint node
@@ -143,11 +239,28 @@ func (t *TMPop) Info(req abci.RequestInfo) abci.ResponseInfo {
 }
 
 // SetOption implements github.com/tendermint/abci/types.Application.SetOption.
+// It changes the runtime options of the node, see Options.
 func (t *TMPop) SetOption(req abci.RequestSetOption) abci.ResponseSetOption {
-	return abci.ResponseSetOption{
-		Code: CodeTypeNotImplemented,
-		Log:  "No options are supported yet",
+	if err := t.options.set(req.Key, req.Value); !err.IsOK() {
+		return abci.ResponseSetOption{
+			Code: err.Code,
+			Log:  err.Log,
+		}
 	}
+
+	log.Infof("Option %s set to %s", req.Key, req.Value)
+
+	return abci.ResponseSetOption{}
+}
+
+// InitChain implements github.com/tendermint/abci/types.Application.InitChain.
+// It saves the genesis validators.
+func (t *TMPop) InitChain(req abci.RequestInitChain) abci.ResponseInitChain {
+	if err := t.saveGenesisValidators(req.Validators); err != nil {
+		log.Errorf("Could not save genesis validators: %v", err)
+	}
+
+	return abci.ResponseInitChain{}
 }
 
 // BeginBlock implements github.com/tendermint/abci/types.Application.BeginBlock.
@@ -163,18 +276,23 @@ func (t *TMPop) BeginBlock(req abci.RequestBeginBlock) abci.ResponseBeginBlock {
 	// This AppHash will never be denied in a future block so we can add
 	// evidence to the links that were added in the previous blocks.
 	if t.lastBlock.AppHash.EqualsBytes(t.currentHeader.AppHash) {
-		t.addTendermintEvidence(req.Header)
+		if t.options.GenerateEvidence {
+			t.addTendermintEvidence(req.Header)
+		}
 	} else {
 		log.Warnf("Unexpected AppHash in BeginBlock, got %x, expected %x",
 			t.currentHeader.AppHash,
 			*t.lastBlock.AppHash)
 	}
 
-	// TODO: we don't need to re-load the file for each block, it's expensive.
-	// We should improve this and only reload when a config update was committed.
-	if t.config.ValidatorFilename != "" {
-		rootValidator := validator.NewRootValidator(t.config.ValidatorFilename, true)
-		t.state.validator = rootValidator
+	// Rules adopted in the previous block validate this block.
+	if t.nextValidator != nil {
+		t.state.validator = t.nextValidator
+		t.nextValidator = nil
+	}
+	if t.nextPermissions != nil {
+		t.state.permissions = t.nextPermissions
+		t.nextPermissions = nil
 	}
 
 	t.state.previousAppHash = types.NewBytes32FromBytes(t.currentHeader.AppHash)
@@ -184,7 +302,13 @@ func (t *TMPop) BeginBlock(req abci.RequestBeginBlock) abci.ResponseBeginBlock {
 
 // DeliverTx implements github.com/tendermint/abci/types.Application.DeliverTx.
 func (t *TMPop) DeliverTx(tx []byte) abci.ResponseDeliverTx {
-	err := t.doTx(t.state.Deliver, tx)
+	err := t.doTx(&txHandlers{
+		createLink:        t.state.Deliver,
+		addEvidence:       t.state.DeliverEvidence,
+		updateRules:       t.deliverRules,
+		updateValidators:  t.deliverValidators,
+		updatePermissions: t.deliverPermissions,
+	}, tx)
 	if !err.IsOK() {
 		return abci.ResponseDeliverTx{
 			Code: err.Code,
@@ -197,7 +321,13 @@ func (t *TMPop) DeliverTx(tx []byte) abci.ResponseDeliverTx {
 
 // CheckTx implements github.com/tendermint/abci/types.Application.CheckTx.
 func (t *TMPop) CheckTx(tx []byte) abci.ResponseCheckTx {
-	err := t.doTx(t.state.Check, tx)
+	err := t.doTx(&txHandlers{
+		createLink:        t.state.Check,
+		addEvidence:       t.state.CheckEvidence,
+		updateRules:       t.checkRules,
+		updateValidators:  t.checkValidators,
+		updatePermissions: t.checkPermissions,
+	}, tx)
 	if !err.IsOK() {
 		return abci.ResponseCheckTx{
 			Code: err.Code,
@@ -208,10 +338,18 @@ func (t *TMPop) CheckTx(tx []byte) abci.ResponseCheckTx {
 	return abci.ResponseCheckTx{}
 }
 
+// EndBlock implements github.com/tendermint/abci/types.Application.EndBlock.
+// It returns the changes of validators approved in the block.
+func (t *TMPop) EndBlock(req abci.RequestEndBlock) abci.ResponseEndBlock {
+	return abci.ResponseEndBlock{
+		ValidatorUpdates: t.validatorChanges,
+	}
+}
+
 // Commit implements github.com/tendermint/abci/types.Application.Commit.
 // It actually commits the current state in the Store.
 func (t *TMPop) Commit() abci.ResponseCommit {
-	appHash, links, err := t.state.Commit()
+	appHash, links, evidences, err := t.state.Commit()
 	if err != nil {
 		return abci.ResponseCommit{
 			Code: CodeTypeInternalError,
@@ -233,7 +371,49 @@ func (t *TMPop) Commit() abci.ResponseCommit {
 		}
 	}
 
+	if err := t.saveLinkHeights(links); err != nil {
+		return abci.ResponseCommit{
+			Code: CodeTypeInternalError,
+			Log:  err.Error(),
+		}
+	}
+
+	if err := t.saveAppHashes(appHash); err != nil {
+		return abci.ResponseCommit{
+			Code: CodeTypeInternalError,
+			Log:  err.Error(),
+		}
+	}
+
+	if err := t.saveRules(); err != nil {
+		return abci.ResponseCommit{
+			Code: CodeTypeInternalError,
+			Log:  err.Error(),
+		}
+	}
+
+	if err := t.saveValidators(); err != nil {
+		return abci.ResponseCommit{
+			Code: CodeTypeInternalError,
+			Log:  err.Error(),
+		}
+	}
+
+	if err := t.savePermissions(); err != nil {
+		return abci.ResponseCommit{
+			Code: CodeTypeInternalError,
+			Log:  err.Error(),
+		}
+	}
+
 	t.eventsManager.AddSavedLinks(links)
+	t.eventsManager.AddSavedEvidences(evidences)
+	if err := t.eventsManager.Commit(t.kvDB, t.currentHeader.Height); err != nil {
+		return abci.ResponseCommit{
+			Code: CodeTypeInternalError,
+			Log:  err.Error(),
+		}
+	}
 
 	t.lastBlock.AppHash = appHash
 	t.lastBlock.Height = t.currentHeader.Height
@@ -246,13 +426,29 @@ func (t *TMPop) Commit() abci.ResponseCommit {
 }
 
 // Query implements github.com/tendermint/abci/types.Application.Query.
+//
+// GetSegment, FindSegments, GetMapIDs, GetRules, GetValidators and
+// GetPermissions can be made at a past height by setting the height of the
+// request. Other queries only support the latest commit. The cost of
+// FindSegments and GetMapIDs at a past height grows with the number of links
+// committed since that height.
+//
+// GetOptions returns the runtime options of the node, which are changed with
+// SetOption.
+//
+// When the request asks for a proof, GetSegment and FindSegments return the
+// proofs that their segments were committed, see LinkProof.
 func (t *TMPop) Query(reqQuery abci.RequestQuery) (resQuery abci.ResponseQuery) {
-	if reqQuery.Height != 0 {
+	if reqQuery.Height < 0 || reqQuery.Height > t.lastBlock.Height {
 		resQuery.Code = CodeTypeInternalError
-		resQuery.Log = "tmpop only supports queries on latest commit"
+		resQuery.Log = fmt.Sprintf("tmpop has no commit at height %d", reqQuery.Height)
 		return
 	}
 
+	if reqQuery.Height != 0 && reqQuery.Height != t.lastBlock.Height {
+		return t.queryAt(reqQuery)
+	}
+
 	resQuery.Height = t.lastBlock.Height
 
 	var err error
@@ -283,6 +479,8 @@ func (t *TMPop) Query(reqQuery abci.RequestQuery) (resQuery abci.ResponseQuery)
 		result, err = t.adapter.GetEvidences(linkHash)
 
 	case AddEvidence:
+		log.Warn("The AddEvidence query is deprecated and will be removed, use an AddEvidenceTx transaction instead")
+
 		evidence := &struct {
 			LinkHash *types.Bytes32
 			Evidence *cs.Evidence
@@ -302,6 +500,7 @@ func (t *TMPop) Query(reqQuery abci.RequestQuery) (resQuery abci.ResponseQuery)
 		if err = json.Unmarshal(reqQuery.Data, filter); err != nil {
 			break
 		}
+		t.options.limit(&filter.Pagination)
 
 		result, err = t.adapter.FindSegments(filter)
 
@@ -310,17 +509,103 @@ func (t *TMPop) Query(reqQuery abci.RequestQuery) (resQuery abci.ResponseQuery)
 		if err = json.Unmarshal(reqQuery.Data, filter); err != nil {
 			break
 		}
+		t.options.limit(&filter.Pagination)
 
 		result, err = t.adapter.GetMapIDs(filter)
 
-	case PendingEvents:
-		result = t.eventsManager.GetPendingEvents()
+	case GetEvents:
+		filter := &EventsFilter{}
+		if err = json.Unmarshal(reqQuery.Data, filter); err != nil {
+			break
+		}
+
+		result, err = t.eventsManager.GetEvents(t.kvDB, filter, t.lastBlock.Height)
+
+	case GetRules:
+		result, err = t.getRulesAt(-1)
+
+	case GetValidators:
+		result, err = t.getValidatorsAt(-1)
+
+	case GetPermissions:
+		result, err = t.getPermissionsAt(-1)
+
+	case GetOptions:
+		result = t.options
 
 	default:
 		resQuery.Code = CodeTypeNotImplemented
 		resQuery.Log = fmt.Sprintf("Unexpected Query path: %v", reqQuery.Path)
 	}
 
+	if err == nil && reqQuery.Prove {
+		resQuery.Proof, err = t.proveResult(result)
+	}
+
+	setQueryResult(&resQuery, result, err)
+
+	return
+}
+
+// queryAt handles queries made at a past height.
+// Segments whose links were committed after that height are excluded.
+func (t *TMPop) queryAt(reqQuery abci.RequestQuery) (resQuery abci.ResponseQuery) {
+	resQuery.Height = reqQuery.Height
+
+	var err error
+	var result interface{}
+
+	switch reqQuery.Path {
+	case GetSegment:
+		linkHash := &types.Bytes32{}
+		if err = linkHash.UnmarshalJSON(reqQuery.Data); err != nil {
+			break
+		}
+
+		result, err = t.getSegmentAt(linkHash, reqQuery.Height)
+
+	case FindSegments:
+		filter := &store.SegmentFilter{}
+		if err = json.Unmarshal(reqQuery.Data, filter); err != nil {
+			break
+		}
+		t.options.limit(&filter.Pagination)
+
+		result, err = t.findSegmentsAt(filter, reqQuery.Height)
+
+	case GetMapIDs:
+		filter := &store.MapFilter{}
+		if err = json.Unmarshal(reqQuery.Data, filter); err != nil {
+			break
+		}
+		t.options.limit(&filter.Pagination)
+
+		result, err = t.getMapIDsAt(filter, reqQuery.Height)
+
+	case GetRules:
+		result, err = t.getRulesAt(reqQuery.Height)
+
+	case GetValidators:
+		result, err = t.getValidatorsAt(reqQuery.Height)
+
+	case GetPermissions:
+		result, err = t.getPermissionsAt(reqQuery.Height)
+
+	default:
+		resQuery.Code = CodeTypeNotImplemented
+		resQuery.Log = fmt.Sprintf("Query path %v only supports the latest commit", reqQuery.Path)
+	}
+
+	if err == nil && reqQuery.Prove {
+		resQuery.Proof, err = t.proveResult(result)
+	}
+
+	setQueryResult(&resQuery, result, err)
+
+	return
+}
+
+func setQueryResult(resQuery *abci.ResponseQuery, result interface{}, err error) {
 	if err != nil {
 		resQuery.Code = CodeTypeInternalError
 		resQuery.Log = err.Error()
@@ -336,11 +621,19 @@ func (t *TMPop) Query(reqQuery abci.RequestQuery) (resQuery abci.ResponseQuery)
 
 		resQuery.Value = resBytes
 	}
+}
 
-	return
+// txHandlers are the functions handling each type of transaction, either
+// when checking or when delivering transactions.
+type txHandlers struct {
+	createLink        func(*cs.Link) *ABCIError
+	addEvidence       func(*types.Bytes32, *cs.Evidence, *Signature) *ABCIError
+	updateRules       func(*RulesUpdate) *ABCIError
+	updateValidators  func(*ValidatorsUpdate) *ABCIError
+	updatePermissions func(*PermissionsUpdate) *ABCIError
 }
 
-func (t *TMPop) doTx(createLink func(*cs.Link) *ABCIError, txBytes []byte) *ABCIError {
+func (t *TMPop) doTx(handlers *txHandlers, txBytes []byte) *ABCIError {
 	if len(txBytes) == 0 {
 		return &ABCIError{
 			CodeTypeValidation,
@@ -355,7 +648,15 @@ func (t *TMPop) doTx(createLink func(*cs.Link) *ABCIError, txBytes []byte) *ABCI
 
 	switch tx.TxType {
 	case CreateLink:
-		return createLink(tx.Link)
+		return handlers.createLink(tx.Link)
+	case AddEvidenceTx:
+		return handlers.addEvidence(tx.LinkHash, tx.Evidence, tx.Signature)
+	case UpdateRules:
+		return handlers.updateRules(tx.RulesUpdate)
+	case UpdateValidators:
+		return handlers.updateValidators(tx.ValidatorsUpdate)
+	case UpdatePermissions:
+		return handlers.updatePermissions(tx.PermissionsUpdate)
 	default:
 		return &ABCIError{
 			CodeTypeNotImplemented,
@@ -407,7 +708,19 @@ func (t *TMPop) addTendermintEvidence(header *abci.Header) {
 
 	merkleRoot := merkle.Root()
 
-	appHash, err := ComputeAppHash(previousAppHash, validatorHash, merkleRoot)
+	// Blocks committed before app hashes were saved have no evidences in
+	// their app hash.
+	hashes, err := t.getAppHashes(height)
+	if err != nil {
+		log.Warn("Could not get app hashes for this block.\nEvidence will not be generated.")
+		return
+	}
+	var evidencesHash *types.Bytes32
+	if hashes != nil {
+		evidencesHash = hashes.EvidencesHash
+	}
+
+	appHash, err := ComputeAppHash(previousAppHash, validatorHash, merkleRoot, evidencesHash)
 	if err != nil {
 		log.Warn("Could not compute app hash.\nEvidence will not be generated.")
 		return
@@ -439,6 +752,7 @@ func (t *TMPop) addTendermintEvidence(header *abci.Header) {
 					Root:            merkleRoot,
 					Path:            merkle.Path(position),
 					ValidationsHash: validatorHash,
+					EvidencesHash:   evidencesHash,
 					Header:          *block.Header,
 					NextHeader:      *header,
 				},
@@ -0,0 +1,145 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpoptestcases
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stratumn/sdk/tmpop"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/go-crypto"
+)
+
+// TestAdminUpdates tests the approval of the updates signed by
+// administrators, shared by rules, validators and permissions updates.
+// Permissions updates are used since they have no other requirement.
+func (f Factory) TestAdminUpdates(t *testing.T) {
+	admin1 := crypto.GenPrivKeyEd25519().Wrap()
+	admin2 := crypto.GenPrivKeyEd25519().Wrap()
+	stranger := crypto.GenPrivKeyEd25519().Wrap()
+
+	h, req := f.newTMPop(t, &tmpop.Config{
+		RulesAdmins:          []crypto.PubKey{admin1.PubKey(), admin2.PubKey()},
+		RulesApprovals:       2,
+		PermissionsAdmins:    []crypto.PubKey{admin1.PubKey(), admin2.PubKey()},
+		PermissionsApprovals: 2,
+	})
+	defer f.free()
+
+	open := map[string]*tmpop.ProcessPermissions{}
+	closed := map[string]*tmpop.ProcessPermissions{
+		"testProcess": {Signers: []string{pubKeyHex(admin1)}},
+	}
+
+	newUpdate := func(previousHeight int64, processes map[string]*tmpop.ProcessPermissions, signers ...crypto.PrivKey) []byte {
+		u := &tmpop.PermissionsUpdate{
+			AdminUpdate: tmpop.AdminUpdate{PreviousHeight: previousHeight},
+			Processes:   processes,
+		}
+		for _, signer := range signers {
+			u.Sign(chainID, signer)
+		}
+		return makeUpdatePermissionsTx(t, u)
+	}
+
+	t.Run("Rejects updates without enough signatures", func(t *testing.T) {
+		res := h.CheckTx(newUpdate(0, closed, admin1))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Ignores signatures of unknown keys", func(t *testing.T) {
+		res := h.CheckTx(newUpdate(0, closed, admin1, stranger))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Ignores duplicate signatures", func(t *testing.T) {
+		res := h.CheckTx(newUpdate(0, closed, admin1, admin1))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Rejects updates of another height", func(t *testing.T) {
+		res := h.CheckTx(newUpdate(1, closed, admin1, admin2))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Rejects signatures of another kind of update", func(t *testing.T) {
+		processes, _ := json.Marshal(closed)
+		rulesUpdate := &tmpop.RulesUpdate{Rules: processes}
+		rulesUpdate.Sign(chainID, admin1)
+		rulesUpdate.Sign(chainID, admin2)
+
+		u := &tmpop.PermissionsUpdate{AdminUpdate: rulesUpdate.AdminUpdate, Processes: closed}
+		res := h.CheckTx(makeUpdatePermissionsTx(t, u))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	// Closes, opens and closes the process again, at heights 2, 3 and 4.
+	closeTx := newUpdate(0, closed, admin1, admin2)
+	openTx := newUpdate(2, open, admin1, admin2)
+	closeAgainTx := newUpdate(3, closed, admin1, admin2)
+
+	t.Run("Accepts one update per block", func(t *testing.T) {
+		// The chain ID is known once a block began.
+		h.BeginBlock(req)
+		res := h.CheckTx(closeTx)
+		assert.True(t, res.IsOK(), "h.CheckTx(): %s", res.Log)
+
+		deliverRes := h.DeliverTx(closeTx)
+		assert.True(t, deliverRes.IsOK(), "h.DeliverTx(): %s", deliverRes.Log)
+
+		deliverRes = h.DeliverTx(closeTx)
+		assert.EqualValues(t, tmpop.CodeTypeValidation, deliverRes.Code)
+
+		commitRes := h.Commit()
+		assert.True(t, commitRes.IsOK(), "h.Commit(): %s", commitRes.Log)
+		req = makeBeginBlock(commitRes.Data, req.Header.Height+1)
+	})
+
+	t.Run("Rejects updates signed for another chain", func(t *testing.T) {
+		u := &tmpop.PermissionsUpdate{
+			AdminUpdate: tmpop.AdminUpdate{PreviousHeight: 2},
+			Processes:   open,
+		}
+		u.Sign("otherChain", admin1)
+		u.Sign("otherChain", admin2)
+
+		res := h.CheckTx(makeUpdatePermissionsTx(t, u))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+
+		res = h.CheckTx(openTx)
+		assert.True(t, res.IsOK(), "h.CheckTx(): %s", res.Log)
+	})
+
+	t.Run("Rejects replayed updates", func(t *testing.T) {
+		res := h.CheckTx(closeTx)
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+
+		req = commitTx(t, h, req, openTx)
+		req = commitTx(t, h, req, closeAgainTx)
+
+		var got *tmpop.Permissions
+		err := makeQuery(h, tmpop.GetPermissions, nil, &got)
+		assert.NoError(t, err)
+		if assert.NotNil(t, got) {
+			assert.Equal(t, int64(4), got.Height)
+		}
+
+		// The process is closed again, like when the open update was
+		// approved, but the open update can't be replayed.
+		res = h.CheckTx(openTx)
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+}
@@ -15,6 +15,7 @@
 package tmpoptestcases
 
 import (
+	"crypto/sha256"
 	"testing"
 
 	"github.com/stratumn/sdk/cs"
@@ -22,11 +23,14 @@ import (
 	"github.com/stratumn/sdk/cs/evidences"
 	"github.com/stratumn/sdk/merkle"
 	"github.com/stratumn/sdk/store"
+	"github.com/stratumn/sdk/testutil"
 	"github.com/stratumn/sdk/tmpop"
 	"github.com/stratumn/sdk/tmpop/tmpoptestcases/mocks"
+	"github.com/stratumn/sdk/tsa/tsatesting"
 	"github.com/stratumn/sdk/types"
 	"github.com/stretchr/testify/assert"
 	abci "github.com/tendermint/abci/types"
+	"github.com/tendermint/go-crypto"
 )
 
 // TestTendermintEvidence tests that evidence is correctly added.
@@ -91,13 +95,13 @@ func (f Factory) TestTendermintEvidence(t *testing.T) {
 		expectedAppHash, _ := tmpop.ComputeAppHash(
 			types.NewBytes32FromBytes(previousAppHash),
 			types.NewBytes32FromBytes(nil),
-			tree.Root())
+			tree.Root(),
+			nil)
 		assert.EqualValues(t, expectedAppHash[:], appHash, "Invalid app hash generated")
 	})
 
 	t.Run("Creates evidence events when block is signed", func(t *testing.T) {
-		var events []*store.Event
-		err := makeQuery(h, tmpop.PendingEvents, nil, &events)
+		events, err := getEvents(h, 0)
 		assert.NoError(t, err)
 
 		var evidenceEvents []*store.Event
@@ -133,3 +137,201 @@ func (f Factory) TestTendermintEvidence(t *testing.T) {
 		assert.Zero(t, len(got.Meta.Evidences), "Evidence should not be added to invalid link")
 	})
 }
+
+// TestAddEvidenceTx tests that external evidences are added by transactions.
+func (f Factory) TestAddEvidenceTx(t *testing.T) {
+	h, req := f.newTMPop(t, &tmpop.Config{EvidenceProviders: evidenceProviders("external", "batch")})
+	defer f.free()
+
+	link, req := commitRandomLink(t, h, req)
+	linkHash, _ := link.Hash()
+
+	evidence := &cs.Evidence{
+		Backend:  evidences.BatchFossilizerName,
+		Provider: "external",
+		Proof:    &evidences.BatchProof{Timestamp: 42, Root: linkHash},
+	}
+
+	t.Run("Check evidence of unknown link returns not-ok", func(t *testing.T) {
+		res := h.CheckTx(makeAddEvidenceTx(t, testutil.RandomHash(), evidence))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Check evidence without provider returns not-ok", func(t *testing.T) {
+		e := &cs.Evidence{Backend: "generic", Proof: &cs.GenericProof{}}
+		res := h.CheckTx(makeAddEvidenceTx(t, linkHash, e))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Check evidence with invalid proof returns not-ok", func(t *testing.T) {
+		e := &cs.Evidence{
+			Backend:  evidences.BatchFossilizerName,
+			Provider: "batch",
+			Proof: &evidences.BatchProof{
+				Root: testutil.RandomHash(),
+				Path: types.Path{{Left: *testutil.RandomHash(), Right: *testutil.RandomHash(), Parent: *testutil.RandomHash()}},
+			},
+		}
+		res := h.CheckTx(makeAddEvidenceTx(t, linkHash, e))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Check evidence of unregistered provider returns not-ok", func(t *testing.T) {
+		e := &cs.Evidence{Backend: "generic", Provider: "bitcoin:main", Proof: &cs.GenericProof{}}
+		res := h.CheckTx(makeAddEvidenceTx(t, linkHash, e))
+		assert.EqualValues(t, tmpop.CodeTypeForbidden, res.Code)
+	})
+
+	t.Run("Check unsigned evidence returns not-ok", func(t *testing.T) {
+		res := h.CheckTx(makeSignedAddEvidenceTx(t, linkHash, evidence, crypto.PrivKey{}))
+		assert.EqualValues(t, tmpop.CodeTypeForbidden, res.Code)
+	})
+
+	t.Run("Check evidence signed by another key returns not-ok", func(t *testing.T) {
+		stranger := crypto.GenPrivKeyEd25519().Wrap()
+		res := h.CheckTx(makeSignedAddEvidenceTx(t, linkHash, evidence, stranger))
+		assert.EqualValues(t, tmpop.CodeTypeForbidden, res.Code)
+	})
+
+	t.Run("Check batch evidence of another link returns not-ok", func(t *testing.T) {
+		e := &cs.Evidence{
+			Backend:  evidences.BatchFossilizerName,
+			Provider: "batch",
+			Proof:    &evidences.BatchProof{Root: testutil.RandomHash()},
+		}
+		res := h.CheckTx(makeAddEvidenceTx(t, linkHash, e))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Check evidence of unverifiable backends returns not-ok", func(t *testing.T) {
+		for _, e := range []*cs.Evidence{
+			{Backend: "generic", Provider: "external", Proof: &cs.GenericProof{}},
+			{Backend: evidences.OpenTimestampsName, Provider: "external", Proof: &evidences.OpenTimestampsProof{}},
+			{Backend: evidences.TMPopName, Provider: "external", Proof: &evidences.TendermintProof{Root: linkHash}},
+		} {
+			res := h.CheckTx(makeAddEvidenceTx(t, linkHash, e))
+			assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code, e.Backend)
+		}
+	})
+
+	t.Run("Check TSA evidence without trusted roots returns not-ok", func(t *testing.T) {
+		e := makeTSAEvidence(t, linkHash, "external")
+		res := h.CheckTx(makeAddEvidenceTx(t, linkHash, e))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Check valid evidence returns ok", func(t *testing.T) {
+		res := h.CheckTx(makeAddEvidenceTx(t, linkHash, evidence))
+		assert.True(t, res.IsOK(), "Expected CheckTx to return an OK result, got %v", res)
+	})
+
+	t.Run("Commit evidence adds it to the store", func(t *testing.T) {
+		height := req.Header.Height
+		previousAppHash := req.Header.AppHash
+		next := commitTx(t, h, req, makeAddEvidenceTx(t, linkHash, evidence))
+
+		evidenceBytes, _ := evidence.MarshalBinary()
+		evidenceHash := sha256.Sum256(evidenceBytes)
+		evidencesHash := sha256.Sum256(append(linkHash[:], evidenceHash[:]...))
+		expectedAppHash, _ := tmpop.ComputeAppHash(
+			types.NewBytes32FromBytes(previousAppHash),
+			nil,
+			nil,
+			types.NewBytes32FromBytes(evidencesHash[:]))
+		assert.EqualValues(t, expectedAppHash[:], next.Header.AppHash, "App hash should include the evidences")
+
+		got := &cs.Segment{}
+		err := makeQuery(h, tmpop.GetSegment, linkHash, got)
+		assert.NoError(t, err)
+		stored := got.Meta.GetEvidence(evidence.Provider)
+		if assert.NotNil(t, stored, "Evidence should be stored") {
+			assert.Equal(t, evidence.Backend, stored.Backend)
+		}
+
+		events, err := getEvents(h, height)
+		assert.NoError(t, err)
+		if assert.Equal(t, 1, len(events), "Expected one saved evidences event") {
+			assert.EqualValues(t, store.SavedEvidences, events[0].EventType)
+		}
+	})
+
+	t.Run("Check evidence of existing provider returns not-ok", func(t *testing.T) {
+		res := h.CheckTx(makeAddEvidenceTx(t, linkHash, evidence))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+}
+
+// TestAddEvidenceTxBackends tests the verification of evidences by backend.
+func (f Factory) TestAddEvidenceTxBackends(t *testing.T) {
+	authority, err := tsatesting.New()
+	if err != nil {
+		t.Fatalf("tsatesting.New(): err: %s", err)
+	}
+
+	t.Run("Accepts TSA evidences of trusted authorities", func(t *testing.T) {
+		h, req := f.newTMPop(t, &tmpop.Config{
+			EvidenceProviders: evidenceProviders("tsa"),
+			TSARoots:          authority.Roots,
+		})
+		defer f.free()
+		defer evidences.RegisterTSARoots(nil)
+
+		link, _ := commitRandomLink(t, h, req)
+		linkHash, _ := link.Hash()
+
+		res := h.CheckTx(makeAddEvidenceTx(t, linkHash, makeTSAEvidenceOf(t, authority, linkHash, "tsa")))
+		assert.True(t, res.IsOK(), "h.CheckTx(): %s", res.Log)
+
+		other, err := tsatesting.New()
+		if err != nil {
+			t.Fatalf("tsatesting.New(): err: %s", err)
+		}
+		res = h.CheckTx(makeAddEvidenceTx(t, linkHash, makeTSAEvidenceOf(t, other, linkHash, "tsa")))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Accepts unverifiable evidences when verification is skipped", func(t *testing.T) {
+		h, req := f.newTMPop(t, &tmpop.Config{
+			EvidenceProviders:        evidenceProviders("ots", "tsa"),
+			SkipEvidenceVerification: true,
+		})
+		defer f.free()
+
+		link, _ := commitRandomLink(t, h, req)
+		linkHash, _ := link.Hash()
+
+		e := &cs.Evidence{Backend: evidences.OpenTimestampsName, Provider: "ots", Proof: &evidences.OpenTimestampsProof{}}
+		res := h.CheckTx(makeAddEvidenceTx(t, linkHash, e))
+		assert.True(t, res.IsOK(), "h.CheckTx(): %s", res.Log)
+
+		res = h.CheckTx(makeAddEvidenceTx(t, linkHash, makeTSAEvidence(t, linkHash, "tsa")))
+		assert.True(t, res.IsOK(), "h.CheckTx(): %s", res.Log)
+	})
+}
+
+// makeTSAEvidence makes a TSA batch evidence of a link signed by a new
+// timestamp authority.
+func makeTSAEvidence(t *testing.T, linkHash *types.Bytes32, provider string) *cs.Evidence {
+	authority, err := tsatesting.New()
+	if err != nil {
+		t.Fatalf("tsatesting.New(): err: %s", err)
+	}
+	return makeTSAEvidenceOf(t, authority, linkHash, provider)
+}
+
+// makeTSAEvidenceOf makes a TSA batch evidence of a link signed by the given
+// timestamp authority.
+func makeTSAEvidenceOf(t *testing.T, authority *tsatesting.Authority, linkHash *types.Bytes32, provider string) *cs.Evidence {
+	token, err := authority.Sign(linkHash[:], nil)
+	if err != nil {
+		t.Fatalf("authority.Sign(): err: %s", err)
+	}
+	return &cs.Evidence{
+		Backend:  evidences.TSABatchFossilizerName,
+		Provider: provider,
+		Proof: &evidences.TSABatchProof{
+			Batch: evidences.BatchProof{Root: linkHash},
+			Token: token,
+		},
+	}
+}
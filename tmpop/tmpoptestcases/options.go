@@ -0,0 +1,120 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpoptestcases
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/store"
+	"github.com/stratumn/sdk/tmpop"
+	"github.com/stratumn/sdk/tmpop/tmpoptestcases/mocks"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/abci/types"
+)
+
+// TestSetOption tests that runtime options are changed with SetOption and
+// returned by the GetOptions query.
+func (f Factory) TestSetOption(t *testing.T) {
+	h, req := f.newTMPop(t, nil)
+	defer f.free()
+
+	level := log.GetLevel()
+	defer log.SetLevel(level)
+
+	t.Run("Starts with default options", func(t *testing.T) {
+		got := &tmpop.Options{}
+		err := makeQuery(h, tmpop.GetOptions, nil, got)
+		assert.NoError(t, err)
+		assert.Equal(t, &tmpop.Options{LogLevel: level.String(), GenerateEvidence: true}, got)
+	})
+
+	t.Run("Rejects unknown options", func(t *testing.T) {
+		res := h.SetOption(abci.RequestSetOption{Key: "unknown", Value: "1"})
+		assert.EqualValues(t, tmpop.CodeTypeNotImplemented, res.Code)
+	})
+
+	t.Run("Rejects invalid values", func(t *testing.T) {
+		for _, key := range []string{tmpop.OptionLogLevel, tmpop.OptionGenerateEvidence, tmpop.OptionQueryLimit} {
+			res := h.SetOption(abci.RequestSetOption{Key: key, Value: "invalid"})
+			assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code, "h.SetOption(%s)", key)
+		}
+
+		res := h.SetOption(abci.RequestSetOption{Key: tmpop.OptionQueryLimit, Value: "-1"})
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Sets the log level", func(t *testing.T) {
+		res := h.SetOption(abci.RequestSetOption{Key: tmpop.OptionLogLevel, Value: "error"})
+		assert.True(t, res.Code == abci.CodeTypeOK, "h.SetOption(): %s", res.Log)
+		assert.Equal(t, log.ErrorLevel, log.GetLevel())
+
+		got := &tmpop.Options{}
+		err := makeQuery(h, tmpop.GetOptions, nil, got)
+		assert.NoError(t, err)
+		assert.Equal(t, "error", got.LogLevel)
+	})
+
+	t.Run("Turns evidence generation off", func(t *testing.T) {
+		res := h.SetOption(abci.RequestSetOption{Key: tmpop.OptionGenerateEvidence, Value: "false"})
+		assert.True(t, res.Code == abci.CodeTypeOK, "h.SetOption(): %s", res.Log)
+
+		// The mock fails if TMPop asks for a block to generate evidence.
+		tmClientMock := new(tmpoptestcasesmocks.MockedTendermintClient)
+		h.ConnectTendermint(tmClientMock)
+
+		var link *cs.Link
+		link, req = commitRandomLink(t, h, req)
+		linkHash, _ := link.Hash()
+		_, req = commitRandomLink(t, h, req)
+
+		got := &cs.Segment{}
+		err := makeQuery(h, tmpop.GetSegment, linkHash, got)
+		assert.NoError(t, err)
+		assert.Nil(t, got.Meta.GetEvidence(req.Header.GetChainId()), "Evidence should not be generated")
+		tmClientMock.AssertNotCalled(t, "Block", 1)
+	})
+
+	t.Run("Limits query results", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_, req = commitRandomLink(t, h, req)
+		}
+
+		res := h.SetOption(abci.RequestSetOption{Key: tmpop.OptionQueryLimit, Value: "2"})
+		assert.True(t, res.Code == abci.CodeTypeOK, "h.SetOption(): %s", res.Log)
+
+		var segments cs.SegmentSlice
+		err := makeQuery(h, tmpop.FindSegments, &store.SegmentFilter{
+			Pagination: store.Pagination{Limit: 10},
+		}, &segments)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(segments), "FindSegments() should be limited")
+
+		var mapIDs []string
+		err = makeQuery(h, tmpop.GetMapIDs, &store.MapFilter{
+			Pagination: store.Pagination{Limit: 10},
+		}, &mapIDs)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(mapIDs), "GetMapIDs() should be limited")
+
+		segments = nil
+		err = makeQueryAt(h, tmpop.FindSegments, &store.SegmentFilter{
+			Pagination: store.Pagination{Limit: 10},
+		}, req.Header.Height-2, &segments)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(segments), "FindSegments() at a past height should be limited")
+	})
+}
@@ -0,0 +1,174 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpoptestcases
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/cstesting"
+	"github.com/stratumn/sdk/tmpop"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/abci/types"
+	"github.com/tendermint/go-crypto"
+)
+
+// TestPermissions tests that links of restricted processes must be signed
+// by allowed keys, and that permissions are updated by transactions signed
+// by enough administrators.
+func (f Factory) TestPermissions(t *testing.T) {
+	admin := crypto.GenPrivKeyEd25519().Wrap()
+	alice := crypto.GenPrivKeyEd25519().Wrap()
+	bob := crypto.GenPrivKeyEd25519().Wrap()
+	stranger := crypto.GenPrivKeyEd25519().Wrap()
+
+	h, req := f.newTMPop(t, &tmpop.Config{
+		PermissionsAdmins: []crypto.PubKey{admin.PubKey()},
+	})
+	defer f.free()
+
+	processes := map[string]*tmpop.ProcessPermissions{
+		"testProcess": {
+			Signers: []string{pubKeyHex(alice), pubKeyHex(bob)},
+			MapIDs:  map[string][]string{"aliceMap": {pubKeyHex(alice)}},
+			Actions: map[string][]string{"close": {pubKeyHex(bob)}},
+		},
+	}
+
+	newLink := func(mapID, action string, signers ...crypto.PrivKey) *cs.Link {
+		l := cstesting.RandomLinkWithProcess("testProcess")
+		if mapID != "" {
+			l.Meta["mapId"] = mapID
+		}
+		if action != "" {
+			l.Meta["action"] = action
+		}
+		for _, signer := range signers {
+			if err := tmpop.SignLink(l, signer); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return l
+	}
+
+	t.Run("Rejects invalid keys", func(t *testing.T) {
+		u := &tmpop.PermissionsUpdate{
+			Processes: map[string]*tmpop.ProcessPermissions{
+				"testProcess": {Signers: []string{"not a key"}},
+			},
+		}
+		u.Sign(chainID, admin)
+
+		res := h.CheckTx(makeUpdatePermissionsTx(t, u))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Applies approved permissions from the next block", func(t *testing.T) {
+		u := &tmpop.PermissionsUpdate{Processes: processes}
+		u.Sign(chainID, admin)
+		tx := makeUpdatePermissionsTx(t, u)
+
+		// The chain ID is known once a block began.
+		h.BeginBlock(req)
+		res := h.CheckTx(tx)
+		assert.True(t, res.IsOK(), "h.CheckTx(): %s", res.Log)
+
+		deliverRes := h.DeliverTx(tx)
+		assert.True(t, deliverRes.IsOK(), "h.DeliverTx(): %s", deliverRes.Log)
+
+		// The update doesn't apply to the current block.
+		deliverRes = h.DeliverTx(makeCreateLinkTx(t, newLink("", "")))
+		assert.True(t, deliverRes.IsOK(), "h.DeliverTx(): %s", deliverRes.Log)
+
+		commitRes := h.Commit()
+		assert.True(t, commitRes.IsOK(), "h.Commit(): %s", commitRes.Log)
+		req = makeBeginBlock(commitRes.Data, req.Header.Height+1)
+	})
+
+	h.BeginBlock(req)
+
+	tests := []struct {
+		name string
+		link *cs.Link
+		code uint32
+	}{
+		{"Accepts links of open processes", cstesting.RandomLinkWithProcess("openProcess"), abci.CodeTypeOK},
+		{"Rejects unsigned links", newLink("", ""), tmpop.CodeTypeForbidden},
+		{"Rejects links signed by other keys", newLink("", "", stranger), tmpop.CodeTypeForbidden},
+		{"Accepts links signed by a process signer", newLink("", "", bob), abci.CodeTypeOK},
+		{"Rejects links appending to a map without permission", newLink("aliceMap", "", bob), tmpop.CodeTypeForbidden},
+		{"Accepts links appending to a map with permission", newLink("aliceMap", "", alice), abci.CodeTypeOK},
+		{"Rejects links using an action without permission", newLink("", "close", alice), tmpop.CodeTypeForbidden},
+		{"Accepts links using an action with permission", newLink("", "close", bob), abci.CodeTypeOK},
+		{"Accepts links signed by several keys", newLink("aliceMap", "close", alice, bob), abci.CodeTypeOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := h.CheckTx(makeCreateLinkTx(t, tt.link))
+			assert.EqualValues(t, tt.code, res.Code, "h.CheckTx(): %s", res.Log)
+
+			deliverRes := h.DeliverTx(makeCreateLinkTx(t, tt.link))
+			assert.EqualValues(t, tt.code, deliverRes.Code, "h.DeliverTx(): %s", deliverRes.Log)
+		})
+	}
+
+	t.Run("Rejects links modified after being signed", func(t *testing.T) {
+		l := newLink("", "", alice)
+		l.State["modified"] = true
+
+		res := h.CheckTx(makeCreateLinkTx(t, l))
+		assert.EqualValues(t, tmpop.CodeTypeForbidden, res.Code)
+	})
+
+	commitRes := h.Commit()
+	assert.True(t, commitRes.IsOK(), "h.Commit(): %s", commitRes.Log)
+
+	t.Run("Includes permissions in the app hash", func(t *testing.T) {
+		args, _ := tmpop.BuildQueryBinary(tests[3].link.Segmentify().GetLinkHash())
+		q := h.Query(abci.RequestQuery{
+			Data:  args,
+			Path:  tmpop.GetSegment,
+			Prove: true,
+		})
+		assert.True(t, q.IsOK(), "Query failed: %s", q.Log)
+
+		proof := &tmpop.LinkProof{}
+		err := json.Unmarshal(q.Proof, proof)
+		assert.NoError(t, err)
+		assert.NotNil(t, proof.ValidationsHash, "proof.ValidationsHash")
+		assert.True(t, proof.AppHash.EqualsBytes(commitRes.Data), "Proof should lead to the app hash of its block")
+		assert.NoError(t, proof.Verify(tests[3].link.Segmentify().GetLinkHash()))
+	})
+
+	t.Run("Queries the permissions adopted on chain", func(t *testing.T) {
+		var got *tmpop.Permissions
+		err := makeQuery(h, tmpop.GetPermissions, nil, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, &tmpop.Permissions{Height: 2, Processes: processes}, got)
+
+		got = nil
+		err = makeQueryAt(h, tmpop.GetPermissions, nil, 1, &got)
+		assert.NoError(t, err)
+		assert.Nil(t, got, "permissions at height 1")
+	})
+}
+
+func pubKeyHex(privKey crypto.PrivKey) string {
+	pubKey := privKey.PubKey().Unwrap().(crypto.PubKeyEd25519)
+	return hex.EncodeToString(pubKey[:])
+}
@@ -15,6 +15,7 @@
 package tmpoptestcases
 
 import (
+	"encoding/json"
 	"testing"
 
 	abci "github.com/tendermint/abci/types"
@@ -139,15 +140,30 @@ func (f Factory) TestQuery(t *testing.T) {
 		}
 	})
 
-	t.Run("Pending events are delivered only once", func(t *testing.T) {
-		var events []*store.Event
-		err := makeQuery(h, tmpop.PendingEvents, nil, &events)
+	t.Run("GetEvents() returns the events of the blocks since a height", func(t *testing.T) {
+		got := &tmpop.Events{}
+		err := makeQuery(h, tmpop.GetEvents, &tmpop.EventsFilter{}, got)
 		assert.NoError(t, err)
-		assert.Equal(t, 2, len(events), "We should have two saved links events (no evidence since Tendermint Core is not connected)")
+		assert.Equal(t, int64(3), got.LastHeight)
+		assert.Equal(t, 2, len(got.Events), "We should have two saved links events (no evidence since Tendermint Core is not connected)")
 
-		err = makeQuery(h, tmpop.PendingEvents, nil, &events)
+		got = &tmpop.Events{}
+		err = makeQuery(h, tmpop.GetEvents, &tmpop.EventsFilter{}, got)
 		assert.NoError(t, err)
-		assert.Equal(t, 0, len(events), "Events should not be delivered twice")
+		assert.Equal(t, 2, len(got.Events), "Events should be delivered to every subscriber")
+
+		got = &tmpop.Events{}
+		err = makeQuery(h, tmpop.GetEvents, &tmpop.EventsFilter{FromHeight: 3}, got)
+		assert.NoError(t, err)
+		if assert.Equal(t, 1, len(got.Events), "Unexpected number of events") {
+			savedLinks := got.Events[0].Data.([]*cs.Link)
+			assert.EqualValues(t, link2, savedLinks[0])
+		}
+
+		got = &tmpop.Events{}
+		err = makeQuery(h, tmpop.GetEvents, &tmpop.EventsFilter{FromHeight: 4}, got)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(got.Events), "Unexpected events after the last block")
 	})
 
 	t.Run("Unsupported Query", func(t *testing.T) {
@@ -163,3 +179,229 @@ func (f Factory) TestQuery(t *testing.T) {
 		assert.EqualValues(t, tmpop.CodeTypeInternalError, q.GetCode())
 	})
 }
+
+// TestQueryAtHeight tests queries made at a past height
+func (f Factory) TestQueryAtHeight(t *testing.T) {
+	h, req := f.newTMPop(t, nil)
+	defer f.free()
+
+	link1, req := commitRandomLink(t, h, req)
+	linkHash1, _ := link1.Hash()
+
+	link2 := cstesting.RandomLinkWithProcess(link1.GetProcess())
+	linkHash2, _ := link2.Hash()
+	req = commitLink(t, h, link2, req)
+
+	link3 := cstesting.RandomBranch(link1)
+	link3.Meta["process"] = link1.GetProcess()
+	commitLink(t, h, link3, req)
+
+	t.Run("GetSegment() excludes later segments", func(t *testing.T) {
+		var got *cs.Segment
+		err := makeQueryAt(h, tmpop.GetSegment, linkHash1, 1, &got)
+		assert.NoError(t, err)
+		assert.NotNil(t, got, "Segment should exist at height 1")
+
+		got = nil
+		err = makeQueryAt(h, tmpop.GetSegment, linkHash2, 1, &got)
+		assert.NoError(t, err)
+		assert.Nil(t, got, "Segment should not exist at height 1")
+
+		err = makeQueryAt(h, tmpop.GetSegment, linkHash2, 2, &got)
+		assert.NoError(t, err)
+		assert.NotNil(t, got, "Segment should exist at height 2")
+	})
+
+	t.Run("FindSegments() excludes later segments", func(t *testing.T) {
+		args := &store.SegmentFilter{
+			Pagination: store.Pagination{
+				Limit: store.DefaultLimit,
+			},
+			Process: link1.GetProcess(),
+		}
+
+		for height, want := range map[int64]int{1: 1, 2: 2, 3: 3} {
+			gots := cs.SegmentSlice{}
+			err := makeQueryAt(h, tmpop.FindSegments, args, height, &gots)
+			assert.NoError(t, err)
+			assert.Equal(t, want, len(gots), "Unexpected number of segments at height %d", height)
+		}
+
+		args.MapIDs = []string{link1.GetMapID()}
+		gots := cs.SegmentSlice{}
+		err := makeQueryAt(h, tmpop.FindSegments, args, 2, &gots)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(gots), "Unexpected number of segments")
+		assert.EqualValues(t, link1, &gots[0].Link)
+	})
+
+	t.Run("FindSegments() paginates segments at height", func(t *testing.T) {
+		args := &store.SegmentFilter{
+			Pagination: store.Pagination{
+				Offset: 1,
+				Limit:  1,
+			},
+			Process: link1.GetProcess(),
+		}
+		gots := cs.SegmentSlice{}
+		err := makeQueryAt(h, tmpop.FindSegments, args, 2, &gots)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(gots), "Unexpected number of segments")
+	})
+
+	t.Run("FindSegments() at height applies the limit", func(t *testing.T) {
+		args := &store.SegmentFilter{
+			Pagination: store.Pagination{Limit: 1},
+			Process:    link1.GetProcess(),
+		}
+		gots := cs.SegmentSlice{}
+		err := makeQueryAt(h, tmpop.FindSegments, args, 3, &gots)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(gots), "Unexpected number of segments")
+
+		args.Limit = 0
+		gots = cs.SegmentSlice{}
+		err = makeQueryAt(h, tmpop.FindSegments, args, 3, &gots)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(gots), "A zero limit should use the default limit")
+	})
+
+	t.Run("GetMapIDs() excludes later maps", func(t *testing.T) {
+		args := &store.MapFilter{
+			Pagination: store.Pagination{
+				Limit: store.DefaultLimit,
+			},
+		}
+
+		var got []string
+		err := makeQueryAt(h, tmpop.GetMapIDs, args, 1, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{link1.GetMapID()}, got)
+
+		err = makeQueryAt(h, tmpop.GetMapIDs, args, 2, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(got), "Unexpected number of maps")
+
+		args.Limit = 0
+		err = makeQueryAt(h, tmpop.GetMapIDs, args, 2, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(got), "A zero limit should use the default limit")
+	})
+
+	t.Run("GetMapIDs() paginates maps at height", func(t *testing.T) {
+		args := &store.MapFilter{
+			Pagination: store.Pagination{
+				Offset: 1,
+				Limit:  1,
+			},
+			Process: link1.GetProcess(),
+		}
+
+		// The map of link1 has a segment committed later, at height 3.
+		var all []string
+		err := makeQueryAt(h, tmpop.GetMapIDs, &store.MapFilter{Pagination: store.Pagination{Limit: 2}}, 2, &all)
+		if !assert.NoError(t, err) || !assert.Equal(t, 2, len(all), "Unexpected number of maps") {
+			return
+		}
+
+		var got []string
+		err = makeQueryAt(h, tmpop.GetMapIDs, args, 2, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, all[1:], got)
+
+		args.Offset = 1
+		err = makeQueryAt(h, tmpop.GetMapIDs, args, 1, &got)
+		assert.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("Other queries only support the latest commit", func(t *testing.T) {
+		q := h.Query(abci.RequestQuery{
+			Path:   tmpop.GetEvidences,
+			Height: 1,
+		})
+		assert.EqualValues(t, tmpop.CodeTypeNotImplemented, q.GetCode())
+	})
+}
+
+// TestQueryProofs tests that queries prove that their segments were
+// committed.
+func (f Factory) TestQueryProofs(t *testing.T) {
+	h, req := f.newTMPop(t, nil)
+	defer f.free()
+
+	link1 := cstesting.RandomLink()
+	linkHash1, _ := link1.Hash()
+	link2 := cstesting.RandomLinkWithProcess(link1.GetProcess())
+	linkHash2, _ := link2.Hash()
+	req = commitTxs(t, h, req, [][]byte{makeCreateLinkTx(t, link1), makeCreateLinkTx(t, link2)})
+	appHash1 := req.Header.AppHash
+
+	link3 := cstesting.RandomLinkWithProcess(link1.GetProcess())
+	linkHash3, _ := link3.Hash()
+	req = commitLink(t, h, link3, req)
+	appHash2 := req.Header.AppHash
+
+	t.Run("GetSegment() proves the segment was committed", func(t *testing.T) {
+		args, _ := tmpop.BuildQueryBinary(linkHash2)
+		q := h.Query(abci.RequestQuery{
+			Data:  args,
+			Path:  tmpop.GetSegment,
+			Prove: true,
+		})
+		assert.True(t, q.IsOK(), "Query failed: %s", q.Log)
+
+		proof := &tmpop.LinkProof{}
+		err := json.Unmarshal(q.Proof, proof)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), proof.BlockHeight)
+		assert.True(t, proof.AppHash.EqualsBytes(appHash1), "Proof should lead to the app hash of its block")
+		assert.NoError(t, proof.Verify(linkHash2))
+		assert.Error(t, proof.Verify(linkHash3), "Proof should not verify another link")
+	})
+
+	t.Run("FindSegments() proves each segment was committed", func(t *testing.T) {
+		args, _ := tmpop.BuildQueryBinary(&store.SegmentFilter{
+			Pagination: store.Pagination{
+				Limit: store.DefaultLimit,
+			},
+			Process: link1.GetProcess(),
+		})
+		q := h.Query(abci.RequestQuery{
+			Data:  args,
+			Path:  tmpop.FindSegments,
+			Prove: true,
+		})
+		assert.True(t, q.IsOK(), "Query failed: %s", q.Log)
+
+		var segments cs.SegmentSlice
+		err := json.Unmarshal(q.Value, &segments)
+		assert.NoError(t, err)
+		var proofs []*tmpop.LinkProof
+		err = json.Unmarshal(q.Proof, &proofs)
+		assert.NoError(t, err)
+
+		if assert.Equal(t, 3, len(proofs), "Expected a proof per segment") {
+			appHashes := map[types.Bytes32][]byte{
+				*linkHash1: appHash1,
+				*linkHash2: appHash1,
+				*linkHash3: appHash2,
+			}
+			for i, segment := range segments {
+				linkHash := segment.GetLinkHash()
+				assert.NoError(t, proofs[i].Verify(linkHash))
+				assert.True(t, proofs[i].AppHash.EqualsBytes(appHashes[*linkHash]), "Proof should lead to the app hash of its block")
+			}
+		}
+	})
+
+	t.Run("Proofs are only returned on demand", func(t *testing.T) {
+		args, _ := tmpop.BuildQueryBinary(linkHash1)
+		q := h.Query(abci.RequestQuery{
+			Data: args,
+			Path: tmpop.GetSegment,
+		})
+		assert.True(t, q.IsOK(), "Query failed: %s", q.Log)
+		assert.Nil(t, q.Proof)
+	})
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpoptestcases
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stratumn/sdk/cs/cstesting"
+	"github.com/stratumn/sdk/tmpop"
+	"github.com/stratumn/sdk/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/go-crypto"
+)
+
+// TestUpdateRules tests that validation rules are replaced by transactions
+// signed by enough administrators.
+func (f Factory) TestUpdateRules(t *testing.T) {
+	admin1 := crypto.GenPrivKeyEd25519().Wrap()
+	admin2 := crypto.GenPrivKeyEd25519().Wrap()
+
+	testFilename := getTestFile(t)
+	h, req := f.newTMPop(t, &tmpop.Config{
+		ValidatorFilename: testFilename,
+		RulesAdmins:       []crypto.PubKey{admin1.PubKey(), admin2.PubKey()},
+		RulesApprovals:    2,
+	})
+	defer f.free()
+
+	newRules := []byte(`{"testProcess":[{"type":"init","schema":{"type":"object","properties":{"string":{"type":"number"}}}}]}`)
+	newHash := types.Bytes32(sha256.Sum256(newRules))
+
+	t.Run("Rejects invalid rules", func(t *testing.T) {
+		u := &tmpop.RulesUpdate{Rules: []byte(`{"testProcess":[{"type":"init"}]}`)}
+		u.Sign(chainID, admin1)
+		u.Sign(chainID, admin2)
+
+		res := h.CheckTx(makeUpdateRulesTx(t, u))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Applies approved rules from the next block", func(t *testing.T) {
+		u := &tmpop.RulesUpdate{Rules: newRules}
+		u.Sign(chainID, admin1)
+		u.Sign(chainID, admin2)
+		tx := makeUpdateRulesTx(t, u)
+
+		// The chain ID is known once a block began.
+		h.BeginBlock(req)
+		res := h.CheckTx(tx)
+		assert.True(t, res.IsOK(), "h.CheckTx(): %s", res.Log)
+
+		deliverRes := h.DeliverTx(tx)
+		assert.True(t, deliverRes.IsOK(), "h.DeliverTx(): %s", deliverRes.Log)
+
+		// The update doesn't apply to the current block.
+		l := cstesting.RandomLinkWithProcess("testProcess")
+		l.Meta["action"] = "init"
+		l.State["string"] = "test"
+		deliverRes = h.DeliverTx(makeCreateLinkTx(t, l))
+		assert.True(t, deliverRes.IsOK(), "h.DeliverTx(): %s", deliverRes.Log)
+
+		commitRes := h.Commit()
+		assert.True(t, commitRes.IsOK(), "h.Commit(): %s", commitRes.Log)
+		req = makeBeginBlock(commitRes.Data, req.Header.Height+1)
+
+		h.BeginBlock(req)
+
+		l = cstesting.RandomLinkWithProcess("testProcess")
+		l.Meta["action"] = "init"
+		l.State["string"] = "test"
+		deliverRes = h.DeliverTx(makeCreateLinkTx(t, l))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, deliverRes.Code)
+
+		l = cstesting.RandomLinkWithProcess("testProcess")
+		l.Meta["action"] = "init"
+		l.State["string"] = 42
+		deliverRes = h.DeliverTx(makeCreateLinkTx(t, l))
+		assert.True(t, deliverRes.IsOK(), "h.DeliverTx(): %s", deliverRes.Log)
+
+		commitRes = h.Commit()
+		assert.True(t, commitRes.IsOK(), "h.Commit(): %s", commitRes.Log)
+	})
+
+	t.Run("Queries the rules adopted on chain", func(t *testing.T) {
+		var got *tmpop.Rules
+		err := makeQuery(h, tmpop.GetRules, nil, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, &tmpop.Rules{Height: 2, Hash: &newHash, Rules: newRules}, got)
+
+		got = nil
+		err = makeQueryAt(h, tmpop.GetRules, nil, 1, &got)
+		assert.NoError(t, err)
+		assert.Nil(t, got, "rules at height 1")
+	})
+}
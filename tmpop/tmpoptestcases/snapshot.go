@@ -0,0 +1,249 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpoptestcases
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/cstesting"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/store"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/tmpop"
+	"github.com/stratumn/sdk/types"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/abci/types"
+	"github.com/tendermint/go-crypto"
+)
+
+// TestSnapshot tests that a node restored from a snapshot has the same state
+// as the node that wrote it.
+func (f Factory) TestSnapshot(t *testing.T) {
+	admin := crypto.GenPrivKeyEd25519().Wrap()
+	h, req := f.newTMPop(t, &tmpop.Config{
+		EvidenceProviders:    evidenceProviders("external"),
+		PermissionsAdmins:    []crypto.PubKey{admin.PubKey()},
+		PermissionsApprovals: 1,
+	})
+	defer f.free()
+
+	link1, req := commitRandomLink(t, h, req)
+	linkHash1, _ := link1.Hash()
+	req = commitTxs(t, h, req, nil)
+	evidence := &cs.Evidence{
+		Backend:  evidences.BatchFossilizerName,
+		Provider: "external",
+		Proof:    &evidences.BatchProof{Timestamp: 42, Root: linkHash1},
+	}
+	req = commitTxs(t, h, req, [][]byte{
+		makeCreateLinkTx(t, cstesting.RandomLink()),
+		makeAddEvidenceTx(t, linkHash1, evidence),
+	})
+
+	// The permissions apply from the next block, which commits to them.
+	update := &tmpop.PermissionsUpdate{
+		Processes: map[string]*tmpop.ProcessPermissions{
+			"testProcess": {Signers: []string{pubKeyHex(admin)}},
+		},
+	}
+	update.Sign(chainID, admin)
+	req = commitTx(t, h, req, makeUpdatePermissionsTx(t, update))
+	req = commitTxs(t, h, req, nil)
+
+	snapshot := &bytes.Buffer{}
+	if err := h.WriteSnapshot(snapshot); err != nil {
+		t.Fatalf("h.WriteSnapshot(): err: %s", err)
+	}
+
+	// Tendermint keeps the height and app hash of the last block it
+	// committed, which must match the snapshot.
+	info := h.Info(abci.RequestInfo{})
+	trusted := &tmpop.LastBlock{
+		Height:  info.LastBlockHeight,
+		AppHash: types.NewBytes32FromBytes(info.LastBlockAppHash),
+	}
+
+	t.Run("Restored node has the same state", func(t *testing.T) {
+		a, kv, err := f.New()
+		if err != nil {
+			t.Fatalf("f.New(): err: %s", err)
+		}
+		if f.Free != nil {
+			defer f.Free(a, kv)
+		}
+
+		err = tmpop.RestoreSnapshot(a, kv, bytes.NewReader(snapshot.Bytes()), &tmpop.Config{}, trusted)
+		if !assert.NoError(t, err) {
+			return
+		}
+		restored, err := tmpop.New(a, kv, &tmpop.Config{})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, h.Info(abci.RequestInfo{}), restored.Info(abci.RequestInfo{}))
+
+		got := &cs.Segment{}
+		err = makeQuery(restored, tmpop.GetSegment, linkHash1, got)
+		assert.NoError(t, err)
+		assert.EqualValues(t, link1, &got.Link)
+		assert.NotNil(t, got.Meta.GetEvidence(evidence.Provider), "Evidence should be restored")
+
+		var permissions *tmpop.Permissions
+		err = makeQuery(restored, tmpop.GetPermissions, nil, &permissions)
+		assert.NoError(t, err)
+		assert.NotNil(t, permissions, "Permissions should be restored")
+
+		// Both nodes compute the same app hash for the next block.
+		tx := makeCreateLinkTx(t, cstesting.RandomLink())
+		commitTx(t, restored, req, tx)
+		req = commitTx(t, h, req, tx)
+		assert.Equal(t, h.Info(abci.RequestInfo{}).LastBlockAppHash, restored.Info(abci.RequestInfo{}).LastBlockAppHash)
+	})
+
+	t.Run("Restoring a tampered snapshot fails", func(t *testing.T) {
+		lines := bytes.Split(snapshot.Bytes(), []byte("\n"))
+
+		segment := &cs.Segment{}
+		if err := json.Unmarshal(lines[1], segment); err != nil {
+			t.Fatal(err)
+		}
+		segment.Link.State["tampered"] = true
+		tampered, err := json.Marshal(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines[1] = tampered
+
+		a, kv, err := f.New()
+		if err != nil {
+			t.Fatalf("f.New(): err: %s", err)
+		}
+		if f.Free != nil {
+			defer f.Free(a, kv)
+		}
+
+		err = tmpop.RestoreSnapshot(a, kv, bytes.NewReader(bytes.Join(lines, []byte("\n"))), &tmpop.Config{}, trusted)
+		assert.Error(t, err)
+	})
+
+	t.Run("Restoring tampered permissions fails", func(t *testing.T) {
+		for name, tamper := range map[string]func(*tmpop.SnapshotHeader){
+			"changed": func(header *tmpop.SnapshotHeader) {
+				header.Permissions[0].Processes = map[string]*tmpop.ProcessPermissions{}
+			},
+			"removed": func(header *tmpop.SnapshotHeader) {
+				header.Permissions = nil
+			},
+		} {
+			lines := bytes.Split(snapshot.Bytes(), []byte("\n"))
+
+			header := &tmpop.SnapshotHeader{}
+			if err := json.Unmarshal(lines[0], header); err != nil {
+				t.Fatal(err)
+			}
+			tamper(header)
+			tampered, err := json.Marshal(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines[0] = tampered
+
+			a, kv, err := f.New()
+			if err != nil {
+				t.Fatalf("f.New(): err: %s", err)
+			}
+
+			err = tmpop.RestoreSnapshot(a, kv, bytes.NewReader(bytes.Join(lines, []byte("\n"))), &tmpop.Config{}, trusted)
+			assert.Error(t, err, name)
+
+			if f.Free != nil {
+				f.Free(a, kv)
+			}
+		}
+	})
+
+	t.Run("Restoring in an existing db fails", func(t *testing.T) {
+		err := tmpop.RestoreSnapshot(f.adapter, f.kv, bytes.NewReader(snapshot.Bytes()), &tmpop.Config{}, trusted)
+		assert.Error(t, err)
+	})
+
+	t.Run("Restoring a snapshot of another chain fails", func(t *testing.T) {
+		for name, untrusted := range map[string]*tmpop.LastBlock{
+			"missing":  nil,
+			"app hash": {Height: trusted.Height, AppHash: testutil.RandomHash()},
+			"height":   {Height: trusted.Height + 1, AppHash: trusted.AppHash},
+		} {
+			a, kv, err := f.New()
+			if err != nil {
+				t.Fatalf("f.New(): err: %s", err)
+			}
+
+			err = tmpop.RestoreSnapshot(a, kv, bytes.NewReader(snapshot.Bytes()), &tmpop.Config{}, untrusted)
+			assert.Error(t, err, name)
+
+			// Nothing is written before the snapshot is trusted.
+			lastBlock, err := kv.GetValue([]byte("tmpop:lastblock"))
+			assert.NoError(t, err, name)
+			assert.Nil(t, lastBlock, name)
+			segments, err := a.FindSegments(&store.SegmentFilter{Pagination: store.Pagination{Limit: store.DefaultLimit}})
+			assert.NoError(t, err, name)
+			assert.Empty(t, segments, name)
+
+			if f.Free != nil {
+				f.Free(a, kv)
+			}
+		}
+	})
+
+	t.Run("Writes app hashes missing from older chains", func(t *testing.T) {
+		want := &bytes.Buffer{}
+		if err := h.WriteSnapshot(want); err != nil {
+			t.Fatalf("h.WriteSnapshot(): err: %s", err)
+		}
+
+		// Older blocks have no evidences in their app hash.
+		for height := int64(1); height <= 2; height++ {
+			if _, err := f.kv.DeleteValue([]byte(fmt.Sprintf("tmpop:apphashes:%d", height))); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got := &bytes.Buffer{}
+		if assert.NoError(t, h.WriteSnapshot(got)) {
+			assert.Equal(t, want.String(), got.String())
+		}
+	})
+
+	t.Run("Writing before adopted permissions are committed fails", func(t *testing.T) {
+		var permissions *tmpop.Permissions
+		if err := makeQuery(h, tmpop.GetPermissions, nil, &permissions); err != nil {
+			t.Fatal(err)
+		}
+
+		update := &tmpop.PermissionsUpdate{
+			AdminUpdate: tmpop.AdminUpdate{PreviousHeight: permissions.Height},
+		}
+		update.Sign(chainID, admin)
+		req = commitTx(t, h, req, makeUpdatePermissionsTx(t, update))
+
+		err := h.WriteSnapshot(&bytes.Buffer{})
+		assert.Error(t, err)
+	})
+}
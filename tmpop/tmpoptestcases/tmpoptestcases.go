@@ -16,6 +16,7 @@ package tmpoptestcases
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -23,8 +24,10 @@ import (
 	"github.com/stratumn/sdk/cs/cstesting"
 	"github.com/stratumn/sdk/store"
 	"github.com/stratumn/sdk/tmpop"
+	"github.com/stratumn/sdk/types"
 
 	abci "github.com/tendermint/abci/types"
+	"github.com/tendermint/go-crypto"
 )
 
 const (
@@ -48,11 +51,22 @@ type Factory struct {
 func (f Factory) RunTests(t *testing.T) {
 	t.Run("TestLastBlock", f.TestLastBlock)
 	t.Run("TestTendermintEvidence", f.TestTendermintEvidence)
+	t.Run("TestAddEvidenceTx", f.TestAddEvidenceTx)
+	t.Run("TestAddEvidenceTxBackends", f.TestAddEvidenceTxBackends)
 	t.Run("TestQuery", f.TestQuery)
+	t.Run("TestQueryAtHeight", f.TestQueryAtHeight)
+	t.Run("TestQueryProofs", f.TestQueryProofs)
 	t.Run("TestCheckTx", f.TestCheckTx)
 	t.Run("TestDeliverTx", f.TestDeliverTx)
 	t.Run("TestCommitTx", f.TestCommitTx)
+	t.Run("TestDuplicateLinks", f.TestDuplicateLinks)
 	t.Run("TestValidation", f.TestValidation)
+	t.Run("TestAdminUpdates", f.TestAdminUpdates)
+	t.Run("TestUpdateRules", f.TestUpdateRules)
+	t.Run("TestUpdateValidators", f.TestUpdateValidators)
+	t.Run("TestPermissions", f.TestPermissions)
+	t.Run("TestSetOption", f.TestSetOption)
+	t.Run("TestSnapshot", f.TestSnapshot)
 }
 
 func (f Factory) free() {
@@ -99,6 +113,36 @@ func makeQuery(h *tmpop.TMPop, name string, args interface{}, res interface{}) e
 	return json.Unmarshal(q.Value, &res)
 }
 
+func makeQueryAt(h *tmpop.TMPop, name string, args interface{}, height int64, res interface{}) error {
+	bytes, err := tmpop.BuildQueryBinary(args)
+	if err != nil {
+		return err
+	}
+
+	q := h.Query(abci.RequestQuery{
+		Data:   bytes,
+		Path:   name,
+		Height: height,
+	})
+	if q.IsErr() {
+		return fmt.Errorf("query %s failed: %s", name, q.Log)
+	}
+	if q.Height != height {
+		return fmt.Errorf("query %s: height = %d want %d", name, q.Height, height)
+	}
+
+	return json.Unmarshal(q.Value, &res)
+}
+
+// getEvents returns the events saved since the given height.
+func getEvents(h *tmpop.TMPop, fromHeight int64) ([]*store.Event, error) {
+	events := &tmpop.Events{}
+	if err := makeQuery(h, tmpop.GetEvents, &tmpop.EventsFilter{FromHeight: fromHeight}, events); err != nil {
+		return nil, err
+	}
+	return events.Events, nil
+}
+
 func makeCreateRandomLinkTx(t *testing.T) (*cs.Link, []byte) {
 	l := cstesting.RandomLink()
 	return l, makeCreateLinkTx(t, l)
@@ -109,7 +153,79 @@ func makeCreateLinkTx(t *testing.T, l *cs.Link) []byte {
 		TxType: tmpop.CreateLink,
 		Link:   l,
 	}
-	res, err := json.Marshal(tx)
+	res, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// evidenceKey signs the evidences of the registered test providers.
+var evidenceKey = crypto.GenPrivKeyEd25519().Wrap()
+
+// evidenceProviders registers the evidence key for the given providers.
+func evidenceProviders(providers ...string) map[string][]crypto.PubKey {
+	res := make(map[string][]crypto.PubKey)
+	for _, provider := range providers {
+		res[provider] = []crypto.PubKey{evidenceKey.PubKey()}
+	}
+	return res
+}
+
+func makeAddEvidenceTx(t *testing.T, linkHash *types.Bytes32, e *cs.Evidence) []byte {
+	return makeSignedAddEvidenceTx(t, linkHash, e, evidenceKey)
+}
+
+// makeSignedAddEvidenceTx makes an evidence transaction signed by the given
+// key, or unsigned if the key is empty.
+func makeSignedAddEvidenceTx(t *testing.T, linkHash *types.Bytes32, e *cs.Evidence, key crypto.PrivKey) []byte {
+	tx := tmpop.Tx{
+		TxType:   tmpop.AddEvidenceTx,
+		LinkHash: linkHash,
+		Evidence: e,
+	}
+	if !key.Empty() {
+		if err := tx.SignEvidence(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func makeUpdateRulesTx(t *testing.T, u *tmpop.RulesUpdate) []byte {
+	tx := tmpop.Tx{
+		TxType:      tmpop.UpdateRules,
+		RulesUpdate: u,
+	}
+	res, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func makeUpdateValidatorsTx(t *testing.T, u *tmpop.ValidatorsUpdate) []byte {
+	tx := tmpop.Tx{
+		TxType:           tmpop.UpdateValidators,
+		ValidatorsUpdate: u,
+	}
+	res, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func makeUpdatePermissionsTx(t *testing.T, u *tmpop.PermissionsUpdate) []byte {
+	tx := tmpop.Tx{
+		TxType:            tmpop.UpdatePermissions,
+		PermissionsUpdate: u,
+	}
+	res, err := tx.MarshalBinary()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -16,6 +16,8 @@ package tmpoptestcases
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"testing"
 
 	"github.com/stratumn/sdk/cs"
@@ -37,6 +39,33 @@ func (f Factory) TestCheckTx(t *testing.T) {
 		assert.True(t, res.IsOK(), "Expected CheckTx to return an OK result, got %v", res)
 	})
 
+	t.Run("Check valid JSON-encoded link returns ok", func(t *testing.T) {
+		tx, err := json.Marshal(tmpop.Tx{
+			TxType: tmpop.CreateLink,
+			Link:   cstesting.RandomLink(),
+		})
+		assert.NoError(t, err)
+		res := h.CheckTx(tx)
+		assert.True(t, res.IsOK(), "Expected CheckTx to return an OK result, got %v", res)
+	})
+
+	t.Run("Check truncated binary Tx returns not-ok", func(t *testing.T) {
+		_, tx := makeCreateRandomLinkTx(t)
+		res := h.CheckTx(tx[:2])
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Check unsupported binary Tx version returns not-ok", func(t *testing.T) {
+		_, tx := makeCreateRandomLinkTx(t)
+		tx[0] = tmpop.TxVersionBinary + 1
+
+		err := (&tmpop.Tx{}).UnmarshalBinary(tx)
+		assert.EqualError(t, err, fmt.Sprintf("unsupported Tx version %X", tx[0]))
+
+		res := h.CheckTx(tx)
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
 	t.Run("Check link with invalid reference returns not-ok", func(t *testing.T) {
 		link := cstesting.RandomLink()
 		link.Meta["refs"] = []interface{}{map[string]interface{}{
@@ -133,8 +162,7 @@ func (f Factory) TestCommitTx(t *testing.T) {
 	})
 
 	t.Run("Committed link events are saved and can be queried", func(t *testing.T) {
-		var events []*store.Event
-		err := makeQuery(h, tmpop.PendingEvents, nil, &events)
+		events, err := getEvents(h, req.Header.Height)
 		assert.NoError(t, err)
 		assert.Equal(t, 1, len(events), "Invalid number of events")
 
@@ -147,3 +175,49 @@ func (f Factory) TestCommitTx(t *testing.T) {
 		assert.EqualValues(t, link2, savedLinks[1])
 	})
 }
+
+// TestDuplicateLinks tests that a link can only be created once.
+func (f Factory) TestDuplicateLinks(t *testing.T) {
+	h, req := f.newTMPop(t, nil)
+	defer f.free()
+
+	committed, req := commitRandomLink(t, h, req)
+
+	t.Run("Check committed link returns duplicate", func(t *testing.T) {
+		res := h.CheckTx(makeCreateLinkTx(t, committed))
+		assert.EqualValues(t, tmpop.CodeTypeDuplicate, res.Code)
+	})
+
+	t.Run("Check link checked in the current block returns duplicate", func(t *testing.T) {
+		_, tx := makeCreateRandomLinkTx(t)
+		res := h.CheckTx(tx)
+		assert.True(t, res.IsOK(), "Expected CheckTx to return an OK result, got %v", res)
+
+		res = h.CheckTx(tx)
+		assert.EqualValues(t, tmpop.CodeTypeDuplicate, res.Code)
+	})
+
+	t.Run("Deliver committed link returns duplicate", func(t *testing.T) {
+		h.BeginBlock(req)
+		res := h.DeliverTx(makeCreateLinkTx(t, committed))
+		assert.EqualValues(t, tmpop.CodeTypeDuplicate, res.Code)
+	})
+
+	t.Run("Deliver link twice in the same block commits it once", func(t *testing.T) {
+		link, tx := makeCreateRandomLinkTx(t)
+		res := h.DeliverTx(tx)
+		assert.True(t, res.IsOK(), "Expected DeliverTx to return an OK result, got %v", res)
+
+		res = h.DeliverTx(tx)
+		assert.EqualValues(t, tmpop.CodeTypeDuplicate, res.Code)
+
+		commitRes := h.Commit()
+		assert.True(t, commitRes.IsOK(), "h.Commit(): %s", commitRes.Log)
+
+		events, err := getEvents(h, req.Header.Height)
+		assert.NoError(t, err)
+		if assert.Equal(t, 1, len(events), "Invalid number of events") {
+			assert.Equal(t, []*cs.Link{link}, events[0].Data)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpoptestcases
+
+import (
+	"testing"
+
+	"github.com/stratumn/sdk/tmpop"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/abci/types"
+	"github.com/tendermint/go-crypto"
+)
+
+// TestUpdateValidators tests that the Tendermint validators are changed by
+// transactions signed by enough administrators.
+func (f Factory) TestUpdateValidators(t *testing.T) {
+	admin1 := crypto.GenPrivKeyEd25519().Wrap()
+	admin2 := crypto.GenPrivKeyEd25519().Wrap()
+
+	h, req := f.newTMPop(t, &tmpop.Config{
+		ValidatorsAdmins:    []crypto.PubKey{admin1.PubKey(), admin2.PubKey()},
+		ValidatorsApprovals: 2,
+	})
+	defer f.free()
+
+	genesis := &abci.Validator{PubKey: crypto.GenPrivKeyEd25519().PubKey().Bytes(), Power: 10}
+	added := &abci.Validator{PubKey: crypto.GenPrivKeyEd25519().PubKey().Bytes(), Power: 5}
+
+	t.Run("Rejects updates before the genesis validators are known", func(t *testing.T) {
+		u := &tmpop.ValidatorsUpdate{Validators: []*abci.Validator{added}}
+		u.Sign(chainID, admin1)
+		u.Sign(chainID, admin2)
+
+		res := h.CheckTx(makeUpdateValidatorsTx(t, u))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	h.InitChain(abci.RequestInitChain{Validators: []*abci.Validator{genesis}})
+
+	var active *tmpop.Validators
+	err := makeQuery(h, tmpop.GetValidators, nil, &active)
+	assert.NoError(t, err)
+	if !assert.NotNil(t, active, "Genesis validators should be saved") {
+		return
+	}
+	assert.Equal(t, []*abci.Validator{genesis}, active.Validators)
+
+	t.Run("Rejects removing every validator", func(t *testing.T) {
+		removed := &abci.Validator{PubKey: genesis.PubKey, Power: 0}
+		u := &tmpop.ValidatorsUpdate{
+			AdminUpdate: tmpop.AdminUpdate{PreviousHeight: active.Height},
+			Validators:  []*abci.Validator{removed},
+		}
+		u.Sign(chainID, admin1)
+		u.Sign(chainID, admin2)
+
+		res := h.CheckTx(makeUpdateValidatorsTx(t, u))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Rejects removing an unknown validator", func(t *testing.T) {
+		removed := &abci.Validator{PubKey: added.PubKey, Power: 0}
+		u := &tmpop.ValidatorsUpdate{
+			AdminUpdate: tmpop.AdminUpdate{PreviousHeight: active.Height},
+			Validators:  []*abci.Validator{removed},
+		}
+		u.Sign(chainID, admin1)
+		u.Sign(chainID, admin2)
+
+		res := h.CheckTx(makeUpdateValidatorsTx(t, u))
+		assert.EqualValues(t, tmpop.CodeTypeValidation, res.Code)
+	})
+
+	t.Run("Returns approved changes at the end of the block", func(t *testing.T) {
+		u := &tmpop.ValidatorsUpdate{
+			AdminUpdate: tmpop.AdminUpdate{PreviousHeight: active.Height},
+			Validators:  []*abci.Validator{added},
+		}
+		u.Sign(chainID, admin1)
+		u.Sign(chainID, admin2)
+		tx := makeUpdateValidatorsTx(t, u)
+
+		// The chain ID is known once a block began.
+		h.BeginBlock(req)
+		res := h.CheckTx(tx)
+		assert.True(t, res.IsOK(), "h.CheckTx(): %s", res.Log)
+
+		deliverRes := h.DeliverTx(tx)
+		assert.True(t, deliverRes.IsOK(), "h.DeliverTx(): %s", deliverRes.Log)
+
+		endRes := h.EndBlock(abci.RequestEndBlock{Height: req.Header.Height})
+		assert.Equal(t, []*abci.Validator{added}, endRes.ValidatorUpdates)
+
+		commitRes := h.Commit()
+		assert.True(t, commitRes.IsOK(), "h.Commit(): %s", commitRes.Log)
+		req = makeBeginBlock(commitRes.Data, req.Header.Height+1)
+
+		// Blocks without updates don't change validators.
+		req = commitTxs(t, h, req, nil)
+	})
+
+	t.Run("Queries the validators at each height", func(t *testing.T) {
+		var got *tmpop.Validators
+		err := makeQuery(h, tmpop.GetValidators, nil, &got)
+		assert.NoError(t, err)
+		if assert.NotNil(t, got) {
+			assert.Equal(t, int64(2), got.Height)
+			assert.Equal(t, 2, len(got.Validators), "Unexpected number of validators")
+		}
+
+		got = nil
+		err = makeQueryAt(h, tmpop.GetValidators, nil, 1, &got)
+		assert.NoError(t, err)
+		assert.Equal(t, active, got)
+	})
+}
@@ -15,18 +15,43 @@
 package tmpop
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"math"
 
 	"github.com/stratumn/sdk/cs"
 	"github.com/stratumn/sdk/types"
 )
 
+const (
+	// TxVersionBinary is the first byte of transactions using the binary encoding.
+	// JSON transactions start with '{' so both encodings can be told apart.
+	TxVersionBinary byte = 0x01
+)
+
 // TxType represents the type of a Transaction
 type TxType byte
 
 const (
 	// CreateLink characterizes a transaction that creates a new link
 	CreateLink TxType = iota
+
+	// AddEvidenceTx characterizes a transaction that adds an external
+	// evidence to an existing link
+	AddEvidenceTx
+
+	// UpdateRules characterizes a transaction that replaces the
+	// validation rules
+	UpdateRules
+
+	// UpdateValidators characterizes a transaction that changes the
+	// Tendermint validators
+	UpdateValidators
+
+	// UpdatePermissions characterizes a transaction that replaces the
+	// permissions of processes
+	UpdatePermissions
 )
 
 // Tx represents a TMPoP transaction
@@ -34,11 +59,182 @@ type Tx struct {
 	TxType   TxType         `json:"type"`
 	Link     *cs.Link       `json:"link"`
 	LinkHash *types.Bytes32 `json:"linkhash"`
+	Evidence *cs.Evidence   `json:"evidence"`
+
+	// The signature of an AddEvidenceTx by a key registered for the
+	// provider of the evidence.
+	Signature *Signature `json:"signature"`
+
+	RulesUpdate       *RulesUpdate       `json:"rulesUpdate"`
+	ValidatorsUpdate  *ValidatorsUpdate  `json:"validatorsUpdate"`
+	PermissionsUpdate *PermissionsUpdate `json:"permissionsUpdate"`
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// The binary layout is:
+//
+//	version (1 byte) | tx type (1 byte) | link hash length (1 byte) | link hash | payload
+//
+// The payload is the binary link of a CreateLink transaction encoded in CBOR.
+// The payload of an AddEvidenceTx transaction is:
+//
+//	signature length (2 bytes, big endian) | JSON signature | CBOR evidence
+//
+// where a zero length means the evidence isn't signed.
+// Administrator updates (UpdateRules, UpdateValidators and UpdatePermissions)
+// contain public keys and signatures that only have a JSON encoding, so their
+// payload is the JSON update.
+func (tx *Tx) MarshalBinary() ([]byte, error) {
+	txBytes := []byte{TxVersionBinary, byte(tx.TxType)}
+
+	if tx.LinkHash != nil {
+		txBytes = append(txBytes, byte(len(tx.LinkHash)))
+		txBytes = append(txBytes, tx.LinkHash[:]...)
+	} else {
+		txBytes = append(txBytes, 0)
+	}
+
+	var payload interface{}
+	switch tx.TxType {
+	case AddEvidenceTx:
+		var sigBytes []byte
+		if tx.Signature != nil {
+			var err error
+			if sigBytes, err = json.Marshal(tx.Signature); err != nil {
+				return nil, err
+			}
+			if len(sigBytes) > math.MaxUint16 {
+				return nil, fmt.Errorf("signature is too long")
+			}
+		}
+		txBytes = append(txBytes, byte(len(sigBytes)>>8), byte(len(sigBytes)))
+		txBytes = append(txBytes, sigBytes...)
+
+		if tx.Evidence != nil {
+			evidenceBytes, err := tx.Evidence.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			txBytes = append(txBytes, evidenceBytes...)
+		}
+	case UpdateRules:
+		if tx.RulesUpdate != nil {
+			payload = tx.RulesUpdate
+		}
+	case UpdateValidators:
+		if tx.ValidatorsUpdate != nil {
+			payload = tx.ValidatorsUpdate
+		}
+	case UpdatePermissions:
+		if tx.PermissionsUpdate != nil {
+			payload = tx.PermissionsUpdate
+		}
+	default:
+		if tx.Link != nil {
+			linkBytes, err := tx.Link.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			txBytes = append(txBytes, linkBytes...)
+		}
+	}
+
+	if payload != nil {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		txBytes = append(txBytes, payloadBytes...)
+	}
+
+	return txBytes, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (tx *Tx) UnmarshalBinary(txBytes []byte) error {
+	if len(txBytes) < 3 {
+		return fmt.Errorf("binary Tx is too short")
+	}
+	if txBytes[0] != TxVersionBinary {
+		return fmt.Errorf("unsupported Tx version %X", txBytes[0])
+	}
+
+	res := Tx{TxType: TxType(txBytes[1])}
+	linkHashLen := int(txBytes[2])
+	txBytes = txBytes[3:]
+
+	switch linkHashLen {
+	case 0:
+	case len(types.Bytes32{}):
+		if len(txBytes) < linkHashLen {
+			return fmt.Errorf("binary Tx is too short")
+		}
+		res.LinkHash = types.NewBytes32FromBytes(txBytes[:linkHashLen])
+		txBytes = txBytes[linkHashLen:]
+	default:
+		return fmt.Errorf("invalid link hash length %d", linkHashLen)
+	}
+
+	if len(txBytes) > 0 {
+		switch res.TxType {
+		case AddEvidenceTx:
+			if len(txBytes) < 2 {
+				return fmt.Errorf("binary Tx is too short")
+			}
+			sigLen := int(binary.BigEndian.Uint16(txBytes))
+			txBytes = txBytes[2:]
+			if len(txBytes) < sigLen {
+				return fmt.Errorf("binary Tx is too short")
+			}
+			if sigLen > 0 {
+				res.Signature = &Signature{}
+				if err := json.Unmarshal(txBytes[:sigLen], res.Signature); err != nil {
+					return err
+				}
+			}
+			if txBytes = txBytes[sigLen:]; len(txBytes) > 0 {
+				res.Evidence = &cs.Evidence{}
+				if err := res.Evidence.UnmarshalBinary(txBytes); err != nil {
+					return err
+				}
+			}
+		case UpdateRules:
+			res.RulesUpdate = &RulesUpdate{}
+			if err := json.Unmarshal(txBytes, res.RulesUpdate); err != nil {
+				return err
+			}
+		case UpdateValidators:
+			res.ValidatorsUpdate = &ValidatorsUpdate{}
+			if err := json.Unmarshal(txBytes, res.ValidatorsUpdate); err != nil {
+				return err
+			}
+		case UpdatePermissions:
+			res.PermissionsUpdate = &PermissionsUpdate{}
+			if err := json.Unmarshal(txBytes, res.PermissionsUpdate); err != nil {
+				return err
+			}
+		default:
+			res.Link = &cs.Link{}
+			if err := res.Link.UnmarshalBinary(txBytes); err != nil {
+				return err
+			}
+		}
+	}
+
+	*tx = res
+	return nil
 }
 
 func unmarshallTx(txBytes []byte) (*Tx, *ABCIError) {
 	tx := &Tx{}
 
+	if len(txBytes) > 0 && txBytes[0] == TxVersionBinary {
+		if err := tx.UnmarshalBinary(txBytes); err != nil {
+			return nil, &ABCIError{CodeTypeValidation, err.Error()}
+		}
+		return tx, nil
+	}
+
 	if err := json.Unmarshal(txBytes, tx); err != nil {
 		return nil, &ABCIError{CodeTypeValidation, err.Error()}
 	}
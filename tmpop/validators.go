@@ -0,0 +1,216 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpop
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/stratumn/sdk/types"
+	abci "github.com/tendermint/abci/types"
+	"github.com/tendermint/go-crypto"
+)
+
+// validatorsPrefix is the prefix of the database keys where validator sets
+// are saved by height.
+const validatorsPrefix = "tmpop:validatorset"
+
+// ValidatorsUpdate proposes changes to the Tendermint validator set. It must
+// be signed by enough administrators to be accepted.
+type ValidatorsUpdate struct {
+	AdminUpdate
+
+	// The validators to add or reweight. A power of zero removes a
+	// validator.
+	Validators []*abci.Validator `json:"validators"`
+}
+
+// Message returns the bytes signed by the administrators of the chain with
+// the given ID.
+func (u *ValidatorsUpdate) Message(chainID string) []byte {
+	validators, _ := json.Marshal(u.Validators)
+	return u.message(chainID, validatorsPrefix, validators)
+}
+
+// Sign adds the signature of an administrator of the chain with the given
+// ID to the update.
+func (u *ValidatorsUpdate) Sign(chainID string, privKey crypto.PrivKey) {
+	u.sign(u.Message(chainID), privKey)
+}
+
+// Validators is a Tendermint validator set adopted on chain.
+type Validators struct {
+	// The height of the first block validated by the set.
+	Height int64 `json:"height"`
+
+	// The validators, sorted by public key.
+	Validators []*abci.Validator `json:"validators"`
+}
+
+// Hash returns the hash of the validators.
+func (v *Validators) Hash() *types.Bytes32 {
+	validators, _ := json.Marshal(v.Validators)
+	hash := types.Bytes32(sha256.Sum256(validators))
+	return &hash
+}
+
+// apply returns the validators resulting from changes.
+func (v *Validators) apply(changes []*abci.Validator) ([]*abci.Validator, error) {
+	powers := make(map[string]int64, len(v.Validators))
+	for _, validator := range v.Validators {
+		powers[string(validator.PubKey)] = validator.Power
+	}
+
+	changed := make(map[string]bool, len(changes))
+	for _, change := range changes {
+		if change == nil || len(change.PubKey) == 0 {
+			return nil, errors.New("validator has no public key")
+		}
+		if _, err := crypto.PubKeyFromBytes(change.PubKey); err != nil {
+			return nil, fmt.Errorf("invalid validator public key: %v", err)
+		}
+
+		key := string(change.PubKey)
+		if changed[key] {
+			return nil, fmt.Errorf("validator %X is changed twice", change.PubKey)
+		}
+		changed[key] = true
+
+		switch {
+		case change.Power < 0:
+			return nil, fmt.Errorf("validator %X has a negative power", change.PubKey)
+		case change.Power == 0:
+			if _, ok := powers[key]; !ok {
+				return nil, fmt.Errorf("validator %X can't be removed because it doesn't exist", change.PubKey)
+			}
+			delete(powers, key)
+		default:
+			powers[key] = change.Power
+		}
+	}
+
+	if len(powers) == 0 {
+		return nil, errors.New("validator set can't be empty")
+	}
+
+	validators := make([]*abci.Validator, 0, len(powers))
+	for key, power := range powers {
+		validators = append(validators, &abci.Validator{PubKey: []byte(key), Power: power})
+	}
+	sortValidators(validators)
+
+	return validators, nil
+}
+
+func sortValidators(validators []*abci.Validator) {
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i].PubKey, validators[j].PubKey) < 0
+	})
+}
+
+// saveGenesisValidators saves the validators of the first block.
+func (t *TMPop) saveGenesisValidators(validators []*abci.Validator) error {
+	genesis := make([]*abci.Validator, len(validators))
+	copy(genesis, validators)
+	sortValidators(genesis)
+
+	return saveAtHeight(t.kvDB, validatorsPrefix, 1, &Validators{
+		Height:     1,
+		Validators: genesis,
+	})
+}
+
+// checkValidatorsUpdate checks that a validators update applies to the
+// latest validators and returns the validators it adopts.
+func (t *TMPop) checkValidatorsUpdate(u *ValidatorsUpdate) (*Validators, *ABCIError) {
+	if u == nil || len(u.Validators) == 0 {
+		return nil, &ABCIError{
+			CodeTypeValidation,
+			"A validators update requires validators",
+		}
+	}
+
+	latest, err := t.getValidatorsAt(-1)
+	if err != nil {
+		return nil, &ABCIError{CodeTypeInternalError, err.Error()}
+	}
+	if latest == nil {
+		return nil, &ABCIError{
+			CodeTypeValidation,
+			"Validators can't be updated because the genesis validators are unknown",
+		}
+	}
+
+	validators, err := latest.apply(u.Validators)
+	if err != nil {
+		return nil, &ABCIError{
+			CodeTypeValidation,
+			fmt.Sprintf("Invalid validators update: %v", err),
+		}
+	}
+
+	return &Validators{
+		Height:     t.currentHeader.GetHeight() + 1,
+		Validators: validators,
+	}, nil
+}
+
+// checkValidators checks a validators update.
+func (t *TMPop) checkValidators(u *ValidatorsUpdate) *ABCIError {
+	if _, err := t.checkValidatorsUpdate(u); !err.IsOK() {
+		return err
+	}
+	return t.validatorsUpdates.check(t.kvDB, &u.AdminUpdate, u.Message(t.currentHeader.GetChainId()))
+}
+
+// deliverValidators approves a validators update. The changes are returned
+// to Tendermint at the end of the block.
+func (t *TMPop) deliverValidators(u *ValidatorsUpdate) *ABCIError {
+	validators, err := t.checkValidatorsUpdate(u)
+	if !err.IsOK() {
+		return err
+	}
+	if err := t.validatorsUpdates.approve(t.kvDB, &u.AdminUpdate, u.Message(t.currentHeader.GetChainId()), validators); !err.IsOK() {
+		return err
+	}
+
+	t.validatorChanges = u.Validators
+	return nil
+}
+
+// saveValidators saves the validators approved in the current block, which
+// validate the blocks from the next one.
+func (t *TMPop) saveValidators() error {
+	t.validatorChanges = nil
+	_, err := t.validatorsUpdates.save(t.kvDB, t.currentHeader.Height+1)
+	return err
+}
+
+// getValidatorsAt returns the validators of the block at the given height,
+// or nil if they are unknown. A negative height returns the latest
+// validators.
+func (t *TMPop) getValidatorsAt(height int64) (*Validators, error) {
+	validators := &Validators{}
+	found, err := getAtHeight(t.kvDB, validatorsPrefix, height, validators)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return validators, nil
+}
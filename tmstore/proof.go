@@ -0,0 +1,259 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/tmpop"
+
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// verifyProofs verifies that segments were committed, using their proofs
+// and the app hashes of the block headers signed by the validators.
+func (t *TMStore) verifyProofs(segments cs.SegmentSlice, proofs []*tmpop.LinkProof) error {
+	if len(proofs) != len(segments) {
+		return errors.New("missing link proofs")
+	}
+
+	signedAppHashes := make(map[int64][]byte)
+	for i, segment := range segments {
+		proof := proofs[i]
+		if proof == nil {
+			return fmt.Errorf("segment %s has no proof", segment.GetLinkHashString())
+		}
+
+		linkHash, err := segment.Link.Hash()
+		if err != nil {
+			return err
+		}
+		if err := proof.Verify(linkHash); err != nil {
+			return err
+		}
+
+		appHash, ok := signedAppHashes[proof.BlockHeight]
+		if !ok {
+			if appHash, err = t.getSignedAppHash(proof.BlockHeight); err != nil {
+				return err
+			}
+			signedAppHashes[proof.BlockHeight] = appHash
+		}
+		if !proof.AppHash.EqualsBytes(appHash) {
+			return fmt.Errorf("proof of segment %s doesn't match the signed app hash", segment.GetLinkHashString())
+		}
+	}
+
+	return nil
+}
+
+// signedHeaderPollInterval is the interval between checks for the next block
+// when verifying the proofs of segments of the latest block.
+const signedHeaderPollInterval = 200 * time.Millisecond
+
+// heightValidators is a validator set verified from the trusted validators.
+type heightValidators struct {
+	// The height of the first block validated by the set.
+	height     int64
+	validators *tmtypes.ValidatorSet
+}
+
+// ReadGenesisValidators reads the validators of a Tendermint genesis file,
+// to be set as the trusted validators of the configuration.
+func ReadGenesisValidators(filename string) ([]*tmtypes.Validator, error) {
+	genDoc, err := tmtypes.GenesisDocFromFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	validators := make([]*tmtypes.Validator, len(genDoc.Validators))
+	for i, v := range genDoc.Validators {
+		validators[i] = tmtypes.NewValidator(v.PubKey, v.Power)
+	}
+
+	return validators, nil
+}
+
+// getSignedAppHash returns the app hash after the block at the given height.
+// It is read from the header of the next block, once its commit is verified
+// against the trusted validators. When the block is the latest one, it
+// waits for the next block.
+func (t *TMStore) getSignedAppHash(height int64) ([]byte, error) {
+	nextHeight := height + 1
+	if err := t.waitForBlock(nextHeight); err != nil {
+		return nil, err
+	}
+
+	commit, err := t.getSignedHeader(nextHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	validatorSet, err := t.getTrustedValidators(nextHeight, commit.Header.ValidatorsHash)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(validatorSet.Hash(), commit.Header.ValidatorsHash) {
+		return nil, fmt.Errorf("validators don't match header at height %d", nextHeight)
+	}
+	if err := validatorSet.VerifyCommit(commit.Header.ChainID, commit.Commit.BlockID, nextHeight, commit.Commit); err != nil {
+		return nil, err
+	}
+
+	return commit.Header.AppHash, nil
+}
+
+// waitForBlock waits until the block at the given height is committed, for
+// at most the signed header timeout.
+func (t *TMStore) waitForBlock(height int64) error {
+	timeout := time.After(t.config.GetSignedHeaderTimeout())
+	for {
+		status, err := t.tmClient.Status()
+		if err != nil {
+			return err
+		}
+		if status.LatestBlockHeight >= height {
+			return nil
+		}
+
+		select {
+		case <-timeout:
+			return fmt.Errorf("no signed header at height %d yet", height)
+		case <-time.After(signedHeaderPollInterval):
+		}
+	}
+}
+
+// getSignedHeader returns the header at the given height and the commit
+// signing it. The signatures are not verified.
+func (t *TMStore) getSignedHeader(height int64) (*ctypes.ResultCommit, error) {
+	commit, err := t.tmClient.Commit(&height)
+	if err != nil {
+		return nil, err
+	}
+	header := commit.Header
+	if header == nil || commit.Commit == nil || header.Height != height {
+		return nil, fmt.Errorf("no signed header at height %d", height)
+	}
+	if !bytes.Equal(header.Hash(), commit.Commit.BlockID.Hash) {
+		return nil, fmt.Errorf("signed commit doesn't match header at height %d", height)
+	}
+
+	return commit, nil
+}
+
+// getTrustedValidators returns the validators of the block at the given
+// height, whose header claims the given validators hash.
+//
+// The validators of the genesis block are trusted. Later validator sets are
+// adopted walking the headers forward, only when more than two thirds of
+// the voting power of the validators they replace signed their first block.
+// A change of more than a third of the voting power at once can therefore
+// not be followed. The walk is skipped while the claimed validators are the
+// last trusted ones, since these signatures are then enough.
+func (t *TMStore) getTrustedValidators(height int64, validatorsHash []byte) (*tmtypes.ValidatorSet, error) {
+	t.validatorsMutex.Lock()
+	defer t.validatorsMutex.Unlock()
+
+	if len(t.validators) == 0 {
+		if len(t.config.TrustedValidators) == 0 {
+			return nil, errors.New("proofs can't be verified without trusted validators")
+		}
+		t.validators = []*heightValidators{{
+			height:     1,
+			validators: tmtypes.NewValidatorSet(t.config.TrustedValidators),
+		}}
+	}
+
+	if height <= t.validatorsHeight {
+		for i := len(t.validators) - 1; i >= 0; i-- {
+			if t.validators[i].height <= height {
+				return t.validators[i].validators, nil
+			}
+		}
+	}
+
+	latest := t.validators[len(t.validators)-1].validators
+	if bytes.Equal(latest.Hash(), validatorsHash) {
+		return latest, nil
+	}
+
+	for h := t.validatorsHeight + 1; h <= height; h++ {
+		commit, err := t.getSignedHeader(h)
+		if err != nil {
+			return nil, err
+		}
+		header := commit.Header
+
+		validatorSet := latest
+		if !bytes.Equal(latest.Hash(), header.ValidatorsHash) {
+			validators, err := t.tmClient.Validators(&h)
+			if err != nil {
+				return nil, err
+			}
+			validatorSet = tmtypes.NewValidatorSet(validators.Validators)
+			if !bytes.Equal(validatorSet.Hash(), header.ValidatorsHash) {
+				return nil, fmt.Errorf("validators don't match header at height %d", h)
+			}
+			if err := verifyTrustedSignatures(latest, header.ChainID, commit.Commit.BlockID, h, commit.Commit); err != nil {
+				return nil, err
+			}
+		}
+		if err := validatorSet.VerifyCommit(header.ChainID, commit.Commit.BlockID, h, commit.Commit); err != nil {
+			return nil, err
+		}
+
+		if validatorSet != latest {
+			t.validators = append(t.validators, &heightValidators{height: h, validators: validatorSet})
+			latest = validatorSet
+		}
+		t.validatorsHeight = h
+	}
+
+	return latest, nil
+}
+
+// verifyTrustedSignatures checks that trusted validators signed more than
+// two thirds of their voting power of a commit made by other validators.
+func verifyTrustedSignatures(trusted *tmtypes.ValidatorSet, chainID string, blockID tmtypes.BlockID, height int64, commit *tmtypes.Commit) error {
+	var signed int64
+	signers := make(map[string]bool)
+
+	for _, vote := range commit.Precommits {
+		if vote == nil || vote.Height != height || vote.Type != tmtypes.VoteTypePrecommit || !blockID.Equals(vote.BlockID) {
+			continue
+		}
+		_, validator := trusted.GetByAddress(vote.ValidatorAddress)
+		if validator == nil || signers[string(validator.Address)] {
+			continue
+		}
+		if !validator.PubKey.VerifyBytes(vote.SignBytes(chainID), vote.Signature) {
+			return fmt.Errorf("invalid signature of validator %X at height %d", validator.Address, height)
+		}
+		signers[string(validator.Address)] = true
+		signed += validator.VotingPower
+	}
+
+	if signed*3 <= trusted.TotalVotingPower()*2 {
+		return fmt.Errorf("validators at height %d aren't signed by enough trusted validators", height)
+	}
+
+	return nil
+}
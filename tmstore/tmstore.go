@@ -20,6 +20,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/stratumn/sdk/bufferedbatch"
@@ -30,6 +32,7 @@ import (
 	"github.com/stratumn/sdk/utils"
 
 	abci "github.com/tendermint/abci/types"
+	"github.com/tendermint/go-crypto"
 	"github.com/tendermint/tendermint/rpc/client"
 	ctypes "github.com/tendermint/tendermint/rpc/core/types"
 	tmtypes "github.com/tendermint/tendermint/types"
@@ -51,6 +54,10 @@ const (
 
 	// DefaultWsRetryInterval is the default interval between Tendermint Websocket connection attempts.
 	DefaultWsRetryInterval = 5 * time.Second
+
+	// DefaultSignedHeaderTimeout is the default time to wait for the next
+	// block when verifying the proofs of segments of the latest block.
+	DefaultSignedHeaderTimeout = 10 * time.Second
 )
 
 // TMStore is the type that implements github.com/stratumn/sdk/store.Adapter.
@@ -60,6 +67,17 @@ type TMStore struct {
 	tmEventChan     chan interface{}
 	storeEventChans []chan *store.Event
 	tmClient        client.Client
+
+	// The height of the last block whose events were notified.
+	eventsHeight  int64
+	eventsStarted bool
+	eventsMutex   sync.Mutex
+
+	// The validator sets verified from the trusted validators, by height,
+	// and the height of the last block whose validators were verified.
+	validators       []*heightValidators
+	validatorsHeight int64
+	validatorsMutex  sync.Mutex
 }
 
 // Config contains configuration options for the store.
@@ -69,6 +87,43 @@ type Config struct {
 
 	// A git commit hash that will be set in the store's information.
 	Commit string
+
+	// Whether to verify that the segments returned by TMPop were
+	// committed, using the block headers signed by the validators.
+	// It requires TrustedValidators.
+	VerifyProofs bool
+
+	// The validators of the genesis block, such as returned by
+	// ReadGenesisValidators. The validators of later blocks are only
+	// trusted once enough of the validators they replace signed them, so
+	// that a node can't make up the signed headers it returns.
+	TrustedValidators []*tmtypes.Validator
+
+	// How long to wait for the next block when verifying the proof of a
+	// segment committed in the latest block, since its app hash is signed
+	// in the header of the next block.
+	SignedHeaderTimeout time.Duration
+
+	// The key signing the evidences added by AddEvidence. It must be
+	// registered for the providers of the evidences in the TMPop
+	// configuration.
+	EvidenceKey crypto.PrivKey
+
+	// The height of the last block whose events were notified by a
+	// previous process, as returned by EventsHeight. When positive, the
+	// events of the blocks committed since are notified with the first new
+	// block, so that they are not lost while the process is down.
+	// Otherwise only the events of new blocks are notified.
+	EventsFromHeight int64
+}
+
+// GetSignedHeaderTimeout returns the configuration's signed header timeout
+// or the default value.
+func (c *Config) GetSignedHeaderTimeout() time.Duration {
+	if c.SignedHeaderTimeout > 0 {
+		return c.SignedHeaderTimeout
+	}
+	return DefaultSignedHeaderTimeout
 }
 
 // Info is the info returned by GetInfo.
@@ -97,6 +152,10 @@ func (t *TMStore) StartWebsocket() error {
 		}
 	}
 
+	if err := t.startEvents(); err != nil {
+		return err
+	}
+
 	// TMPoP notifies us of store events that we forward to clients
 	t.tmEventChan = make(chan interface{}, 10)
 	go func() {
@@ -149,21 +208,71 @@ func (t *TMStore) StopWebsocket() error {
 	return nil
 }
 
-func (t *TMStore) notifyStoreChans() {
-	var pendingEvents []*store.Event
-	response, err := t.sendQuery(tmpop.PendingEvents, nil)
-	if err != nil || response.Value == nil {
-		log.Warn("Could not get pending events from TMPoP.")
+// startEvents sets the height from which events are notified the first
+// time the websocket is started. Events of the blocks committed while the
+// websocket was stopped are notified when it is restarted.
+func (t *TMStore) startEvents() error {
+	t.eventsMutex.Lock()
+	defer t.eventsMutex.Unlock()
+
+	if t.eventsStarted {
+		return nil
 	}
 
-	err = json.Unmarshal(response.Value, &pendingEvents)
+	response, err := t.sendQuery(tmpop.GetInfo, nil)
 	if err != nil {
-		log.Warn("TMPoP pending events could not be unmarshalled.")
+		return err
+	}
+
+	t.eventsHeight = response.Height
+	if t.config.EventsFromHeight > 0 && t.config.EventsFromHeight < response.Height {
+		t.eventsHeight = t.config.EventsFromHeight
 	}
+	t.eventsStarted = true
 
-	for _, event := range pendingEvents {
-		for _, c := range t.storeEventChans {
-			c <- event
+	return nil
+}
+
+// EventsHeight returns the height of the last block whose events were
+// notified. It can be saved to set Config.EventsFromHeight when the process
+// restarts.
+func (t *TMStore) EventsHeight() int64 {
+	t.eventsMutex.Lock()
+	defer t.eventsMutex.Unlock()
+
+	return t.eventsHeight
+}
+
+func (t *TMStore) notifyStoreChans() {
+	t.eventsMutex.Lock()
+	defer t.eventsMutex.Unlock()
+
+	for {
+		response, err := t.sendQuery(tmpop.GetEvents, &tmpop.EventsFilter{FromHeight: t.eventsHeight + 1})
+		if err != nil || response.Value == nil {
+			log.Warn("Could not get events from TMPoP.")
+			return
+		}
+
+		var events tmpop.Events
+		if err := json.Unmarshal(response.Value, &events); err != nil {
+			log.Warn("TMPoP events could not be unmarshalled.")
+			return
+		}
+
+		for _, event := range events.Events {
+			for _, c := range t.storeEventChans {
+				c <- event
+			}
+		}
+
+		if events.LastHeight <= t.eventsHeight {
+			return
+		}
+
+		t.eventsHeight = events.LastHeight
+		if t.eventsHeight >= response.Height {
+			return
 		}
 	}
 }
@@ -213,32 +322,22 @@ func (t *TMStore) CreateLink(link *cs.Link) (*types.Bytes32, error) {
 }
 
 // AddEvidence implements github.com/stratumn/sdk/store.EvidenceWriter.AddEvidence.
+// The evidence goes through a transaction so that it is replicated on all
+// the nodes. The saved evidence event is sent once the block is committed.
 func (t *TMStore) AddEvidence(linkHash *types.Bytes32, evidence *cs.Evidence) error {
-	// Adding an external evidence does not require consensus
-	// So it will not go through a blockchain transaction, but will rather
-	// be stored in TMPoP's store directly
-	_, err := t.sendQuery(
-		tmpop.AddEvidence,
-		struct {
-			LinkHash *types.Bytes32
-			Evidence *cs.Evidence
-		}{
-			linkHash,
-			evidence,
-		})
-
-	if err != nil {
-		return err
+	tx := &tmpop.Tx{
+		TxType:   tmpop.AddEvidenceTx,
+		LinkHash: linkHash,
+		Evidence: evidence,
 	}
-
-	evidenceEvent := store.NewSavedEvidences()
-	evidenceEvent.AddSavedEvidence(linkHash, evidence)
-
-	for _, c := range t.storeEventChans {
-		c <- evidenceEvent
+	if !t.config.EvidenceKey.Empty() {
+		if err := tx.SignEvidence(t.config.EvidenceKey); err != nil {
+			return err
+		}
 	}
+	_, err := t.broadcastTx(tx)
 
-	return nil
+	return err
 }
 
 // GetEvidences implements github.com/stratumn/sdk/store.EvidenceReader.GetEvidences.
@@ -261,8 +360,15 @@ func (t *TMStore) GetEvidences(linkHash *types.Bytes32) (evidences *cs.Evidences
 }
 
 // GetSegment implements github.com/stratumn/sdk/store.SegmentReader.GetSegment.
-func (t *TMStore) GetSegment(linkHash *types.Bytes32) (segment *cs.Segment, err error) {
-	response, err := t.sendQuery(tmpop.GetSegment, linkHash)
+func (t *TMStore) GetSegment(linkHash *types.Bytes32) (*cs.Segment, error) {
+	return t.GetSegmentAt(linkHash, 0)
+}
+
+// GetSegmentAt returns the segment with the given link hash as it was at the
+// given block height. It returns nil if the link was committed after that
+// height. A height of zero means the latest commit.
+func (t *TMStore) GetSegmentAt(linkHash *types.Bytes32, height int64) (segment *cs.Segment, err error) {
+	response, err := t.sendQueryAt(tmpop.GetSegment, linkHash, height)
 	if err != nil {
 		return
 	}
@@ -279,13 +385,33 @@ func (t *TMStore) GetSegment(linkHash *types.Bytes32) (segment *cs.Segment, err
 	// Return nil when no segment has been found (and not an empty segment)
 	if segment.IsEmpty() {
 		segment = nil
+		return
+	}
+
+	if t.config.VerifyProofs {
+		proof := &tmpop.LinkProof{}
+		if err = json.Unmarshal(response.Proof, proof); err != nil {
+			return nil, err
+		}
+		if err = t.verifyProofs(cs.SegmentSlice{segment}, []*tmpop.LinkProof{proof}); err != nil {
+			return nil, err
+		}
 	}
+
 	return
 }
 
 // FindSegments implements github.com/stratumn/sdk/store.SegmentReader.FindSegments.
-func (t *TMStore) FindSegments(filter *store.SegmentFilter) (segmentSlice cs.SegmentSlice, err error) {
-	response, err := t.sendQuery(tmpop.FindSegments, filter)
+func (t *TMStore) FindSegments(filter *store.SegmentFilter) (cs.SegmentSlice, error) {
+	return t.FindSegmentsAt(filter, 0)
+}
+
+// FindSegmentsAt finds the segments that existed at the given block height.
+// A height of zero means the latest commit.
+// The cost of the query grows with the number of links committed since
+// that height.
+func (t *TMStore) FindSegmentsAt(filter *store.SegmentFilter, height int64) (segmentSlice cs.SegmentSlice, err error) {
+	response, err := t.sendQueryAt(tmpop.FindSegments, filter, height)
 	if err != nil {
 		return
 	}
@@ -295,12 +421,34 @@ func (t *TMStore) FindSegments(filter *store.SegmentFilter) (segmentSlice cs.Seg
 		return
 	}
 
+	if t.config.VerifyProofs {
+		var proofs []*tmpop.LinkProof
+		if err = json.Unmarshal(response.Proof, &proofs); err != nil {
+			return nil, err
+		}
+		if err = t.verifyProofs(segmentSlice, proofs); err != nil {
+			return nil, err
+		}
+	}
+
 	return
 }
 
 // GetMapIDs implements github.com/stratumn/sdk/store.SegmentReader.GetMapIDs.
-func (t *TMStore) GetMapIDs(filter *store.MapFilter) (ids []string, err error) {
-	response, err := t.sendQuery(tmpop.GetMapIDs, filter)
+func (t *TMStore) GetMapIDs(filter *store.MapFilter) ([]string, error) {
+	return t.GetMapIDsAt(filter, 0)
+}
+
+// GetMapIDsAt returns the IDs of the maps that existed at the given block
+// height. A height of zero means the latest commit.
+// The cost of the query grows with the number of links committed since
+// that height.
+func (t *TMStore) GetMapIDsAt(filter *store.MapFilter, height int64) (ids []string, err error) {
+	response, err := t.sendQueryAt(tmpop.GetMapIDs, filter, height)
+	if err != nil {
+		return
+	}
+
 	err = json.Unmarshal(response.Value, &ids)
 	if err != nil {
 		return
@@ -315,7 +463,7 @@ func (t *TMStore) NewBatch() (store.Batch, error) {
 }
 
 func (t *TMStore) broadcastTx(tx *tmpop.Tx) (*ctypes.ResultBroadcastTxCommit, error) {
-	txBytes, err := json.Marshal(tx)
+	txBytes, err := tx.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
@@ -325,14 +473,24 @@ func (t *TMStore) broadcastTx(tx *tmpop.Tx) (*ctypes.ResultBroadcastTxCommit, er
 		return nil, err
 	}
 	if result.CheckTx.IsErr() {
-		if result.CheckTx.Code == tmpop.CodeTypeValidation {
-			// TODO: this package should be HTTP unaware, so
-			// we need a better way to pass error types.
+		switch result.CheckTx.Code {
+		// TODO: this package should be HTTP unaware, so
+		// we need a better way to pass error types.
+		case tmpop.CodeTypeValidation:
 			return nil, jsonhttp.NewErrBadRequest(result.CheckTx.Error())
+		case tmpop.CodeTypeForbidden:
+			return nil, jsonhttp.NewErrHTTP(result.CheckTx.Error(), http.StatusForbidden)
+		case tmpop.CodeTypeDuplicate:
+			return nil, jsonhttp.NewErrHTTP(result.CheckTx.Error(), http.StatusConflict)
 		}
 		return nil, fmt.Errorf(result.CheckTx.Error())
 	}
 	if result.DeliverTx.IsErr() {
+		// A link checked twice before being delivered is only rejected
+		// when delivered.
+		if result.DeliverTx.Code == tmpop.CodeTypeDuplicate {
+			return nil, jsonhttp.NewErrHTTP(result.DeliverTx.Error(), http.StatusConflict)
+		}
 		return nil, fmt.Errorf(result.DeliverTx.Error())
 	}
 
@@ -340,12 +498,19 @@ func (t *TMStore) broadcastTx(tx *tmpop.Tx) (*ctypes.ResultBroadcastTxCommit, er
 }
 
 func (t *TMStore) sendQuery(name string, args interface{}) (res *abci.ResponseQuery, err error) {
+	return t.sendQueryAt(name, args, 0)
+}
+
+func (t *TMStore) sendQueryAt(name string, args interface{}, height int64) (res *abci.ResponseQuery, err error) {
 	query, err := tmpop.BuildQueryBinary(args)
 	if err != nil {
 		return
 	}
 
-	response, err := t.tmClient.ABCIQuery(name, query)
+	response, err := t.tmClient.ABCIQueryWithOptions(name, query, client.ABCIQueryOptions{
+		Height:  height,
+		Trusted: !t.config.VerifyProofs,
+	})
 	if err != nil {
 		return
 	}
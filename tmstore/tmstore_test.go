@@ -17,12 +17,19 @@ package tmstore
 import (
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/stratumn/sdk/cs"
 	"github.com/stratumn/sdk/cs/cstesting"
 	"github.com/stratumn/sdk/jsonhttp"
 	"github.com/stratumn/sdk/store"
 	"github.com/stratumn/sdk/store/storetestcases"
+	"github.com/stratumn/sdk/tmpop"
 	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/go-crypto"
+	"github.com/tendermint/tendermint/rpc/client"
+	rpctest "github.com/tendermint/tendermint/rpc/test"
+	tmtypes "github.com/tendermint/tendermint/types"
 )
 
 var (
@@ -93,3 +100,88 @@ func TestValidation(t *testing.T) {
 	assert.True(t, ok, "Invalid error received: want ErrHTTP")
 	assert.Equal(t, http.StatusBadRequest, errHTTP.Status())
 }
+
+// TestVerifyProofs tests that segments are verified against the headers
+// signed by the validators.
+func TestVerifyProofs(t *testing.T) {
+	validators, err := ReadGenesisValidators(rpctest.GetConfig().GenesisFile())
+	if !assert.NoError(t, err) {
+		return
+	}
+	tmstore := New(&Config{VerifyProofs: true, TrustedValidators: validators}, client.NewLocal(testNode))
+
+	l := cstesting.RandomLink()
+	linkHash, err := tmstore.CreateLink(l)
+	assert.NoError(t, err)
+
+	// The app hash of the block is only signed in the header of the next
+	// block, which the store waits for.
+	segment, err := tmstore.GetSegment(linkHash)
+	assert.NoError(t, err)
+	if assert.NotNil(t, segment) {
+		assert.EqualValues(t, l, &segment.Link)
+	}
+
+	segments, err := tmstore.FindSegments(&store.SegmentFilter{
+		Pagination: store.Pagination{Limit: store.DefaultLimit},
+		Process:    l.GetProcess(),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(segments), "Unexpected number of segments")
+
+	t.Run("Rejects headers of untrusted validators", func(t *testing.T) {
+		untrusted := []*tmtypes.Validator{tmtypes.NewValidator(crypto.GenPrivKeyEd25519().PubKey(), 10)}
+		tmstore := New(&Config{VerifyProofs: true, TrustedValidators: untrusted}, client.NewLocal(testNode))
+
+		_, err := tmstore.GetSegment(linkHash)
+		assert.Error(t, err)
+	})
+
+	t.Run("Requires trusted validators", func(t *testing.T) {
+		tmstore := New(&Config{VerifyProofs: true}, client.NewLocal(testNode))
+
+		_, err := tmstore.GetSegment(linkHash)
+		assert.Error(t, err)
+	})
+}
+
+// TestEventsFromHeight tests that a restarted store notifies the events of
+// the blocks committed while it was stopped.
+func TestEventsFromHeight(t *testing.T) {
+	previous := NewTestClient()
+	response, err := previous.sendQuery(tmpop.GetInfo, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	missed := cstesting.RandomLink()
+	missedHash, err := previous.CreateLink(missed)
+	assert.NoError(t, err)
+
+	restarted := New(&Config{EventsFromHeight: response.Height}, client.NewLocal(testNode))
+	eventChan := make(chan *store.Event, 10)
+	restarted.AddStoreEventChannel(eventChan)
+	assert.NoError(t, restarted.StartWebsocket())
+	defer restarted.StopWebsocket()
+
+	// Events are notified with the next block.
+	_, err = restarted.CreateLink(cstesting.RandomLink())
+	assert.NoError(t, err)
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event := <-eventChan:
+			if event.EventType != store.SavedLinks {
+				continue
+			}
+			for _, l := range event.Data.([]*cs.Link) {
+				if linkHash, _ := l.Hash(); *linkHash == *missedHash {
+					return
+				}
+			}
+		case <-timeout:
+			t.Fatal("The event of the missed link wasn't notified")
+		}
+	}
+}
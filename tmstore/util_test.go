@@ -11,6 +11,7 @@ import (
 
 	"github.com/stratumn/sdk/dummystore"
 	"github.com/stratumn/sdk/tmpop"
+	"github.com/tendermint/go-crypto"
 	node "github.com/tendermint/tendermint/node"
 	"github.com/tendermint/tendermint/rpc/client"
 	rpctest "github.com/tendermint/tendermint/rpc/test"
@@ -20,11 +21,14 @@ var (
 	testDummyStore *dummystore.DummyStore
 	testTmpop      *tmpop.TMPop
 	testNode       *node.Node
+
+	// testEvidenceKey signs the evidences of the store test cases.
+	testEvidenceKey = crypto.GenPrivKeyEd25519().Wrap()
 )
 
 // NewTestClient returns a rpc client pointing to the test node
 func NewTestClient() *TMStore {
-	return New(&Config{}, client.NewLocal(testNode))
+	return New(&Config{EvidenceKey: testEvidenceKey}, client.NewLocal(testNode))
 }
 
 func ResetNode() {
@@ -37,6 +41,9 @@ func StartNode() *node.Node {
 	var err error
 	testTmpop, err = tmpop.New(testDummyStore, testDummyStore, &tmpop.Config{
 		ValidatorFilename: filepath.Join("testdata", "rules.json"),
+		// The store test cases add evidences without valid proofs.
+		SkipEvidenceVerification: true,
+		EvidenceProviders:        testEvidenceProviders(),
 	})
 	if err != nil {
 		panic(err)
@@ -52,3 +59,12 @@ func StartNode() *node.Node {
 
 	return testNode
 }
+
+// testEvidenceProviders registers the providers of the store test cases.
+func testEvidenceProviders() map[string][]crypto.PubKey {
+	providers := make(map[string][]crypto.PubKey)
+	for _, provider := range []string{"1", "2", "3", "4", "5", "42"} {
+		providers[provider] = []crypto.PubKey{testEvidenceKey.PubKey()}
+	}
+	return providers
+}
@@ -0,0 +1,42 @@
+package tsa
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	url      string
+	policy   string
+	username string
+	password string
+	timeout  time.Duration
+)
+
+// RegisterFlags registers the flags used by InitializeWithFlags.
+func RegisterFlags() {
+	flag.StringVar(&url, "tsa", os.Getenv("TSA_URL"), "URL of the RFC 3161 timestamp authority")
+	flag.StringVar(&policy, "tsapolicy", "", "optional policy OID requested to the timestamp authority")
+	flag.StringVar(&username, "tsauser", os.Getenv("TSA_USERNAME"), "optional username for the timestamp authority")
+	flag.StringVar(&password, "tsapassword", os.Getenv("TSA_PASSWORD"), "optional password for the timestamp authority")
+	flag.DurationVar(&timeout, "tsatimeout", DefaultTimeout, "timeout of requests to the timestamp authority")
+}
+
+// InitializeWithFlags should be called after RegisterFlags and flag.Parse to
+// initialize a TSA client using flag values.
+func InitializeWithFlags() *Client {
+	c, err := New(&Config{
+		URL:      url,
+		Policy:   policy,
+		Username: username,
+		Password: password,
+		Timeout:  timeout,
+	})
+	if err != nil {
+		log.WithField("error", err).Fatal("Failed to create TSA client")
+	}
+	return c
+}
@@ -0,0 +1,367 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"time"
+
+	// Register hash functions used by time-stamp tokens.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/pkg/errors"
+)
+
+// Object identifiers used by RFC 3161 and CMS (RFC 5652).
+var (
+	OIDSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	OIDSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	OIDSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	OIDSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	OIDTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	OIDContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+var (
+	// ErrInvalidSignature is returned when the CMS signature of a token is
+	// invalid.
+	ErrInvalidSignature = errors.New("invalid time-stamp token signature")
+
+	// ErrImprintMismatch is returned when the message imprint of a token
+	// does not match the expected hash.
+	ErrImprintMismatch = errors.New("message imprint mismatch")
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"optional,tag:0"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time        `asn1:"generalized"`
+	Accuracy       accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+// TSTInfo contains the information a timestamp authority signed.
+type TSTInfo struct {
+	Policy        asn1.ObjectIdentifier
+	HashAlgorithm asn1.ObjectIdentifier
+	HashedMessage []byte
+	SerialNumber  *big.Int
+	GenTime       time.Time
+	Nonce         *big.Int
+}
+
+// Token is a parsed RFC 3161 time-stamp token.
+type Token struct {
+	// Raw is the DER encoded token.
+	Raw []byte
+
+	// Info is the signed time-stamp information.
+	Info *TSTInfo
+
+	// Certificates contains the certificates included in the token.
+	Certificates []*x509.Certificate
+
+	eContent []byte
+	signer   signerInfo
+}
+
+// ParseToken parses a DER encoded time-stamp token (a CMS SignedData
+// structure whose content is a TSTInfo).
+func ParseToken(der []byte) (*Token, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, errors.WithStack(err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after time-stamp token")
+	}
+	if !ci.ContentType.Equal(OIDSignedData) {
+		return nil, errors.Errorf("unexpected content type %v", ci.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(OIDTSTInfo) {
+		return nil, errors.Errorf("unexpected encapsulated content type %v", sd.EncapContentInfo.EContentType)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, errors.Errorf("time-stamp token has %d signers want 1", len(sd.SignerInfos))
+	}
+
+	var eContent []byte
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &eContent); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(eContent, &info); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		var err error
+		if certs, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return &Token{
+		Raw: der,
+		Info: &TSTInfo{
+			Policy:        info.Policy,
+			HashAlgorithm: info.MessageImprint.HashAlgorithm.Algorithm,
+			HashedMessage: info.MessageImprint.HashedMessage,
+			SerialNumber:  info.SerialNumber,
+			GenTime:       info.GenTime,
+			Nonce:         info.Nonce,
+		},
+		Certificates: certs,
+		eContent:     eContent,
+		signer:       sd.SignerInfos[0],
+	}, nil
+}
+
+// Verify checks the CMS signature of the token and that its message imprint
+// is the given SHA-256 hash.
+// It does not check that the signing certificate is trusted, see VerifyChain.
+func (t *Token) Verify(hashedMessage []byte) error {
+	if !t.Info.HashAlgorithm.Equal(OIDSHA256) || !bytes.Equal(t.Info.HashedMessage, hashedMessage) {
+		return ErrImprintMismatch
+	}
+
+	cert := t.SigningCertificate()
+	if cert == nil {
+		return errors.New("signing certificate not found in time-stamp token")
+	}
+
+	hash, err := hashFromOID(t.signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	signed := t.eContent
+	if len(t.signer.SignedAttrs.FullBytes) > 0 {
+		// The signed attributes must contain the digest of the content.
+		// The signature is then computed over their DER encoding as a SET.
+		if err := t.verifySignedAttrs(hash); err != nil {
+			return err
+		}
+		signed = append([]byte{0x31}, t.signer.SignedAttrs.FullBytes[1:]...)
+	}
+
+	sigAlg, err := signatureAlgorithm(cert, hash)
+	if err != nil {
+		return err
+	}
+	if err := cert.CheckSignature(sigAlg, signed, t.signer.Signature); err != nil {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// VerifyChain checks that the signing certificate chains to one of the given
+// roots and is allowed to sign time-stamps.
+func (t *Token) VerifyChain(roots *x509.CertPool) error {
+	cert := t.SigningCertificate()
+	if cert == nil {
+		return errors.New("signing certificate not found in time-stamp token")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range t.Certificates {
+		if c != cert {
+			intermediates.AddCert(c)
+		}
+	}
+
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   t.Info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	return errors.WithStack(err)
+}
+
+// SigningCertificate returns the certificate of the signer if the token
+// contains it.
+func (t *Token) SigningCertificate() *x509.Certificate {
+	for _, c := range t.Certificates {
+		if c.SerialNumber.Cmp(t.signer.SID.SerialNumber) == 0 &&
+			bytes.Equal(c.RawIssuer, t.signer.SID.Issuer.FullBytes) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (t *Token) verifySignedAttrs(hash crypto.Hash) error {
+	var attrs []attribute
+	set := append([]byte{0x31}, t.signer.SignedAttrs.FullBytes[1:]...)
+	if _, err := asn1.UnmarshalWithParams(set, &attrs, "set"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var digest []byte
+	var contentType asn1.ObjectIdentifier
+	for _, attr := range attrs {
+		switch {
+		case attr.Type.Equal(OIDMessageDigest):
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &digest); err != nil {
+				return errors.WithStack(err)
+			}
+		case attr.Type.Equal(OIDContentType):
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &contentType); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	if !contentType.Equal(OIDTSTInfo) {
+		return ErrInvalidSignature
+	}
+
+	h := hash.New()
+	h.Write(t.eContent)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func hashFromOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(OIDSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(OIDSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(OIDSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, errors.Errorf("unsupported digest algorithm %v", oid)
+}
+
+func signatureAlgorithm(cert *x509.Certificate, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		switch hash {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, errors.New("unsupported signature algorithm")
+}
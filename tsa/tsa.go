@@ -0,0 +1,238 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tsa implements a client for the RFC 3161 Time-Stamp Protocol and
+// the verification of the time-stamp tokens it returns.
+package tsa
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/stratumn/sdk/types"
+)
+
+const (
+	// Description is the description set in the timestamper's information.
+	Description = "RFC 3161 Timestamper"
+
+	// DefaultTimeout is the default timeout of requests to the TSA.
+	DefaultTimeout = 30 * time.Second
+
+	// QueryContentType is the content type of time-stamp requests.
+	QueryContentType = "application/timestamp-query"
+
+	// ReplyContentType is the content type of time-stamp responses.
+	ReplyContentType = "application/timestamp-reply"
+)
+
+// PKI statuses of a time-stamp response.
+const (
+	StatusGranted = iota
+	StatusGrantedWithMods
+	StatusRejection
+	StatusWaiting
+	StatusRevocationWarning
+	StatusRevocationNotification
+)
+
+var (
+	// ErrNonceMismatch is returned when the nonce of a response does not
+	// match the one of the request.
+	ErrNonceMismatch = errors.New("nonce mismatch")
+)
+
+// Info is the info returned by GetInfo.
+type Info struct {
+	URL         string
+	Description string
+}
+
+// HashTimestamper must be able to obtain a time-stamp token for a hash.
+type HashTimestamper interface {
+	// GetInfo returns information on the timestamper.
+	GetInfo() *Info
+
+	// TimestampHash returns a DER encoded time-stamp token for the hash.
+	TimestampHash(hash *types.Bytes32) ([]byte, error)
+}
+
+// Config contains configuration options for the client.
+type Config struct {
+	// The URL of the timestamp authority.
+	URL string
+
+	// An optional policy OID (ie "1.2.3.4") requested to the TSA.
+	Policy string
+
+	// Optional credentials for HTTP basic authentication.
+	Username string
+	Password string
+
+	// The timeout of requests to the TSA.
+	Timeout time.Duration
+}
+
+// Client is an RFC 3161 client that implements HashTimestamper.
+type Client struct {
+	config *Config
+	policy asn1.ObjectIdentifier
+	client *http.Client
+}
+
+// New creates an instance of a Client.
+func New(config *Config) (*Client, error) {
+	if config.URL == "" {
+		return nil, errors.New("a TSA URL is required")
+	}
+
+	var policy asn1.ObjectIdentifier
+	if config.Policy != "" {
+		var err error
+		if policy, err = ParseOID(config.Policy); err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Client{
+		config: config,
+		policy: policy,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// GetInfo implements HashTimestamper.GetInfo.
+func (c *Client) GetInfo() *Info {
+	return &Info{
+		URL:         c.config.URL,
+		Description: Description,
+	}
+}
+
+// TimestampHash implements HashTimestamper.TimestampHash.
+func (c *Client) TimestampHash(hash *types.Bytes32) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	req, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  OIDSHA256,
+				Parameters: asn1.NullRawValue,
+			},
+			HashedMessage: hash[:],
+		},
+		ReqPolicy: c.policy,
+		Nonce:     nonce,
+		CertReq:   true,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	httpReq, err := http.NewRequest("POST", c.config.URL, bytes.NewReader(req))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	httpReq.Header.Set("Content-Type", QueryContentType)
+	if c.config.Username != "" {
+		httpReq.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+
+	res, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("TSA responded with HTTP status %d", res.StatusCode)
+	}
+
+	token, err := ParseResponse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if t.Info.Nonce == nil || t.Info.Nonce.Cmp(nonce) != 0 {
+		return nil, ErrNonceMismatch
+	}
+	if err := t.Verify(hash[:]); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// ParseResponse parses a DER encoded time-stamp response and returns the
+// time-stamp token it contains.
+func ParseResponse(der []byte) ([]byte, error) {
+	var res timeStampResp
+	if rest, err := asn1.Unmarshal(der, &res); err != nil {
+		return nil, errors.WithStack(err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after time-stamp response")
+	}
+
+	if status := res.Status.Status; status != StatusGranted && status != StatusGrantedWithMods {
+		return nil, errors.Errorf("TSA rejected the request with status %d: %v", status, res.Status.StatusString)
+	}
+	if len(res.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("time-stamp response has no token")
+	}
+
+	return res.TimeStampToken.FullBytes, nil
+}
+
+// ParseOID parses a dotted OID string.
+func ParseOID(s string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid OID %q", s)
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 {
+		return nil, errors.Errorf("invalid OID %q", s)
+	}
+	return oid, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsa_test
+
+import (
+	"crypto/x509"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/tsa"
+	"github.com/stratumn/sdk/tsa/tsatesting"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClient(t *testing.T) (*tsa.Client, *tsatesting.Authority, func()) {
+	authority, err := tsatesting.New()
+	if err != nil {
+		t.Fatalf("tsatesting.New(): err: %s", err)
+	}
+	server := httptest.NewServer(authority)
+
+	c, err := tsa.New(&tsa.Config{URL: server.URL, Policy: "1.2.3.4"})
+	if err != nil {
+		t.Fatalf("tsa.New(): err: %s", err)
+	}
+
+	return c, authority, server.Close
+}
+
+func TestNew_noURL(t *testing.T) {
+	_, err := tsa.New(&tsa.Config{})
+	assert.Error(t, err)
+}
+
+func TestNew_invalidPolicy(t *testing.T) {
+	_, err := tsa.New(&tsa.Config{URL: "http://localhost", Policy: "1.a"})
+	assert.Error(t, err)
+}
+
+func TestGetInfo(t *testing.T) {
+	c, err := tsa.New(&tsa.Config{URL: "http://localhost"})
+	if err != nil {
+		t.Fatalf("tsa.New(): err: %s", err)
+	}
+	info := c.GetInfo()
+	assert.Equal(t, "http://localhost", info.URL)
+	assert.Equal(t, tsa.Description, info.Description)
+}
+
+func TestTimestampHash(t *testing.T) {
+	c, authority, close := newClient(t)
+	defer close()
+
+	hash := testutil.RandomHash()
+	token, err := c.TimestampHash(hash)
+	if err != nil {
+		t.Fatalf("c.TimestampHash(): err: %s", err)
+	}
+
+	parsed, err := tsa.ParseToken(token)
+	if err != nil {
+		t.Fatalf("tsa.ParseToken(): err: %s", err)
+	}
+
+	assert.Equal(t, hash[:], parsed.Info.HashedMessage)
+	assert.True(t, parsed.Info.Policy.Equal(authority.Policy))
+	assert.NotZero(t, parsed.Info.GenTime)
+	assert.NoError(t, parsed.Verify(hash[:]), "parsed.Verify()")
+	assert.Equal(t, tsa.ErrImprintMismatch, parsed.Verify(testutil.RandomHash()[:]))
+
+	assert.NoError(t, parsed.VerifyChain(authority.Roots), "parsed.VerifyChain()")
+	assert.Error(t, parsed.VerifyChain(x509.NewCertPool()), "parsed.VerifyChain()")
+}
+
+func TestTimestampHash_rejected(t *testing.T) {
+	c, authority, close := newClient(t)
+	defer close()
+
+	authority.Status = tsatesting.StatusRejection
+	_, err := c.TimestampHash(testutil.RandomHash())
+	assert.Error(t, err)
+}
+
+func TestVerify_tampered(t *testing.T) {
+	authority, err := tsatesting.New()
+	if err != nil {
+		t.Fatalf("tsatesting.New(): err: %s", err)
+	}
+
+	hash := testutil.RandomHash()
+	token, err := authority.Sign(hash[:], nil)
+	if err != nil {
+		t.Fatalf("authority.Sign(): err: %s", err)
+	}
+
+	// Flip the last byte of the signature.
+	token[len(token)-1] ^= 0xff
+
+	parsed, err := tsa.ParseToken(token)
+	if err != nil {
+		t.Fatalf("tsa.ParseToken(): err: %s", err)
+	}
+	assert.Error(t, parsed.Verify(hash[:]))
+}
+
+func TestParseToken_invalid(t *testing.T) {
+	_, err := tsa.ParseToken([]byte("invalid"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,344 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tsatesting defines an in-process RFC 3161 timestamp authority to
+// test time-stamping.
+package tsatesting
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stratumn/sdk/tsa"
+)
+
+// Status values that can be returned by the authority.
+const (
+	StatusGranted   = tsa.StatusGranted
+	StatusRejection = tsa.StatusRejection
+)
+
+// Authority is a timestamp authority backed by an in-process CA.
+// It implements net/http.Handler.
+type Authority struct {
+	// CA is the certificate of the root authority.
+	CA *x509.Certificate
+
+	// Certificate is the certificate used to sign time-stamp tokens.
+	Certificate *x509.Certificate
+
+	// Roots contains the root certificate of the authority.
+	Roots *x509.CertPool
+
+	// Status is the status returned in responses.
+	Status int
+
+	// Policy is the policy set in time-stamp tokens.
+	Policy asn1.ObjectIdentifier
+
+	key    *ecdsa.PrivateKey
+	mu     sync.Mutex
+	serial int64
+}
+
+// New creates a new Authority with a freshly generated CA.
+func New() (*Authority, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	return &Authority{
+		CA:          ca,
+		Certificate: cert,
+		Roots:       roots,
+		Status:      StatusGranted,
+		Policy:      asn1.ObjectIdentifier{1, 2, 3, 4},
+		key:         key,
+	}, nil
+}
+
+// ServeHTTP implements net/http.Handler.ServeHTTP.
+func (a *Authority) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := timeStampResp{Status: pkiStatusInfo{Status: a.Status}}
+	if a.Status == StatusGranted {
+		token, err := a.Sign(req.MessageImprint.HashedMessage, req.Nonce)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.TimeStampToken = asn1.RawValue{FullBytes: token}
+	}
+
+	resBytes, err := asn1.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", tsa.ReplyContentType)
+	w.Write(resBytes)
+}
+
+// Sign creates a DER encoded time-stamp token for a SHA-256 hash.
+func (a *Authority) Sign(hashedMessage []byte, nonce *big.Int) ([]byte, error) {
+	a.mu.Lock()
+	a.serial++
+	serial := a.serial
+	a.mu.Unlock()
+
+	eContent, err := asn1.Marshal(tstInfo{
+		Version: 1,
+		Policy:  a.Policy,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  tsa.OIDSHA256,
+				Parameters: asn1.NullRawValue,
+			},
+			HashedMessage: hashedMessage,
+		},
+		SerialNumber: big.NewInt(serial),
+		GenTime:      time.Now().UTC().Truncate(time.Second),
+		Nonce:        nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(eContent)
+	signedAttrs, err := marshalAttributes(
+		attribute{tsa.OIDContentType, tsa.OIDTSTInfo},
+		attribute{tsa.OIDMessageDigest, digest[:]},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := a.key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	eContentOctets, err := asn1.Marshal(eContent)
+	if err != nil {
+		return nil, err
+	}
+
+	digestAlgorithm := pkix.AlgorithmIdentifier{Algorithm: tsa.OIDSHA256, Parameters: asn1.NullRawValue}
+	sd, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgorithm},
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: tsa.OIDTSTInfo,
+			EContent:     explicit(0, eContentOctets),
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: a.Certificate.Raw},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: a.Certificate.RawIssuer},
+				SerialNumber: a.Certificate.SerialNumber,
+			},
+			DigestAlgorithm: digestAlgorithm,
+			// The signed attributes are implicitly tagged [0] in the
+			// SignerInfo but signed as a SET.
+			SignedAttrs:        asn1.RawValue{FullBytes: append([]byte{0xa0}, signedAttrs[1:]...)},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: tsa.OIDSignedData,
+		Content:     explicit(0, sd),
+	})
+}
+
+func explicit(tag int, der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: der}
+}
+
+// marshalAttributes returns the DER encoding of a SET OF attributes.
+func marshalAttributes(attrs ...attribute) ([]byte, error) {
+	var encoded [][]byte
+	for _, attr := range attrs {
+		value, err := asn1.Marshal(attr.Value)
+		if err != nil {
+			return nil, err
+		}
+		b, err := asn1.Marshal(rawAttribute{
+			Type:   attr.Type,
+			Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, b)
+	}
+
+	// DER requires the elements of a SET OF to be sorted.
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      bytes.Join(encoded, nil),
+	})
+}
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value interface{}
+}
+
+type rawAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status int
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
@@ -0,0 +1,75 @@
+package tsabatchfossilizer
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/batchfossilizer/storages"
+	"github.com/stratumn/sdk/postgresstore"
+	"github.com/stratumn/sdk/tsa"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	interval    time.Duration
+	maxLeaves   int
+	path        string
+	archive     bool
+	exitBatch   bool
+	fsync       bool
+	storageType string
+	storageURL  string
+	storageID   string
+)
+
+// RegisterFlags registers the flags used by RunWithFlags.
+func RegisterFlags() {
+	flag.DurationVar(&interval, "interval", batchfossilizer.DefaultInterval, "batch interval")
+	flag.IntVar(&maxLeaves, "maxleaves", batchfossilizer.DefaultMaxLeaves, "maximum number of leaves in a Merkle tree")
+	flag.StringVar(&path, "path", "", "an optional path to store files")
+	flag.BoolVar(&archive, "archive", batchfossilizer.DefaultArchive, "whether to archive completed batches (requires path)")
+	flag.BoolVar(&exitBatch, "exitbatch", batchfossilizer.DefaultStopBatch, "whether to do a batch on exit")
+	flag.BoolVar(&fsync, "fsync", batchfossilizer.DefaultFSync, "whether to fsync after saving a pending hash (requires path)")
+	flag.StringVar(&storageType, "storage", storages.Dir, "where to store pending hashes and archived batches (dir, leveldb or postgres), dir and leveldb require path")
+	flag.StringVar(&storageURL, "storageurl", postgresstore.DefaultURL, "URL of the PostgreSQL database of the postgres storage")
+	flag.StringVar(&storageID, "storageid", "", "ID of the fossilizer in a postgres storage shared by several fossilizers")
+}
+
+// RunWithFlags should be called after RegisterFlags and flag.Parse to initialize
+// a tsabatchfossilizer using flag values.
+func RunWithFlags(ctx context.Context, version, commit string, hashTS tsa.HashTimestamper) *Fossilizer {
+	log.Infof("%s v%s@%s", Description, version, commit[:7])
+
+	storage, err := storages.New(storageType, path, storageURL, storageID, fsync)
+	if err != nil {
+		log.WithField("error", err).Fatal("Failed to create batch fossilizer storage")
+	}
+
+	a, err := New(&Config{
+		HashTimestamper: hashTS,
+	}, &batchfossilizer.Config{
+		Version:   version,
+		Commit:    commit,
+		Interval:  interval,
+		MaxLeaves: maxLeaves,
+		Storage:   storage,
+		Path:      path,
+		Archive:   archive,
+		StopBatch: exitBatch,
+		FSync:     fsync,
+	})
+	if err != nil {
+		log.WithField("error", err).Fatal("Failed to create trusted timestamping batch fossilizer")
+	}
+
+	go func() {
+		if err := a.Start(ctx); err != nil {
+			log.WithField("error", err)
+		}
+	}()
+
+	return a
+}
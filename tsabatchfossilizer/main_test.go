@@ -0,0 +1,57 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsabatchfossilizer
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stratumn/sdk/types"
+)
+
+const testInterval = 100 * time.Millisecond
+
+var (
+	pathABCDE0 types.Path
+	pathABCDE1 types.Path
+	pathABCDE2 types.Path
+	pathABCDE3 types.Path
+	pathABCDE4 types.Path
+)
+
+func loadPath(filename string, path *types.Path) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+	if err = json.Unmarshal(data, path); err != nil {
+		panic(err)
+	}
+}
+
+func TestMain(m *testing.M) {
+	loadPath("testdata/path-abcde-0.json", &pathABCDE0)
+	loadPath("testdata/path-abcde-1.json", &pathABCDE1)
+	loadPath("testdata/path-abcde-2.json", &pathABCDE2)
+	loadPath("testdata/path-abcde-3.json", &pathABCDE3)
+	loadPath("testdata/path-abcde-4.json", &pathABCDE4)
+
+	flag.Parse()
+	os.Exit(m.Run())
+}
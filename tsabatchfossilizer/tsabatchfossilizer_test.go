@@ -0,0 +1,197 @@
+// Copyright 2017 Stratumn SAS. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tsabatchfossilizer
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stratumn/sdk/batchfossilizer"
+	"github.com/stratumn/sdk/cs"
+	"github.com/stratumn/sdk/cs/evidences"
+	"github.com/stratumn/sdk/testutil"
+	"github.com/stratumn/sdk/tsa"
+	"github.com/stratumn/sdk/tsa/tsatesting"
+	"github.com/stratumn/sdk/types"
+)
+
+func newFossilizer(t *testing.T) (*Fossilizer, *tsatesting.Authority, func()) {
+	authority, err := tsatesting.New()
+	if err != nil {
+		t.Fatalf("tsatesting.New(): err: %s", err)
+	}
+	server := httptest.NewServer(authority)
+
+	ts, err := tsa.New(&tsa.Config{URL: server.URL})
+	if err != nil {
+		t.Fatalf("tsa.New(): err: %s", err)
+	}
+
+	a, err := New(&Config{
+		HashTimestamper: ts,
+	}, &batchfossilizer.Config{
+		Interval: testInterval,
+	})
+	if err != nil {
+		t.Fatalf("New(): err: %s", err)
+	}
+
+	return a, authority, server.Close
+}
+
+func TestNew_maxSimBatches(t *testing.T) {
+	ts, err := tsa.New(&tsa.Config{URL: "http://localhost"})
+	if err != nil {
+		t.Fatalf("tsa.New(): err: %s", err)
+	}
+	if _, err := New(&Config{HashTimestamper: ts}, &batchfossilizer.Config{MaxSimBatches: 2}); err == nil {
+		t.Error("New(): err = nil want Error")
+	}
+}
+
+func TestGetInfo(t *testing.T) {
+	a, _, close := newFossilizer(t)
+	defer close()
+
+	got, err := a.GetInfo()
+	if err != nil {
+		t.Fatalf("a.GetInfo(): err: %s", err)
+	}
+	info, ok := got.(*Info)
+	if !ok {
+		t.Fatalf("a.GetInfo(): info = %#v want *Info", got)
+	}
+	if got, want := info.Description, "Indigo's Trusted Timestamping Batch Fossilizer with RFC 3161 Timestamper"; got != want {
+		t.Errorf("a.GetInfo(): Description = %s want %s", got, want)
+	}
+	if info.TSA == "" {
+		t.Error("a.GetInfo(): TSA is empty")
+	}
+}
+
+func TestFossilize(t *testing.T) {
+	a, _, close := newFossilizer(t)
+	defer close()
+
+	tests := []fossilizeTest{
+		{atos(sha256.Sum256([]byte("a"))), []byte("test a"), pathABCDE0, 0, false},
+		{atos(sha256.Sum256([]byte("b"))), []byte("test b"), pathABCDE1, 0, false},
+		{atos(sha256.Sum256([]byte("c"))), []byte("test c"), pathABCDE2, 0, false},
+		{atos(sha256.Sum256([]byte("d"))), []byte("test d"), pathABCDE3, 0, false},
+		{atos(sha256.Sum256([]byte("e"))), []byte("test e"), pathABCDE4, 0, false},
+	}
+	testFossilizeMultiple(t, a, tests)
+}
+
+func TestTSABatchProof(t *testing.T) {
+	a, authority, close := newFossilizer(t)
+	defer close()
+
+	tests := []fossilizeTest{
+		{atos(sha256.Sum256([]byte("a"))), []byte("test a"), pathABCDE0, 0, false},
+		{atos(sha256.Sum256([]byte("b"))), []byte("test b"), pathABCDE1, 0, false},
+		{atos(sha256.Sum256([]byte("c"))), []byte("test c"), pathABCDE2, 0, false},
+		{atos(sha256.Sum256([]byte("d"))), []byte("test d"), pathABCDE3, 0, false},
+		{atos(sha256.Sum256([]byte("e"))), []byte("test e"), pathABCDE4, 0, false},
+	}
+	start := uint64(time.Now().Add(-time.Second).Unix())
+	results := testFossilizeMultiple(t, a, tests)
+
+	t.Run("TestTime()", func(t *testing.T) {
+		for _, r := range results {
+			e := r.Evidence.Proof.(*evidences.TSABatchProof)
+			if got := e.Time(); got < start || got > uint64(time.Now().Unix()) {
+				t.Errorf("wrong timestamp %d in TSABatchProof", got)
+			}
+		}
+	})
+
+	t.Run("TestFullProof()", func(t *testing.T) {
+		for _, r := range results {
+			e := r.Evidence.Proof.(*evidences.TSABatchProof)
+			p := e.FullProof()
+			if p == nil {
+				t.Errorf("got evidence.FullProof() == nil")
+			}
+			if err := json.Unmarshal(p, &evidences.TSABatchProof{}); err != nil {
+				t.Errorf("Could not unmarshal bytes proof, err = %+v", err)
+			}
+		}
+	})
+
+	t.Run("TestVerify()", func(t *testing.T) {
+		evidences.RegisterTSARoots(authority.Roots)
+		defer evidences.RegisterTSARoots(nil)
+
+		for _, r := range results {
+			e := r.Evidence.Proof.(*evidences.TSABatchProof)
+			var lh types.Bytes32
+			copy(lh[:], r.Data)
+			if !e.Verify(&lh) {
+				t.Errorf("got evidence.Verify() == false")
+			}
+			if e.Verify(testutil.RandomHash()) {
+				t.Errorf("got evidence.Verify() == true for a random hash")
+			}
+		}
+	})
+
+	t.Run("TestVerify() without trusted roots", func(t *testing.T) {
+		for _, roots := range []*x509.CertPool{nil, x509.NewCertPool()} {
+			evidences.RegisterTSARoots(roots)
+			for _, r := range results {
+				e := r.Evidence.Proof.(*evidences.TSABatchProof)
+				var lh types.Bytes32
+				copy(lh[:], r.Data)
+				if e.Verify(&lh) {
+					t.Errorf("got evidence.Verify() == true for an untrusted authority")
+				}
+			}
+		}
+		evidences.RegisterTSARoots(nil)
+	})
+
+	t.Run("TestVerifyChain()", func(t *testing.T) {
+		for _, r := range results {
+			e := r.Evidence.Proof.(*evidences.TSABatchProof)
+			if err := e.VerifyChain(authority.Roots); err != nil {
+				t.Errorf("evidence.VerifyChain(): err: %s", err)
+			}
+			if err := e.VerifyChain(x509.NewCertPool()); err == nil {
+				t.Errorf("evidence.VerifyChain(): err = nil want Error")
+			}
+		}
+	})
+
+	t.Run("TestSerialize()", func(t *testing.T) {
+		for _, r := range results {
+			js, err := json.Marshal(&r.Evidence)
+			if err != nil {
+				t.Fatalf("json.Marshal(): err: %s", err)
+			}
+			var e cs.Evidence
+			if err := json.Unmarshal(js, &e); err != nil {
+				t.Fatalf("json.Unmarshal(): err: %s", err)
+			}
+			if _, ok := e.Proof.(*evidences.TSABatchProof); !ok {
+				t.Errorf("e.Proof = %#v want *evidences.TSABatchProof", e.Proof)
+			}
+		}
+	})
+}
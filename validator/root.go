@@ -55,6 +55,19 @@ func NewRootValidator(filename string, validByDefault bool) Validator {
 	return &v
 }
 
+// NewRootValidatorFromJSON creates a validator from the content of a JSON
+// schema rules file. Unlike NewRootValidator, it fails if the rules are
+// invalid.
+func NewRootValidatorFromJSON(data []byte, validByDefault bool) (Validator, error) {
+	v := rootValidator{ValidByDefault: validByDefault}
+	if err := v.loadFromJSON(data); err != nil {
+		return nil, err
+	}
+	v.updateHash(data)
+
+	return &v, nil
+}
+
 func (rv rootValidator) Validate(store store.SegmentReader, link *cs.Link) error {
 	validByDefault := rv.ValidByDefault
 	processValidators, exists := rv.ValidatorsByProcess[link.GetProcess()]
@@ -14,6 +14,7 @@
 package validator
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -260,6 +261,23 @@ func TestNewRootValidator(t *testing.T) {
 	}
 }
 
+func TestNewRootValidatorFromJSON(t *testing.T) {
+	v, err := NewRootValidatorFromJSON([]byte(defaultJSON), true)
+	if err != nil {
+		t.Fatalf("NewRootValidatorFromJSON(): err: %s", err)
+	}
+	if len(v.(*rootValidator).ValidatorsByProcess) != 2 {
+		t.Errorf("fail to load root validator")
+	}
+	if want := sha256.Sum256([]byte(defaultJSON)); *v.Hash() != want {
+		t.Errorf("v.Hash() = %x want %x", *v.Hash(), want)
+	}
+
+	if _, err := NewRootValidatorFromJSON([]byte(`{"testProcess": [{"type": "init"}]}`), true); err == nil {
+		t.Errorf("NewRootValidatorFromJSON(): err = nil want Error")
+	}
+}
+
 func TestRootValidator(t *testing.T) {
 	link := makeLink("init")
 